@@ -2,29 +2,73 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/uragirii/got/internals"
-	"github.com/uragirii/got/internals/git/transport/http"
+	"github.com/uragirii/got/internals/git/remote"
 )
 
 var CLONE *internals.Command = &internals.Command{
-	Name:  "clone",
-	Desc:  "Clones the repository into a folder",
-	Flags: []*internals.Flag{},
-	Run:   Clone,
+	Name: "clone",
+	Desc: "Clones the repository into a folder",
+	Flags: append([]*internals.Flag{
+		{
+			Name:  "local",
+			Short: "l",
+			Help:  "link the objects when cloning from a local path, this is the default",
+			Key:   "local",
+			Type:  internals.Bool,
+		},
+		{
+			Name: "no-local",
+			Help: "use the git protocol even when cloning from a local path",
+			Key:  "no-local",
+			Type: internals.Bool,
+		},
+	}, append(shallowFlags(), progressFlags()...)...),
+	Run: Clone,
+}
+
+// Same as git, https://host/org/repo.git and host:repo.git are cloned into repo
+func dirFromURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	url = strings.TrimSuffix(url, ".git")
+
+	return url[strings.LastIndexAny(url, "/:")+1:]
 }
 
 func Clone(c *internals.Command, _ string) {
 	if len(c.Args) == 0 {
-		panic("expected more arguments")
+		fmt.Println("fatal: You must specify a repository to clone.")
+		os.Exit(1)
 	}
 
-	cap, err := http.CapabilityAdvertisement(c.Args[0])
+	url := c.Args[0]
 
-	if err != nil {
-		panic(err)
+	dir := dirFromURL(url)
+
+	if len(c.Args) > 1 {
+		dir = c.Args[1]
 	}
 
-	fmt.Println(cap)
+	if !isQuiet(c) {
+		fmt.Fprintf(os.Stderr, "Cloning into '%s'...\n", dir)
+	}
+
+	since, exclude := shallowOptions(c)
+
+	err := remote.Clone(url, dir, remote.CloneOptions{
+		Progress:       progressOutput(c),
+		NoLocal:        c.GetFlag("no-local") == "true",
+		Depth:          depthFlag(c, "depth"),
+		ShallowSince:   since,
+		ShallowExclude: exclude,
+		Filter:         c.GetFlag("filter"),
+	})
 
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
 }
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+var COMMIT_GRAPH *internals.Command = &internals.Command{
+	Name: "commit-graph",
+	Desc: "Write and verify Git commit-graph files",
+	Flags: append([]*internals.Flag{
+		{
+			Name: "reachable",
+			Help: "write the commits reachable from the refs instead of the packed ones",
+			Key:  "reachable",
+			Type: internals.Bool,
+		},
+		{
+			Name: "stdin-commits",
+			Help: "write the commits read from stdin and their ancestors",
+			Key:  "stdin-commits",
+			Type: internals.Bool,
+		},
+		{
+			Name: "split",
+			Help: "write a layer of the split chain, =no-merge or =replace to change merging",
+			Key:  "split",
+			Type: internals.OptionalString,
+		},
+		{
+			Name: "shallow",
+			Help: "verify only the top layer of the split chain",
+			Key:  "shallow",
+			Type: internals.Bool,
+		},
+	}, progressFlags()...),
+	Run: CommitGraph,
+}
+
+const _CommitGraphUsage = "usage: got commit-graph write [--reachable | --stdin-commits] [--split[=<strategy>]]\n" +
+	"   or: got commit-graph verify [--shallow]"
+
+func readStdinCommits() ([]*sha.SHA, error) {
+	var commits []*sha.SHA
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		commitSha, err := sha.FromString(line)
+
+		if err != nil || len(line) != 2*sha.BYTES_LEN {
+			return nil, fmt.Errorf("unexpected non-hex object ID: %s", line)
+		}
+
+		commits = append(commits, commitSha)
+	}
+
+	return commits, scanner.Err()
+}
+
+func writeCommitGraph(c *internals.Command, gitDir string) error {
+	var split commitgraph.SplitStrategy
+
+	switch value := c.GetFlag("split"); {
+	case !c.HasFlag("split"):
+		split = commitgraph.NoSplit
+	case value == "":
+		split = commitgraph.Split
+	case value == "no-merge":
+		split = commitgraph.SplitNoMerge
+	case value == "replace":
+		split = commitgraph.SplitReplace
+	default:
+		fmt.Fprintf(os.Stderr, "error: unrecognized --split argument, %s\n", value)
+		os.Exit(129)
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	var commits []*sha.SHA
+	var err error
+
+	switch {
+	case c.GetFlag("reachable") == "true":
+		commits, err = reachable.Commits(gitFs)
+	case c.GetFlag("stdin-commits") == "true":
+		commits, err = readStdinCommits()
+	default:
+		commits, err = commitgraph.PackedCommits(gitFs, progressOutput(c))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return commitgraph.Write(gitDir, commits, commitgraph.WriteOptions{
+		Split:    split,
+		Progress: progressOutput(c),
+	})
+}
+
+func CommitGraph(c *internals.Command, _ string) {
+	if len(c.Args) != 1 || c.Args[0] != "write" && c.Args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, _CommitGraphUsage)
+		os.Exit(129)
+	}
+
+	if c.GetFlag("reachable") == "true" && c.GetFlag("stdin-commits") == "true" {
+		fmt.Fprintln(os.Stderr, "fatal: options '--reachable' and '--stdin-commits' cannot be used together")
+		os.Exit(128)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	if c.Args[0] == "write" {
+		if err = writeCommitGraph(c, gitDir); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(128)
+		}
+
+		return
+	}
+
+	problems, err := commitgraph.Verify(os.DirFS(gitDir), commitgraph.VerifyOptions{
+		Shallow:  c.GetFlag("shallow") == "true",
+		Progress: progressOutput(c),
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "error: %s\n", problem)
+	}
+
+	if len(problems) != 0 {
+		os.Exit(1)
+	}
+}
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
+	"strings"
 
 	"github.com/uragirii/got/internals"
 	"github.com/uragirii/got/internals/git/commit"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/editor"
 	"github.com/uragirii/got/internals/git/head"
+	"github.com/uragirii/got/internals/git/hooks"
 	"github.com/uragirii/got/internals/git/index"
 )
 
@@ -22,18 +27,149 @@ var COMMIT *internals.Command = &internals.Command{
 			Key:   "message",
 			Type:  internals.String,
 		},
+		{
+			Name:  "author",
+			Short: "",
+			Help:  "override the commit author, in \"Name <email>\" format",
+			Key:   "author",
+			Type:  internals.String,
+		},
+		{
+			Name:  "date",
+			Short: "",
+			Help:  "override the author date used in the commit",
+			Key:   "date",
+			Type:  internals.String,
+		},
+		{
+			Name:  "all",
+			Short: "a",
+			Help:  "commit all changed files",
+			Key:   "all",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "amend",
+			Short: "",
+			Help:  "amend previous commit",
+			Key:   "amend",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "no-edit",
+			Short: "",
+			Help:  "use the selected commit message without launching an editor",
+			Key:   "no-edit",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "no-verify",
+			Short: "n",
+			Help:  "bypass pre-commit and commit-msg hooks",
+			Key:   "no-verify",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "allow-empty",
+			Short: "",
+			Help:  "allow recording an empty commit",
+			Key:   "allow-empty",
+			Type:  internals.Bool,
+		},
 	},
 	Run: Commit,
 }
 
-func Commit(cmd *internals.Command, gitPath string) {
+const _CommitEditMsgFile = "COMMIT_EDITMSG"
+
+const _CommitEditMsgHelp = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+#
+`
+
+type commitMsgOpts struct {
+	initialMessage string
+	// message source passed to prepare-commit-msg hook
+	source    string
+	sourceSHA string
+	useEditor bool
+	noVerify  bool
+}
+
+// Writes the message to COMMIT_EDITMSG, runs the message hooks and
+// the editor on it like git, and returns the cleaned up message
+func prepareMessage(gitDir string, c *config.Config, runner *hooks.Runner, h *head.Head, opts commitMsgOpts) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString(opts.initialMessage)
+
+	if opts.useEditor {
+		sb.WriteString(_CommitEditMsgHelp)
+
+		if h.Mode == head.Detached {
+			sb.WriteString("# HEAD detached\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("# On branch %s\n", h.Branch))
+		}
+	}
 
-	if cmd.GetFlag("message") == "" {
-		fmt.Println("Aborting commit due to empty commit message")
-		return
+	editMsgPath := path.Join(gitDir, _CommitEditMsgFile)
+
+	err := os.WriteFile(editMsgPath, []byte(sb.String()), 0644)
+
+	if err != nil {
+		return "", err
+	}
+
+	hookArgs := []string{editMsgPath}
+
+	if opts.source != "" {
+		hookArgs = append(hookArgs, opts.source)
+	}
+
+	if opts.sourceSHA != "" {
+		hookArgs = append(hookArgs, opts.sourceSHA)
+	}
+
+	if err = runner.Run(hooks.PrepareCommitMsg, nil, hookArgs...); err != nil {
+		return "", err
+	}
+
+	if opts.useEditor {
+		if err = editor.Launch(c, editMsgPath); err != nil {
+			return "", fmt.Errorf("there was a problem with the editor '%s': %w", editor.GetEditor(c), err)
+		}
+	}
+
+	if !opts.noVerify {
+		if err = runner.Run(hooks.CommitMsg, nil, editMsgPath); err != nil {
+			return "", err
+		}
+	}
+
+	contents, err := os.ReadFile(editMsgPath)
+
+	if err != nil {
+		return "", err
+	}
+
+	return commit.CleanupMessage(string(contents), opts.useEditor), nil
+}
+
+func loadIndex(gitDir string) (*index.Index, error) {
+	indexFile, err := os.Open(path.Join(gitDir, index.IndexFileName))
+
+	if err != nil {
+		return nil, err
 	}
 
-	message := cmd.GetFlag("message")
+	defer indexFile.Close()
+
+	return index.New(indexFile)
+}
+
+func Commit(cmd *internals.Command, gitPath string) {
 
 	gitDir, err := internals.GetGitDir()
 
@@ -41,13 +177,44 @@ func Commit(cmd *internals.Command, gitPath string) {
 		panic(err)
 	}
 
-	indexFile, err := os.Open(path.Join(gitDir, "index"))
+	gitFs := os.DirFS(gitDir)
+
+	cfg, err := config.Load(gitFs)
 
 	if err != nil {
 		panic(err)
 	}
 
-	i, err := index.New(indexFile)
+	runner := hooks.New(gitDir, gitPath, cfg)
+	runner.Env = []string{fmt.Sprintf("GIT_INDEX_FILE=%s", path.Join(gitDir, index.IndexFileName))}
+
+	noVerify := cmd.GetFlag("no-verify") == "true"
+
+	if cmd.GetFlag("all") == "true" {
+		i, err := loadIndex(gitDir)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if _, err = i.Update(os.DirFS(gitPath)); err != nil {
+			panic(err)
+		}
+
+		if err = i.WriteToFile(); err != nil {
+			panic(err)
+		}
+	}
+
+	if !noVerify {
+		if err = runner.Run(hooks.PreCommit, nil); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	// pre-commit hook could have updated the index
+	i, err := loadIndex(gitDir)
 
 	if err != nil {
 		panic(err)
@@ -65,9 +232,24 @@ func Commit(cmd *internals.Command, gitPath string) {
 		panic(err)
 	}
 
-	gitFs := os.DirFS(gitDir)
+	isAmend := cmd.GetFlag("amend") == "true"
 
-	c, err := commit.New(gitFs, message)
+	c, err := commit.New(gitFs, cmd.GetFlag("message"), commit.Options{
+		Author:     cmd.GetFlag("author"),
+		AuthorDate: cmd.GetFlag("date"),
+		Amend:      isAmend,
+		AllowEmpty: cmd.GetFlag("allow-empty") == "true",
+	})
+
+	if errors.Is(err, commit.ErrNothingToCommit) {
+		if isAmend {
+			fmt.Println("You asked to amend the most recent commit, but doing so would make")
+			fmt.Println("it empty. You can repeat your command with --allow-empty.")
+		} else {
+			fmt.Println("nothing to commit, working tree clean")
+		}
+		os.Exit(1)
+	}
 
 	if err != nil {
 		panic(err)
@@ -79,19 +261,80 @@ func Commit(cmd *internals.Command, gitPath string) {
 		panic(err)
 	}
 
-	h.SetTo(c.GetSHA(), h.Mode)
+	msgOpts := commitMsgOpts{
+		initialMessage: cmd.GetFlag("message"),
+		noVerify:       noVerify,
+	}
 
-	err = h.WriteToFile()
+	if msgOpts.initialMessage != "" {
+		msgOpts.source = "message"
+	} else if isAmend {
+		amendedCommit, err := commit.FromSHA(h.SHA, gitFs)
+
+		if err != nil {
+			panic(err)
+		}
+
+		msgOpts.initialMessage = amendedCommit.GetMessage()
+		msgOpts.source = "commit"
+		msgOpts.sourceSHA = h.SHA.String()
+		msgOpts.useEditor = cmd.GetFlag("no-edit") != "true"
+	} else {
+		msgOpts.useEditor = cmd.GetFlag("no-edit") != "true"
+	}
+
+	message, err := prepareMessage(gitDir, cfg, runner, h, msgOpts)
+
+	if errors.Is(err, hooks.ErrHookFailed) {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	if err != nil {
 		panic(err)
 	}
 
+	if strings.TrimSpace(message) == "" {
+		fmt.Println("Aborting commit due to empty commit message.")
+		os.Exit(1)
+	}
+
+	if err = c.SetMessage(message); err != nil {
+		panic(err)
+	}
+
 	err = c.WriteToFile()
 
 	if err != nil {
 		panic(err)
 	}
 
-	fmt.Printf("[%s %s] %s\n", h.Branch, c.GetSHA().String()[:7], message)
+	isRootCommit := len(c.GetParents()) == 0
+
+	h.SetTo(c.GetSHA(), h.Mode)
+
+	err = h.WriteToFile()
+
+	if err != nil {
+		panic(err)
+	}
+
+	branch := h.Branch
+
+	if h.Mode == head.Detached {
+		branch = "detached HEAD"
+	}
+
+	if isRootCommit {
+		branch += " (root-commit)"
+	}
+
+	subject, _, _ := strings.Cut(message, "\n")
+
+	fmt.Printf("[%s %s] %s\n", branch, c.GetSHA().String()[:7], subject)
+
+	// post-commit can't affect the outcome of the commit
+	runner.Run(hooks.PostCommit, nil)
+
+	autoGC(gitDir, false, progressOutput(cmd))
 }
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/gc"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var COUNT_OBJECTS *internals.Command = &internals.Command{
+	Name: "count-objects",
+	Desc: "Count unpacked number of objects and their disk consumption",
+	Flags: []*internals.Flag{
+		{
+			Name:  "verbose",
+			Short: "v",
+			Help:  "report the packs, prunable objects and garbage too",
+			Key:   "verbose",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "human-readable",
+			Short: "H",
+			Help:  "print the sizes in human readable format",
+			Key:   "human-readable",
+			Type:  internals.Bool,
+		},
+	},
+	Run: CountObjects,
+}
+
+func CountObjects(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got count-objects [-v] [-H]")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	counts, err := gc.CountObjects(gitDir)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	// sizes are in KiB unless human readable like git
+	formatSize := func(size int64) string {
+		if c.GetFlag("human-readable") == "true" {
+			return progress.HumanSize(uint64(size))
+		}
+
+		return fmt.Sprintf("%d", size/1024)
+	}
+
+	if c.GetFlag("verbose") != "true" {
+		if c.GetFlag("human-readable") == "true" {
+			fmt.Printf("%d objects, %s\n", counts.Count, formatSize(counts.Size))
+		} else {
+			fmt.Printf("%d objects, %s kilobytes\n", counts.Count, formatSize(counts.Size))
+		}
+
+		return
+	}
+
+	for _, garbagePath := range counts.Garbage {
+		fmt.Fprintf(os.Stderr, "warning: garbage found: %s\n", garbagePath)
+	}
+
+	fmt.Printf("count: %d\n", counts.Count)
+	fmt.Printf("size: %s\n", formatSize(counts.Size))
+	fmt.Printf("in-pack: %d\n", counts.InPack)
+	fmt.Printf("packs: %d\n", counts.Packs)
+	fmt.Printf("size-pack: %s\n", formatSize(counts.SizePack))
+	fmt.Printf("prune-packable: %d\n", counts.PrunePackable)
+	fmt.Printf("garbage: %d\n", len(counts.Garbage))
+	fmt.Printf("size-garbage: %s\n", formatSize(counts.SizeGarbage))
+}
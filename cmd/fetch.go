@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/commit"
+	"github.com/uragirii/got/internals/git/remote"
+)
+
+var FETCH *internals.Command = &internals.Command{
+	Name: "fetch",
+	Desc: "Download objects and refs from another repository",
+	Flags: append([]*internals.Flag{
+		{
+			Name:  "prune",
+			Short: "p",
+			Help:  "remove remote-tracking references that no longer exist on the remote",
+			Key:   "prune",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "force",
+			Short: "f",
+			Help:  "update the local refs even if they are not fast-forward",
+			Key:   "force",
+			Type:  internals.Bool,
+		},
+		{
+			Name: "deepen",
+			Help: "deepen the history of a shallow repository by the number of commits",
+			Key:  "deepen",
+			Type: internals.String,
+		},
+		{
+			Name: "unshallow",
+			Help: "fetch the whole history of a shallow repository",
+			Key:  "unshallow",
+			Type: internals.Bool,
+		},
+	}, append(shallowFlags(), progressFlags()...)...),
+	Run: Fetch,
+}
+
+// Flags limiting the history and the objects, shared by clone and fetch
+func shallowFlags() []*internals.Flag {
+	return []*internals.Flag{
+		{
+			Name: "depth",
+			Help: "limit the history to the number of commits",
+			Key:  "depth",
+			Type: internals.String,
+		},
+		{
+			Name: "shallow-since",
+			Help: "limit the history to the commits after the date",
+			Key:  "shallow-since",
+			Type: internals.String,
+		},
+		{
+			Name: "shallow-exclude",
+			Help: "limit the history to the commits not reachable from the remote branch or tag",
+			Key:  "shallow-exclude",
+			Type: internals.String,
+		},
+		{
+			Name: "filter",
+			Help: "omit the objects matching the filter like blob:none, they are fetched when needed",
+			Key:  "filter",
+			Type: internals.String,
+		},
+	}
+}
+
+// Parses the depth flag, exits like git if it's not a positive number
+func depthFlag(c *internals.Command, key string) int {
+	value := c.GetFlag(key)
+
+	if value == "" {
+		return 0
+	}
+
+	depth, err := strconv.Atoi(value)
+
+	if err != nil || depth <= 0 {
+		fmt.Fprintf(os.Stderr, "fatal: depth %s is not a positive number\n", value)
+		os.Exit(128)
+	}
+
+	return depth
+}
+
+// Parses the shallow-since and shallow-exclude flags
+func shallowOptions(c *internals.Command) (time.Time, []string) {
+	var since time.Time
+	var exclude []string
+
+	if value := c.GetFlag("shallow-since"); value != "" {
+		date, err := commit.ParseDate(value)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(128)
+		}
+
+		since = date
+	}
+
+	if value := c.GetFlag("shallow-exclude"); value != "" {
+		exclude = []string{value}
+	}
+
+	return since, exclude
+}
+
+func Fetch(c *internals.Command, _ string) {
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	var remoteName string
+	var refspecs []string
+
+	if len(c.Args) > 0 {
+		remoteName = c.Args[0]
+		refspecs = c.Args[1:]
+	} else {
+		remoteName, err = remote.DefaultRemote(os.DirFS(gitDir))
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	since, exclude := shallowOptions(c)
+
+	result, err := remote.Fetch(gitDir, remoteName, refspecs, remote.FetchOptions{
+		Prune:          c.GetFlag("prune") == "true",
+		Force:          c.GetFlag("force") == "true",
+		Progress:       progressOutput(c),
+		Depth:          depthFlag(c, "depth"),
+		Deepen:         depthFlag(c, "deepen"),
+		ShallowSince:   since,
+		ShallowExclude: exclude,
+		Unshallow:      c.GetFlag("unshallow") == "true",
+		Filter:         c.GetFlag("filter"),
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	if !isQuiet(c) || result.HasRejected() {
+		result.WriteSummary(os.Stderr)
+	}
+
+	if result.HasRejected() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/fsck"
+)
+
+var FSCK *internals.Command = &internals.Command{
+	Name: "fsck",
+	Desc: "Verifies the connectivity and validity of the objects in the database",
+	Flags: append([]*internals.Flag{
+		{
+			Name: "no-dangling",
+			Help: "don't report the dangling objects",
+			Key:  "no-dangling",
+			Type: internals.Bool,
+		},
+	}, progressFlags()...),
+	Run: Fsck,
+}
+
+func Fsck(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got fsck [--no-dangling] [-q | --progress]")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	report, err := fsck.Run(gitDir, fsck.Options{
+		Progress:   progressOutput(c),
+		NoDangling: c.GetFlag("no-dangling") == "true",
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	for _, finding := range report.Findings {
+		if finding.IsError() {
+			fmt.Fprintln(os.Stderr, finding)
+		} else {
+			fmt.Println(finding)
+		}
+	}
+
+	os.Exit(report.ExitCode())
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/gc"
+)
+
+var GC *internals.Command = &internals.Command{
+	Name: "gc",
+	Desc: "Cleanup unnecessary files and optimize the local repository",
+	Flags: append([]*internals.Flag{
+		{
+			Name: "auto",
+			Help: "run only if there are too many loose objects or packs",
+			Key:  "auto",
+			Type: internals.Bool,
+		},
+		{
+			Name: "prune",
+			Help: "prune the unreachable loose objects older than the date, default 2.weeks.ago",
+			Key:  "prune",
+			Type: internals.OptionalString,
+		},
+		{
+			Name: "no-prune",
+			Help: "don't prune any unreachable loose objects",
+			Key:  "no-prune",
+			Type: internals.Bool,
+		},
+	}, progressFlags()...),
+	Run: GarbageCollect,
+}
+
+// Runs gc if the repository is over the gc --auto thresholds, the
+// errors are only warnings as the command running it already succeeded
+func autoGC(gitDir string, quiet bool, progressOut io.Writer) {
+	needsAuto, err := gc.NeedsAuto(gitDir)
+
+	if err == nil && needsAuto {
+		if !quiet {
+			fmt.Fprintln(os.Stderr, "Auto packing the repository for optimum performance.")
+		}
+
+		err = gc.Run(gitDir, gc.Options{Progress: progressOut})
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: gc --auto failed: %v\n", err)
+	}
+}
+
+func GarbageCollect(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got gc [--auto] [--prune=<date>] [--no-prune] [-q]")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	if c.GetFlag("auto") == "true" {
+		autoGC(gitDir, isQuiet(c), progressOutput(c))
+		return
+	}
+
+	opts := gc.Options{
+		PruneExpire: c.GetFlag("prune"),
+		NoPrune:     c.GetFlag("no-prune") == "true",
+		Progress:    progressOutput(c),
+	}
+
+	if err = gc.Run(gitDir, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pack"
+)
+
+var INDEX_PACK *internals.Command = &internals.Command{
+	Name: "index-pack",
+	Desc: "Build pack index file for an existing packed archive",
+	Flags: []*internals.Flag{
+		{
+			Name: "stdin",
+			Help: "read the pack from stdin, it's stored in the repository unless the pack path is given",
+			Key:  "stdin",
+			Type: internals.Bool,
+		},
+		{
+			Name: "fix-thin",
+			Help: "append the delta bases missing from the pack from the repository, needs --stdin",
+			Key:  "fix-thin",
+			Type: internals.Bool,
+		},
+		{
+			Name: "rev-index",
+			Help: "write the .rev reverse index along with the idx",
+			Key:  "rev-index",
+			Type: internals.Bool,
+		},
+		{
+			Name:  "output",
+			Short: "o",
+			Help:  "write the idx to the file instead of next to the pack",
+			Key:   "output",
+			Type:  internals.String,
+		},
+		{
+			Name:  "verbose",
+			Short: "v",
+			Help:  "report the progress",
+			Key:   "verbose",
+			Type:  internals.Bool,
+		},
+	},
+	Run: IndexPack,
+}
+
+func indexPackFatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "fatal: "+format+"\n", args...)
+	os.Exit(128)
+}
+
+// Spools the pack from stdin to a temp file in dir, the thin pack is
+// completed from the repository. Returns the path of the temp file
+func readStdinPack(c *internals.Command, gitDir, dir string, progress io.Writer) string {
+	file, err := os.CreateTemp(dir, "tmp_pack_")
+
+	if err != nil {
+		indexPackFatal("%v", err)
+	}
+
+	defer file.Close()
+
+	receiver := pack.NewReceiverTo(file, progress)
+
+	_, err = io.Copy(receiver, os.Stdin)
+
+	if _, packErr := receiver.Close(); err == nil {
+		err = packErr
+	}
+
+	if err == nil && c.GetFlag("fix-thin") == "true" {
+		err = pack.FixThinFile(os.DirFS(gitDir), file)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		indexPackFatal("%v", err)
+	}
+
+	return file.Name()
+}
+
+func IndexPack(c *internals.Command, _ string) {
+	isStdin := c.GetFlag("stdin") == "true"
+
+	if len(c.Args) > 1 || (len(c.Args) == 0 && !isStdin) {
+		fmt.Fprintln(os.Stderr, "usage: got index-pack [-v] [-o <index-file>] [--rev-index] <pack-file>")
+		fmt.Fprintln(os.Stderr, "   or: got index-pack --stdin [--fix-thin] [-v] [--rev-index] [<pack-file>]")
+		os.Exit(129)
+	}
+
+	if c.GetFlag("fix-thin") == "true" && !isStdin {
+		indexPackFatal("the option '--fix-thin' requires '--stdin'")
+	}
+
+	opts := pack.IndexOptions{RevIndex: c.GetFlag("rev-index") == "true"}
+
+	if c.GetFlag("verbose") == "true" {
+		opts.Progress = os.Stderr
+	}
+
+	// repository is only needed for storing the pack and fixing thin packs
+	gitDir, gitDirErr := internals.GetGitDir()
+
+	if gitDirErr == nil {
+		if cfg, err := config.Load(os.DirFS(gitDir)); err == nil {
+			opts.RevIndex = opts.RevIndex || cfg.GetBool("pack.writeReverseIndex", false)
+			opts.DeltaBaseCacheLimit = cfg.GetInt("core.deltaBaseCacheLimit", 0)
+		}
+	}
+
+	if isStdin && (len(c.Args) == 0 || c.GetFlag("fix-thin") == "true") && gitDirErr != nil {
+		indexPackFatal("--stdin requires a git repository")
+	}
+
+	if isStdin && len(c.Args) == 0 {
+		packDir := path.Join(gitDir, "objects", "pack")
+
+		if err := os.MkdirAll(packDir, 0755); err != nil {
+			indexPackFatal("%v", err)
+		}
+
+		tmpPath := readStdinPack(c, gitDir, packDir, opts.Progress)
+
+		checksum, err := pack.StoreFile(gitDir, tmpPath, opts)
+
+		// the temp file is left when the same pack is already stored
+		os.Remove(tmpPath)
+
+		if err != nil {
+			indexPackFatal("%v", err)
+		}
+
+		fmt.Printf("pack\t%s\n", checksum)
+		return
+	}
+
+	packPath := c.Args[0]
+	idxPath := c.GetFlag("output")
+
+	if idxPath == "" {
+		if !strings.HasSuffix(packPath, ".pack") {
+			indexPackFatal("packfile name '%s' does not end with '.pack'", packPath)
+		}
+
+		idxPath = strings.TrimSuffix(packPath, ".pack") + ".idx"
+	}
+
+	if isStdin {
+		tmpPath := readStdinPack(c, gitDir, path.Dir(packPath), opts.Progress)
+
+		err := os.Chmod(tmpPath, 0444)
+
+		if err == nil {
+			err = os.Rename(tmpPath, packPath)
+		}
+
+		if err != nil {
+			os.Remove(tmpPath)
+			indexPackFatal("%v", err)
+		}
+	}
+
+	checksum, err := pack.WriteIndexFromFile(idxPath, packPath, opts)
+
+	if err != nil {
+		indexPackFatal("%v", err)
+	}
+
+	if isStdin {
+		fmt.Printf("pack\t%s\n", checksum)
+	} else {
+		fmt.Println(checksum)
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/pack"
+)
+
+var MULTI_PACK_INDEX *internals.Command = &internals.Command{
+	Name: "multi-pack-index",
+	Desc: "Write and verify multi-pack-indexes",
+	Flags: append([]*internals.Flag{
+		{
+			Name: "preferred-pack",
+			Help: "use the copies of this pack for the objects in several packs",
+			Key:  "preferred-pack",
+			Type: internals.String,
+		},
+		{
+			Name: "batch-size",
+			Help: "repack the packs whose used objects add up to less than the size, 0 for all",
+			Key:  "batch-size",
+			Type: internals.String,
+		},
+	}, progressFlags()...),
+	Run: MultiPackIndex,
+}
+
+const _MultiPackIndexUsage = "usage: got multi-pack-index write [--preferred-pack=<pack>]\n" +
+	"   or: got multi-pack-index verify\n" +
+	"   or: got multi-pack-index expire\n" +
+	"   or: got multi-pack-index repack [--batch-size=<size>]"
+
+// Parses the size with an optional k, m or g suffix like git
+func parseMagnitude(value string) (uint64, error) {
+	if value == "" {
+		return 0, strconv.ErrSyntax
+	}
+
+	multiplier := uint64(1)
+
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	size, err := strconv.ParseUint(value, 10, 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return size * multiplier, nil
+}
+
+func verifyMultiPackIndex(c *internals.Command, gitDir string) {
+	problems, err := pack.VerifyMultiPackIndex(os.DirFS(gitDir), progressOutput(c))
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	// git doesn't prefix the problems with error:
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+
+	if len(problems) != 0 {
+		os.Exit(1)
+	}
+}
+
+func MultiPackIndex(c *internals.Command, _ string) {
+	if len(c.Args) != 1 {
+		fmt.Fprintln(os.Stderr, _MultiPackIndexUsage)
+		os.Exit(129)
+	}
+
+	var batchSize uint64
+
+	if c.HasFlag("batch-size") {
+		size, err := parseMagnitude(c.GetFlag("batch-size"))
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: option `batch-size' expects a non-negative integer value with an optional k/m/g suffix")
+			os.Exit(129)
+		}
+
+		batchSize = size
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	switch c.Args[0] {
+	case "write":
+		err = pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{
+			PreferredPack: c.GetFlag("preferred-pack"),
+			Progress:      progressOutput(c),
+		})
+	case "verify":
+		verifyMultiPackIndex(c, gitDir)
+	case "expire":
+		err = pack.ExpireMultiPackIndex(gitDir, progressOutput(c))
+	case "repack":
+		err = pack.RepackMultiPackIndex(gitDir, batchSize, progressOutput(c))
+	default:
+		fmt.Fprintf(os.Stderr, "error: unrecognized subcommand: %s\n%s\n", c.Args[0], _MultiPackIndexUsage)
+		os.Exit(129)
+	}
+
+	if errors.Is(err, pack.ErrNoPacksToIndex) {
+		fmt.Fprintln(os.Stderr, "error: no pack files to index.")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
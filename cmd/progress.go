@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// Flags controlling the progress, shared by clone, fetch, push, gc and repack
+func progressFlags() []*internals.Flag {
+	return []*internals.Flag{
+		{
+			Name:  "quiet",
+			Short: "q",
+			Help:  "don't report the progress, only the errors and warnings",
+			Key:   "quiet",
+			Type:  internals.Bool,
+		},
+		{
+			Name: "progress",
+			Help: "report the progress even if stderr is not a terminal",
+			Key:  "progress",
+			Type: internals.Bool,
+		},
+	}
+}
+
+func isQuiet(c *internals.Command) bool {
+	return c.GetFlag("quiet") == "true"
+}
+
+// Returns stderr for the progress and warnings, same as git the
+// progress is only shown on a terminal unless forced with --progress
+func progressOutput(c *internals.Command) io.Writer {
+	switch {
+	case isQuiet(c):
+		return progress.Quiet(os.Stderr)
+	case c.GetFlag("progress") == "true", progress.IsTerminal(os.Stderr):
+		return os.Stderr
+	}
+
+	return progress.Quiet(os.Stderr)
+}
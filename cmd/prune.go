@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/gc"
+)
+
+var PRUNE *internals.Command = &internals.Command{
+	Name: "prune",
+	Desc: "Prune all unreachable objects from the object database",
+	Flags: []*internals.Flag{
+		{
+			Name:  "dry-run",
+			Short: "n",
+			Help:  "report the objects without removing them",
+			Key:   "dry-run",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "verbose",
+			Short: "v",
+			Help:  "report the removed objects",
+			Key:   "verbose",
+			Type:  internals.Bool,
+		},
+		{
+			Name: "expire",
+			Help: "only prune the objects older than the time, ex: 2.weeks.ago",
+			Key:  "expire",
+			Type: internals.String,
+		},
+	},
+	Run: Prune,
+}
+
+func Prune(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got prune [-n] [-v] [--expire <time>]")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	// everything unreachable is pruned by default like git
+	expire := time.Now()
+
+	if c.HasFlag("expire") {
+		if expire, err = gc.ParseExpiry(c.GetFlag("expire"), expire); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+			os.Exit(129)
+		}
+	}
+
+	isDryRun := c.GetFlag("dry-run") == "true"
+
+	pruned, err := gc.Prune(gitDir, gc.PruneOptions{Expire: expire, DryRun: isDryRun})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	if !isDryRun && c.GetFlag("verbose") != "true" {
+		return
+	}
+
+	for _, obj := range pruned {
+		objType := string(obj.Type)
+
+		if objType == "" {
+			objType = "unknown"
+		}
+
+		fmt.Printf("%s %s\n", obj.SHA, objType)
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/hooks"
+	"github.com/uragirii/got/internals/git/remote"
+)
+
+var PUSH *internals.Command = &internals.Command{
+	Name: "push",
+	Desc: "Update remote refs along with associated objects",
+	Flags: append([]*internals.Flag{
+		{
+			Name:  "force",
+			Short: "f",
+			Help:  "update the remote refs even if they are not fast-forward",
+			Key:   "force",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "force-with-lease",
+			Short: "",
+			Help:  "force update only if the remote refs are at the expected value, <refname>[:<expect>]",
+			Key:   "force-with-lease",
+			Type:  internals.OptionalString,
+		},
+		{
+			Name:  "delete",
+			Short: "d",
+			Help:  "delete the refs from the remote",
+			Key:   "delete",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "no-verify",
+			Short: "",
+			Help:  "bypass the pre-push hook",
+			Key:   "no-verify",
+			Type:  internals.Bool,
+		},
+	}, progressFlags()...),
+	Run: Push,
+}
+
+func Push(c *internals.Command, _ string) {
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	var remoteName string
+	var refspecs []string
+
+	if len(c.Args) > 0 {
+		remoteName = c.Args[0]
+		refspecs = c.Args[1:]
+	} else {
+		remoteName, err = remote.DefaultRemote(os.DirFS(gitDir))
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	opts := remote.PushOptions{
+		Force:    c.GetFlag("force") == "true",
+		Delete:   c.GetFlag("delete") == "true",
+		Progress: progressOutput(c),
+		NoVerify: c.GetFlag("no-verify") == "true",
+	}
+
+	if c.HasFlag("force-with-lease") {
+		opts.ForceWithLease = []string{c.GetFlag("force-with-lease")}
+	}
+
+	result, err := remote.Push(gitDir, remoteName, refspecs, opts)
+
+	if errors.Is(err, remote.ErrNoUpstream) {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n\nTo push the current branch, use\n\n    got push %s <branch>\n\n", err, remoteName)
+		os.Exit(128)
+	}
+
+	// the hook reports why the push was declined
+	if errors.Is(err, hooks.ErrHookFailed) {
+		fmt.Fprintf(os.Stderr, "error: failed to push some refs to '%s'\n", result.URL)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	if !isQuiet(c) || result.HasRejected() {
+		result.WriteSummary(os.Stderr)
+	}
+
+	if result.HasRejected() {
+		fmt.Fprintf(os.Stderr, "error: failed to push some refs to '%s'\n", result.URL)
+		os.Exit(1)
+	}
+}
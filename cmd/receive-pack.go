@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/server"
+)
+
+var RECEIVE_PACK *internals.Command = &internals.Command{
+	Name: "receive-pack",
+	Desc: "Receive what is pushed into the repository",
+	Flags: []*internals.Flag{
+		{
+			Name:  "stateless-rpc",
+			Short: "",
+			Help:  "handle a single push request without advertising the refs, used by the http servers",
+			Key:   "stateless-rpc",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "advertise-refs",
+			Short: "",
+			Help:  "only write the ref advertisement and exit",
+			Key:   "advertise-refs",
+			Type:  internals.Bool,
+		},
+	},
+	Run: ReceivePack,
+}
+
+// Serves the push over stdin and stdout, ssh runs it on the remote
+func ReceivePack(c *internals.Command, _ string) {
+	if len(c.Args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: got receive-pack [--stateless-rpc] [--advertise-refs] <dir>")
+		os.Exit(129)
+	}
+
+	gitDir, err := server.FindGitDir(c.Args[0])
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: '%s' does not appear to be a git repository\n", c.Args[0])
+		os.Exit(128)
+	}
+
+	receivePack := server.NewReceivePack(gitDir)
+
+	switch {
+	case c.GetFlag("advertise-refs") == "true":
+		err = receivePack.WriteAdvertisement(os.Stdout)
+	case c.GetFlag("stateless-rpc") == "true":
+		err = receivePack.Serve(os.Stdin, os.Stdout)
+	default:
+		err = receivePack.ServeStream(os.Stdin, os.Stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/gc"
+)
+
+var REPACK *internals.Command = &internals.Command{
+	Name: "repack",
+	Desc: "Pack unpacked objects in a repository",
+	Flags: append([]*internals.Flag{
+		{
+			Name:  "all",
+			Short: "a",
+			Help:  "pack everything into a single pack",
+			Key:   "all",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "delete",
+			Short: "d",
+			Help:  "remove the redundant packs and loose objects after packing",
+			Key:   "delete",
+			Type:  internals.Bool,
+		},
+	}, progressFlags()...),
+	Run: Repack,
+}
+
+func Repack(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got repack [-a] [-d] [-q]")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	checksum, err := gc.Repack(gitDir, gc.RepackOptions{
+		All:      c.GetFlag("all") == "true",
+		Delete:   c.GetFlag("delete") == "true",
+		Progress: progressOutput(c),
+	})
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+
+	if checksum == nil && !isQuiet(c) {
+		fmt.Println("Nothing new to pack.")
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var UNPACK_OBJECTS *internals.Command = &internals.Command{
+	Name: "unpack-objects",
+	Desc: "Unpack objects from a packed archive",
+	Flags: []*internals.Flag{
+		{
+			Name:  "dry-run",
+			Short: "n",
+			Help:  "check the pack without writing the objects",
+			Key:   "dry-run",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "quiet",
+			Short: "q",
+			Help:  "don't report the progress",
+			Key:   "quiet",
+			Type:  internals.Bool,
+		},
+		{
+			Name: "strict",
+			Help: "don't write the objects with broken contents or links",
+			Key:  "strict",
+			Type: internals.Bool,
+		},
+	},
+	Run: UnpackObjects,
+}
+
+// Reads the pack from stdin and writes its objects as loose objects
+func UnpackObjects(c *internals.Command, _ string) {
+	if len(c.Args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: got unpack-objects [-n] [-q] [--strict] < <pack-file>")
+		os.Exit(129)
+	}
+
+	gitDir, err := internals.GetGitDir()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "fatal: not a git repository (or any of the parent directories): .git")
+		os.Exit(128)
+	}
+
+	opts := pack.UnpackOptions{
+		DryRun: c.GetFlag("dry-run") == "true",
+		Strict: c.GetFlag("strict") == "true",
+	}
+
+	if !isQuiet(c) && progress.IsTerminal(os.Stderr) {
+		opts.Progress = os.Stderr
+	}
+
+	packData, err := io.ReadAll(os.Stdin)
+
+	if err == nil {
+		_, err = pack.Unpack(gitDir, packData, opts)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/server"
+)
+
+var UPLOAD_PACK *internals.Command = &internals.Command{
+	Name: "upload-pack",
+	Desc: "Send objects packed back to git-fetch-pack",
+	Flags: []*internals.Flag{
+		{
+			Name:  "stateless-rpc",
+			Short: "",
+			Help:  "handle a single command request and exit, used by the http servers",
+			Key:   "stateless-rpc",
+			Type:  internals.Bool,
+		},
+		{
+			Name:  "advertise-refs",
+			Short: "",
+			Help:  "only write the capability advertisement and exit",
+			Key:   "advertise-refs",
+			Type:  internals.Bool,
+		},
+	},
+	Run: UploadPack,
+}
+
+// Serves the repository over stdin and stdout, ssh runs it on the remote
+func UploadPack(c *internals.Command, _ string) {
+	if len(c.Args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: got upload-pack [--stateless-rpc] [--advertise-refs] <dir>")
+		os.Exit(129)
+	}
+
+	gitDir, err := server.FindGitDir(c.Args[0])
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: '%s' does not appear to be a git repository\n", c.Args[0])
+		os.Exit(128)
+	}
+
+	if !server.IsProtocolV2(os.Getenv("GIT_PROTOCOL")) {
+		server.WriteError(os.Stdout, "upload-pack", server.ErrProtocolV2Required)
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", server.ErrProtocolV2Required)
+		os.Exit(128)
+	}
+
+	uploadPack := server.NewUploadPack(gitDir)
+
+	switch {
+	case c.GetFlag("advertise-refs") == "true":
+		err = uploadPack.WriteCapabilities(os.Stdout)
+	case c.GetFlag("stateless-rpc") == "true":
+		err = uploadPack.Command(os.Stdin, os.Stdout)
+	default:
+		err = uploadPack.ServeStream(os.Stdin, os.Stdout)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: %v\n", err)
+		os.Exit(128)
+	}
+}
@@ -1,10 +1,17 @@
 package internals
 
+import (
+	"fmt"
+	"strings"
+)
+
 type flagType int
 
 const (
 	Bool flagType = iota
 	String
+	// Value is optional and can only be given as --flag=value
+	OptionalString
 )
 
 type Flag struct {
@@ -30,8 +37,8 @@ func (c *Command) ParseCommand(args []string) {
 
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
-		if arg[0] == '-' {
-			c.parseFlag(args[i:])
+		if len(arg) > 1 && arg[0] == '-' {
+			i += c.parseFlag(args[i:])
 		} else {
 			c.Args = append(c.Args, arg)
 		}
@@ -46,22 +53,49 @@ func getRawFlag(flag string) string {
 	return flag[1:]
 }
 
-func (c *Command) parseFlag(args []string) {
+// Parses the flag at args[0] and returns the number of
+// extra args consumed as the value of the flag
+func (c *Command) parseFlag(args []string) int {
 	flag := getRawFlag(args[0])
 	rest := args[1:]
 
+	// --flag=value form
+	flag, inlineValue, hasInlineValue := strings.Cut(flag, "=")
+
 	for _, commandFlag := range c.Flags {
 		if commandFlag.Name == flag || commandFlag.Short == flag {
 			switch commandFlag.Type {
 			case Bool:
 				c.parsedFlag[commandFlag.Key] = "true"
 			case String:
+				if hasInlineValue {
+					c.parsedFlag[commandFlag.Key] = inlineValue
+					return 0
+				}
+
+				if len(rest) == 0 {
+					panic(fmt.Sprintf("fatal: option '%s' requires a value", flag))
+				}
+
 				c.parsedFlag[commandFlag.Key] = rest[0]
+				return 1
+			case OptionalString:
+				c.parsedFlag[commandFlag.Key] = inlineValue
 			}
 		}
 	}
+
+	return 0
 }
 
 func (c *Command) GetFlag(flag string) string {
 	return c.parsedFlag[flag]
 }
+
+// Returns true if the flag was given, used for the
+// optional flags which can be given without a value
+func (c *Command) HasFlag(flag string) bool {
+	_, ok := c.parsedFlag[flag]
+
+	return ok
+}
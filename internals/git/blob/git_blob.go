@@ -3,12 +3,9 @@ package blob
 import (
 	"bytes"
 	"compress/zlib"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
-	"path"
 
 	"github.com/uragirii/got/internals"
 	"github.com/uragirii/got/internals/git/object"
@@ -83,39 +80,15 @@ func (blob Blob) Write(w io.Writer) error {
 }
 
 func (blob Blob) WriteToFile() error {
-	blobPath, err := blob.sha.GetObjPath()
-
-	if err != nil {
-		return err
-	}
-
 	gitDir, err := internals.GetGitDir()
 
 	if err != nil {
 		return err
 	}
 
-	blobPath = path.Join(gitDir, blobPath)
-
-	if _, err := os.Stat(blobPath); errors.Is(err, os.ErrNotExist) {
-
-		var compressBytes bytes.Buffer
+	_, err = object.WriteLoose(gitDir, object.ObjectContents{ObjType: object.BlobObj, Contents: blob.contents})
 
-		err := os.MkdirAll(path.Join(blobPath, ".."), 0755)
-
-		if err != nil {
-			return err
-		}
-
-		err = blob.Write(&compressBytes)
-
-		if err != nil {
-			return err
-		}
-
-		return os.WriteFile(blobPath, compressBytes.Bytes(), 0444)
-	}
-	return nil
+	return err
 }
 
 func (blob Blob) GetSHA() *sha.SHA {
@@ -0,0 +1,111 @@
+package chunk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Each entry of the table of contents is a 4 byte id and an 8 byte offset
+const _TocEntrySize = 12
+
+var ErrInvalidChunks = errors.New("invalid chunk table of contents")
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Chunk of the files of the chunk format like the commit-graph and the
+// multi-pack-index. ID is 4 characters like "OIDF"
+type Chunk struct {
+	ID   string
+	Data []byte
+}
+
+// Parses the table of contents of count chunks following the header and
+// returns the data of the chunks by their id. The data ends before the
+// trailing checksum
+func Read(data []byte, headerSize, count int) (map[string][]byte, error) {
+	tocEnd := headerSize + (count+1)*_TocEntrySize
+
+	if len(data) < tocEnd+sha.BYTES_LEN {
+		return nil, fmt.Errorf("%w: file is too small", ErrInvalidChunks)
+	}
+
+	chunks := make(map[string][]byte, count)
+
+	for i := 0; i < count; i++ {
+		entry := data[headerSize+i*_TocEntrySize:]
+		next := data[headerSize+(i+1)*_TocEntrySize:]
+
+		id := string(entry[:4])
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(next[4:12])
+
+		if start < uint64(tocEnd) || start > end || end > uint64(len(data)-sha.BYTES_LEN) {
+			return nil, fmt.Errorf("%w: chunk %s is out of bounds", ErrInvalidChunks, id)
+		}
+
+		if _, found := chunks[id]; found {
+			return nil, fmt.Errorf("%w: duplicate chunk %s", ErrInvalidChunks, id)
+		}
+
+		chunks[id] = data[start:end]
+	}
+
+	// terminating label
+	if !bytes.Equal(data[headerSize+count*_TocEntrySize:][:4], []byte{0, 0, 0, 0}) {
+		return nil, fmt.Errorf("%w: missing terminating label", ErrInvalidChunks)
+	}
+
+	return chunks, nil
+}
+
+// Returns the header, the table of contents and the chunks followed by
+// the checksum of all of them
+func Write(header []byte, chunks []Chunk) []byte {
+	var buffer bytes.Buffer
+
+	buffer.Write(header)
+
+	offset := uint64(len(header) + (len(chunks)+1)*_TocEntrySize)
+	entry := make([]byte, _TocEntrySize)
+
+	for _, c := range chunks {
+		copy(entry, c.ID)
+		binary.BigEndian.PutUint64(entry[4:], offset)
+		buffer.Write(entry)
+
+		offset += uint64(len(c.Data))
+	}
+
+	clear(entry)
+	binary.BigEndian.PutUint64(entry[4:], offset)
+	buffer.Write(entry)
+
+	for _, c := range chunks {
+		buffer.Write(c.Data)
+	}
+
+	checksum := sha1.Sum(buffer.Bytes())
+	buffer.Write(checksum[:])
+
+	return buffer.Bytes()
+}
+
+// Checks the trailing checksum of the file and returns it
+func VerifyChecksum(data []byte) (*sha.SHA, error) {
+	if len(data) < sha.BYTES_LEN {
+		return nil, ErrChecksumMismatch
+	}
+
+	checksum := sha1.Sum(data[:len(data)-sha.BYTES_LEN])
+	trailer := data[len(data)-sha.BYTES_LEN:]
+
+	if !bytes.Equal(checksum[:], trailer) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return sha.FromByteSlice(&trailer)
+}
@@ -0,0 +1,47 @@
+package chunk_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestReadWrite(t *testing.T) {
+	header := []byte("TEST")
+
+	data := chunk.Write(header, []chunk.Chunk{
+		{ID: "ONE1", Data: []byte("first")},
+		{ID: "EMPT", Data: nil},
+		{ID: "TWO2", Data: []byte("second")},
+	})
+
+	if _, err := chunk.VerifyChecksum(data); err != nil {
+		t.Fatalf("VerifyChecksum failed with err %v", err)
+	}
+
+	chunks, err := chunk.Read(data, len(header), 3)
+
+	if err != nil {
+		t.Fatalf("Read failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "ONE1", "first", string(chunks["ONE1"]))
+	testutils.AssertString(t, "EMPT", "", string(chunks["EMPT"]))
+	testutils.AssertString(t, "TWO2", "second", string(chunks["TWO2"]))
+
+	t.Run("fails for out of bounds chunks", func(t *testing.T) {
+		if _, err := chunk.Read(data, len(header), 4); !errors.Is(err, chunk.ErrInvalidChunks) {
+			t.Errorf("expected ErrInvalidChunks but got %v", err)
+		}
+	})
+
+	t.Run("fails for corrupted data", func(t *testing.T) {
+		data[len(data)/2] ^= 0xff
+
+		if _, err := chunk.VerifyChecksum(data); !errors.Is(err, chunk.ErrChecksumMismatch) {
+			t.Errorf("expected ErrChecksumMismatch but got %v", err)
+		}
+	})
+}
@@ -1,14 +1,10 @@
 package commit
 
 import (
-	"bytes"
 	"compress/zlib"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
-	"path"
 	"strings"
 	"time"
 
@@ -18,14 +14,15 @@ import (
 	"github.com/uragirii/got/internals/git/index"
 	"github.com/uragirii/got/internals/git/object"
 	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
 	"github.com/uragirii/got/internals/git/tree"
 )
 
 type Commit struct {
-	Tree      *tree.Tree
-	parentSHA *sha.SHA
-	sha       *sha.SHA
-	message   string
+	Tree    *tree.Tree
+	parents []*sha.SHA
+	sha     *sha.SHA
+	message string
 
 	author   config.User
 	commiter config.User
@@ -35,6 +32,8 @@ type Commit struct {
 }
 
 var ErrInvalidCommit = fmt.Errorf("invalid commit")
+var ErrNothingToCommit = fmt.Errorf("nothing to commit")
+var ErrNothingToAmend = fmt.Errorf("you have nothing to amend")
 
 func FromSHA(SHA *sha.SHA, gitFsys fs.FS) (*Commit, error) {
 
@@ -66,28 +65,39 @@ func FromObj(objContents object.ObjectContents, gitFsys fs.FS) (*Commit, error)
 
 	lines := strings.Split(commitDetails, "\n")
 
-	treeLine := lines[0]
-	parentLine := lines[1]
-	authorLine := lines[2]
-	commiterLine := lines[3]
-
-	treeSha, err := sha.FromString(strings.Split(treeLine, " ")[1])
+	var err error
+	var treeSha *sha.SHA
+	var parents []*sha.SHA
+	var author, commiter config.User
+	var authorTime, commiterTime time.Time
+
+	for _, line := range lines {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "tree":
+			treeSha, err = sha.FromString(value)
+		case "parent":
+			var parentSha *sha.SHA
+			parentSha, err = sha.FromString(value)
+			parents = append(parents, parentSha)
+		case "author":
+			author, authorTime = parseAuthorLine(line)
+		case "committer":
+			commiter, commiterTime = parseCommitterLine(line)
+		}
 
-	if err != nil {
-		return nil, err
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	parentSha, err := sha.FromString(strings.Split(parentLine, " ")[1])
-
-	if err != nil {
-		return nil, err
+	if treeSha == nil {
+		return nil, ErrInvalidCommit
 	}
 
 	tree, err := tree.FromSHA(treeSha, gitFsys)
 
-	author, authorTime := parseAuthorLine(authorLine)
-	commiter, commiterTime := parseCommitterLine(commiterLine)
-
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +105,7 @@ func FromObj(objContents object.ObjectContents, gitFsys fs.FS) (*Commit, error)
 	c := &Commit{
 		Tree:       tree,
 		message:    commitMsg,
-		parentSHA:  parentSha,
+		parents:    parents,
 		author:     author,
 		authorTime: authorTime,
 		commiter:   commiter,
@@ -116,6 +126,29 @@ func (commit Commit) GetSHA() *sha.SHA {
 	return commit.sha
 }
 
+func (commit Commit) GetParents() []*sha.SHA {
+	return commit.parents
+}
+
+func (commit Commit) GetMessage() string {
+	return commit.message
+}
+
+func (commit Commit) GetAuthor() (config.User, time.Time) {
+	return commit.author, commit.authorTime
+}
+
+func (commit Commit) GetCommitter() (config.User, time.Time) {
+	return commit.commiter, commit.commitTime
+}
+
+// Replaces the message and recalculates the SHA
+func (commit *Commit) SetMessage(message string) error {
+	commit.message = message
+
+	return commit.CalculateSha()
+}
+
 func (commit Commit) GetObjType() object.ObjectType {
 	return object.CommitObj
 }
@@ -124,7 +157,9 @@ func (commit Commit) String() string {
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("tree %s\n", commit.Tree.SHA))
-	sb.WriteString(fmt.Sprintf("parent %s\n", commit.parentSHA))
+	for _, parent := range commit.parents {
+		sb.WriteString(fmt.Sprintf("parent %s\n", parent))
+	}
 	sb.WriteString(fmt.Sprintf("author %s ", commit.author.String()))
 	sb.WriteString(toGitTime(commit.authorTime))
 	sb.WriteRune('\n')
@@ -162,40 +197,17 @@ func (commit Commit) Write(writer io.Writer) error {
 }
 
 func (commit Commit) WriteToFile() error {
-	objPath, err := commit.sha.GetObjPath()
-
-	if err != nil {
-		return err
-	}
-
 	gitDir, err := internals.GetGitDir()
 
 	if err != nil {
 		return err
 	}
 
-	objPath = path.Join(gitDir, objPath)
-
-	if _, err := os.Stat(objPath); errors.Is(err, os.ErrNotExist) {
-		var buffer bytes.Buffer
-
-		err = commit.Write(&buffer)
-
-		if err != nil {
-			return err
-		}
+	contents := []byte(commit.Raw())
 
-		err = os.MkdirAll(path.Join(objPath, ".."), 0755)
+	_, err = object.WriteLoose(gitDir, object.ObjectContents{ObjType: object.CommitObj, Contents: &contents})
 
-		if err != nil {
-			return err
-		}
-
-		return os.WriteFile(objPath, buffer.Bytes(), 0444) // Read only file
-
-	}
-
-	return nil
+	return err
 }
 
 func (commit Commit) Raw() string {
@@ -218,7 +230,7 @@ func (commit *Commit) CalculateSha() error {
 	return nil
 }
 
-func New(gitFs fs.FS, message string) (*Commit, error) {
+func New(gitFs fs.FS, message string, opts Options) (*Commit, error) {
 
 	indexFile, err := gitFs.Open(index.IndexFileName)
 
@@ -252,21 +264,79 @@ func New(gitFs fs.FS, message string) (*Commit, error) {
 		return nil, err
 	}
 
-	// TODO: Read these from global config
-	c, err := config.FromFile()
+	c, err := config.Load(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []*sha.SHA
+
+	if head.SHA != nil {
+		parents = []*sha.SHA{head.SHA}
+	}
+
+	if opts.Amend {
+		if head.SHA == nil {
+			return nil, ErrNothingToAmend
+		}
+
+		headCommit, err := FromSHA(head.SHA, gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		parents = headCommit.parents
+
+		shallowSet, err := shallow.ReadSet(gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// same as git, the parents of a shallow commit are grafted away
+		// as they are not in the repository, so the amend is a root commit
+		if shallowSet[head.SHA.String()] {
+			parents = nil
+		}
+
+		// amend keeps the original authorship unless overridden
+		if opts.Author == "" {
+			opts.Author = headCommit.author.String()
+		}
+
+		if opts.AuthorDate == "" {
+			opts.AuthorDate = toGitTime(headCommit.authorTime)
+		}
+	}
+
+	if !opts.AllowEmpty {
+		isEmpty, err := isSameTreeAsParent(tree, parents, gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if isEmpty {
+			return nil, ErrNothingToCommit
+		}
+	}
+
+	author, authorTime, commiter, commitTime, err := resolveIdents(c, opts)
 
 	if err != nil {
 		return nil, err
 	}
 
 	commit := &Commit{
-		parentSHA:  head.SHA,
+		parents:    parents,
 		message:    message,
 		Tree:       tree,
-		author:     c.User,
-		authorTime: time.Now(),
-		commiter:   c.User,
-		commitTime: time.Now(),
+		author:     author,
+		authorTime: authorTime,
+		commiter:   commiter,
+		commitTime: commitTime,
 	}
 
 	if err = commit.CalculateSha(); err != nil {
@@ -275,3 +345,23 @@ func New(gitFs fs.FS, message string) (*Commit, error) {
 
 	return commit, nil
 }
+
+// A commit is empty when it records the same tree as its first parent
+// or an empty tree in case of root commit. Merges are never empty
+func isSameTreeAsParent(commitTree *tree.Tree, parents []*sha.SHA, gitFs fs.FS) (bool, error) {
+	if len(parents) > 1 {
+		return false, nil
+	}
+
+	if len(parents) == 0 {
+		return commitTree.SHA.String() == tree.EmptyTreeSHA, nil
+	}
+
+	parent, err := FromSHA(parents[0], gitFs)
+
+	if err != nil {
+		return false, err
+	}
+
+	return parent.Tree.SHA.Eq(commitTree.SHA), nil
+}
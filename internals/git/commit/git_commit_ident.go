@@ -0,0 +1,209 @@
+package commit
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/config"
+)
+
+var ErrInvalidIdent = fmt.Errorf("invalid identity, expected format 'Name <email>'")
+var ErrInvalidDate = fmt.Errorf("invalid date format")
+
+type identRole string
+
+const (
+	roleAuthor    identRole = "AUTHOR"
+	roleCommitter identRole = "COMMITTER"
+)
+
+// Options used while creating a commit, empty identity
+// values fallback to env vars and config like git
+type Options struct {
+	// In "Name <email>" format, same as --author
+	Author string
+	// Any format supported by ParseDate, same as --date
+	AuthorDate string
+	// Replace the HEAD commit, reusing its parents and authorship
+	Amend bool
+	// Allow recording a commit with the same tree as its parent
+	AllowEmpty bool
+}
+
+// Parses "Name <email>" into user
+func ParseIdent(ident string) (config.User, error) {
+	emailStartIdx := strings.IndexByte(ident, '<')
+	emailEndIdx := strings.LastIndexByte(ident, '>')
+
+	if emailStartIdx == -1 || emailEndIdx < emailStartIdx {
+		return config.User{}, ErrInvalidIdent
+	}
+
+	return config.User{
+		Name:  strings.TrimSpace(ident[:emailStartIdx]),
+		Email: strings.TrimSpace(ident[emailStartIdx+1 : emailEndIdx]),
+	}, nil
+}
+
+// Resolves the user in the same order as git
+// GIT_<ROLE>_NAME > <role>.name > user.name
+func resolveUser(role identRole, c *config.Config) (config.User, error) {
+	lowerRole := strings.ToLower(string(role))
+
+	resolve := func(field string) string {
+		if value := os.Getenv(fmt.Sprintf("GIT_%s_%s", role, strings.ToUpper(field))); value != "" {
+			return value
+		}
+
+		if value, ok := c.Get(fmt.Sprintf("%s.%s", lowerRole, field)); ok && value != "" {
+			return value
+		}
+
+		if value, ok := c.Get(fmt.Sprintf("user.%s", field)); ok && value != "" {
+			return value
+		}
+
+		if field == "email" {
+			return os.Getenv("EMAIL")
+		}
+
+		return ""
+	}
+
+	user := config.User{
+		Name:  resolve("name"),
+		Email: resolve("email"),
+	}
+
+	if user.Name == "" || user.Email == "" {
+		return config.User{}, fmt.Errorf("%s identity unknown, please set user.name and user.email", lowerRole)
+	}
+
+	return user, nil
+}
+
+func resolveDate(role identRole, now time.Time) (time.Time, error) {
+	dateStr := os.Getenv(fmt.Sprintf("GIT_%s_DATE", role))
+
+	if dateStr == "" {
+		return now, nil
+	}
+
+	return ParseDate(dateStr)
+}
+
+// parses +0530 or +05:30
+func parseZone(zone string) (*time.Location, error) {
+	zone = strings.ReplaceAll(zone, ":", "")
+
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return nil, ErrInvalidDate
+	}
+
+	if _, err := strconv.Atoi(zone[1:]); err != nil {
+		return nil, ErrInvalidDate
+	}
+
+	return time.FixedZone(zone, parseOffset(zone)), nil
+}
+
+// Parses the raw git format "<unix> <zone>" with optional "@" prefix
+func parseRawDate(date string) (time.Time, bool) {
+	date = strings.TrimPrefix(date, "@")
+
+	unixStr, zone, hasZone := strings.Cut(date, " ")
+
+	unix, err := strconv.ParseInt(unixStr, 10, 64)
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	location := time.UTC
+
+	if hasZone {
+		location, err = parseZone(strings.TrimSpace(zone))
+
+		if err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	return time.Unix(unix, 0).In(location), true
+}
+
+var _DateLayouts = []string{
+	// RFC 2822
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	// git's default format
+	"Mon Jan 2 15:04:05 2006 -0700",
+	// ISO 8601
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parses the date formats supported by git
+// @see https://git-scm.com/docs/git-commit#_date_formats
+func ParseDate(date string) (time.Time, error) {
+	date = strings.TrimSpace(date)
+
+	if t, ok := parseRawDate(date); ok {
+		return t, nil
+	}
+
+	for _, layout := range _DateLayouts {
+		// Dates without zone are in local time like git
+		t, err := time.ParseInLocation(layout, date, time.Local)
+
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidDate, date)
+}
+
+// Returns the author and committer identity along with their times
+func resolveIdents(c *config.Config, opts Options) (author config.User, authorTime time.Time, committer config.User, commitTime time.Time, err error) {
+	now := time.Now()
+
+	if opts.Author != "" {
+		author, err = ParseIdent(opts.Author)
+	} else {
+		author, err = resolveUser(roleAuthor, c)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if opts.AuthorDate != "" {
+		authorTime, err = ParseDate(opts.AuthorDate)
+	} else {
+		authorTime, err = resolveDate(roleAuthor, now)
+	}
+
+	if err != nil {
+		return
+	}
+
+	committer, err = resolveUser(roleCommitter, c)
+
+	if err != nil {
+		return
+	}
+
+	commitTime, err = resolveDate(roleCommitter, now)
+
+	return
+}
@@ -0,0 +1,111 @@
+package commit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/config"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestParseDate(t *testing.T) {
+	dates := []string{
+		"1720643686 +0530",
+		"@1720643686 +0530",
+		"Thu, 11 Jul 2024 02:04:46 +0530",
+		"Thu Jul 11 02:04:46 2024 +0530",
+		"2024-07-11T02:04:46+05:30",
+		"2024-07-11 02:04:46 +0530",
+	}
+
+	for _, date := range dates {
+		t.Run(date, func(t *testing.T) {
+			parsed, err := ParseDate(date)
+
+			if err != nil {
+				t.Fatalf("ParseDate failed with err %v", err)
+			}
+
+			testutils.AssertString(t, "git time", TIME_FORMATTED, toGitTime(parsed))
+		})
+	}
+
+	t.Run("fails for invalid date", func(t *testing.T) {
+		if _, err := ParseDate("not a date"); err == nil {
+			t.Errorf("expected error for invalid date")
+		}
+	})
+}
+
+func TestResolveIdents(t *testing.T) {
+	c, err := config.New(strings.NewReader("[user]\n\tname = Config User\n\temail = config@idc.com\n"))
+
+	if err != nil {
+		t.Fatalf("config.New failed with err %v", err)
+	}
+
+	t.Run("uses config when env is not set", func(t *testing.T) {
+		author, _, committer, _, err := resolveIdents(c, Options{})
+
+		if err != nil {
+			t.Fatalf("resolveIdents failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "author", "Config User <config@idc.com>", author.String())
+		testutils.AssertString(t, "committer", "Config User <config@idc.com>", committer.String())
+	})
+
+	t.Run("env overrides config", func(t *testing.T) {
+		t.Setenv("GIT_AUTHOR_NAME", TEST_USER_NAME)
+		t.Setenv("GIT_AUTHOR_EMAIL", TEST_USER_EMAIL)
+		t.Setenv("GIT_AUTHOR_DATE", "1720643686 +0530")
+		t.Setenv("GIT_COMMITTER_DATE", "@1720643686 +0530")
+
+		author, authorTime, committer, commitTime, err := resolveIdents(c, Options{})
+
+		if err != nil {
+			t.Fatalf("resolveIdents failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "author", TEST_USER_NAME+" <"+TEST_USER_EMAIL+">", author.String())
+		testutils.AssertString(t, "committer", "Config User <config@idc.com>", committer.String())
+		testutils.AssertString(t, "author time", TIME_FORMATTED, toGitTime(authorTime))
+		testutils.AssertString(t, "commit time", TIME_FORMATTED, toGitTime(commitTime))
+	})
+
+	t.Run("options override env", func(t *testing.T) {
+		t.Setenv("GIT_AUTHOR_NAME", "Env User")
+		t.Setenv("GIT_AUTHOR_DATE", "1 +0000")
+
+		author, authorTime, _, _, err := resolveIdents(c, Options{
+			Author:     TEST_USER_NAME + " <" + TEST_USER_EMAIL + ">",
+			AuthorDate: "2024-07-11T02:04:46+05:30",
+		})
+
+		if err != nil {
+			t.Fatalf("resolveIdents failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "author", TEST_USER_NAME+" <"+TEST_USER_EMAIL+">", author.String())
+		testutils.AssertString(t, "author time", TIME_FORMATTED, toGitTime(authorTime))
+	})
+
+	t.Run("fails when identity is unknown", func(t *testing.T) {
+		t.Setenv("EMAIL", "")
+
+		if _, _, _, _, err := resolveIdents(&config.Config{}, Options{}); err == nil {
+			t.Errorf("expected error when identity is not configured")
+		}
+	})
+
+	t.Run("defaults to current time", func(t *testing.T) {
+		before := time.Now().Add(-time.Second)
+
+		_, authorTime, _, _, _ := resolveIdents(c, Options{})
+
+		if authorTime.Before(before) {
+			t.Errorf("expected author time to be now but got %s", authorTime)
+		}
+	})
+}
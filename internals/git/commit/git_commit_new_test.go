@@ -0,0 +1,249 @@
+package commit_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/commit"
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/tree"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const TEST_AUTHOR = "Original Author <author@idc.com>"
+const TEST_AUTHOR_DATE = "1720643686 +0530"
+
+// Creates a repository with an unborn main branch, returns the work tree
+// and the git dir
+func setupRepo(t *testing.T) (string, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	gitDir := path.Join(root, ".git")
+
+	if err := os.MkdirAll(path.Join(gitDir, "refs/heads"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err := os.WriteFile(path.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// the git dir is cached after the first lookup
+	internals.GIT_DIR = gitDir
+	t.Cleanup(func() { internals.GIT_DIR = "" })
+
+	t.Setenv("GIT_CONFIG", path.Join(root, "gitconfig"))
+	t.Setenv("GIT_COMMITTER_NAME", TEST_USER_NAME)
+	t.Setenv("GIT_COMMITTER_EMAIL", TEST_USER_EMAIL)
+	t.Setenv("GIT_AUTHOR_NAME", TEST_USER_NAME)
+	t.Setenv("GIT_AUTHOR_EMAIL", TEST_USER_EMAIL)
+
+	return root, gitDir
+}
+
+// Checks out the files in the work tree and writes the index with them
+func stage(t *testing.T, root, gitDir string, files map[string]string) {
+	t.Helper()
+
+	entries := make([]tree.TreeEntry, 0, len(files))
+
+	for name, contents := range files {
+		data := []byte(contents)
+
+		if err := os.WriteFile(path.Join(root, name), data, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		blobSha, err := object.WriteLoose(gitDir, object.ObjectContents{ObjType: object.BlobObj, Contents: &data})
+
+		if err != nil {
+			t.Fatalf("WriteLoose failed with err %v", err)
+		}
+
+		entries = append(entries, tree.TreeEntry{Name: name, Mode: tree.ModeNormal, SHA: blobSha})
+	}
+
+	indexTree, err := tree.FromEnteries(entries)
+
+	if err != nil {
+		t.Fatalf("FromEnteries failed with err %v", err)
+	}
+
+	if err = indexTree.WriteToFile(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	i, err := index.FromTree(root, indexTree, os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("FromTree failed with err %v", err)
+	}
+
+	if err = i.WriteToFile(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+// Creates the commit from the index and moves main to it
+func commitIndex(t *testing.T, gitDir, message string, opts commit.Options) *commit.Commit {
+	t.Helper()
+
+	c, err := commit.New(os.DirFS(gitDir), message, opts)
+
+	if err != nil {
+		t.Fatalf("New failed with err %v", err)
+	}
+
+	if err = c.WriteToFile(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = refs.Write(gitDir, "refs/heads/main", c.GetSHA()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return c
+}
+
+func TestNew(t *testing.T) {
+	t.Run("root commit with the empty tree", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{})
+
+		_, err := commit.New(os.DirFS(gitDir), "empty\n", commit.Options{})
+
+		if !errors.Is(err, commit.ErrNothingToCommit) {
+			t.Fatalf("expected ErrNothingToCommit but got %v", err)
+		}
+
+		c := commitIndex(t, gitDir, "empty\n", commit.Options{AllowEmpty: true})
+
+		if len(c.GetParents()) != 0 {
+			t.Errorf("expected root commit but got parents %v", c.GetParents())
+		}
+
+		testutils.AssertString(t, "tree", tree.EmptyTreeSHA, c.Tree.SHA.String())
+	})
+
+	t.Run("rejects an empty commit unless allowed", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "first\n"})
+
+		first := commitIndex(t, gitDir, "first\n", commit.Options{})
+
+		_, err := commit.New(os.DirFS(gitDir), "second\n", commit.Options{})
+
+		if !errors.Is(err, commit.ErrNothingToCommit) {
+			t.Fatalf("expected ErrNothingToCommit but got %v", err)
+		}
+
+		second := commitIndex(t, gitDir, "second\n", commit.Options{AllowEmpty: true})
+
+		if len(second.GetParents()) != 1 || !second.GetParents()[0].Eq(first.GetSHA()) {
+			t.Fatalf("expected parent %s but got %v", first.GetSHA(), second.GetParents())
+		}
+
+		testutils.AssertString(t, "tree", first.Tree.SHA.String(), second.Tree.SHA.String())
+	})
+
+	t.Run("amend fails without HEAD", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "first\n"})
+
+		_, err := commit.New(os.DirFS(gitDir), "first\n", commit.Options{Amend: true})
+
+		if !errors.Is(err, commit.ErrNothingToAmend) {
+			t.Fatalf("expected ErrNothingToAmend but got %v", err)
+		}
+	})
+
+	t.Run("amend keeps the parents and authorship", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "first\n"})
+
+		first := commitIndex(t, gitDir, "first\n", commit.Options{})
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "second\n"})
+
+		second := commitIndex(t, gitDir, "second\n", commit.Options{Author: TEST_AUTHOR, AuthorDate: TEST_AUTHOR_DATE})
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "amended\n"})
+
+		amended := commitIndex(t, gitDir, "amended\n", commit.Options{Amend: true})
+
+		if len(amended.GetParents()) != 1 || !amended.GetParents()[0].Eq(first.GetSHA()) {
+			t.Fatalf("expected parent %s but got %v", first.GetSHA(), amended.GetParents())
+		}
+
+		author, authorTime := amended.GetAuthor()
+		expectedAuthor, expectedTime := second.GetAuthor()
+
+		testutils.AssertString(t, "author", TEST_AUTHOR, author.String())
+		testutils.AssertString(t, "author", expectedAuthor.String(), author.String())
+
+		if !authorTime.Equal(expectedTime) {
+			t.Errorf("expected author time %v but got %v", expectedTime, authorTime)
+		}
+
+		committer, _ := amended.GetCommitter()
+
+		testutils.AssertString(t, "committer", TEST_USER_NAME+" <"+TEST_USER_EMAIL+">", committer.String())
+		testutils.AssertString(t, "message", "amended\n", amended.GetMessage())
+	})
+
+	t.Run("amend allows the tree of the amended commit", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "first\n"})
+
+		commitIndex(t, gitDir, "first\n", commit.Options{})
+
+		// rewording only changes the message, the tree is compared with
+		// the parents of HEAD
+		reworded := commitIndex(t, gitDir, "reworded\n", commit.Options{Amend: true})
+
+		if len(reworded.GetParents()) != 0 {
+			t.Errorf("expected root commit but got parents %v", reworded.GetParents())
+		}
+	})
+	t.Run("amend on a shallow clone", func(t *testing.T) {
+		root, gitDir := setupRepo(t)
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "first\n"})
+
+		first := commitIndex(t, gitDir, "first\n", commit.Options{})
+
+		stage(t, root, gitDir, map[string]string{"file.txt": "second\n"})
+
+		second := commitIndex(t, gitDir, "second\n", commit.Options{})
+
+		// depth 1 clone, the parent isn't in the repository
+		firstPath, _ := first.GetSHA().GetObjPath()
+
+		os.Remove(path.Join(gitDir, firstPath))
+
+		if err := shallow.Write(gitDir, []*sha.SHA{second.GetSHA()}); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		reworded := commitIndex(t, gitDir, "reworded\n", commit.Options{Amend: true})
+
+		if len(reworded.GetParents()) != 0 {
+			t.Errorf("expected root commit but got parents %v", reworded.GetParents())
+		}
+
+		testutils.AssertString(t, "tree", second.Tree.SHA.String(), reworded.Tree.SHA.String())
+	})
+}
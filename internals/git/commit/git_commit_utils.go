@@ -94,3 +94,37 @@ func toGitTime(t time.Time) string {
 	return fmt.Sprintf("%d %s%02d%02d", t.Unix(), sign, hrs, min)
 
 }
+
+// Cleans up the message like git's default "strip" cleanup mode.
+// Removes trailing whitespace, leading and trailing empty lines,
+// collapses consecutive empty lines and optionally removes comment lines
+func CleanupMessage(message string, stripComments bool) string {
+	var lines []string
+
+	prevEmpty := true
+
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t\r")
+
+		isEmpty := line == ""
+
+		if isEmpty && prevEmpty {
+			continue
+		}
+
+		lines = append(lines, line)
+		prevEmpty = isEmpty
+	}
+
+	cleaned := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+
+	if cleaned == "" {
+		return ""
+	}
+
+	return cleaned + "\n"
+}
@@ -57,3 +57,21 @@ func TestToGitTime(t *testing.T) {
 	testutils.AssertString(t, "time", TIME_FORMATTED, fmtTime)
 
 }
+
+func TestCleanupMessage(t *testing.T) {
+	message := `
+
+feat: add amend   
+
+# Please enter the commit message
+body line 1
+
+
+body line 2
+#
+`
+
+	testutils.AssertString(t, "with comments stripped", "feat: add amend\n\nbody line 1\n\nbody line 2\n", CleanupMessage(message, true))
+	testutils.AssertString(t, "with comments", "feat: add amend\n\n# Please enter the commit message\nbody line 1\n\nbody line 2\n#\n", CleanupMessage(message, false))
+	testutils.AssertString(t, "only comments", "", CleanupMessage("# comment\n\n", true))
+}
@@ -0,0 +1,465 @@
+package commitgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+)
+
+const (
+	File     = "objects/info/commit-graph"
+	ChainDir = "objects/info/commit-graphs"
+	Chain    = ChainDir + "/commit-graph-chain"
+)
+
+const (
+	_HeaderSize = 8
+	_Version    = 1
+	_HashSHA1   = 1
+	_FanoutLen  = 256
+	// tree, 2 parents and the generation with the commit time
+	_CommitDataSize = sha.BYTES_LEN + 16
+)
+
+const (
+	_ParentNone      = 0x70000000
+	_ExtraEdges      = 0x80000000
+	_LastEdge        = 0x80000000
+	_GenerationV1Max = 0x3fffffff
+	// offsets of the corrected commit dates above it are in GDO2
+	_GenerationV2OffsetMax = 0x7fffffff
+)
+
+var _Signature = []byte("CGPH")
+
+var ErrInvalidGraph = errors.New("invalid commit-graph")
+
+// Commit read from the commit-graph
+type Commit struct {
+	SHA     *sha.SHA
+	Tree    *sha.SHA
+	Parents []*sha.SHA
+	Time    time.Time
+	// Corrected commit date when all the layers have it, otherwise the
+	// topological level. Ancestors always have a smaller generation
+	Generation uint64
+}
+
+// Commit-graph file, a layer of the split chain or the only one
+type layer struct {
+	path     string
+	checksum *sha.SHA
+	count    uint32
+	// position of the first commit, the commits of the base layers are
+	// numbered first
+	offset uint32
+	fanout []byte
+	oids   []byte
+	data   []byte
+	edges  []byte
+	// corrected commit date offsets of generation v2 and their overflow
+	generations        []byte
+	generationOverflow []byte
+	bases              []byte
+}
+
+// Commit-graph of the repository, the layers of a split chain are
+// ordered from the base
+type Graph struct {
+	layers       []*layer
+	generationV2 bool
+}
+
+func parseLayer(filePath string, data []byte) (*layer, error) {
+	if len(data) < _HeaderSize || !bytes.Equal(data[:4], _Signature) {
+		return nil, fmt.Errorf("%w: %s: bad signature", ErrInvalidGraph, filePath)
+	}
+
+	if data[4] != _Version || data[5] != _HashSHA1 {
+		return nil, fmt.Errorf("%w: %s: unsupported version %d or hash %d", ErrInvalidGraph, filePath, data[4], data[5])
+	}
+
+	chunks, err := chunk.Read(data, _HeaderSize, int(data[6]))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidGraph, filePath, err)
+	}
+
+	trailer := data[len(data)-sha.BYTES_LEN:]
+	checksum, _ := sha.FromByteSlice(&trailer)
+
+	l := &layer{
+		path:               filePath,
+		checksum:           checksum,
+		fanout:             chunks["OIDF"],
+		oids:               chunks["OIDL"],
+		data:               chunks["CDAT"],
+		edges:              chunks["EDGE"],
+		generations:        chunks["GDA2"],
+		generationOverflow: chunks["GDO2"],
+		bases:              chunks["BASE"],
+	}
+
+	if len(l.fanout) != _FanoutLen*4 {
+		return nil, fmt.Errorf("%w: %s: bad OIDF chunk", ErrInvalidGraph, filePath)
+	}
+
+	l.count = binary.BigEndian.Uint32(l.fanout[(_FanoutLen-1)*4:])
+
+	switch {
+	case len(l.oids) != int(l.count)*sha.BYTES_LEN:
+		return nil, fmt.Errorf("%w: %s: bad OIDL chunk", ErrInvalidGraph, filePath)
+	case len(l.data) != int(l.count)*_CommitDataSize:
+		return nil, fmt.Errorf("%w: %s: bad CDAT chunk", ErrInvalidGraph, filePath)
+	case l.generations != nil && len(l.generations) != int(l.count)*4:
+		return nil, fmt.Errorf("%w: %s: bad GDA2 chunk", ErrInvalidGraph, filePath)
+	case len(l.bases) != int(data[7])*sha.BYTES_LEN:
+		return nil, fmt.Errorf("%w: %s: bad BASE chunk", ErrInvalidGraph, filePath)
+	}
+
+	return l, nil
+}
+
+func readLayer(gitFs fs.FS, filePath string) (*layer, error) {
+	data, err := fs.ReadFile(gitFs, filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLayer(filePath, data)
+}
+
+// Returns the graph files of the split chain, from the base
+func readChain(gitFs fs.FS) ([]string, error) {
+	data, err := fs.ReadFile(gitFs, Chain)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if len(line) != sha.BYTES_LEN*2 {
+			return nil, fmt.Errorf("%w: invalid chain entry %q", ErrInvalidGraph, line)
+		}
+
+		files = append(files, path.Join(ChainDir, "graph-"+line+".graph"))
+	}
+
+	return files, nil
+}
+
+// Reads the layers of the chain and checks that each one lists the
+// ones below it as its bases
+func readLayers(gitFs fs.FS, files []string) ([]*layer, error) {
+	layers := make([]*layer, 0, len(files))
+
+	var offset uint32
+
+	for i, filePath := range files {
+		l, err := readLayer(gitFs, filePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(l.bases) != i*sha.BYTES_LEN {
+			return nil, fmt.Errorf("%w: %s: has %d bases instead of %d", ErrInvalidGraph, filePath, len(l.bases)/sha.BYTES_LEN, i)
+		}
+
+		for j, base := range layers {
+			if !bytes.Equal(l.bases[j*sha.BYTES_LEN:(j+1)*sha.BYTES_LEN], *base.checksum.GetBytes()) {
+				return nil, fmt.Errorf("%w: %s: base %s doesn't match", ErrInvalidGraph, filePath, base.path)
+			}
+		}
+
+		l.offset = offset
+		offset += l.count
+
+		layers = append(layers, l)
+	}
+
+	return layers, nil
+}
+
+// Loads objects/info/commit-graph or the split chain, returns nil if
+// there is no graph or it's disabled with core.commitGraph. Shallow
+// repositories don't use the graph as the parents of their shallow
+// commits are cut
+func Load(gitFs fs.FS) (*Graph, error) {
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.GetBool("core.commitGraph", true) {
+		return nil, nil
+	}
+
+	shallowCommits, err := shallow.Read(gitFs)
+
+	if err != nil || len(shallowCommits) != 0 {
+		return nil, err
+	}
+
+	return load(gitFs)
+}
+
+func load(gitFs fs.FS) (*Graph, error) {
+	files := []string{File}
+
+	if _, err := fs.Stat(gitFs, File); errors.Is(err, fs.ErrNotExist) {
+		files, err = readChain(gitFs)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	layers, err := readLayers(gitFs, files)
+
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{layers: layers, generationV2: true}
+
+	for _, l := range layers {
+		if l.generations == nil {
+			g.generationV2 = false
+		}
+	}
+
+	return g, nil
+}
+
+// Number of commits in all the layers
+func (g *Graph) Len() int {
+	if g == nil || len(g.layers) == 0 {
+		return 0
+	}
+
+	top := g.layers[len(g.layers)-1]
+
+	return int(top.offset + top.count)
+}
+
+// Returns true if the generations are the corrected commit dates
+func (g *Graph) GenerationV2() bool {
+	return g != nil && g.generationV2
+}
+
+// Binary searches the commit in the layer using the fanout
+func (l *layer) find(commitSha *sha.SHA) (uint32, bool) {
+	hash := *commitSha.GetBytes()
+
+	if len(hash) != sha.BYTES_LEN {
+		return 0, false
+	}
+
+	var start uint32
+
+	if hash[0] != 0 {
+		start = binary.BigEndian.Uint32(l.fanout[(int(hash[0])-1)*4:])
+	}
+
+	end := binary.BigEndian.Uint32(l.fanout[int(hash[0])*4:])
+
+	if start > end || end > l.count {
+		return 0, false
+	}
+
+	idx := sort.Search(int(end-start), func(i int) bool {
+		pos := int(start) + i
+
+		return bytes.Compare(l.oids[pos*sha.BYTES_LEN:(pos+1)*sha.BYTES_LEN], hash) >= 0
+	})
+
+	pos := start + uint32(idx)
+
+	if pos >= end || !bytes.Equal(l.oids[pos*sha.BYTES_LEN:(pos+1)*sha.BYTES_LEN], hash) {
+		return 0, false
+	}
+
+	return pos, true
+}
+
+func (l *layer) oid(idx uint32) *sha.SHA {
+	hash := l.oids[idx*sha.BYTES_LEN : (idx+1)*sha.BYTES_LEN]
+	oid, _ := sha.FromByteSlice(&hash)
+
+	return oid
+}
+
+// Returns the layer with the commit at the position and its index in it
+func (g *Graph) layerAt(pos uint32) (*layer, uint32, bool) {
+	for _, l := range g.layers {
+		if pos >= l.offset && pos < l.offset+l.count {
+			return l, pos - l.offset, true
+		}
+	}
+
+	return nil, 0, false
+}
+
+// Returns the position of the commit in the graph
+func (g *Graph) position(commitSha *sha.SHA) (uint32, bool) {
+	if g == nil {
+		return 0, false
+	}
+
+	// newer commits are in the top layers
+	for i := len(g.layers) - 1; i >= 0; i-- {
+		if idx, ok := g.layers[i].find(commitSha); ok {
+			return g.layers[i].offset + idx, true
+		}
+	}
+
+	return 0, false
+}
+
+func (g *Graph) oidAt(pos uint32) (*sha.SHA, bool) {
+	l, idx, ok := g.layerAt(pos)
+
+	if !ok {
+		return nil, false
+	}
+
+	return l.oid(idx), true
+}
+
+// Returns the parent positions of the commit, the ones after the first
+// are in the EDGE chunk for octopus merges
+func (g *Graph) parentPositions(l *layer, idx uint32) ([]uint32, bool) {
+	entry := l.data[idx*_CommitDataSize:]
+
+	first := binary.BigEndian.Uint32(entry[sha.BYTES_LEN:])
+	second := binary.BigEndian.Uint32(entry[sha.BYTES_LEN+4:])
+
+	if first == _ParentNone {
+		return nil, true
+	}
+
+	parents := []uint32{first}
+
+	switch {
+	case second == _ParentNone:
+	case second&_ExtraEdges == 0:
+		parents = append(parents, second)
+	default:
+		for edge := second &^ _ExtraEdges; ; edge++ {
+			if int(edge+1)*4 > len(l.edges) {
+				return nil, false
+			}
+
+			value := binary.BigEndian.Uint32(l.edges[edge*4:])
+			parents = append(parents, value&^_LastEdge)
+
+			if value&_LastEdge != 0 {
+				break
+			}
+		}
+	}
+
+	return parents, true
+}
+
+// Returns the topological level and the commit time packed in CDAT
+func commitDates(entry []byte) (uint32, int64) {
+	high := binary.BigEndian.Uint32(entry[sha.BYTES_LEN+8:])
+	low := binary.BigEndian.Uint32(entry[sha.BYTES_LEN+12:])
+
+	return high >> 2, int64(high&0x3)<<32 | int64(low)
+}
+
+// Corrected commit date of generation v2, the commit time and its offset
+func (l *layer) correctedDate(idx uint32, commitTime int64) (uint64, bool) {
+	offset := binary.BigEndian.Uint32(l.generations[idx*4:])
+
+	if offset&_ExtraEdges == 0 {
+		return uint64(commitTime) + uint64(offset), true
+	}
+
+	overflowIdx := offset &^ _ExtraEdges
+
+	if int(overflowIdx+1)*8 > len(l.generationOverflow) {
+		return 0, false
+	}
+
+	return uint64(commitTime) + binary.BigEndian.Uint64(l.generationOverflow[overflowIdx*8:]), true
+}
+
+func (g *Graph) commitAt(pos uint32) (*Commit, bool) {
+	l, idx, ok := g.layerAt(pos)
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := l.data[idx*_CommitDataSize : (idx+1)*_CommitDataSize]
+	treeHash := entry[:sha.BYTES_LEN]
+	tree, _ := sha.FromByteSlice(&treeHash)
+
+	level, commitTime := commitDates(entry)
+
+	c := &Commit{
+		SHA:        l.oid(idx),
+		Tree:       tree,
+		Time:       time.Unix(commitTime, 0),
+		Generation: uint64(level),
+	}
+
+	if g.generationV2 {
+		if c.Generation, ok = l.correctedDate(idx, commitTime); !ok {
+			return nil, false
+		}
+	}
+
+	parents, ok := g.parentPositions(l, idx)
+
+	if !ok {
+		return nil, false
+	}
+
+	for _, parentPos := range parents {
+		parent, ok := g.oidAt(parentPos)
+
+		if !ok {
+			return nil, false
+		}
+
+		c.Parents = append(c.Parents, parent)
+	}
+
+	return c, true
+}
+
+// Returns the commit if it's in the graph, corrupted entries are
+// treated as missing so the commit is read from the object instead
+func (g *Graph) Lookup(commitSha *sha.SHA) (*Commit, bool) {
+	pos, ok := g.position(commitSha)
+
+	if !ok {
+		return nil, false
+	}
+
+	return g.commitAt(pos)
+}
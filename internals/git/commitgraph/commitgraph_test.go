@@ -0,0 +1,159 @@
+package commitgraph_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// commits reachable from the tip of the testdata pack
+const _CommitCount = 76
+
+func setupRepo(t *testing.T) string {
+	t.Helper()
+
+	gitDir := t.TempDir()
+
+	testutils.StoreTestPack(t, gitDir)
+
+	return gitDir
+}
+
+func writeFile(t *testing.T, filePath, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatalf("failed to create dir %v", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write %s %v", filePath, err)
+	}
+}
+
+func writeGraph(t *testing.T, gitDir string, tip string, split commitgraph.SplitStrategy) {
+	t.Helper()
+
+	tipSha, _ := sha.FromString(tip)
+
+	if err := commitgraph.Write(gitDir, []*sha.SHA{tipSha}, commitgraph.WriteOptions{Split: split}); err != nil {
+		t.Fatalf("Write failed with err %v", err)
+	}
+}
+
+// Checks that the graph has the commits reachable from the tip with the
+// same parents, tree and time as the objects
+func assertGraph(t *testing.T, gitDir, tip string, count int) *commitgraph.Graph {
+	t.Helper()
+
+	gitFs := os.DirFS(gitDir)
+
+	graph, err := commitgraph.Load(gitFs)
+
+	if err != nil || graph == nil {
+		t.Fatalf("expected a graph but got %v %v", graph, err)
+	}
+
+	if graph.Len() != count {
+		t.Errorf("expected %d commits but got %d", count, graph.Len())
+	}
+
+	tipSha, _ := sha.FromString(tip)
+
+	w, _ := revlist.NewWalker(gitFs, []*sha.SHA{tipSha})
+
+	for {
+		c, err := w.Next()
+
+		if err != nil {
+			t.Fatalf("Next failed with err %v", err)
+		}
+
+		if c == nil {
+			break
+		}
+
+		expected, _ := revlist.ReadCommit(gitFs, c.SHA)
+		actual, ok := graph.Lookup(c.SHA)
+
+		if !ok {
+			t.Fatalf("expected %s to be in the graph", c.SHA)
+		}
+
+		if !actual.Tree.Eq(expected.Tree) || !actual.Time.Equal(expected.Time) || len(actual.Parents) != len(expected.Parents) {
+			t.Fatalf("expected %+v but got %+v", expected, actual)
+		}
+
+		for i, parent := range expected.Parents {
+			parentCommit, _ := graph.Lookup(parent)
+
+			if !actual.Parents[i].Eq(parent) || parentCommit.Generation >= actual.Generation {
+				t.Fatalf("expected parent %s with a smaller generation in %+v", parent, actual)
+			}
+		}
+	}
+
+	return graph
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("returns nil without a graph", func(t *testing.T) {
+		graph, err := commitgraph.Load(os.DirFS(setupRepo(t)))
+
+		if err != nil || graph != nil {
+			t.Errorf("expected no graph but got %v %v", graph, err)
+		}
+	})
+
+	gitDir := setupRepo(t)
+	writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.NoSplit)
+
+	t.Run("reads the commits", func(t *testing.T) {
+		graph := assertGraph(t, gitDir, testutils.PackTipSHA, _CommitCount)
+
+		if !graph.GenerationV2() {
+			t.Errorf("expected corrected commit dates as generations")
+		}
+
+		missing, _ := sha.FromString("1111111111111111111111111111111111111111")
+
+		if _, ok := graph.Lookup(missing); ok {
+			t.Errorf("expected missing commit to not be found")
+		}
+	})
+
+	t.Run("is disabled by core.commitGraph", func(t *testing.T) {
+		writeFile(t, path.Join(gitDir, "config"), "[core]\n\tcommitGraph = false\n")
+		defer os.Remove(path.Join(gitDir, "config"))
+
+		if graph, err := commitgraph.Load(os.DirFS(gitDir)); err != nil || graph != nil {
+			t.Errorf("expected no graph but got %v %v", graph, err)
+		}
+	})
+
+	t.Run("is not used in shallow repositories", func(t *testing.T) {
+		writeFile(t, path.Join(gitDir, "shallow"), testutils.PackRootSHA+"\n")
+		defer os.Remove(path.Join(gitDir, "shallow"))
+
+		if graph, err := commitgraph.Load(os.DirFS(gitDir)); err != nil || graph != nil {
+			t.Errorf("expected no graph but got %v %v", graph, err)
+		}
+	})
+
+	t.Run("fails for invalid graph", func(t *testing.T) {
+		graphPath := path.Join(gitDir, commitgraph.File)
+
+		os.Chmod(graphPath, 0644)
+		writeFile(t, graphPath, "CGPH")
+
+		if _, err := commitgraph.Load(os.DirFS(gitDir)); !errors.Is(err, commitgraph.ErrInvalidGraph) {
+			t.Errorf("expected ErrInvalidGraph but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package commitgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+type VerifyOptions struct {
+	// Only verifies the top layer of the chain
+	Shallow bool
+	// "Verifying commits in commit graph" progress, nil to disable
+	Progress io.Writer
+}
+
+// Checks the OID order and the fanout of the layer
+func verifyOIDs(l *layer) []string {
+	var problems []string
+
+	var fanout [_FanoutLen]uint32
+
+	for idx := uint32(0); idx < l.count; idx++ {
+		oid := l.oids[idx*sha.BYTES_LEN : (idx+1)*sha.BYTES_LEN]
+
+		if idx > 0 {
+			prev := l.oids[(idx-1)*sha.BYTES_LEN : idx*sha.BYTES_LEN]
+
+			if bytes.Compare(prev, oid) >= 0 {
+				problems = append(problems, fmt.Sprintf("commit-graph has incorrect OID order: %x then %x", prev, oid))
+			}
+		}
+
+		for i := int(oid[0]); i < _FanoutLen; i++ {
+			fanout[i]++
+		}
+	}
+
+	for i, expected := range fanout {
+		if actual := binary.BigEndian.Uint32(l.fanout[i*4:]); actual != expected {
+			problems = append(problems, fmt.Sprintf("commit-graph has incorrect fanout value: fanout[%d] = %d != %d", i, actual, expected))
+		}
+	}
+
+	return problems
+}
+
+// Compares the commits of the layer with the objects
+func (g *Graph) verifyCommits(gitFs fs.FS, l *layer, meter *progress.Meter) []string {
+	var problems []string
+
+	for idx := uint32(0); idx < l.count; idx++ {
+		meter.Add(1)
+
+		commitSha := l.oid(idx)
+
+		c, err := readCommit(gitFs, commitSha)
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to parse commit %s from object database for commit-graph", commitSha))
+			continue
+		}
+
+		entry := l.data[idx*_CommitDataSize : (idx+1)*_CommitDataSize]
+
+		if tree := entry[:sha.BYTES_LEN]; !bytes.Equal(tree, *c.tree.GetBytes()) {
+			problems = append(problems, fmt.Sprintf("root tree OID for commit %s in commit-graph is %x != %s", commitSha, tree, c.tree))
+		}
+
+		parents, ok := g.parentPositions(l, idx)
+
+		if !ok {
+			problems = append(problems, fmt.Sprintf("commit-graph has invalid edges for commit %s", commitSha))
+			continue
+		}
+
+		level, commitTime := commitDates(entry)
+
+		var maxLevel uint32
+		var maxCorrected uint64
+
+		for i, parentPos := range parents {
+			if i >= len(c.parents) {
+				problems = append(problems, fmt.Sprintf("commit-graph parent list for commit %s is too long", commitSha))
+				break
+			}
+
+			parentLayer, parentIdx, ok := g.layerAt(parentPos)
+
+			if !ok {
+				problems = append(problems, fmt.Sprintf("commit-graph parent position %d for %s is out of range", parentPos, commitSha))
+				continue
+			}
+
+			if parent := parentLayer.oid(parentIdx); !parent.Eq(c.parents[i]) {
+				problems = append(problems, fmt.Sprintf("commit-graph parent for %s is %s != %s", commitSha, parent, c.parents[i]))
+			}
+
+			parentEntry := parentLayer.data[parentIdx*_CommitDataSize:]
+			parentLevel, parentTime := commitDates(parentEntry)
+			maxLevel = max(maxLevel, parentLevel)
+
+			if g.generationV2 {
+				parentCorrected, _ := parentLayer.correctedDate(parentIdx, parentTime)
+				maxCorrected = max(maxCorrected, parentCorrected)
+			}
+		}
+
+		if len(parents) < len(c.parents) {
+			problems = append(problems, fmt.Sprintf("commit-graph parent list for commit %s terminates early", commitSha))
+		}
+
+		if expected := min(maxLevel+1, _GenerationV1Max); level < expected {
+			problems = append(problems, fmt.Sprintf("commit-graph generation for commit %s is %d < %d", commitSha, level, expected))
+		}
+
+		if g.generationV2 && len(parents) != 0 {
+			if corrected, _ := l.correctedDate(idx, commitTime); corrected < maxCorrected+1 {
+				problems = append(problems, fmt.Sprintf("commit-graph generation for commit %s is %d < %d", commitSha, corrected, maxCorrected+1))
+			}
+		}
+
+		if commitTime != c.time {
+			problems = append(problems, fmt.Sprintf("commit date for commit %s in commit-graph is %d != %d", commitSha, commitTime, c.time))
+		}
+	}
+
+	return problems
+}
+
+// Verifies the commit-graph like git commit-graph verify, the checksums
+// of the files, the OID order and fanout, and the commits against the
+// objects. Returns the problems found, the error is for the graphs which
+// couldn't be read
+func Verify(gitFs fs.FS, opts VerifyOptions) ([]string, error) {
+	files := []string{File}
+
+	if _, err := fs.Stat(gitFs, File); errors.Is(err, fs.ErrNotExist) {
+		files, err = readChain(gitFs)
+
+		// nothing to verify
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+
+	for _, filePath := range files {
+		data, err := fs.ReadFile(gitFs, filePath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = chunk.VerifyChecksum(data); err != nil {
+			problems = append(problems, "the commit-graph file has incorrect checksum and is likely corrupt")
+		}
+	}
+
+	graph, err := load(gitFs)
+
+	if err != nil {
+		return append(problems, err.Error()), nil
+	}
+
+	layers := graph.layers
+
+	if opts.Shallow {
+		layers = layers[len(layers)-1:]
+	}
+
+	var total uint64
+
+	for _, l := range layers {
+		total += uint64(l.count)
+	}
+
+	meter := progress.New(opts.Progress, "Verifying commits in commit graph", total)
+
+	for _, l := range layers {
+		if oidProblems := verifyOIDs(l); len(oidProblems) != 0 {
+			// lookups of the parents are not reliable without the order
+			problems = append(problems, oidProblems...)
+			continue
+		}
+
+		problems = append(problems, graph.verifyCommits(gitFs, l, meter)...)
+	}
+
+	meter.Done()
+
+	return problems, nil
+}
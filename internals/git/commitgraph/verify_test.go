@@ -0,0 +1,63 @@
+package commitgraph_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestVerify(t *testing.T) {
+	gitDir := setupRepo(t)
+
+	problems, err := commitgraph.Verify(os.DirFS(gitDir), commitgraph.VerifyOptions{})
+
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected nothing to verify but got %v %v", problems, err)
+	}
+
+	writeGraph(t, gitDir, testutils.PackParentSHA, commitgraph.Split)
+	writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.Split)
+
+	problems, err = commitgraph.Verify(os.DirFS(gitDir), commitgraph.VerifyOptions{})
+
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected a valid graph but got %v %v", problems, err)
+	}
+
+	t.Run("reports corrupted commits", func(t *testing.T) {
+		chain := readChain(t, gitDir)
+		graphPath := path.Join(gitDir, commitgraph.ChainDir, "graph-"+chain[0]+".graph")
+
+		data, _ := os.ReadFile(graphPath)
+
+		// commit time of the last commit, CDAT is followed by the GDA2
+		// chunk of the 75 commits and the checksum
+		data[len(data)-20-75*4-1] ^= 0x01
+
+		os.Chmod(graphPath, 0644)
+		os.WriteFile(graphPath, data, 0644)
+
+		problems, err := commitgraph.Verify(os.DirFS(gitDir), commitgraph.VerifyOptions{})
+
+		if err != nil {
+			t.Fatalf("Verify failed with err %v", err)
+		}
+
+		if len(problems) != 2 ||
+			!strings.Contains(problems[0], "incorrect checksum") ||
+			!strings.Contains(problems[1], "commit date for commit") {
+			t.Errorf("expected checksum and commit date problems but got %v", problems)
+		}
+
+		// the corrupted base layer is not verified
+		problems, _ = commitgraph.Verify(os.DirFS(gitDir), commitgraph.VerifyOptions{Shallow: true})
+
+		if len(problems) != 1 {
+			t.Errorf("expected only the checksum problem but got %v", problems)
+		}
+	})
+}
@@ -0,0 +1,577 @@
+package commitgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var ErrNotCommit = errors.New("object is not a commit")
+
+type SplitStrategy int
+
+const (
+	// Writes a single objects/info/commit-graph
+	NoSplit SplitStrategy = iota
+	// Adds a layer to the chain, merging the layers less than twice
+	// as big as the new one like git
+	Split
+	// Adds a layer without merging the layers below it
+	SplitNoMerge
+	// Merges all the layers into a single layer of the chain
+	SplitReplace
+)
+
+// Layers smaller than this multiple of the new layer are merged into it
+const _SplitSizeMultiple = 2
+
+type WriteOptions struct {
+	Split SplitStrategy
+	// Progress of finding the commits and computing the generations,
+	// nil to disable
+	Progress io.Writer
+}
+
+// Commit of the layer being written
+type graphCommit struct {
+	sha     *sha.SHA
+	tree    *sha.SHA
+	parents []*sha.SHA
+	time    int64
+	// topological level and corrected commit date
+	level     uint32
+	corrected uint64
+	computed  bool
+}
+
+type writer struct {
+	gitFs fs.FS
+	// graph on disk, commits are read from it before the objects
+	existing *Graph
+	// layers kept below the new one
+	base    []*layer
+	commits map[string]*graphCommit
+}
+
+// Parses the headers of the commit object needed by the graph
+func parseCommit(commitSha *sha.SHA, obj object.ObjectContents) (*graphCommit, error) {
+	if obj.ObjType != object.CommitObj {
+		return nil, fmt.Errorf("%w: %s", ErrNotCommit, commitSha)
+	}
+
+	headers, _, _ := strings.Cut(string(*obj.Contents), "\n\n")
+
+	c := &graphCommit{sha: commitSha}
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		var err error
+
+		switch key {
+		case "tree":
+			c.tree, err = sha.FromString(value)
+		case "parent":
+			var parentSha *sha.SHA
+			parentSha, err = sha.FromString(value)
+			c.parents = append(c.parents, parentSha)
+		case "committer":
+			// "Name <email> 1723625479 +0530"
+			fields := strings.Fields(value[strings.LastIndexByte(value, '>')+1:])
+
+			if len(fields) != 0 {
+				c.time, _ = strconv.ParseInt(fields[0], 10, 64)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.tree == nil {
+		return nil, fmt.Errorf("%w: %s has no tree", ErrNotCommit, commitSha)
+	}
+
+	return c, nil
+}
+
+func readCommit(gitFs fs.FS, commitSha *sha.SHA) (*graphCommit, error) {
+	obj, err := object.FromSHA(commitSha, gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCommit(commitSha, obj)
+}
+
+// Reads the commit from the graph on disk if it has it
+func (w *writer) read(commitSha *sha.SHA) (*graphCommit, error) {
+	if c, ok := w.existing.Lookup(commitSha); ok {
+		return &graphCommit{sha: c.SHA, tree: c.Tree, parents: c.Parents, time: c.Time.Unix()}, nil
+	}
+
+	return readCommit(w.gitFs, commitSha)
+}
+
+func (w *writer) inBase(commitSha *sha.SHA) bool {
+	for _, l := range w.base {
+		if _, ok := l.find(commitSha); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Adds the commits and their ancestors missing from the base layers
+func (w *writer) expand(commits []*sha.SHA, meter *progress.Meter) error {
+	stack := append([]*sha.SHA{}, commits...)
+
+	for len(stack) != 0 {
+		commitSha := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if w.commits[commitSha.String()] != nil || w.inBase(commitSha) {
+			continue
+		}
+
+		c, err := w.read(commitSha)
+
+		if err != nil {
+			return err
+		}
+
+		w.commits[commitSha.String()] = c
+		meter.Add(1)
+
+		stack = append(stack, c.parents...)
+	}
+
+	return nil
+}
+
+// Merges the top base layer into the new one
+func (w *writer) mergeTop() error {
+	top := w.base[len(w.base)-1]
+	w.base = w.base[:len(w.base)-1]
+
+	for idx := uint32(0); idx < top.count; idx++ {
+		c, err := w.read(top.oid(idx))
+
+		if err != nil {
+			return err
+		}
+
+		w.commits[c.sha.String()] = c
+	}
+
+	return nil
+}
+
+// Returns the position of the commit in the layers below the new one
+func (w *writer) basePosition(commitSha *sha.SHA) (uint32, bool) {
+	for i := len(w.base) - 1; i >= 0; i-- {
+		if idx, ok := w.base[i].find(commitSha); ok {
+			return w.base[i].offset + idx, true
+		}
+	}
+
+	return 0, false
+}
+
+// Returns the topological level and corrected commit date of a commit
+// of the base layers, the date is unknown if the layer has no GDA2
+func (w *writer) baseGenerations(commitSha *sha.SHA) (uint32, uint64, bool) {
+	pos, _ := w.basePosition(commitSha)
+	l, idx, _ := w.existing.layerAt(pos)
+
+	level, commitTime := commitDates(l.data[idx*_CommitDataSize:])
+
+	if l.generations == nil {
+		return level, 0, false
+	}
+
+	corrected, ok := l.correctedDate(idx, commitTime)
+
+	return level, corrected, ok
+}
+
+// Computes the generations of the commits, parents first. Returns false
+// if the corrected commit dates can't be computed as a base layer has none
+func (w *writer) computeGenerations(meter *progress.Meter) bool {
+	hasCorrected := true
+
+	for _, c := range w.commits {
+		stack := []*graphCommit{c}
+
+		for len(stack) != 0 {
+			top := stack[len(stack)-1]
+
+			if top.computed {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			var level uint32
+			corrected := uint64(top.time)
+			pending := false
+
+			for _, parentSha := range top.parents {
+				parent := w.commits[parentSha.String()]
+
+				var parentLevel uint32
+				var parentCorrected uint64
+
+				switch {
+				case parent == nil:
+					var ok bool
+					parentLevel, parentCorrected, ok = w.baseGenerations(parentSha)
+					hasCorrected = hasCorrected && ok
+				case !parent.computed:
+					stack = append(stack, parent)
+					pending = true
+
+					continue
+				default:
+					parentLevel, parentCorrected = parent.level, parent.corrected
+				}
+
+				level = max(level, parentLevel)
+				corrected = max(corrected, parentCorrected+1)
+			}
+
+			if pending {
+				continue
+			}
+
+			top.level = min(level+1, _GenerationV1Max)
+			top.corrected = corrected
+			top.computed = true
+			meter.Add(1)
+
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return hasCorrected
+}
+
+// Encodes the commits sorted by SHA into the graph file
+func (w *writer) encode(sorted []*graphCommit, withCorrected bool) []byte {
+	var baseCount uint32
+
+	for _, l := range w.base {
+		baseCount += l.count
+	}
+
+	positions := make(map[string]uint32, len(sorted))
+
+	for idx, c := range sorted {
+		positions[c.sha.String()] = baseCount + uint32(idx)
+	}
+
+	position := func(commitSha *sha.SHA) uint32 {
+		if pos, ok := positions[commitSha.String()]; ok {
+			return pos
+		}
+
+		pos, _ := w.basePosition(commitSha)
+
+		return pos
+	}
+
+	fanout := make([]byte, _FanoutLen*4)
+	oids := make([]byte, 0, len(sorted)*sha.BYTES_LEN)
+	data := make([]byte, 0, len(sorted)*_CommitDataSize)
+	generations := make([]byte, 0, len(sorted)*4)
+
+	var edges, overflow []byte
+
+	for idx, c := range sorted {
+		hash := *c.sha.GetBytes()
+
+		for i := int(hash[0]); i < _FanoutLen; i++ {
+			binary.BigEndian.PutUint32(fanout[i*4:], uint32(idx+1))
+		}
+
+		oids = append(oids, hash...)
+		data = append(data, *c.tree.GetBytes()...)
+
+		first, second := uint32(_ParentNone), uint32(_ParentNone)
+
+		switch len(c.parents) {
+		case 0:
+		case 1:
+			first = position(c.parents[0])
+		case 2:
+			first, second = position(c.parents[0]), position(c.parents[1])
+		default:
+			first = position(c.parents[0])
+			second = _ExtraEdges | uint32(len(edges)/4)
+
+			for i, parent := range c.parents[1:] {
+				edge := position(parent)
+
+				if i == len(c.parents)-2 {
+					edge |= _LastEdge
+				}
+
+				edges = binary.BigEndian.AppendUint32(edges, edge)
+			}
+		}
+
+		data = binary.BigEndian.AppendUint32(data, first)
+		data = binary.BigEndian.AppendUint32(data, second)
+		data = binary.BigEndian.AppendUint32(data, c.level<<2|uint32(c.time>>32)&0x3)
+		data = binary.BigEndian.AppendUint32(data, uint32(c.time))
+
+		offset := c.corrected - uint64(c.time)
+
+		if offset > _GenerationV2OffsetMax {
+			generations = binary.BigEndian.AppendUint32(generations, _ExtraEdges|uint32(len(overflow)/8))
+			overflow = binary.BigEndian.AppendUint64(overflow, offset)
+		} else {
+			generations = binary.BigEndian.AppendUint32(generations, uint32(offset))
+		}
+	}
+
+	chunks := []chunk.Chunk{
+		{ID: "OIDF", Data: fanout},
+		{ID: "OIDL", Data: oids},
+		{ID: "CDAT", Data: data},
+	}
+
+	if withCorrected {
+		chunks = append(chunks, chunk.Chunk{ID: "GDA2", Data: generations})
+
+		if len(overflow) != 0 {
+			chunks = append(chunks, chunk.Chunk{ID: "GDO2", Data: overflow})
+		}
+	}
+
+	if len(edges) != 0 {
+		chunks = append(chunks, chunk.Chunk{ID: "EDGE", Data: edges})
+	}
+
+	var bases []byte
+
+	for _, l := range w.base {
+		bases = append(bases, *l.checksum.GetBytes()...)
+	}
+
+	if len(bases) != 0 {
+		chunks = append(chunks, chunk.Chunk{ID: "BASE", Data: bases})
+	}
+
+	header := append(append([]byte{}, _Signature...), _Version, _HashSHA1, byte(len(chunks)), byte(len(w.base)))
+
+	return chunk.Write(header, chunks)
+}
+
+// Writes the file through a lock file, so readers never see it partially
+func writeLocked(filePath string, data []byte) error {
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	lockPath := filePath + ".lock"
+
+	if err := os.WriteFile(lockPath, data, 0444); err != nil {
+		return err
+	}
+
+	return os.Rename(lockPath, filePath)
+}
+
+// Removes the chain and the graph files which are not in the chain
+func removeStaleLayers(gitDir string, chain []string) error {
+	inChain := make(map[string]bool, len(chain))
+
+	for _, checksum := range chain {
+		inChain["graph-"+checksum+".graph"] = true
+	}
+
+	entries, err := os.ReadDir(path.Join(gitDir, ChainDir))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if inChain[entry.Name()] || entry.Name() == path.Base(Chain) && len(chain) != 0 {
+			continue
+		}
+
+		if err = os.Remove(path.Join(gitDir, ChainDir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes the commit-graph of the commits and all their ancestors like
+// git commit-graph write. Nothing is written in a shallow repository
+func Write(gitDir string, commits []*sha.SHA, opts WriteOptions) error {
+	gitFs := os.DirFS(gitDir)
+
+	shallowCommits, err := shallow.Read(gitFs)
+
+	if err != nil || len(shallowCommits) != 0 {
+		return err
+	}
+
+	// a corrupted graph is rewritten from the objects
+	existing, _ := load(gitFs)
+
+	w := &writer{
+		gitFs:    gitFs,
+		existing: existing,
+		commits:  make(map[string]*graphCommit),
+	}
+
+	_, singleErr := fs.Stat(gitFs, File)
+
+	// layers of a single graph file can't be the base of a chain
+	if opts.Split != NoSplit && existing != nil && singleErr != nil {
+		w.base = existing.layers
+	}
+
+	meter := progress.New(opts.Progress, "Expanding reachable commits in commit graph", 0)
+
+	if err = w.expand(commits, meter); err != nil {
+		return err
+	}
+
+	meter.Done()
+
+	for len(w.base) != 0 {
+		top := w.base[len(w.base)-1]
+
+		if opts.Split == SplitNoMerge || opts.Split == Split && top.count > uint32(len(w.commits))*_SplitSizeMultiple {
+			break
+		}
+
+		if err = w.mergeTop(); err != nil {
+			return err
+		}
+	}
+
+	// nothing new for the chain
+	if opts.Split != NoSplit && len(w.commits) == 0 && singleErr != nil {
+		return nil
+	}
+
+	meter = progress.New(opts.Progress, "Computing commit graph generation numbers", uint64(len(w.commits)))
+	withCorrected := w.computeGenerations(meter)
+	meter.Done()
+
+	sorted := make([]*graphCommit, 0, len(w.commits))
+
+	for _, c := range w.commits {
+		sorted = append(sorted, c)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(*sorted[i].sha.GetBytes(), *sorted[j].sha.GetBytes()) < 0
+	})
+
+	data := w.encode(sorted, withCorrected)
+
+	if opts.Split == NoSplit {
+		if err = writeLocked(path.Join(gitDir, File), data); err != nil {
+			return err
+		}
+
+		return removeStaleLayers(gitDir, nil)
+	}
+
+	checksum := fmt.Sprintf("%x", data[len(data)-sha.BYTES_LEN:])
+
+	if err = writeLocked(path.Join(gitDir, ChainDir, "graph-"+checksum+".graph"), data); err != nil {
+		return err
+	}
+
+	var chain []string
+
+	for _, l := range w.base {
+		chain = append(chain, l.checksum.String())
+	}
+
+	chain = append(chain, checksum)
+
+	if err = writeLocked(path.Join(gitDir, Chain), []byte(strings.Join(chain, "\n")+"\n")); err != nil {
+		return err
+	}
+
+	// the single file takes precedence over the chain
+	if err = os.Remove(path.Join(gitDir, File)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return removeStaleLayers(gitDir, chain)
+}
+
+// Returns the commits of all the packs, git commit-graph write
+// uses them when no commits are given
+func PackedCommits(gitFs fs.FS, progressOut io.Writer) ([]*sha.SHA, error) {
+	packList, err := pack.ListPacks(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	meter := progress.New(progressOut, "Finding commits for commit graph among packed objects", 0)
+
+	var commits []*sha.SHA
+
+	for _, p := range packList {
+		packFile, err := p.Open(gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, objSha := range p.Idx.Objects() {
+			obj, err := packFile.GetObj(objSha)
+
+			if err != nil {
+				packFile.Close()
+				return nil, err
+			}
+
+			if obj.ObjType == object.CommitObj {
+				commits = append(commits, objSha)
+			}
+
+			meter.Add(1)
+		}
+
+		packFile.Close()
+	}
+
+	meter.Done()
+
+	return commits, nil
+}
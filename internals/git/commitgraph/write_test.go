@@ -0,0 +1,151 @@
+package commitgraph_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func readChain(t *testing.T, gitDir string) []string {
+	t.Helper()
+
+	contents, err := os.ReadFile(path.Join(gitDir, commitgraph.Chain))
+
+	if err != nil {
+		t.Fatalf("failed to read chain %v", err)
+	}
+
+	return strings.Fields(string(contents))
+}
+
+func TestWrite(t *testing.T) {
+	t.Run("writes split chains", func(t *testing.T) {
+		gitDir := setupRepo(t)
+
+		writeGraph(t, gitDir, testutils.PackParentSHA, commitgraph.Split)
+		writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.Split)
+
+		// the base is more than twice as big as the new layer
+		chain := readChain(t, gitDir)
+
+		if len(chain) != 2 {
+			t.Fatalf("expected 2 layers but got %v", chain)
+		}
+
+		assertGraph(t, gitDir, testutils.PackTipSHA, _CommitCount)
+
+		writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.SplitReplace)
+
+		if chain = readChain(t, gitDir); len(chain) != 1 {
+			t.Fatalf("expected a single layer but got %v", chain)
+		}
+
+		assertGraph(t, gitDir, testutils.PackTipSHA, _CommitCount)
+
+		entries, _ := os.ReadDir(path.Join(gitDir, commitgraph.ChainDir))
+
+		if len(entries) != 2 {
+			t.Errorf("expected the replaced layers to be removed but got %d files", len(entries))
+		}
+	})
+
+	t.Run("merges the small layers", func(t *testing.T) {
+		gitDir := setupRepo(t)
+
+		writeGraph(t, gitDir, testutils.PackRootSHA, commitgraph.Split)
+		writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.SplitNoMerge)
+
+		if chain := readChain(t, gitDir); len(chain) != 2 {
+			t.Fatalf("expected 2 layers but got %v", chain)
+		}
+
+		writeGraph(t, gitDir, testutils.PackRootSHA, commitgraph.Split)
+		writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.Split)
+
+		if chain := readChain(t, gitDir); len(chain) != 2 {
+			t.Fatalf("expected nothing new to not add a layer but got %v", chain)
+		}
+	})
+
+	t.Run("replaces the chain with a single file", func(t *testing.T) {
+		gitDir := setupRepo(t)
+
+		writeGraph(t, gitDir, testutils.PackParentSHA, commitgraph.Split)
+		writeGraph(t, gitDir, testutils.PackTipSHA, commitgraph.NoSplit)
+
+		if _, err := os.Stat(path.Join(gitDir, commitgraph.ChainDir, "commit-graph-chain")); !os.IsNotExist(err) {
+			t.Errorf("expected the chain to be removed but got %v", err)
+		}
+
+		assertGraph(t, gitDir, testutils.PackTipSHA, _CommitCount)
+	})
+
+	t.Run("writes octopus merges", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		treeSha := testutils.WriteObj(t, gitDir, object.TreeObj, "")
+
+		commit := func(message string, time int64, parents ...*sha.SHA) *sha.SHA {
+			contents := "tree " + treeSha.String() + "\n"
+
+			for _, parent := range parents {
+				contents += "parent " + parent.String() + "\n"
+			}
+
+			ident := fmt.Sprintf("A <a@b.c> %d +0000", time)
+
+			return testutils.WriteObj(t, gitDir, object.CommitObj, contents+"author "+ident+"\ncommitter "+ident+"\n\n"+message+"\n")
+		}
+
+		// the clock of the second root is ahead of its child
+		first := commit("first", 1700000000)
+		second := commit("second", 1800000000)
+		third := commit("third", 1700000000, first)
+		merge := commit("merge", 1700000100, first, second, third)
+
+		writeGraph(t, gitDir, merge.String(), commitgraph.NoSplit)
+
+		graph := assertGraph(t, gitDir, merge.String(), 4)
+
+		c, _ := graph.Lookup(merge)
+
+		testutils.AssertString(t, "parents", first.String()+second.String()+third.String(),
+			c.Parents[0].String()+c.Parents[1].String()+c.Parents[2].String())
+
+		if c.Generation != 1800000001 {
+			t.Errorf("expected corrected commit date 1800000001 but got %d", c.Generation)
+		}
+	})
+
+	t.Run("fails for non commits", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		blobSha := testutils.WriteObj(t, gitDir, object.BlobObj, "blob")
+
+		if err := commitgraph.Write(gitDir, []*sha.SHA{blobSha}, commitgraph.WriteOptions{}); err == nil {
+			t.Errorf("expected an error for a blob")
+		}
+	})
+}
+
+func TestPackedCommits(t *testing.T) {
+	gitDir := setupRepo(t)
+
+	commits, err := commitgraph.PackedCommits(os.DirFS(gitDir), nil)
+
+	if err != nil {
+		t.Fatalf("PackedCommits failed with err %v", err)
+	}
+
+	// the pack has 2 commits not reachable from the tip
+	if len(commits) != _CommitCount+2 {
+		t.Errorf("expected %d commits but got %d", _CommitCount+2, len(commits))
+	}
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 )
 
@@ -17,12 +20,26 @@ func (user User) String() string {
 	return fmt.Sprintf("%s <%s>", user.Name, user.Email)
 }
 
+type entry struct {
+	// Normalised key, section and name are lowercased
+	// but subsection is kept as is. ex: remote.origin.url
+	key   string
+	value string
+}
+
 type Config struct {
 	User User
+
+	entries []entry
 }
 
+var ErrInvalidConfig = fmt.Errorf("invalid config file")
+
 const _GLOBAL_CONFIG_PATH = ".gitconfig"
 
+// Name of the repository config file inside the git dir
+const RepoConfigFile = "config"
+
 func getConfigFilePath() (string, error) {
 	configPathOverwrite := os.Getenv("GIT_CONFIG")
 
@@ -39,32 +56,74 @@ func getConfigFilePath() (string, error) {
 
 }
 
-func userSectionParser(sectionLines []string, config *Config) error {
+// Lowercases the section and the name but keeps the subsection
+// as it is, as subsections are case sensitive
+func normaliseKey(key string) string {
+	firstDot := strings.IndexByte(key, '.')
+	lastDot := strings.LastIndexByte(key, '.')
 
-	for _, line := range sectionLines {
-		line = strings.Trim(line, "\t")
+	if firstDot == -1 {
+		return strings.ToLower(key)
+	}
 
-		splittedLine := strings.Split(line, " = ")
+	return strings.ToLower(key[:firstDot]) + key[firstDot:lastDot] + strings.ToLower(key[lastDot:])
+}
 
-		if len(splittedLine) != 2 {
-			break
-		}
+func parseSectionHeader(line string) (string, error) {
+	endIdx := strings.LastIndexByte(line, ']')
 
-		key := splittedLine[0]
-		value := splittedLine[1]
+	if endIdx == -1 {
+		return "", ErrInvalidConfig
+	}
 
-		switch key {
-		case "name":
-			config.User.Name = value
-		case "email":
-			config.User.Email = value
-		}
+	header := strings.TrimSpace(line[1:endIdx])
+
+	quoteIdx := strings.IndexByte(header, '"')
+
+	if quoteIdx == -1 {
+		// deprecated [section.subsection] syntax is also handled here
+		return strings.ToLower(header), nil
 	}
-	return nil
+
+	section := strings.TrimSpace(header[:quoteIdx])
+	subsection := strings.TrimSuffix(header[quoteIdx+1:], `"`)
+	subsection = strings.ReplaceAll(subsection, `\"`, `"`)
+	subsection = strings.ReplaceAll(subsection, `\\`, `\`)
+
+	return strings.ToLower(section) + "." + subsection, nil
 }
 
-var _SECTION_PARSER_MAP = map[string]func(sectionLines []string, c *Config) error{
-	"user": userSectionParser,
+func parseValue(raw string) string {
+	var sb strings.Builder
+
+	inQuote := false
+
+	raw = strings.TrimSpace(raw)
+
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+
+		switch {
+		case ch == '"':
+			inQuote = !inQuote
+		case ch == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(raw[i])
+			}
+		case (ch == '#' || ch == ';') && !inQuote:
+			return strings.TrimSpace(sb.String())
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+
+	return strings.TrimRight(sb.String(), " \t")
 }
 
 func New(reader io.Reader) (*Config, error) {
@@ -77,49 +136,202 @@ func New(reader io.Reader) (*Config, error) {
 	// TODO: i want to use bufio here
 	// but the config files are really small imo
 	// plus idc about perf rn, we can improve later
-	configFile := string(configFileBytes)
+	lines := strings.Split(string(configFileBytes), "\n")
 
 	config := &Config{}
 
-	lines := strings.Split(configFile, "\n")
+	section := ""
 
-	for idx := range len(lines) {
-		line := lines[idx]
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
 
-		if line == "" {
-			break
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
 		}
 
-		if strings.HasPrefix(line, "[") {
-			// section header
-			sectionName := line[1 : len(line)-1]
+		if line[0] == '[' {
+			section, err = parseSectionHeader(line)
 
-			sectionParser, hasParser := _SECTION_PARSER_MAP[sectionName]
+			if err != nil {
+				return nil, err
+			}
 
-			if hasParser {
+			continue
+		}
 
-				var section []string
+		if section == "" {
+			return nil, ErrInvalidConfig
+		}
 
-				idx++
-				for ; idx < len(lines)-1 && lines[idx][0] != '['; idx++ {
-					section = append(section, lines[idx])
-				}
+		name, value, hasValue := strings.Cut(line, "=")
 
-				// need to do it coz range also autoincrements
-				idx--
+		name = strings.TrimSpace(name)
 
-				err = sectionParser(section, config)
+		if !hasValue {
+			// A variable without "=" is a boolean true
+			value = "true"
+		} else {
+			value = parseValue(value)
+		}
 
-				if err != nil {
-					return config, err
-				}
+		config.add(section+"."+name, value)
+	}
 
-			}
+	return config, nil
+}
+
+func (c *Config) add(key, value string) {
+	key = normaliseKey(key)
+
+	c.entries = append(c.entries, entry{
+		key:   key,
+		value: value,
+	})
+
+	switch key {
+	case "user.name":
+		c.User.Name = value
+	case "user.email":
+		c.User.Email = value
+	}
+}
+
+// Returns the last value set for the key, later files
+// override the earlier ones like git does
+func (c *Config) Get(key string) (string, bool) {
+	key = normaliseKey(key)
+
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		if c.entries[i].key == key {
+			return c.entries[i].value, true
 		}
+	}
 
+	return "", false
+}
+
+// Returns all the values for a multi-valued key in order
+func (c *Config) GetAll(key string) []string {
+	key = normaliseKey(key)
+
+	var values []string
+
+	for _, e := range c.entries {
+		if e.key == key {
+			values = append(values, e.value)
+		}
 	}
 
-	return config, nil
+	return values
+}
+
+// Parses a boolean like git, an empty value from "key =" is false
+// while a key without "=" is already parsed as true
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("bad boolean config value '%s'", value)
+}
+
+func (c *Config) GetBool(key string, defaultValue bool) bool {
+	value, ok := c.Get(key)
+
+	return parseBoolOr(value, ok, defaultValue)
+}
+
+func parseBoolOr(value string, ok bool, defaultValue bool) bool {
+	if !ok {
+		return defaultValue
+	}
+
+	b, err := ParseBool(value)
+
+	if err != nil {
+		return defaultValue
+	}
+
+	return b
+}
+
+// Parses integers with optional k, m or g suffix
+func (c *Config) GetInt(key string, defaultValue int) int {
+	value, ok := c.Get(key)
+
+	return parseIntOr(value, ok, defaultValue)
+}
+
+func parseIntOr(value string, ok bool, defaultValue int) int {
+	if !ok || value == "" {
+		return defaultValue
+	}
+
+	multiplier := 1
+
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		multiplier = 1024
+	case "m":
+		multiplier = 1024 * 1024
+	case "g":
+		multiplier = 1024 * 1024 * 1024
+	}
+
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	num, err := strconv.Atoi(value)
+
+	if err != nil {
+		return defaultValue
+	}
+
+	return num * multiplier
+}
+
+// Returns the subsections present for a section
+// ex: Subsections("remote") would return ["origin"]
+func (c *Config) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + "."
+
+	var subsections []string
+	seen := make(map[string]bool)
+
+	for _, e := range c.entries {
+		if !strings.HasPrefix(e.key, prefix) {
+			continue
+		}
+
+		rest := e.key[len(prefix):]
+
+		lastDot := strings.LastIndexByte(rest, '.')
+
+		if lastDot == -1 {
+			continue
+		}
+
+		subsection := rest[:lastDot]
+
+		if !seen[subsection] {
+			seen[subsection] = true
+			subsections = append(subsections, subsection)
+		}
+	}
+
+	return subsections
+}
+
+// Appends the entries of other config, so that its values
+// take precedence over the current config
+func (c *Config) Merge(other *Config) {
+	for _, e := range other.entries {
+		c.add(e.key, e.value)
+	}
 }
 
 func FromFile() (*Config, error) {
@@ -136,6 +348,48 @@ func FromFile() (*Config, error) {
 		return nil, err
 	}
 
+	defer configFile.Close()
+
 	return New(configFile)
 
 }
+
+// Loads the global config and merges the repository config
+// present in the git dir on top of it. Missing files are ignored
+func Load(gitFs fs.FS) (*Config, error) {
+	c, err := FromFile()
+
+	if errors.Is(err, fs.ErrNotExist) {
+		c, err = &Config{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if gitFs == nil {
+		return c, nil
+	}
+
+	repoConfigFile, err := gitFs.Open(RepoConfigFile)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer repoConfigFile.Close()
+
+	repoConfig, err := New(repoConfigFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Merge(repoConfig)
+
+	return c, nil
+}
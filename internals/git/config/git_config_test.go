@@ -6,6 +6,7 @@ import (
 	"path"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/uragirii/got/internals/git/config"
@@ -67,3 +68,134 @@ func TestFromFile(t *testing.T) {
 	assertConfig(c, t)
 
 }
+
+func TestGet(t *testing.T) {
+	c, err := config.New(strings.NewReader(`# comment
+[core]
+	bare = false
+	ignoreCase
+	logAllRefUpdates =
+[remote "origin"]
+	url = "https://example.com/repo.git" ; trailing comment
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[Remote "Upstream"]
+	URL = https://example.com/upstream.git
+`))
+
+	if err != nil {
+		t.Fatalf("Failed with err %v", err)
+	}
+
+	url, ok := c.Get("remote.origin.url")
+
+	if !ok {
+		t.Fatalf("expected remote.origin.url to be set")
+	}
+
+	testutils.AssertString(t, "url", "https://example.com/repo.git", url)
+
+	upstreamUrl, _ := c.Get("remote.Upstream.url")
+
+	testutils.AssertString(t, "case insensitive section and name", "https://example.com/upstream.git", upstreamUrl)
+
+	if _, ok := c.Get("remote.upstream.url"); ok {
+		t.Errorf("subsections should be case sensitive")
+	}
+
+	if len(c.GetAll("remote.origin.fetch")) != 2 {
+		t.Errorf("expected 2 fetch refspecs but got %d", len(c.GetAll("remote.origin.fetch")))
+	}
+
+	if c.GetBool("core.bare", true) {
+		t.Errorf("expected core.bare to be false")
+	}
+
+	if !c.GetBool("core.ignorecase", false) {
+		t.Errorf("expected key without value to be true")
+	}
+
+	if c.GetBool("core.logallrefupdates", true) {
+		t.Errorf("expected empty value to be false")
+	}
+
+	testutils.AssertString(t, "subsections", "origin,Upstream", strings.Join(c.Subsections("remote"), ","))
+}
+
+func TestLoad(t *testing.T) {
+	tempDir := t.TempDir()
+
+	globalConfigFile := path.Join(tempDir, "global")
+
+	if err := os.WriteFile(globalConfigFile, []byte(TEST_CONFIG_FILE), 0644); err != nil {
+		t.Fatalf("Failed to create temp file %v", err)
+	}
+
+	t.Setenv("GIT_CONFIG", globalConfigFile)
+
+	gitFs := fstest.MapFS{
+		"config": {Data: []byte("[user]\n\temail = repo@idc.com\n")},
+	}
+
+	c, err := config.Load(gitFs)
+
+	if err != nil {
+		t.Fatalf("Failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "name from global", TEST_USER_NAME, c.User.Name)
+	testutils.AssertString(t, "email from repo", "repo@idc.com", c.User.Email)
+}
+
+func TestSet(t *testing.T) {
+	configFile := path.Join(t.TempDir(), "config")
+
+	if err := os.WriteFile(configFile, []byte("[core]\n\tbare = false\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp file %v", err)
+	}
+
+	steps := []struct {
+		fn    func(string, string, string) error
+		key   string
+		value string
+	}{
+		{config.Set, "remote.origin.url", "https://example.com/repo.git"},
+		{config.Set, "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"},
+		{config.Add, "remote.origin.fetch", "+refs/tags/*:refs/tags/*"},
+		{config.Set, "core.bare", "true"},
+		{config.Set, "branch.main.merge", "refs/heads/main"},
+		{config.Set, "remote.origin.url", "https://example.com/moved.git"},
+	}
+
+	for _, step := range steps {
+		if err := step.fn(configFile, step.key, step.value); err != nil {
+			t.Fatalf("failed to set %s with err %v", step.key, err)
+		}
+	}
+
+	contents, err := os.ReadFile(configFile)
+
+	if err != nil {
+		t.Fatalf("Failed to read config %v", err)
+	}
+
+	expected := `[core]
+	bare = true
+[remote "origin"]
+	url = https://example.com/moved.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[branch "main"]
+	merge = refs/heads/main
+`
+
+	testutils.AssertString(t, "config file", expected, string(contents))
+
+	c, err := config.New(strings.NewReader(string(contents)))
+
+	if err != nil {
+		t.Fatalf("Failed to parse written config %v", err)
+	}
+
+	testutils.AssertString(t, "fetch", "+refs/tags/*:refs/tags/*", c.GetAll("remote.origin.fetch")[1])
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+var _DefaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+func portOf(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	return _DefaultPorts[u.Scheme]
+}
+
+// Host labels must match one by one, * in the pattern matches one label
+func hostMatches(pattern, host string) bool {
+	patternLabels := strings.Split(strings.ToLower(pattern), ".")
+	hostLabels := strings.Split(strings.ToLower(host), ".")
+
+	if len(patternLabels) != len(hostLabels) {
+		return false
+	}
+
+	for idx, label := range patternLabels {
+		if label != "*" && label != hostLabels[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matches the url of a subsection like http.<url>.* with the target url,
+// the score is higher for more specific matches. A longer path is more
+// specific than the user name
+// @see https://git-scm.com/docs/git-config#Documentation/git-config.txt-httplturlgt
+func urlMatch(pattern string, target *url.URL) (int, bool) {
+	p, err := url.Parse(pattern)
+
+	if err != nil || p.Host == "" {
+		return 0, false
+	}
+
+	if !strings.EqualFold(p.Scheme, target.Scheme) ||
+		!hostMatches(p.Hostname(), target.Hostname()) ||
+		portOf(p) != portOf(target) {
+		return 0, false
+	}
+
+	patternPath := strings.TrimSuffix(p.Path, "/")
+	targetPath := strings.TrimSuffix(target.Path, "/")
+
+	if patternPath != "" && patternPath != targetPath && !strings.HasPrefix(targetPath, patternPath+"/") {
+		return 0, false
+	}
+
+	score := 2 * (len(patternPath) + 1)
+
+	if p.User != nil {
+		if target.User == nil || p.User.Username() != target.User.Username() {
+			return 0, false
+		}
+
+		score++
+	}
+
+	return score, true
+}
+
+// Returns the score of the entry for the key and the target url, -1 for
+// the key without a subsection. ok is false if the entry doesn't apply
+func (e entry) urlScore(key string, target *url.URL) (int, bool) {
+	if e.key == key {
+		return -1, true
+	}
+
+	section, name, _ := strings.Cut(key, ".")
+
+	rest, found := strings.CutPrefix(e.key, section+".")
+
+	if !found {
+		return 0, false
+	}
+
+	subsection, found := strings.CutSuffix(rest, "."+name)
+
+	if !found || target == nil {
+		return 0, false
+	}
+
+	return urlMatch(subsection, target)
+}
+
+// Returns the value of section.name from the most specific section.<url>.name
+// matching the url, falling back to section.name. ex: GetURL("http.sslVerify", url)
+func (c *Config) GetURL(key, rawURL string) (string, bool) {
+	key = normaliseKey(key)
+	target, _ := url.Parse(rawURL)
+
+	value, best, found := "", 0, false
+
+	for _, e := range c.entries {
+		score, ok := e.urlScore(key, target)
+
+		// later values override the earlier ones of same specificity
+		if ok && (!found || score >= best) {
+			value, best, found = e.value, score, true
+		}
+	}
+
+	return value, found
+}
+
+// Returns all the values of the multi-valued key from every section
+// matching the url in order, an empty value resets the earlier ones
+func (c *Config) GetAllURL(key, rawURL string) []string {
+	key = normaliseKey(key)
+	target, _ := url.Parse(rawURL)
+
+	var values []string
+
+	for _, e := range c.entries {
+		if _, ok := e.urlScore(key, target); !ok {
+			continue
+		}
+
+		if e.value == "" {
+			values = nil
+			continue
+		}
+
+		values = append(values, e.value)
+	}
+
+	return values
+}
+
+func (c *Config) GetBoolURL(key, rawURL string, defaultValue bool) bool {
+	value, ok := c.GetURL(key, rawURL)
+
+	return parseBoolOr(value, ok, defaultValue)
+}
+
+func (c *Config) GetIntURL(key, rawURL string, defaultValue int) int {
+	value, ok := c.GetURL(key, rawURL)
+
+	return parseIntOr(value, ok, defaultValue)
+}
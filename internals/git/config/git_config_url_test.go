@@ -0,0 +1,69 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const TEST_URL_CONFIG_FILE = `[http]
+	sslVerify = true
+	extraHeader = X-Global: 1
+[http "https://example.com"]
+	sslVerify = false
+	extraHeader = X-Host: 1
+[http "https://example.com/org/repo.git"]
+	proxy = repo-proxy
+[http "https://example.com/org"]
+	proxy = org-proxy
+[http "https://user@example.com"]
+	proxy = user-proxy
+[http "https://*.example.org:8443"]
+	lowSpeedLimit = 1k
+[http "https://other.com"]
+	extraHeader =
+	extraHeader = X-Other: 1
+`
+
+func TestGetURL(t *testing.T) {
+	c, err := config.New(strings.NewReader(TEST_URL_CONFIG_FILE))
+
+	if err != nil {
+		t.Fatalf("New failed with err %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		url      string
+		expected string
+	}{
+		{"falls back to the section", "http.sslVerify", "https://other.com/repo.git", "true"},
+		{"host match", "http.sslVerify", "https://example.com/org/repo.git", "false"},
+		{"scheme must match", "http.sslVerify", "http://example.com/repo.git", "true"},
+		{"default port", "http.sslVerify", "https://example.com:443/repo.git", "false"},
+		{"longest path wins", "http.proxy", "https://example.com/org/repo.git/", "repo-proxy"},
+		{"path on segment boundary", "http.proxy", "https://example.com/organization/repo.git", ""},
+		{"path wins over user", "http.proxy", "https://user@example.com/org/other.git", "org-proxy"},
+		{"user match", "http.proxy", "https://user@example.com/repo.git", "user-proxy"},
+		{"wildcard label", "http.lowSpeedLimit", "https://git.example.org:8443/repo.git", "1k"},
+		{"wildcard needs same labels", "http.lowSpeedLimit", "https://a.git.example.org:8443/repo.git", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, _ := c.GetURL(test.key, test.url)
+
+			testutils.AssertString(t, test.key, test.expected, value)
+		})
+	}
+
+	if limit := c.GetIntURL("http.lowSpeedLimit", "https://git.example.org:8443", 0); limit != 1024 {
+		t.Errorf("expected lowSpeedLimit 1024 but got %d", limit)
+	}
+
+	testutils.AssertString(t, "extraHeader", "X-Global: 1,X-Host: 1", strings.Join(c.GetAllURL("http.extraHeader", "https://example.com/repo.git"), ","))
+	testutils.AssertString(t, "reset extraHeader", "X-Other: 1", strings.Join(c.GetAllURL("http.extraHeader", "https://other.com/repo.git"), ","))
+}
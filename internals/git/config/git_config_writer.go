@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Splits remote.origin.url into remote, origin and url
+func splitKey(key string) (section, subsection, name string, err error) {
+	firstDot := strings.IndexByte(key, '.')
+	lastDot := strings.LastIndexByte(key, '.')
+
+	if firstDot == -1 || lastDot == len(key)-1 || firstDot == 0 {
+		return "", "", "", fmt.Errorf("%w: key does not contain a section: %s", ErrInvalidConfig, key)
+	}
+
+	section = strings.ToLower(key[:firstDot])
+	name = key[lastDot+1:]
+
+	if firstDot != lastDot {
+		subsection = key[firstDot+1 : lastDot]
+	}
+
+	return section, subsection, name, nil
+}
+
+func formatSectionHeader(section, subsection string) string {
+	if subsection == "" {
+		return fmt.Sprintf("[%s]", section)
+	}
+
+	subsection = strings.ReplaceAll(subsection, `\`, `\\`)
+	subsection = strings.ReplaceAll(subsection, `"`, `\"`)
+
+	return fmt.Sprintf("[%s \"%s\"]", section, subsection)
+}
+
+// Quotes the value if it would be parsed differently otherwise
+func formatValue(value string) string {
+	needsQuote := value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;")
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, "\t", `\t`)
+
+	if needsQuote {
+		return `"` + value + `"`
+	}
+
+	return value
+}
+
+// Updates the config file at filePath. Existing value of the key
+// is replaced when replace is true, else a new value is added
+func writeValue(filePath, key, value string, replace bool) error {
+	section, subsection, name, err := splitKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	contents, err := os.ReadFile(filePath)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(contents), "\n"), "\n")
+
+	if len(contents) == 0 {
+		lines = nil
+	}
+
+	wantedSection := normaliseKey(key)
+	wantedSection = wantedSection[:strings.LastIndexByte(wantedSection, '.')]
+
+	newLine := fmt.Sprintf("\t%s = %s", name, formatValue(value))
+
+	currentSection := ""
+	// last line of the wanted section and the existing key
+	sectionEnd := -1
+	keyLine := -1
+
+	for idx, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") {
+			currentSection, err = parseSectionHeader(trimmed)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if currentSection != wantedSection {
+			continue
+		}
+
+		sectionEnd = idx
+
+		lineName, _, _ := strings.Cut(trimmed, "=")
+
+		if strings.EqualFold(strings.TrimSpace(lineName), name) {
+			keyLine = idx
+		}
+	}
+
+	switch {
+	case replace && keyLine != -1:
+		lines[keyLine] = newLine
+	case sectionEnd != -1:
+		lines = append(lines[:sectionEnd+1], append([]string{newLine}, lines[sectionEnd+1:]...)...)
+	default:
+		lines = append(lines, formatSectionHeader(section, subsection), newLine)
+	}
+
+	return os.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// Sets the value in the config file, similar to
+// git config --file <filePath> <key> <value>
+func Set(filePath, key, value string) error {
+	return writeValue(filePath, key, value, true)
+}
+
+// Adds another value for a multi-valued key, similar to
+// git config --file <filePath> --add <key> <value>
+func Add(filePath, key, value string) error {
+	return writeValue(filePath, key, value, false)
+}
@@ -0,0 +1,266 @@
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/config"
+)
+
+var ErrNoCredentials = errors.New("could not read credentials")
+
+// Credential for a remote as exchanged with the helpers
+// @see https://git-scm.com/docs/git-credential#IOFMT
+type Credential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Creates the credential for the url, the username and the password
+// embedded in the url are kept. Path is only sent to the helpers
+// when credential.useHttpPath is set
+func FromURL(rawURL string) (*Credential, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+
+	return c, nil
+}
+
+// Url of the credential without the path, used in the prompts
+func (c *Credential) URL() string {
+	if c.Username == "" {
+		return fmt.Sprintf("%s://%s", c.Protocol, c.Host)
+	}
+
+	return fmt.Sprintf("%s://%s@%s", c.Protocol, url.PathEscape(c.Username), c.Host)
+}
+
+// Writes the attributes which are set as key=value lines
+func (c *Credential) Write(w io.Writer) error {
+	var sb strings.Builder
+
+	for _, attr := range [][2]string{
+		{"protocol", c.Protocol},
+		{"host", c.Host},
+		{"path", c.Path},
+		{"username", c.Username},
+		{"password", c.Password},
+	} {
+		if attr[1] != "" {
+			fmt.Fprintf(&sb, "%s=%s\n", attr[0], attr[1])
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+// Reads key=value lines till a blank line or the end, the
+// attributes which are present override the current ones
+func (c *Credential) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+
+		if !ok {
+			return fmt.Errorf("invalid credential line: %s", line)
+		}
+
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Url the credential.<url>.* config is matched with
+func (c *Credential) configURL() string {
+	return c.URL() + "/" + c.Path
+}
+
+// Helpers configured with credential.helper and credential.<url>.helper,
+// an empty value resets the list of the helpers configured before it
+func helpers(cfg *config.Config, c *Credential) []string {
+	if cfg == nil {
+		return nil
+	}
+
+	return cfg.GetAllURL("credential.helper", c.configURL())
+}
+
+// Runs the helper with the action and the credential as input, the
+// helper is a shell snippet when it starts with !, a path to a program
+// or the name of git-credential-<name> program. store is built in
+func runHelper(helper, action string, c *Credential) (*Credential, error) {
+	if name, args, _ := strings.Cut(helper, " "); name == _StoreHelper {
+		return runStore(strings.Fields(args), action, c)
+	}
+
+	var prog string
+
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		prog = helper[1:]
+	case path.IsAbs(helper):
+		prog = helper
+	default:
+		prog = "git-credential-" + helper
+	}
+
+	var input, output bytes.Buffer
+
+	if err := c.Write(&input); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("sh", "-c", prog+" \"$@\"", prog, action)
+
+	cmd.Stdin = &input
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	result := *c
+
+	if err := result.Read(&output); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Asks the program from GIT_ASKPASS, core.askPass or SSH_ASKPASS with
+// the prompt and returns the answer without the trailing newline
+func askPass(cfg *config.Config, prompt string) (string, bool) {
+	prog := os.Getenv("GIT_ASKPASS")
+
+	if prog == "" && cfg != nil {
+		prog, _ = cfg.Get("core.askPass")
+	}
+
+	if prog == "" {
+		prog = os.Getenv("SSH_ASKPASS")
+	}
+
+	if prog == "" {
+		return "", false
+	}
+
+	out, err := exec.Command("sh", "-c", prog+" \"$@\"", prog, prompt).Output()
+
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), true
+}
+
+// Fills the username and the password from the helpers in order, the
+// first helper which returns both wins. Missing values are asked with
+// askpass, it fails when there is nothing to ask with
+func Fill(cfg *config.Config, c *Credential) error {
+	list := helpers(cfg, c)
+
+	if cfg == nil || !cfg.GetBoolURL("credential.useHttpPath", c.configURL(), false) {
+		c.Path = ""
+	}
+
+	for _, helper := range list {
+		if c.Username != "" && c.Password != "" {
+			return nil
+		}
+
+		// a broken helper is skipped like git does
+		result, err := runHelper(helper, "get", c)
+
+		if err != nil {
+			continue
+		}
+
+		c.Username, c.Password = result.Username, result.Password
+	}
+
+	if c.Username == "" {
+		username, ok := askPass(cfg, fmt.Sprintf("Username for '%s': ", c.URL()))
+
+		if !ok {
+			return fmt.Errorf("%w: Username for '%s'", ErrNoCredentials, c.URL())
+		}
+
+		c.Username = username
+	}
+
+	if c.Password == "" {
+		password, ok := askPass(cfg, fmt.Sprintf("Password for '%s': ", c.URL()))
+
+		if !ok {
+			return fmt.Errorf("%w: Password for '%s'", ErrNoCredentials, c.URL())
+		}
+
+		c.Password = password
+	}
+
+	return nil
+}
+
+// Tells the helpers to store the credential which was accepted
+func Approve(cfg *config.Config, c *Credential) {
+	for _, helper := range helpers(cfg, c) {
+		runHelper(helper, "store", c)
+	}
+}
+
+// Tells the helpers to erase the credential which was rejected
+func Reject(cfg *config.Config, c *Credential) {
+	for _, helper := range helpers(cfg, c) {
+		runHelper(helper, "erase", c)
+	}
+
+	c.Password = ""
+}
@@ -0,0 +1,52 @@
+package editor
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/uragirii/got/internals/git/config"
+)
+
+const _DefaultEditor = "vi"
+
+// Returns the editor in the same order as git
+// GIT_EDITOR > core.editor > VISUAL > EDITOR > vi
+func GetEditor(c *config.Config) string {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+
+	if editor, ok := c.Get("core.editor"); ok && editor != "" {
+		return editor
+	}
+
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+
+	return _DefaultEditor
+}
+
+// Opens the file in the editor and waits for it to exit
+// The editor is run through the shell as it can contain args
+// like "code --wait"
+func Launch(c *config.Config, filePath string) error {
+	editor := GetEditor(c)
+
+	// ":" is the conventional no-op editor
+	if editor == ":" {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, filePath)
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,48 @@
+package editor_test
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/editor"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestGetEditor(t *testing.T) {
+	c, err := config.New(strings.NewReader("[core]\n\teditor = nano\n"))
+
+	if err != nil {
+		t.Fatalf("config.New failed with err %v", err)
+	}
+
+	t.Setenv("GIT_EDITOR", "")
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "emacs")
+
+	testutils.AssertString(t, "core.editor", "nano", editor.GetEditor(c))
+
+	t.Setenv("GIT_EDITOR", "vim")
+
+	testutils.AssertString(t, "GIT_EDITOR", "vim", editor.GetEditor(c))
+}
+
+func TestLaunch(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "COMMIT_EDITMSG")
+
+	if err := os.WriteFile(filePath, []byte("# comment\n"), 0644); err != nil {
+		t.Fatalf("failed to write file %v", err)
+	}
+
+	t.Setenv("GIT_EDITOR", `sh -c 'echo "edited message" > "$1"' -`)
+
+	if err := editor.Launch(&config.Config{}, filePath); err != nil {
+		t.Fatalf("Launch failed with err %v", err)
+	}
+
+	contents, _ := os.ReadFile(filePath)
+
+	testutils.AssertString(t, "edited file", "edited message\n", string(contents))
+}
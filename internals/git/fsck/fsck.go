@@ -0,0 +1,507 @@
+package fsck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/reflog"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/progress"
+)
+
+type Kind int
+
+const (
+	// Loose object which can't be decompressed, parsed or has the wrong SHA
+	Corrupt Kind = iota
+	// Object with invalid contents like unsorted tree entries
+	BadObject
+	// Pack or idx which doesn't match its checksum or each other
+	BadPack
+	// Object linked from a reachable object but not in the repository
+	Missing
+	// Unreachable object not linked from any other object
+	Dangling
+	// Ref or reflog entry pointing to a missing object
+	BadRef
+	// multi-pack-index which doesn't match its checksum or its packs
+	BadMultiPackIndex
+)
+
+// Problem found by fsck, From is the first object linking to the
+// missing objects and Ref the name of the ref for bad refs
+type Finding struct {
+	Kind     Kind
+	SHA      *sha.SHA
+	Type     object.ObjectType
+	From     *sha.SHA
+	FromType object.ObjectType
+	Ref      string
+	Message  string
+}
+
+// Formats the finding like git fsck
+func (f Finding) String() string {
+	switch f.Kind {
+	case Corrupt:
+		return fmt.Sprintf("error: %s: object corrupt or missing: %s", f.SHA, f.Message)
+	case BadObject:
+		return fmt.Sprintf("error in %s %s: %s", f.Type, f.SHA, f.Message)
+	case BadPack:
+		return fmt.Sprintf("error: %s", f.Message)
+	case BadMultiPackIndex:
+		// printed as is by git multi-pack-index verify
+		return f.Message
+	case Missing:
+		return fmt.Sprintf("missing %s %s", f.Type, f.SHA)
+	case Dangling:
+		return fmt.Sprintf("dangling %s %s", f.Type, f.SHA)
+	default:
+		return fmt.Sprintf("error: %s: %s", f.Ref, f.Message)
+	}
+}
+
+// Errors are written to stderr by git and the rest to stdout
+func (f Finding) IsError() bool {
+	return f.Kind != Missing && f.Kind != Dangling
+}
+
+type Report struct {
+	Findings []Finding
+}
+
+// Exit code of git fsck, a bit for each kind of error. Dangling
+// objects are not errors
+func (r *Report) ExitCode() int {
+	code := 0
+
+	for _, finding := range r.Findings {
+		switch finding.Kind {
+		case Corrupt, BadObject:
+			code |= 1
+		case Missing:
+			code |= 2
+		case BadPack:
+			code |= 4
+		case BadRef:
+			code |= 8
+		case BadMultiPackIndex:
+			code |= 32
+		}
+	}
+
+	return code
+}
+
+type Options struct {
+	// "Checking objects" progress, nil to disable
+	Progress io.Writer
+	// Skips reporting the dangling objects
+	NoDangling bool
+}
+
+// Valid object of the repository and the objects it links to
+type checkedObject struct {
+	objType object.ObjectType
+	links   []object.Link
+	// Objects of promisor packs may link to the objects omitted by a
+	// partial clone
+	promisor bool
+	// Objects listed by the idx of a corrupted pack, their contents and
+	// links are unknown
+	unchecked bool
+}
+
+type checker struct {
+	gitDir   string
+	gitFs    fs.FS
+	objects  map[string]*checkedObject
+	findings []Finding
+	meter    *progress.Meter
+}
+
+func (c *checker) add(objSha *sha.SHA, obj object.ObjectContents, promisor bool) {
+	links, err := object.CheckLinks(obj)
+
+	if err != nil {
+		c.findings = append(c.findings, Finding{
+			Kind:    BadObject,
+			SHA:     objSha,
+			Type:    obj.ObjType,
+			Message: strings.TrimPrefix(err.Error(), object.ErrBadObject.Error()+": "),
+		})
+	}
+
+	c.objects[objSha.String()] = &checkedObject{objType: obj.ObjType, links: links, promisor: promisor}
+	c.meter.Add(1)
+}
+
+func (c *checker) corrupt(objSha *sha.SHA, message string) {
+	c.findings = append(c.findings, Finding{Kind: Corrupt, SHA: objSha, Message: message})
+}
+
+// Checks the zlib stream, header and SHA of the loose objects
+func (c *checker) checkLoose() error {
+	objectsDir := path.Join(c.gitDir, "objects")
+
+	dirs, err := os.ReadDir(objectsDir)
+
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		// pack and info dirs
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		files, err := os.ReadDir(path.Join(objectsDir, dir.Name()))
+
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			objSha, err := sha.FromString(dir.Name() + file.Name())
+
+			// temporary files of the writers
+			if err != nil {
+				continue
+			}
+
+			objPath := path.Join("objects", dir.Name(), file.Name())
+
+			data, err := os.ReadFile(path.Join(c.gitDir, objPath))
+
+			if err != nil {
+				c.corrupt(objSha, fmt.Sprintf("%s: %v", objPath, err))
+				continue
+			}
+
+			raw, err := object.Decompress(bytes.NewReader(data))
+
+			if err != nil {
+				c.corrupt(objSha, fmt.Sprintf("%s: %v", objPath, err))
+				continue
+			}
+
+			obj, err := object.FromRaw(raw)
+
+			if err != nil {
+				c.corrupt(objSha, fmt.Sprintf("%s: %v", objPath, err))
+				continue
+			}
+
+			actualSha, err := sha.FromData(raw)
+
+			if err != nil {
+				return err
+			}
+
+			if !actualSha.Eq(objSha) {
+				c.corrupt(objSha, fmt.Sprintf("%s: hash mismatch, found %s", objPath, actualSha))
+				continue
+			}
+
+			c.add(objSha, obj, false)
+		}
+	}
+
+	return nil
+}
+
+// Verifies the packs and checks their objects. The idx files are listed
+// directly as pack.ListPacks fails for a corrupted idx
+func (c *checker) checkPacks() error {
+	entries, err := fs.ReadDir(c.gitFs, "objects/pack")
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name, isIdx := strings.CutSuffix(entry.Name(), ".idx")
+
+		if !isIdx {
+			continue
+		}
+
+		_, promisorErr := fs.Stat(c.gitFs, path.Join("objects/pack", name+".promisor"))
+
+		err = pack.Verify(c.gitFs, name, func(objSha *sha.SHA, obj object.ObjectContents) error {
+			c.add(objSha, obj, promisorErr == nil)
+
+			return nil
+		})
+
+		if err == nil {
+			continue
+		}
+
+		c.findings = append(c.findings, Finding{
+			Kind:    BadPack,
+			Message: fmt.Sprintf("objects/pack/%s.pack: %v", name, err),
+		})
+
+		// the objects which couldn't be checked still exist, otherwise
+		// every ref would be reported as invalid
+		idx, err := pack.FromIdxFile(c.gitFs, path.Join("objects/pack", entry.Name()))
+
+		if err != nil {
+			continue
+		}
+
+		for _, objSha := range idx.Objects() {
+			if c.objects[objSha.String()] == nil {
+				c.objects[objSha.String()] = &checkedObject{unchecked: true}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Verifies the multi-pack-index like git fsck runs git multi-pack-index verify
+func (c *checker) checkMultiPackIndex() error {
+	problems, err := pack.VerifyMultiPackIndex(c.gitFs, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		c.findings = append(c.findings, Finding{Kind: BadMultiPackIndex, Message: problem})
+	}
+
+	return nil
+}
+
+// Checks that the refs, HEAD and reflog entries point to existing objects
+func (c *checker) checkRefs() error {
+	refList, err := refs.List(c.gitFs, "refs/")
+
+	if err != nil {
+		return err
+	}
+
+	if headSha, err := refs.Read(c.gitFs, "HEAD"); err == nil {
+		refList = append(refList, refs.Ref{Name: "HEAD", SHA: headSha})
+	}
+
+	for _, ref := range refList {
+		if c.objects[ref.SHA.String()] == nil {
+			c.findings = append(c.findings, Finding{
+				Kind:    BadRef,
+				SHA:     ref.SHA,
+				Ref:     ref.Name,
+				Message: fmt.Sprintf("invalid sha1 pointer %s", ref.SHA),
+			})
+		}
+	}
+
+	logs, err := reflog.List(c.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range logs {
+		entries, err := reflog.Read(c.gitFs, ref)
+
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			for _, objSha := range []*sha.SHA{entry.Old, entry.New} {
+				// zero SHA of the created and deleted refs
+				if strings.Trim(objSha.String(), "0") == "" || c.objects[objSha.String()] != nil {
+					continue
+				}
+
+				c.findings = append(c.findings, Finding{
+					Kind:    BadRef,
+					SHA:     objSha,
+					Ref:     ref,
+					Message: fmt.Sprintf("invalid reflog entry %s", objSha),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// Walks the links from the roots reporting the missing objects, and
+// returns the reachable objects
+func (c *checker) checkConnectivity() (map[string]bool, error) {
+	roots, err := reachable.Roots(c.gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shallowSet, err := shallow.ReadSet(c.gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reachableSet := make(map[string]bool)
+	missing := make(map[string]Finding)
+
+	queue := make([]*sha.SHA, 0, len(roots))
+
+	for _, root := range roots {
+		if !reachableSet[root.String()] {
+			reachableSet[root.String()] = true
+			queue = append(queue, root)
+		}
+	}
+
+	for len(queue) != 0 {
+		objSha := queue[0]
+		queue = queue[1:]
+
+		obj := c.objects[objSha.String()]
+
+		// missing roots are reported by checkRefs
+		if obj == nil {
+			continue
+		}
+
+		for _, link := range obj.links {
+			// history of the shallow commits is cut
+			if shallowSet[objSha.String()] && link.Type == object.CommitObj {
+				continue
+			}
+
+			if c.objects[link.SHA.String()] == nil {
+				if _, found := missing[link.SHA.String()]; !found && !obj.promisor {
+					missing[link.SHA.String()] = Finding{
+						Kind:     Missing,
+						SHA:      link.SHA,
+						Type:     link.Type,
+						From:     objSha,
+						FromType: obj.objType,
+					}
+				}
+
+				continue
+			}
+
+			if !reachableSet[link.SHA.String()] {
+				reachableSet[link.SHA.String()] = true
+				queue = append(queue, link.SHA)
+			}
+		}
+	}
+
+	c.findings = append(c.findings, sortedFindings(missing)...)
+
+	return reachableSet, nil
+}
+
+// Unreachable objects not linked from any other object, the tips of the
+// unreachable history
+func (c *checker) dangling(reachableSet map[string]bool) []Finding {
+	linked := make(map[string]bool)
+
+	for _, obj := range c.objects {
+		for _, link := range obj.links {
+			linked[link.SHA.String()] = true
+		}
+	}
+
+	dangling := make(map[string]Finding)
+
+	for shaStr, obj := range c.objects {
+		if reachableSet[shaStr] || linked[shaStr] || obj.unchecked {
+			continue
+		}
+
+		objSha, _ := sha.FromString(shaStr)
+
+		dangling[shaStr] = Finding{Kind: Dangling, SHA: objSha, Type: obj.objType}
+	}
+
+	return sortedFindings(dangling)
+}
+
+func sortedFindings(findings map[string]Finding) []Finding {
+	keys := make([]string, 0, len(findings))
+
+	for key := range findings {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	sorted := make([]Finding, 0, len(keys))
+
+	for _, key := range keys {
+		sorted = append(sorted, findings[key])
+	}
+
+	return sorted
+}
+
+// Checks the integrity of the repository like git fsck --full, the
+// loose and packed objects, the pack and idx checksums, the refs and
+// the connectivity. Problems are returned in the report, the error
+// is only for failures to read the repository
+func Run(gitDir string, opts Options) (*Report, error) {
+	c := &checker{
+		gitDir:  gitDir,
+		gitFs:   os.DirFS(gitDir),
+		objects: make(map[string]*checkedObject),
+		meter:   progress.New(opts.Progress, "Checking objects", 0),
+	}
+
+	if err := c.checkLoose(); err != nil {
+		return nil, err
+	}
+
+	if err := c.checkPacks(); err != nil {
+		return nil, err
+	}
+
+	if err := c.checkMultiPackIndex(); err != nil {
+		return nil, err
+	}
+
+	c.meter.Done()
+
+	if err := c.checkRefs(); err != nil {
+		return nil, err
+	}
+
+	reachableSet, err := c.checkConnectivity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoDangling {
+		c.findings = append(c.findings, c.dangling(reachableSet)...)
+	}
+
+	return &Report{Findings: c.findings}, nil
+}
@@ -0,0 +1,227 @@
+package fsck_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/fsck"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Overwrites the loose object file with the data
+func overwrite(t *testing.T, gitDir string, objSha *sha.SHA, data []byte) {
+	t.Helper()
+
+	objPath, _ := objSha.GetObjPath()
+	objPath = path.Join(gitDir, objPath)
+
+	os.Chmod(objPath, 0644)
+
+	if err := os.WriteFile(objPath, data, 0644); err != nil {
+		t.Fatalf("failed to write %v", err)
+	}
+}
+
+func compress(data string) []byte {
+	var buffer bytes.Buffer
+
+	writer := zlib.NewWriter(&buffer)
+	writer.Write([]byte(data))
+	writer.Close()
+
+	return buffer.Bytes()
+}
+
+func run(t *testing.T, gitDir string, opts fsck.Options) (string, int) {
+	t.Helper()
+
+	report, err := fsck.Run(gitDir, opts)
+
+	if err != nil {
+		t.Fatalf("Run failed with err %v", err)
+	}
+
+	lines := make([]string, 0, len(report.Findings))
+
+	for _, finding := range report.Findings {
+		lines = append(lines, finding.String())
+	}
+
+	return strings.Join(lines, "\n"), report.ExitCode()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("reports nothing for a valid repository", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commitSha, _, _ := testutils.WriteCommit(t, gitDir, "first")
+		refs.Write(gitDir, "refs/heads/main", commitSha)
+
+		output, code := run(t, gitDir, fsck.Options{})
+
+		testutils.AssertString(t, "findings", "", output)
+
+		if code != 0 {
+			t.Errorf("expected exit code 0 but got %d", code)
+		}
+	})
+
+	t.Run("reports dangling objects", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commitSha, _, _ := testutils.WriteCommit(t, gitDir, "first")
+		refs.Write(gitDir, "refs/heads/main", commitSha)
+
+		danglingCommit, _, _ := testutils.WriteCommit(t, gitDir, "dangling")
+		danglingBlob := testutils.WriteObj(t, gitDir, object.BlobObj, "dangling blob")
+
+		output, code := run(t, gitDir, fsck.Options{})
+
+		expected := []string{"dangling commit " + danglingCommit.String(), "dangling blob " + danglingBlob.String()}
+
+		if danglingBlob.String() < danglingCommit.String() {
+			expected[0], expected[1] = expected[1], expected[0]
+		}
+
+		testutils.AssertString(t, "findings", strings.Join(expected, "\n"), output)
+
+		if code != 0 {
+			t.Errorf("expected exit code 0 but got %d", code)
+		}
+
+		output, _ = run(t, gitDir, fsck.Options{NoDangling: true})
+
+		testutils.AssertString(t, "findings", "", output)
+	})
+
+	t.Run("reports missing objects", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commitSha, _, blobSha := testutils.WriteCommit(t, gitDir, "first")
+		refs.Write(gitDir, "refs/heads/main", commitSha)
+
+		objPath, _ := blobSha.GetObjPath()
+		os.Remove(path.Join(gitDir, objPath))
+
+		output, code := run(t, gitDir, fsck.Options{})
+
+		testutils.AssertString(t, "findings", "missing blob "+blobSha.String(), output)
+
+		if code != 2 {
+			t.Errorf("expected exit code 2 but got %d", code)
+		}
+	})
+
+	t.Run("reports corrupted loose objects", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commitSha, _, blobSha := testutils.WriteCommit(t, gitDir, "first")
+		refs.Write(gitDir, "refs/heads/main", commitSha)
+
+		otherBlob := testutils.WriteObj(t, gitDir, object.BlobObj, "other")
+		shortBlob := testutils.WriteObj(t, gitDir, object.BlobObj, "short")
+
+		overwrite(t, gitDir, blobSha, []byte("not zlib"))
+		overwrite(t, gitDir, otherBlob, compress("blob 5\x00first"))
+		overwrite(t, gitDir, shortBlob, compress("blob 9\x00short"))
+
+		report, err := fsck.Run(gitDir, fsck.Options{NoDangling: true})
+
+		if err != nil {
+			t.Fatalf("Run failed with err %v", err)
+		}
+
+		corrupt := make(map[string]string)
+
+		for _, finding := range report.Findings {
+			if finding.Kind == fsck.Corrupt {
+				corrupt[finding.SHA.String()] = finding.Message
+			}
+		}
+
+		if len(corrupt) != 3 {
+			t.Fatalf("expected 3 corrupted objects but got %v", report.Findings)
+		}
+
+		if !strings.Contains(corrupt[otherBlob.String()], "hash mismatch") {
+			t.Errorf("expected hash mismatch but got %q", corrupt[otherBlob.String()])
+		}
+
+		if !strings.Contains(corrupt[shortBlob.String()], "expected length") {
+			t.Errorf("expected length mismatch but got %q", corrupt[shortBlob.String()])
+		}
+
+		// the corrupted blob is missing for the tree linking to it
+		if report.ExitCode() != 3 {
+			t.Errorf("expected exit code 3 but got %d", report.ExitCode())
+		}
+	})
+
+	t.Run("reports invalid objects and refs", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		blobSha := testutils.WriteObj(t, gitDir, object.BlobObj, "blob")
+		treeSha := testutils.WriteObj(t, gitDir, object.TreeObj,
+			"100644 b.txt\x00"+string(*blobSha.GetBytes())+"100644 a.txt\x00"+string(*blobSha.GetBytes()))
+
+		refs.Write(gitDir, "refs/heads/main", treeSha)
+
+		missingSha, _ := sha.FromString("1111111111111111111111111111111111111111")
+		refs.Write(gitDir, "refs/heads/broken", missingSha)
+
+		// links of the invalid tree are unknown, so its blob is dangling
+		output, code := run(t, gitDir, fsck.Options{NoDangling: true})
+
+		testutils.AssertString(t, "findings",
+			"error in tree "+treeSha.String()+": entry \"a.txt\" is not sorted\n"+
+				"error: refs/heads/broken: invalid sha1 pointer "+missingSha.String(),
+			output)
+
+		if code != 9 {
+			t.Errorf("expected exit code 9 but got %d", code)
+		}
+	})
+
+	t.Run("reports corrupted multi-pack-index", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commitSha, _, blobSha := testutils.WriteCommit(t, gitDir, "packed")
+		refs.Write(gitDir, "refs/heads/main", commitSha)
+
+		var packData bytes.Buffer
+
+		pack.WriteObjects(&packData, os.DirFS(gitDir), []*sha.SHA{commitSha, blobSha})
+		pack.Store(gitDir, packData.Bytes())
+
+		if err := pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{}); err != nil {
+			t.Fatalf("WriteMultiPackIndex failed with err %v", err)
+		}
+
+		midxPath := path.Join(gitDir, pack.MultiPackIndexFile)
+
+		data, _ := os.ReadFile(midxPath)
+		os.WriteFile(midxPath, data[:len(data)/2], 0644)
+
+		report, err := fsck.Run(gitDir, fsck.Options{})
+
+		if err != nil {
+			t.Fatalf("Run failed with err %v", err)
+		}
+
+		last := report.Findings[len(report.Findings)-1]
+
+		testutils.AssertString(t, "finding", "multi-pack-index file exists, but failed to parse", last.String())
+
+		if report.ExitCode() != 32 {
+			t.Errorf("expected exit code 32 but got %d", report.ExitCode())
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package gc
+
+import (
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/uragirii/got/internals/git/pack"
+)
+
+// Object store statistics of git count-objects -v, sizes are in bytes
+type ObjectCounts struct {
+	// Loose objects and their disk usage
+	Count int
+	Size  int64
+	// Objects in the packs, the packs and the size of the packs and idx
+	InPack   int
+	Packs    int
+	SizePack int64
+	// Loose objects also present in a pack
+	PrunePackable int
+	// Files in objects/pack which don't belong to any pack
+	Garbage     []string
+	SizeGarbage int64
+}
+
+// Files allowed next to a pack in objects/pack
+var _PackExtensions = []string{".pack", ".idx", ".rev", ".keep", ".promisor", ".bitmap", ".mtimes"}
+
+// Disk usage of the file like git, the blocks used and not the length
+func diskUsage(info os.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(stat.Blocks) * 512
+	}
+
+	return info.Size()
+}
+
+// Returns the files of objects/pack which don't belong to a pack
+func packGarbage(gitDir string, packList []pack.PackFile) ([]string, int64, error) {
+	entries, err := os.ReadDir(path.Join(gitDir, "objects/pack"))
+
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	packNames := make(map[string]bool, len(packList))
+
+	for _, p := range packList {
+		packNames[p.Name] = true
+	}
+
+	var garbage []string
+	var size int64
+
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+
+		isPackFile := false
+
+		for _, packExt := range _PackExtensions {
+			if ext == packExt && packNames[strings.TrimSuffix(entry.Name(), ext)] {
+				isPackFile = true
+			}
+		}
+
+		if isPackFile || entry.IsDir() || entry.Name() == path.Base(pack.MultiPackIndexFile) {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		garbage = append(garbage, path.Join("objects/pack", entry.Name()))
+		size += diskUsage(info)
+	}
+
+	return garbage, size, nil
+}
+
+// Counts the loose and packed objects like git count-objects
+func CountObjects(gitDir string) (*ObjectCounts, error) {
+	packList, err := pack.ListPacks(os.DirFS(gitDir))
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := &ObjectCounts{Packs: len(packList)}
+
+	packed := make(map[string]bool)
+
+	for _, p := range packList {
+		counts.InPack += len(p.Idx.Objects())
+
+		for _, objSha := range p.Idx.Objects() {
+			packed[objSha.String()] = true
+		}
+
+		for _, ext := range []string{".pack", ".idx"} {
+			info, err := os.Stat(path.Join(gitDir, "objects/pack", p.Name+ext))
+
+			if err != nil {
+				return nil, err
+			}
+
+			counts.SizePack += info.Size()
+		}
+	}
+
+	loose, err := listLoose(gitDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range loose {
+		info, err := os.Stat(obj.path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		counts.Count++
+		counts.Size += diskUsage(info)
+
+		if packed[obj.sha.String()] {
+			counts.PrunePackable++
+		}
+	}
+
+	if counts.Garbage, counts.SizeGarbage, err = packGarbage(gitDir, packList); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,60 @@
+package gc_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/gc"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestCountObjects(t *testing.T) {
+	gitDir := t.TempDir()
+
+	writeCommit(t, gitDir, "first")
+
+	if _, err := gc.Repack(gitDir, gc.RepackOptions{}); err != nil {
+		t.Fatalf("Repack failed with err %v", err)
+	}
+
+	testutils.WriteObj(t, gitDir, object.BlobObj, "loose")
+	writeFile(t, path.Join(gitDir, "objects/pack/tmp_pack_1"), "garbage")
+
+	// not garbage like the files of the packs
+	if err := pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{}); err != nil {
+		t.Fatalf("WriteMultiPackIndex failed with err %v", err)
+	}
+
+	counts, err := gc.CountObjects(gitDir)
+
+	if err != nil {
+		t.Fatalf("CountObjects failed with err %v", err)
+	}
+
+	// 3 packed objects are still loose without -d
+	if counts.Count != 4 || counts.InPack != 3 || counts.Packs != 1 || counts.PrunePackable != 3 {
+		t.Errorf("unexpected counts %+v", counts)
+	}
+
+	packList := listPacks(t, gitDir)
+
+	packInfo, _ := os.Stat(path.Join(gitDir, "objects/pack", packList[0].Name+".pack"))
+	idxInfo, _ := os.Stat(path.Join(gitDir, "objects/pack", packList[0].Name+".idx"))
+
+	if counts.SizePack != packInfo.Size()+idxInfo.Size() {
+		t.Errorf("expected size-pack %d but got %d", packInfo.Size()+idxInfo.Size(), counts.SizePack)
+	}
+
+	if counts.Size == 0 {
+		t.Errorf("expected the size of the loose objects")
+	}
+
+	if len(counts.Garbage) != 1 {
+		t.Fatalf("expected 1 garbage file but got %v", counts.Garbage)
+	}
+
+	testutils.AssertString(t, "garbage", "objects/pack/tmp_pack_1", counts.Garbage[0])
+}
@@ -0,0 +1,79 @@
+package gc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/commit"
+)
+
+var ErrInvalidExpiry = errors.New("invalid expiry date")
+
+// Parses "<n>.<unit>[.ago]" like 2.weeks.ago, units can be plural
+func parseRelative(value string, now time.Time) (time.Time, bool) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == '.' || r == ' '
+	})
+
+	if len(fields) == 3 && fields[2] == "ago" {
+		fields = fields[:2]
+	}
+
+	if len(fields) != 2 {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(fields[0])
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	switch strings.TrimSuffix(fields[1], "s") {
+	case "second":
+		return now.Add(-time.Duration(n) * time.Second), true
+	case "minute":
+		return now.Add(-time.Duration(n) * time.Minute), true
+	case "hour":
+		return now.Add(-time.Duration(n) * time.Hour), true
+	case "day":
+		return now.AddDate(0, 0, -n), true
+	case "week":
+		return now.AddDate(0, 0, -7*n), true
+	case "month":
+		return now.AddDate(0, -n, 0), true
+	case "year":
+		return now.AddDate(-n, 0, 0), true
+	}
+
+	return time.Time{}, false
+}
+
+// Parses the expiry of the gc.*Expire configs and the --prune option,
+// the objects and reflog entries older than it are expired. "never"
+// returns the zero time as nothing is older than it
+func ParseExpiry(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(value) {
+	case "now", "all":
+		return now, nil
+	case "never", "false":
+		return time.Time{}, nil
+	}
+
+	if t, ok := parseRelative(strings.ToLower(value), now); ok {
+		return t, nil
+	}
+
+	t, err := commit.ParseDate(value)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrInvalidExpiry, value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,43 @@
+package gc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/gc"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"now":               now,
+		"never":             {},
+		"2.weeks.ago":       now.AddDate(0, 0, -14),
+		"90.days":           now.AddDate(0, 0, -90),
+		"1.hour.ago":        now.Add(-time.Hour),
+		"3 months ago":      now.AddDate(0, -3, 0),
+		"1700000000":        time.Unix(1700000000, 0),
+		"@1700000000 +0530": time.Unix(1700000000, 0),
+	} {
+		t.Run(value, func(t *testing.T) {
+			got, err := gc.ParseExpiry(value, now)
+
+			if err != nil {
+				t.Fatalf("ParseExpiry failed with err %v", err)
+			}
+
+			testutils.AssertString(t, "expiry", expected.UTC().String(), got.UTC().String())
+		})
+	}
+
+	t.Run("fails for invalid dates", func(t *testing.T) {
+		for _, value := range []string{"soon", "2.fortnights.ago", "x.days.ago"} {
+			if _, err := gc.ParseExpiry(value, now); !errors.Is(err, gc.ErrInvalidExpiry) {
+				t.Errorf("expected ErrInvalidExpiry for %s but got %v", value, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,309 @@
+package gc
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/reflog"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Defaults of the gc configs, same as git
+// @see https://git-scm.com/docs/git-gc#_configuration
+const (
+	_DefaultPruneExpire             = "2.weeks.ago"
+	_DefaultReflogExpire            = "90.days.ago"
+	_DefaultReflogExpireUnreachable = "30.days.ago"
+	_DefaultAutoLimit               = 6700
+	_DefaultAutoPackLimit           = 50
+)
+
+// git estimates the loose objects from this dir assuming
+// that the objects are evenly spread over the 256 dirs
+const _AutoSampleDir = "objects/17"
+
+type Options struct {
+	// Loose unreachable objects older than it are pruned, gc.pruneExpire
+	// is used if empty
+	PruneExpire string
+	// Keeps the unreachable loose objects
+	NoPrune bool
+	// Progress of the repack is written here, nil to disable
+	Progress io.Writer
+}
+
+type looseObject struct {
+	sha     *sha.SHA
+	path    string
+	modTime time.Time
+}
+
+// Returns the loose objects of the repository
+func listLoose(gitDir string) ([]looseObject, error) {
+	objectsDir := path.Join(gitDir, "objects")
+
+	dirs, err := os.ReadDir(objectsDir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var loose []looseObject
+
+	for _, dir := range dirs {
+		// pack and info dirs
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+
+		files, err := os.ReadDir(path.Join(objectsDir, dir.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			objSha, err := sha.FromString(dir.Name() + file.Name())
+
+			// temporary files of the writers
+			if err != nil {
+				continue
+			}
+
+			info, err := file.Info()
+
+			if err != nil {
+				return nil, err
+			}
+
+			loose = append(loose, looseObject{
+				sha:     objSha,
+				path:    path.Join(objectsDir, dir.Name(), file.Name()),
+				modTime: info.ModTime(),
+			})
+		}
+	}
+
+	return loose, nil
+}
+
+// Objects of a partial clone are never walked as the objects
+// omitted from it would be lazily fetched
+func isPartial(packList []pack.PackFile) bool {
+	for _, p := range packList {
+		if p.Promisor {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getExpiry(cfg *config.Config, key, defaultValue string, now time.Time) (time.Time, error) {
+	value, ok := cfg.Get(key)
+
+	if !ok {
+		value = defaultValue
+	}
+
+	return ParseExpiry(value, now)
+}
+
+// Removes the reflog entries older than gc.reflogExpire, and the ones
+// older than gc.reflogExpireUnreachable not reachable from the ref
+func expireReflogs(gitDir string, cfg *config.Config, now time.Time) error {
+	gitFs := os.DirFS(gitDir)
+
+	expire, err := getExpiry(cfg, "gc.reflogExpire", _DefaultReflogExpire, now)
+
+	if err != nil {
+		return err
+	}
+
+	expireUnreachable, err := getExpiry(cfg, "gc.reflogExpireUnreachable", _DefaultReflogExpireUnreachable, now)
+
+	if err != nil {
+		return err
+	}
+
+	logs, err := reflog.List(gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range logs {
+		// commits reachable from the ref, read only if needed
+		var reachable map[string]bool
+
+		_, err = reflog.Expire(gitDir, ref, func(entry reflog.Entry) bool {
+			if entry.Time.Before(expire) {
+				return false
+			}
+
+			if !entry.Time.Before(expireUnreachable) {
+				return true
+			}
+
+			if reachable == nil {
+				reachable = make(map[string]bool)
+
+				// deleted refs and refs to non commits have nothing reachable
+				if tip, err := refs.Read(gitFs, ref); err == nil {
+					if commits, err := revlist.Reachable(gitFs, []*sha.SHA{tip}, nil); err == nil {
+						reachable = commits
+					}
+				}
+			}
+
+			return reachable[entry.New.String()]
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Cleans up the repository like git gc. Refs are packed, old reflog
+// entries are expired, all the reachable objects are packed into a
+// single pack and the old unreachable loose objects are pruned
+func Run(gitDir string, opts Options) error {
+	cfg, err := config.Load(os.DirFS(gitDir))
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	pruneExpire := opts.PruneExpire
+
+	if pruneExpire == "" {
+		if pruneExpire, _ = cfg.Get("gc.pruneExpire"); pruneExpire == "" {
+			pruneExpire = _DefaultPruneExpire
+		}
+	}
+
+	// invalid expiry fails before anything is changed
+	expire, err := ParseExpiry(pruneExpire, now)
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.GetBool("gc.packRefs", true) {
+		if err = refs.Pack(gitDir); err != nil {
+			return err
+		}
+	}
+
+	if err = expireReflogs(gitDir, cfg, now); err != nil {
+		return err
+	}
+
+	// unreachable packed objects would be pruned right away with --prune=now
+	_, err = Repack(gitDir, RepackOptions{
+		All:             true,
+		Delete:          true,
+		KeepUnreachable: opts.NoPrune || expire.Before(now),
+		Progress:        opts.Progress,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !opts.NoPrune {
+		if _, err = Prune(gitDir, PruneOptions{Expire: expire}); err != nil {
+			return err
+		}
+	}
+
+	if !cfg.GetBool("gc.writeCommitGraph", true) {
+		return nil
+	}
+
+	commits, err := reachable.Commits(os.DirFS(gitDir))
+
+	if err != nil {
+		return err
+	}
+
+	return commitgraph.Write(gitDir, commits, commitgraph.WriteOptions{Progress: opts.Progress})
+}
+
+// Checks the thresholds of git gc --auto, the loose objects are more than
+// gc.auto or the packs are more than gc.autoPackLimit. Setting gc.auto
+// to 0 disables it
+func NeedsAuto(gitDir string) (bool, error) {
+	gitFs := os.DirFS(gitDir)
+
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return false, err
+	}
+
+	autoLimit := cfg.GetInt("gc.auto", _DefaultAutoLimit)
+
+	if autoLimit <= 0 {
+		return false, nil
+	}
+
+	files, err := fs.ReadDir(gitFs, _AutoSampleDir)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	sampled := 0
+
+	for _, file := range files {
+		if len(file.Name()) == sha.BYTES_LEN*2-2 {
+			sampled++
+		}
+	}
+
+	if sampled > (autoLimit+255)/256 {
+		return true, nil
+	}
+
+	packLimit := cfg.GetInt("gc.autoPackLimit", _DefaultAutoPackLimit)
+
+	if packLimit <= 0 {
+		return false, nil
+	}
+
+	packList, err := pack.ListPacks(gitFs)
+
+	if err != nil {
+		return false, err
+	}
+
+	packs := 0
+
+	for _, p := range packList {
+		if !p.Keep && !p.Promisor {
+			packs++
+		}
+	}
+
+	return packs > packLimit, nil
+}
@@ -0,0 +1,146 @@
+package gc_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/gc"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/reflog"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const _ZeroSHA = "0000000000000000000000000000000000000000"
+
+func writeFile(t *testing.T, filePath, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatalf("failed to create dir %v", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write %s %v", filePath, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	gitDir := t.TempDir()
+
+	old := writeCommit(t, gitDir, "old")
+	commitSha := writeCommit(t, gitDir, "new")
+	unreachable := testutils.WriteObj(t, gitDir, object.BlobObj, "unreachable")
+
+	writeFile(t, path.Join(gitDir, "HEAD"), "ref: refs/heads/main\n")
+
+	now := time.Now().Unix()
+
+	// the old commit is only kept by the recent reflog entry
+	writeFile(t, path.Join(gitDir, reflog.Dir, "refs/heads/main"),
+		fmt.Sprintf("%s %s A <a@b.c> %d +0000\tcommit (initial): old\n", _ZeroSHA, old, now-100*24*3600)+
+			fmt.Sprintf("%s %s A <a@b.c> %d +0000\treset: moving to old\n", commitSha, old, now)+
+			fmt.Sprintf("%s %s A <a@b.c> %d +0000\tcommit: new\n", old, commitSha, now))
+
+	if err := gc.Run(gitDir, gc.Options{}); err != nil {
+		t.Fatalf("Run failed with err %v", err)
+	}
+
+	t.Run("packs the refs", func(t *testing.T) {
+		contents, _ := os.ReadFile(path.Join(gitDir, "packed-refs"))
+
+		testutils.AssertString(t, "packed-refs", "# pack-refs with: sorted \n"+commitSha.String()+" refs/heads/main\n", string(contents))
+	})
+
+	t.Run("expires the old reflog entries", func(t *testing.T) {
+		entries, _ := reflog.Read(os.DirFS(gitDir), "refs/heads/main")
+
+		if len(entries) != 2 {
+			t.Errorf("expected 2 entries but got %d", len(entries))
+		}
+	})
+
+	t.Run("packs the objects kept by the reflog", func(t *testing.T) {
+		packList := listPacks(t, gitDir)
+
+		if len(packList) != 1 || len(packList[0].Idx.Objects()) != 6 {
+			t.Fatalf("expected a single pack with 6 objects but got %+v", packList)
+		}
+
+		if isLoose(gitDir, old) {
+			t.Errorf("expected the old commit to be packed")
+		}
+	})
+
+	t.Run("keeps the recent unreachable objects", func(t *testing.T) {
+		if !isLoose(gitDir, unreachable) {
+			t.Errorf("expected the unreachable blob to be kept for the grace period")
+		}
+	})
+
+	t.Run("writes the commit-graph", func(t *testing.T) {
+		graph, err := commitgraph.Load(os.DirFS(gitDir))
+
+		if err != nil || graph.Len() != 1 {
+			t.Fatalf("expected a commit-graph with the branch commit but got %v", err)
+		}
+	})
+
+	t.Run("prunes the unreachable objects", func(t *testing.T) {
+		if err := gc.Run(gitDir, gc.Options{PruneExpire: "now"}); err != nil {
+			t.Fatalf("Run failed with err %v", err)
+		}
+
+		if isLoose(gitDir, unreachable) {
+			t.Errorf("expected the unreachable blob to be pruned")
+		}
+	})
+
+	t.Run("fails for invalid expiry", func(t *testing.T) {
+		if err := gc.Run(gitDir, gc.Options{PruneExpire: "soon"}); err == nil {
+			t.Errorf("expected an error for invalid expiry")
+		}
+	})
+}
+
+func TestNeedsAuto(t *testing.T) {
+	gitDir := t.TempDir()
+
+	needsAuto := func(config string) bool {
+		t.Helper()
+
+		writeFile(t, path.Join(gitDir, "config"), config)
+
+		needs, err := gc.NeedsAuto(gitDir)
+
+		if err != nil {
+			t.Fatalf("NeedsAuto failed with err %v", err)
+		}
+
+		return needs
+	}
+
+	if needsAuto("") {
+		t.Errorf("expected an empty repository to not need gc")
+	}
+
+	// objects/17 has 1/256 of the loose objects
+	for idx := range 2 {
+		writeFile(t, path.Join(gitDir, "objects/17", fmt.Sprintf("%038d", idx)), "")
+	}
+
+	if !needsAuto("[gc]\n\tauto = 256\n") {
+		t.Errorf("expected too many loose objects")
+	}
+
+	if needsAuto("[gc]\n\tauto = 512\n") {
+		t.Errorf("expected the loose objects to be under the limit")
+	}
+
+	if needsAuto("[gc]\n\tauto = 0\n") {
+		t.Errorf("expected gc.auto = 0 to disable it")
+	}
+}
@@ -0,0 +1,88 @@
+package gc
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+type PruneOptions struct {
+	// Only the objects not modified since it are pruned, the zero time
+	// prunes nothing
+	Expire time.Time
+	// Reports the objects without removing them
+	DryRun bool
+}
+
+// Unreachable loose object removed by prune
+type PrunedObject struct {
+	SHA  *sha.SHA
+	Type object.ObjectType
+}
+
+// Removes the loose objects not reachable from the refs, reflogs, HEAD or
+// the index like git prune, and returns them. Loose objects present in a
+// pack are removed too. Nothing is pruned in a partial clone as its
+// objects can't be walked without fetching the omitted ones
+func Prune(gitDir string, opts PruneOptions) ([]PrunedObject, error) {
+	gitFs := os.DirFS(gitDir)
+
+	packList, err := pack.ListPacks(gitFs)
+
+	if err != nil || isPartial(packList) {
+		return nil, err
+	}
+
+	loose, err := listLoose(gitDir)
+
+	if err != nil || len(loose) == 0 {
+		return nil, err
+	}
+
+	reachableSet, err := reachable.Set(gitFs, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	packed := make(map[string]bool)
+
+	for _, p := range packList {
+		for _, objSha := range p.Idx.Objects() {
+			packed[objSha.String()] = true
+		}
+	}
+
+	var pruned []PrunedObject
+
+	for _, obj := range loose {
+		isPacked := packed[obj.sha.String()]
+
+		if !isPacked && (reachableSet[obj.sha.String()] || obj.modTime.After(opts.Expire)) {
+			continue
+		}
+
+		if !isPacked {
+			// corrupted objects are pruned too, their type is unknown
+			contents, _ := object.FromSHA(obj.sha, gitFs)
+
+			pruned = append(pruned, PrunedObject{SHA: obj.sha, Type: contents.ObjType})
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		if err = os.Remove(obj.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,81 @@
+package gc_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/gc"
+	"github.com/uragirii/got/internals/git/object"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestPrune(t *testing.T) {
+	gitDir := t.TempDir()
+
+	commitSha := writeCommit(t, gitDir, "first")
+	unreachable := testutils.WriteObj(t, gitDir, object.BlobObj, "unreachable")
+	old := testutils.WriteObj(t, gitDir, object.BlobObj, "old")
+
+	oldPath, _ := old.GetObjPath()
+	monthAgo := time.Now().AddDate(0, -1, 0)
+
+	if err := os.Chtimes(path.Join(gitDir, oldPath), monthAgo, monthAgo); err != nil {
+		t.Fatalf("failed to change mtime %v", err)
+	}
+
+	t.Run("reports without removing for dry run", func(t *testing.T) {
+		pruned, err := gc.Prune(gitDir, gc.PruneOptions{Expire: time.Now(), DryRun: true})
+
+		if err != nil {
+			t.Fatalf("Prune failed with err %v", err)
+		}
+
+		if len(pruned) != 2 {
+			t.Fatalf("expected 2 objects but got %+v", pruned)
+		}
+
+		testutils.AssertString(t, "type", string(object.BlobObj), string(pruned[0].Type))
+
+		if !isLoose(gitDir, unreachable) || !isLoose(gitDir, old) {
+			t.Errorf("expected the objects to be kept")
+		}
+	})
+
+	t.Run("removes only the objects older than expire", func(t *testing.T) {
+		pruned, err := gc.Prune(gitDir, gc.PruneOptions{Expire: time.Now().AddDate(0, 0, -14)})
+
+		if err != nil {
+			t.Fatalf("Prune failed with err %v", err)
+		}
+
+		if len(pruned) != 1 {
+			t.Fatalf("expected 1 object but got %+v", pruned)
+		}
+
+		testutils.AssertString(t, "pruned", old.String(), pruned[0].SHA.String())
+
+		if isLoose(gitDir, old) || !isLoose(gitDir, unreachable) || !isLoose(gitDir, commitSha) {
+			t.Errorf("expected only the old object to be pruned")
+		}
+	})
+
+	t.Run("removes the packed objects", func(t *testing.T) {
+		if _, err := gc.Repack(gitDir, gc.RepackOptions{}); err != nil {
+			t.Fatalf("Repack failed with err %v", err)
+		}
+
+		if _, err := gc.Prune(gitDir, gc.PruneOptions{}); err != nil {
+			t.Fatalf("Prune failed with err %v", err)
+		}
+
+		if isLoose(gitDir, commitSha) {
+			t.Errorf("expected the packed commit to be removed")
+		}
+
+		if !isLoose(gitDir, unreachable) {
+			t.Errorf("expected nothing to be pruned for zero expire")
+		}
+	})
+}
@@ -0,0 +1,230 @@
+package gc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+type RepackOptions struct {
+	// Packs the objects of the existing packs too instead of only the
+	// loose objects, same as repack -a
+	All bool
+	// Removes the packs and the loose objects made redundant by the
+	// new pack, same as repack -d
+	Delete bool
+	// Unreachable objects of the removed packs are written loose so
+	// that they are pruned after the grace period instead of right away
+	KeepUnreachable bool
+	// "Counting objects" and "Writing objects" progress is written
+	// here, nil to disable
+	Progress io.Writer
+}
+
+// Returns the objects of the packs repack must not remove, the promisor
+// packs of a partial clone and the packs marked with .keep
+func keptObjects(packList []pack.PackFile) map[string]bool {
+	kept := make(map[string]bool)
+
+	for _, p := range packList {
+		if !p.Keep && !p.Promisor {
+			continue
+		}
+
+		for _, objSha := range p.Idx.Objects() {
+			kept[objSha.String()] = true
+		}
+	}
+
+	return kept
+}
+
+// Returns the objects to pack in a partial clone. Its objects can't be
+// walked as the omitted objects would be fetched, so all the loose objects
+// and the objects of the packs are packed whether reachable or not
+func partialObjects(loose []looseObject, packList []pack.PackFile, all bool) []*sha.SHA {
+	objects := make([]*sha.SHA, 0, len(loose))
+
+	for _, obj := range loose {
+		objects = append(objects, obj.sha)
+	}
+
+	if !all {
+		return objects
+	}
+
+	for _, p := range packList {
+		if !p.Keep && !p.Promisor {
+			objects = append(objects, p.Idx.Objects()...)
+		}
+	}
+
+	return objects
+}
+
+// Writes the objects of the pack which are not in the new pack as loose
+// objects, their mtime starts the grace period of prune
+func unpackUnreachable(gitDir string, p pack.PackFile, packed map[string]bool) error {
+	packFile, err := p.Open(os.DirFS(gitDir))
+
+	if err != nil {
+		return err
+	}
+
+	defer packFile.Close()
+
+	for _, objSha := range p.Idx.Objects() {
+		if packed[objSha.String()] {
+			continue
+		}
+
+		obj, err := packFile.GetObj(objSha)
+
+		if err != nil {
+			return fmt.Errorf("object %s: %w", objSha, err)
+		}
+
+		if _, err = object.WriteLoose(gitDir, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes the loose objects present in the packs, same as git prune-packed
+func prunePacked(gitDir string, loose []looseObject, packed map[string]bool) error {
+	for _, obj := range loose {
+		if !packed[obj.sha.String()] {
+			continue
+		}
+
+		if err := os.Remove(obj.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Packs the reachable objects into a new pack like git repack and returns
+// its checksum, nil if there was nothing to pack. Packs with a .keep file
+// and the promisor packs of a partial clone are never repacked
+func Repack(gitDir string, opts RepackOptions) (*sha.SHA, error) {
+	gitFs := os.DirFS(gitDir)
+
+	packList, err := pack.ListPacks(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loose, err := listLoose(gitDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kept := keptObjects(packList)
+
+	var candidates []*sha.SHA
+
+	if isPartial(packList) {
+		candidates = partialObjects(loose, packList, opts.All)
+	} else {
+		reachableObjs, err := reachable.Objects(gitFs, opts.Progress)
+
+		if err != nil {
+			return nil, err
+		}
+
+		looseSet := make(map[string]bool, len(loose))
+
+		for _, obj := range loose {
+			looseSet[obj.sha.String()] = true
+		}
+
+		for _, objSha := range reachableObjs {
+			if opts.All || looseSet[objSha.String()] {
+				candidates = append(candidates, objSha)
+			}
+		}
+	}
+
+	objects := make([]*sha.SHA, 0, len(candidates))
+	packed := make(map[string]bool, len(candidates))
+
+	for _, objSha := range candidates {
+		if !kept[objSha.String()] && !packed[objSha.String()] {
+			objects = append(objects, objSha)
+			packed[objSha.String()] = true
+		}
+	}
+
+	var checksum *sha.SHA
+
+	if len(objects) != 0 {
+		var buffer bytes.Buffer
+
+		if _, err = pack.WriteObjectsWithProgress(&buffer, gitFs, objects, opts.Progress); err != nil {
+			return nil, err
+		}
+
+		if checksum, err = pack.Store(gitDir, buffer.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.Delete {
+		return checksum, nil
+	}
+
+	// objects of the kept packs are never written loose
+	for objSha := range kept {
+		packed[objSha] = true
+	}
+
+	// a corrupted multi-pack-index is left alone, readers skip it
+	midx, _ := pack.ReadMultiPackIndex(gitFs)
+
+	for _, p := range packList {
+		isNewPack := checksum != nil && p.Name == "pack-"+checksum.String()
+
+		if !opts.All || p.Keep || p.Promisor || isNewPack {
+			// loose copies of the objects of the remaining packs are redundant
+			for _, objSha := range p.Idx.Objects() {
+				packed[objSha.String()] = true
+			}
+
+			continue
+		}
+
+		if opts.KeepUnreachable {
+			if err = unpackUnreachable(gitDir, p, packed); err != nil {
+				return nil, err
+			}
+		}
+
+		// git repack clears the multi-pack-index pointing to removed packs
+		if midx != nil && slices.Contains(midx.Packs(), p.Name) {
+			if err = pack.RemoveMultiPackIndex(gitDir); err != nil {
+				return nil, err
+			}
+
+			midx = nil
+		}
+
+		if err = pack.RemovePack(gitDir, p.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return checksum, prunePacked(gitDir, loose, packed)
+}
@@ -0,0 +1,155 @@
+package gc_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/gc"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Writes a commit with a single file and points refs/heads/main to it
+func writeCommit(t *testing.T, gitDir, fileContents string) *sha.SHA {
+	t.Helper()
+
+	commitSha, _, _ := testutils.WriteCommit(t, gitDir, fileContents)
+
+	if err := refs.Write(gitDir, "refs/heads/main", commitSha); err != nil {
+		t.Fatalf("Write failed with err %v", err)
+	}
+
+	return commitSha
+}
+
+func isLoose(gitDir string, objSha *sha.SHA) bool {
+	objPath, _ := objSha.GetObjPath()
+
+	_, err := os.Stat(path.Join(gitDir, objPath))
+
+	return err == nil
+}
+
+func listPacks(t *testing.T, gitDir string) []pack.PackFile {
+	t.Helper()
+
+	packList, err := pack.ListPacks(os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("ListPacks failed with err %v", err)
+	}
+
+	return packList
+}
+
+func TestRepack(t *testing.T) {
+	gitDir := t.TempDir()
+
+	commitSha := writeCommit(t, gitDir, "first")
+	unreachable := testutils.WriteObj(t, gitDir, object.BlobObj, "unreachable")
+
+	checksum, err := gc.Repack(gitDir, gc.RepackOptions{Delete: true})
+
+	if err != nil {
+		t.Fatalf("Repack failed with err %v", err)
+	}
+
+	packList := listPacks(t, gitDir)
+
+	if len(packList) != 1 || packList[0].Name != "pack-"+checksum.String() || len(packList[0].Idx.Objects()) != 3 {
+		t.Fatalf("expected a pack with the 3 reachable objects but got %+v", packList)
+	}
+
+	if isLoose(gitDir, commitSha) {
+		t.Errorf("expected the packed commit to be removed")
+	}
+
+	if !isLoose(gitDir, unreachable) {
+		t.Errorf("expected the unreachable blob to be kept loose")
+	}
+
+	t.Run("packs only the loose objects", func(t *testing.T) {
+		writeCommit(t, gitDir, "second")
+
+		if _, err := gc.Repack(gitDir, gc.RepackOptions{Delete: true}); err != nil {
+			t.Fatalf("Repack failed with err %v", err)
+		}
+
+		packList := listPacks(t, gitDir)
+
+		if len(packList) != 2 {
+			t.Fatalf("expected 2 packs but got %+v", packList)
+		}
+	})
+
+	t.Run("consolidates the packs with all", func(t *testing.T) {
+		if err := refs.Write(gitDir, "refs/heads/old", commitSha); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		if err := pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{}); err != nil {
+			t.Fatalf("WriteMultiPackIndex failed with err %v", err)
+		}
+
+		if _, err := gc.Repack(gitDir, gc.RepackOptions{All: true, Delete: true}); err != nil {
+			t.Fatalf("Repack failed with err %v", err)
+		}
+
+		packList := listPacks(t, gitDir)
+
+		if len(packList) != 1 || len(packList[0].Idx.Objects()) != 6 {
+			t.Fatalf("expected a single pack with 6 objects but got %+v", packList)
+		}
+
+		// it would point to the removed packs
+		if midx, _ := pack.ReadMultiPackIndex(os.DirFS(gitDir)); midx != nil {
+			t.Errorf("expected the multi-pack-index to be removed")
+		}
+	})
+
+	t.Run("unpacks the unreachable objects", func(t *testing.T) {
+		if err := refs.Delete(gitDir, "refs/heads/old"); err != nil {
+			t.Fatalf("Delete failed with err %v", err)
+		}
+
+		if _, err := gc.Repack(gitDir, gc.RepackOptions{All: true, Delete: true, KeepUnreachable: true}); err != nil {
+			t.Fatalf("Repack failed with err %v", err)
+		}
+
+		if !isLoose(gitDir, commitSha) {
+			t.Errorf("expected the unreachable commit to be written loose")
+		}
+
+		packList := listPacks(t, gitDir)
+
+		if len(packList) != 1 || len(packList[0].Idx.Objects()) != 3 {
+			t.Fatalf("expected a single pack with 3 objects but got %+v", packList)
+		}
+	})
+
+	t.Run("keeps the packs with .keep", func(t *testing.T) {
+		keepPath := path.Join(gitDir, "objects/pack", listPacks(t, gitDir)[0].Name+".keep")
+
+		if err := os.WriteFile(keepPath, nil, 0644); err != nil {
+			t.Fatalf("failed to write .keep %v", err)
+		}
+
+		checksum, err := gc.Repack(gitDir, gc.RepackOptions{All: true, Delete: true})
+
+		if err != nil {
+			t.Fatalf("Repack failed with err %v", err)
+		}
+
+		if checksum != nil {
+			t.Errorf("expected nothing to pack but got %s", checksum)
+		}
+
+		if packList := listPacks(t, gitDir); len(packList) != 1 || !packList[0].Keep {
+			t.Errorf("expected the kept pack but got %+v", packList)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package head
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -10,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/refs"
 	"github.com/uragirii/got/internals/git/sha"
 )
 
@@ -28,6 +30,7 @@ const (
 )
 
 type Head struct {
+	// nil when the branch doesn't have any commits yet
 	SHA    *sha.SHA
 	Mode   Mode
 	Branch string
@@ -36,23 +39,8 @@ type Head struct {
 var ErrInvalidHead = fmt.Errorf("invalid HEAD")
 
 func newRefHead(headData []byte, gitFs fs.FS) (*Head, error) {
-
 	refPath := string(headData[len(_Ref):])
 
-	branchFile, err := gitFs.Open(refPath)
-
-	if err != nil {
-		return nil, err
-	}
-
-	defer branchFile.Close()
-
-	var buffer bytes.Buffer
-
-	buffer.ReadFrom(branchFile)
-
-	shaBytes := buffer.Bytes()
-
 	var branch string
 
 	headMode := Tag
@@ -62,9 +50,16 @@ func newRefHead(headData []byte, gitFs fs.FS) (*Head, error) {
 		branch = refPath[len(_BranchPrefix):]
 	}
 
-	// Need to convert to string as the SHA in hex is stored as string
-	// in the file and the bytes are not ASCII for those hex characters
-	sha, err := sha.FromString(string(shaBytes))
+	// the ref can be loose or in packed-refs after gc
+	sha, err := refs.Read(gitFs, refPath)
+
+	if errors.Is(err, refs.ErrRefNotFound) && headMode == Branch {
+		// Unborn branch, there are no commits yet
+		return &Head{
+			Mode:   Branch,
+			Branch: branch,
+		}, nil
+	}
 
 	if err != nil {
 		return nil, err
@@ -138,17 +133,7 @@ func writeDetachedHead(sha *sha.SHA) error {
 		return err
 	}
 
-	headFile, err := os.Open(path.Join(gitDir, _HeadFile))
-
-	if err != nil {
-		return err
-	}
-
-	defer headFile.Close()
-
-	headFile.WriteString(sha.String())
-
-	return nil
+	return os.WriteFile(path.Join(gitDir, _HeadFile), []byte(sha.String()+"\n"), 0644)
 }
 
 func writeBranchHead(sha *sha.SHA, branch string) error {
@@ -160,6 +145,10 @@ func writeBranchHead(sha *sha.SHA, branch string) error {
 
 	branchFilePath := path.Join(gitDir, _BranchPrefix+branch)
 
+	if err = os.MkdirAll(path.Dir(branchFilePath), 0755); err != nil {
+		return err
+	}
+
 	return os.WriteFile(branchFilePath, []byte(sha.String()+"\n"), 0644)
 
 }
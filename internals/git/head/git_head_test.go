@@ -65,5 +65,42 @@ func TestNew(t *testing.T) {
 		}
 	})
 
+	t.Run("it works for packed branch", func(t *testing.T) {
+		fs := fstest.MapFS(fstest.MapFS{
+			"HEAD":        {Data: []byte("ref: refs/heads/main\n")},
+			"packed-refs": {Data: []byte("# pack-refs with: sorted \n14201e266991676173cbd041257cf1a0d8ff3a3a refs/heads/main\n")},
+		})
+
+		gitHead, err := head.New(fs)
+
+		if err != nil {
+			t.Fatalf("expected error to be nil got: %v", err)
+		}
+
+		if gitHead.Mode != head.Branch || gitHead.SHA == nil || gitHead.SHA.String() != "14201e266991676173cbd041257cf1a0d8ff3a3a" {
+			t.Errorf("expected the packed branch but got %+v", gitHead)
+		}
+	})
+
 	// TODO: check for Tagged head
 }
+
+func TestNewUnborn(t *testing.T) {
+	fs := fstest.MapFS(fstest.MapFS{
+		"HEAD": {Data: []byte("ref: refs/heads/main\n")},
+	})
+
+	gitHead, err := head.New(fs)
+
+	if err != nil {
+		t.Fatalf("expected error to be nil got: %v", err)
+	}
+
+	if gitHead.Mode != head.Branch || gitHead.Branch != "main" {
+		t.Errorf("expected unborn branch main but got mode %d branch %s", gitHead.Mode, gitHead.Branch)
+	}
+
+	if gitHead.SHA != nil {
+		t.Errorf("expected SHA to be nil for unborn branch but got %s", gitHead.SHA)
+	}
+}
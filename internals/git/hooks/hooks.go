@@ -0,0 +1,120 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+
+	"github.com/uragirii/got/internals/git/config"
+)
+
+// @see https://git-scm.com/docs/githooks
+type Hook string
+
+const (
+	PreCommit        Hook = "pre-commit"
+	PrepareCommitMsg Hook = "prepare-commit-msg"
+	CommitMsg        Hook = "commit-msg"
+	PostCommit       Hook = "post-commit"
+	PostCheckout     Hook = "post-checkout"
+	PrePush          Hook = "pre-push"
+	PostMerge        Hook = "post-merge"
+	PreReceive       Hook = "pre-receive"
+	Update           Hook = "update"
+	PostReceive      Hook = "post-receive"
+	PostUpdate       Hook = "post-update"
+)
+
+const _HooksDir = "hooks"
+
+var ErrHookFailed = errors.New("hook failed")
+
+type Runner struct {
+	// Directory containing the hook executables
+	Dir string
+	// Hooks are run from this directory, worktree root or
+	// git dir for bare repositories
+	WorkDir string
+	// Extra env vars passed to the hooks in KEY=VALUE format
+	Env []string
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Creates a runner using core.hooksPath or <gitDir>/hooks.
+// Relative hooksPath is resolved from the workDir like git
+func New(gitDir, workDir string, c *config.Config) *Runner {
+	hooksDir := path.Join(gitDir, _HooksDir)
+
+	if hooksPath, ok := c.Get("core.hooksPath"); ok && hooksPath != "" {
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = path.Join(workDir, hooksPath)
+		}
+
+		hooksDir = hooksPath
+	}
+
+	return &Runner{
+		Dir:     hooksDir,
+		WorkDir: workDir,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+}
+
+func (r *Runner) hookPath(hook Hook) string {
+	return path.Join(r.Dir, string(hook))
+}
+
+// Hooks which are not executable are ignored like git
+func (r *Runner) Exists(hook Hook) bool {
+	stat, err := os.Stat(r.hookPath(hook))
+
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode().IsRegular() && stat.Mode().Perm()&0111 != 0
+}
+
+// Runs the hook if it exists. Returns ErrHookFailed if it exits
+// with non zero status, callers decide if that should abort
+func (r *Runner) Run(hook Hook, stdin io.Reader, args ...string) error {
+	hookPath := r.hookPath(hook)
+
+	if !r.Exists(hook) {
+		if stat, err := os.Stat(hookPath); err == nil && stat.Mode().IsRegular() {
+			fmt.Fprintf(r.Stderr, "hint: The '%s' hook was ignored because it's not set as executable.\n", hookPath)
+		}
+
+		return nil
+	}
+
+	cmd := exec.Command(hookPath, args...)
+
+	cmd.Dir = r.WorkDir
+	cmd.Env = append(os.Environ(), r.Env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("%w: %s exited with status %d", ErrHookFailed, hook, exitErr.ExitCode())
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package hooks_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/hooks"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func writeHook(t *testing.T, dir string, hook hooks.Hook, script string, perm os.FileMode) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create hooks dir %v", err)
+	}
+
+	if err := os.WriteFile(path.Join(dir, string(hook)), []byte(script), perm); err != nil {
+		t.Fatalf("failed to write hook %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	workDir := t.TempDir()
+	gitDir := path.Join(workDir, ".git")
+
+	t.Run("runs hook with args and stdin", func(t *testing.T) {
+		writeHook(t, path.Join(gitDir, "hooks"), hooks.PrePush, "#!/bin/sh\necho \"$1 $2\"\ncat\n", 0755)
+
+		var stdout bytes.Buffer
+
+		runner := hooks.New(gitDir, workDir, &config.Config{})
+		runner.Stdout = &stdout
+
+		err := runner.Run(hooks.PrePush, strings.NewReader("refs/heads/main\n"), "origin", "https://example.com")
+
+		if err != nil {
+			t.Fatalf("Run failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "stdout", "origin https://example.com\nrefs/heads/main\n", stdout.String())
+	})
+
+	t.Run("returns ErrHookFailed on non zero exit", func(t *testing.T) {
+		writeHook(t, path.Join(gitDir, "hooks"), hooks.PreCommit, "#!/bin/sh\nexit 1\n", 0755)
+
+		err := hooks.New(gitDir, workDir, &config.Config{}).Run(hooks.PreCommit, nil)
+
+		if !errors.Is(err, hooks.ErrHookFailed) {
+			t.Errorf("expected ErrHookFailed but got %v", err)
+		}
+	})
+
+	t.Run("ignores non executable hooks", func(t *testing.T) {
+		writeHook(t, path.Join(gitDir, "hooks"), hooks.CommitMsg, "#!/bin/sh\nexit 1\n", 0644)
+
+		var stderr bytes.Buffer
+
+		runner := hooks.New(gitDir, workDir, &config.Config{})
+		runner.Stderr = &stderr
+
+		if err := runner.Run(hooks.CommitMsg, nil); err != nil {
+			t.Errorf("expected no error but got %v", err)
+		}
+
+		if !strings.Contains(stderr.String(), "not set as executable") {
+			t.Errorf("expected hint about non executable hook but got %q", stderr.String())
+		}
+	})
+
+	t.Run("uses core.hooksPath relative to work dir", func(t *testing.T) {
+		writeHook(t, path.Join(workDir, "my-hooks"), hooks.PostCommit, "#!/bin/sh\npwd\n", 0755)
+
+		c, err := config.New(strings.NewReader("[core]\n\thooksPath = my-hooks\n"))
+
+		if err != nil {
+			t.Fatalf("config.New failed with err %v", err)
+		}
+
+		var stdout bytes.Buffer
+
+		runner := hooks.New(gitDir, workDir, c)
+		runner.Stdout = &stdout
+
+		if err := runner.Run(hooks.PostCommit, nil); err != nil {
+			t.Fatalf("Run failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "hook run from work dir", workDir+"\n", stdout.String())
+	})
+}
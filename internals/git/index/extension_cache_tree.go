@@ -280,8 +280,7 @@ func (tree *CacheTree) Hydrate(basePath string, index *Index) (int, error) {
 		enteries = append(enteries, objTree.TreeEntry{
 			Name: item.Name(),
 			SHA:  indexEntry.SHA,
-			// TODO: Fixme check mode from index file and then check
-			Mode: objTree.ModeNormal,
+			Mode: indexEntry.mode.treeMode(),
 		})
 		entryCount++
 
@@ -324,3 +323,19 @@ func (tree *CacheTree) Hydrate(basePath string, index *Index) (int, error) {
 
 	return entryCount, nil
 }
+
+// Returns the SHAs of the valid trees of the cache tree, the
+// invalidated trees don't have any
+func (tree *CacheTree) TreeSHAs() []*sha.SHA {
+	var shas []*sha.SHA
+
+	if !tree.IsInvalidated && tree.SHA != nil {
+		shas = append(shas, tree.SHA)
+	}
+
+	for _, subTree := range tree.SubTrees {
+		shas = append(shas, subTree.TreeSHAs()...)
+	}
+
+	return shas
+}
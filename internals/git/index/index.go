@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -25,6 +26,8 @@ type Index struct {
 	fileMap   map[string]*IndexEntry
 	cacheTree *CacheTree
 	sha       *sha.SHA
+	// Add updates the entries concurrently
+	mu sync.Mutex
 }
 
 var (
@@ -311,7 +314,13 @@ func (i *Index) Add(filePaths []string, fsys fs.FS) error {
 				panic(err)
 			}
 
-			i.fileMap[filePath] = &IndexEntry{
+			// written outside the lock so the blobs are written in parallel,
+			// before the entry so the index never has a missing blob
+			if err = obj.WriteToFile(); err != nil {
+				panic(err)
+			}
+
+			entry := &IndexEntry{
 				ctime: fileStat.Ctimespec,
 				mtime: fileStat.Mtimespec,
 				mode:  mode,
@@ -327,14 +336,10 @@ func (i *Index) Add(filePaths []string, fsys fs.FS) error {
 				Filepath: filePath,
 			}
 
+			i.mu.Lock()
+			i.fileMap[filePath] = entry
 			i.cacheTree.add(strings.Split(filepath.Dir(filePath), string(filepath.Separator)))
-
-			err = obj.WriteToFile()
-
-			if err != nil {
-				panic(err)
-			}
-
+			i.mu.Unlock()
 		}(filePath)
 
 	}
@@ -344,6 +349,63 @@ func (i *Index) Add(filePaths []string, fsys fs.FS) error {
 	return nil
 }
 
+// Removes the file from the index, no-op if the file isn't tracked
+func (i *Index) Remove(filePath string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if _, ok := i.fileMap[filePath]; !ok {
+		return
+	}
+
+	delete(i.fileMap, filePath)
+
+	i.cacheTree.add(strings.Split(filepath.Dir(filePath), string(filepath.Separator)))
+}
+
+// Stages modifications and deletions of the tracked files
+// similar to git add -u. Returns the paths that were updated
+func (i *Index) Update(fsys fs.FS) ([]string, error) {
+	var modified []string
+	var updated []string
+
+	for _, entry := range i.GetTrackedFiles() {
+		file, err := fsys.Open(entry.Filepath)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			i.Remove(entry.Filepath)
+			updated = append(updated, entry.Filepath)
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj, err := blob.FromFile(file)
+
+		file.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !obj.GetSHA().Eq(entry.SHA) {
+			modified = append(modified, entry.Filepath)
+		}
+	}
+
+	if err := i.Add(modified, fsys); err != nil {
+		return nil, err
+	}
+
+	updated = append(updated, modified...)
+
+	sort.Strings(updated)
+
+	return updated, nil
+}
+
 func (i *Index) Hydrate() error {
 
 	gitDir, err := internals.GetGitDir()
@@ -365,7 +427,7 @@ func (i *Index) Hydrate() error {
 	return nil
 }
 
-func (i Index) Debug(writer io.Writer) {
+func (i *Index) Debug(writer io.Writer) {
 	sortedEnteries := i.GetTrackedFiles()
 
 	for _, entry := range sortedEnteries {
@@ -373,6 +435,15 @@ func (i Index) Debug(writer io.Writer) {
 	}
 }
 
-func (i Index) GetTreeSHA() *sha.SHA {
+func (i *Index) GetTreeSHA() *sha.SHA {
 	return i.cacheTree.SHA
 }
+
+// Returns the trees recorded in the cache tree extension
+func (i *Index) CacheTreeSHAs() []*sha.SHA {
+	if i.cacheTree == nil {
+		return nil
+	}
+
+	return i.cacheTree.TreeSHAs()
+}
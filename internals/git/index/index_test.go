@@ -10,7 +10,10 @@ import (
 	"testing"
 	"testing/fstest"
 
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/blob"
 	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/tree"
 	testutils "github.com/uragirii/got/internals/test_utils"
 )
 
@@ -199,3 +202,98 @@ func TestIndexAdd(t *testing.T) {
 	testutils.AssertString(t, "debug", addedFileBytes, gotBytes)
 
 }
+
+func TestCacheTreeSHAs(t *testing.T) {
+	indexFile, err := os.Open(path.Join(TEST_DIR, "normal"))
+
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	defer indexFile.Close()
+
+	i, err := index.New(indexFile)
+
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	shas := i.CacheTreeSHAs()
+
+	if len(shas) != 16 {
+		t.Fatalf("expected 16 trees but got %d", len(shas))
+	}
+
+	testutils.AssertString(t, "root", "4815b7124d964006d38e5e893017e8038895deec", shas[0].String())
+	testutils.AssertString(t, "cmd", "87eb04e0e70ec5ac20366a607699d5facb948fc6", shas[1].String())
+}
+
+func TestIndexUpdate(t *testing.T) {
+	root := t.TempDir()
+	gitDir := path.Join(root, ".git")
+
+	// the git dir is cached after the first lookup
+	internals.GIT_DIR = gitDir
+	t.Cleanup(func() { internals.GIT_DIR = "" })
+
+	files := map[string]string{
+		"deleted.txt":   "deleted\n",
+		"modified.txt":  "original\n",
+		"unchanged.txt": "unchanged\n",
+	}
+
+	entries := make([]tree.TreeEntry, 0, len(files))
+
+	for name, contents := range files {
+		if err := os.WriteFile(path.Join(root, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		obj, _ := blob.FromFile(strings.NewReader(contents))
+
+		entries = append(entries, tree.TreeEntry{Name: name, Mode: tree.ModeNormal, SHA: obj.GetSHA()})
+	}
+
+	indexTree, _ := tree.FromEnteries(entries)
+
+	i, err := index.FromTree(root, indexTree, os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("FromTree failed with err %v", err)
+	}
+
+	os.Remove(path.Join(root, "deleted.txt"))
+	os.WriteFile(path.Join(root, "modified.txt"), []byte("modified\n"), 0644)
+
+	// Add stats the paths relative to the work tree
+	sysStat := index.SysStat
+	index.SysStat = func(filePath string, stat *syscall.Stat_t) error {
+		return syscall.Stat(path.Join(root, filePath), stat)
+	}
+	t.Cleanup(func() { index.SysStat = sysStat })
+
+	updated, err := i.Update(os.DirFS(root))
+
+	if err != nil {
+		t.Fatalf("Update failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "updated", "deleted.txt modified.txt", strings.Join(updated, " "))
+
+	if i.Has("deleted.txt") {
+		t.Errorf("expected deleted.txt to be removed")
+	}
+
+	modified, _ := blob.FromFile(strings.NewReader("modified\n"))
+
+	unchanged, _ := blob.FromFile(strings.NewReader("unchanged\n"))
+
+	testutils.AssertString(t, "modified", modified.GetSHA().String(), i.Get("modified.txt").SHA.String())
+	testutils.AssertString(t, "unchanged", unchanged.GetSHA().String(), i.Get("unchanged.txt").SHA.String())
+
+	objPath, _ := modified.GetSHA().GetObjPath()
+
+	if _, err = os.Stat(path.Join(gitDir, objPath)); err != nil {
+		t.Errorf("expected the modified blob to be written but got %v", err)
+	}
+}
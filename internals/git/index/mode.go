@@ -3,6 +3,8 @@ package index
 import (
 	"io"
 	"io/fs"
+
+	objTree "github.com/uragirii/got/internals/git/tree"
 )
 
 // binary are 1000 (regular file), 1010 (symbolic link) and 1110 (gitlink)
@@ -67,3 +69,16 @@ func (m mode) Write(writer io.Writer) (int, error) {
 
 	return writeUint32(num, writer)
 }
+
+func (m mode) treeMode() objTree.Mode {
+	switch {
+	case m.fileType == modeSymLink:
+		return objTree.ModeSymLink
+	case m.fileType == modeGitLink:
+		return objTree.ModeGitLink
+	case m.perm == 0755:
+		return objTree.ModeExecutable
+	}
+
+	return objTree.ModeNormal
+}
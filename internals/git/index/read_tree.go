@@ -0,0 +1,113 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"syscall"
+
+	objTree "github.com/uragirii/got/internals/git/tree"
+)
+
+var (
+	SysLstat = syscall.Lstat
+)
+
+func modeFromTreeMode(treeMode objTree.Mode) (*mode, error) {
+	switch treeMode {
+	case objTree.ModeNormal:
+		return &mode{fileType: modeRegular, perm: 0644}, nil
+	case objTree.ModeExecutable:
+		return &mode{fileType: modeRegular, perm: 0755}, nil
+	case objTree.ModeSymLink:
+		return &mode{fileType: modeSymLink}, nil
+	case objTree.ModeGitLink:
+		return &mode{fileType: modeGitLink}, nil
+	}
+
+	return nil, ErrInvalidEntryMode
+}
+
+func (i *Index) readTree(root, relPath string, tree *objTree.Tree, gitFs fs.FS) (*CacheTree, error) {
+	cacheTree := &CacheTree{
+		RelPath:  path.Base(relPath),
+		SubTrees: make([]*CacheTree, 0),
+		SHA:      tree.SHA,
+	}
+
+	if relPath == "" {
+		cacheTree.RelPath = ""
+	}
+
+	for _, entry := range tree.Entries() {
+		filePath := path.Join(relPath, entry.Name)
+
+		if entry.Mode == objTree.ModeDir {
+			subTree, err := entry.GetTree(gitFs)
+
+			if err != nil {
+				return nil, err
+			}
+
+			subCacheTree, err := i.readTree(root, filePath, subTree, gitFs)
+
+			if err != nil {
+				return nil, err
+			}
+
+			cacheTree.SubTrees = append(cacheTree.SubTrees, subCacheTree)
+			cacheTree.SubTreesCount++
+			cacheTree.EntryCount += subCacheTree.EntryCount
+
+			continue
+		}
+
+		entryMode, err := modeFromTreeMode(entry.Mode)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s for %s", err, entry.Mode, filePath)
+		}
+
+		var fileStat syscall.Stat_t
+
+		if err = SysLstat(path.Join(root, filePath), &fileStat); err != nil {
+			return nil, err
+		}
+
+		i.fileMap[filePath] = &IndexEntry{
+			ctime:    fileStat.Ctimespec,
+			mtime:    fileStat.Mtimespec,
+			mode:     entryMode,
+			devId:    uint32(fileStat.Dev),
+			uid:      uint32(fileStat.Uid),
+			gid:      uint32(fileStat.Gid),
+			inode:    uint32(fileStat.Ino),
+			Size:     uint32(fileStat.Size),
+			SHA:      entry.SHA,
+			Filepath: filePath,
+		}
+
+		cacheTree.EntryCount++
+	}
+
+	return cacheTree, nil
+}
+
+// Creates the index from the tree, similar to git read-tree.
+// The files should already be checked out in the root as
+// their stat info is recorded in the index
+func FromTree(root string, tree *objTree.Tree, gitFs fs.FS) (*Index, error) {
+	i := &Index{
+		fileMap: make(map[string]*IndexEntry),
+	}
+
+	cacheTree, err := i.readTree(root, "", tree, gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i.cacheTree = cacheTree
+
+	return i, nil
+}
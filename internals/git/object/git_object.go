@@ -1,12 +1,17 @@
 package object
 
 import (
+	"bytes"
 	"compress/zlib"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path"
 	"slices"
 	"strconv"
+	"sync"
 
 	"github.com/uragirii/got/internals/git/sha"
 )
@@ -16,6 +21,7 @@ var ErrInvalidObj = fmt.Errorf("invalid git object")
 const BlobHeader string = "blob %d\u0000"
 const TreeHeader string = "tree %d\u0000"
 const CommitHeader string = "commit %d\u0000"
+const TagHeader string = "tag %d\u0000"
 
 type ObjectType string
 
@@ -23,10 +29,142 @@ const (
 	BlobObj   ObjectType = "blob"
 	TreeObj   ObjectType = "tree"
 	CommitObj ObjectType = "commit"
+	TagObj    ObjectType = "tag"
 )
 
 func IsValidObjectType(objType string) bool {
-	return objType == string(BlobObj) || objType == string(TreeObj) || objType == string(CommitObj)
+	return objType == string(BlobObj) || objType == string(TreeObj) || objType == string(CommitObj) || objType == string(TagObj)
+}
+
+// Returns the raw object with the header, SHA of an object is
+// calculated over these bytes
+func WithHeader(objType ObjectType, contents []byte) []byte {
+	header := fmt.Sprintf("%s %d\u0000", objType, len(contents))
+
+	return append([]byte(header), contents...)
+}
+
+// Lookup for the objects stored in packs. This is set by
+// the pack package as it depends on this package
+type PackedObjStore interface {
+	Read(sha *sha.SHA, fsys fs.FS) (ObjectContents, error)
+	Has(sha *sha.SHA, fsys fs.FS) bool
+}
+
+var _PackedObjStore PackedObjStore
+
+func RegisterPackedObjStore(store PackedObjStore) {
+	_PackedObjStore = store
+}
+
+// Fetches the objects missing from a partial clone from its promisor
+// remote. This is set by the remote package as it depends on this package
+type Promisor interface {
+	FetchMissing(shas []*sha.SHA, fsys fs.FS) error
+}
+
+type registeredPromisor struct {
+	gitDir   fs.FileInfo
+	promisor Promisor
+}
+
+var _PromisorsMu sync.Mutex
+var _Promisors []registeredPromisor
+
+// Registers the promisor of the partial clone at gitFs, the objects of
+// the other repositories are never fetched by it
+func RegisterPromisor(gitFs fs.FS, promisor Promisor) error {
+	gitDir, err := fs.Stat(gitFs, ".")
+
+	if err != nil {
+		return err
+	}
+
+	_PromisorsMu.Lock()
+	defer _PromisorsMu.Unlock()
+
+	for idx, registered := range _Promisors {
+		if os.SameFile(registered.gitDir, gitDir) {
+			_Promisors[idx].promisor = promisor
+			return nil
+		}
+	}
+
+	_Promisors = append(_Promisors, registeredPromisor{gitDir: gitDir, promisor: promisor})
+
+	return nil
+}
+
+// Checks if both are the same git dir, the paths can differ for the same
+// dir like with symlinks or a relative path
+func SameRepository(a, b fs.FS) bool {
+	aInfo, err := fs.Stat(a, ".")
+
+	if err != nil {
+		return false
+	}
+
+	bInfo, err := fs.Stat(b, ".")
+
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(aInfo, bInfo)
+}
+
+func promisorOf(fsys fs.FS) Promisor {
+	_PromisorsMu.Lock()
+	defer _PromisorsMu.Unlock()
+
+	if len(_Promisors) == 0 {
+		return nil
+	}
+
+	gitDir, err := fs.Stat(fsys, ".")
+
+	if err != nil {
+		return nil
+	}
+
+	for _, registered := range _Promisors {
+		if os.SameFile(registered.gitDir, gitDir) {
+			return registered.promisor
+		}
+	}
+
+	return nil
+}
+
+// Checks if the missing objects of the repository can be fetched, ex: to
+// skip preparing a Prefetch
+func HasPromisor(fsys fs.FS) bool {
+	return promisorOf(fsys) != nil
+}
+
+// Fetches the objects missing from the repository at once, used to batch
+// the lazy fetches like for the blobs of a tree before checking it out.
+// Nothing is fetched if the repository isn't a partial clone
+func Prefetch(shas []*sha.SHA, fsys fs.FS) error {
+	promisor := promisorOf(fsys)
+
+	if promisor == nil {
+		return nil
+	}
+
+	var missing []*sha.SHA
+
+	for _, objSha := range shas {
+		if !Exists(objSha, fsys) {
+			missing = append(missing, objSha)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return promisor.FetchMissing(missing, fsys)
 }
 
 type Object interface {
@@ -62,8 +200,8 @@ func Decompress(reader io.Reader) (*[]byte, error) {
 	return &uncompressed, nil
 }
 
-func FromSHA(sha *sha.SHA, fsys fs.FS) (ObjectContents, error) {
-	objPath, err := sha.GetObjPath()
+func FromSHA(objSha *sha.SHA, fsys fs.FS) (ObjectContents, error) {
+	objPath, err := objSha.GetObjPath()
 
 	if err != nil {
 		return ObjectContents{}, err
@@ -71,6 +209,17 @@ func FromSHA(sha *sha.SHA, fsys fs.FS) (ObjectContents, error) {
 
 	objFile, err := fsys.Open(objPath)
 
+	if errors.Is(err, fs.ErrNotExist) && _PackedObjStore != nil {
+		// objects omitted from a partial clone are fetched when read
+		if promisor := promisorOf(fsys); promisor != nil && !_PackedObjStore.Has(objSha, fsys) {
+			if fetchErr := promisor.FetchMissing([]*sha.SHA{objSha}, fsys); fetchErr != nil {
+				return ObjectContents{}, fetchErr
+			}
+		}
+
+		return _PackedObjStore.Read(objSha, fsys)
+	}
+
 	if err != nil {
 		return ObjectContents{}, err
 	}
@@ -81,6 +230,89 @@ func FromSHA(sha *sha.SHA, fsys fs.FS) (ObjectContents, error) {
 
 }
 
+// Checks if the object is present either loose or in a pack
+// without reading its contents
+func Exists(sha *sha.SHA, fsys fs.FS) bool {
+	objPath, err := sha.GetObjPath()
+
+	if err != nil {
+		return false
+	}
+
+	if _, err = fs.Stat(fsys, objPath); err == nil {
+		return true
+	}
+
+	return _PackedObjStore != nil && _PackedObjStore.Has(sha, fsys)
+}
+
+// Writes the object as a loose object and returns its SHA, nothing
+// is written if the object is already present as a loose object
+func WriteLoose(gitDir string, obj ObjectContents) (*sha.SHA, error) {
+	raw := WithHeader(obj.ObjType, *obj.Contents)
+
+	objSha, err := sha.FromData(&raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objPath, err := objSha.GetObjPath()
+
+	if err != nil {
+		return nil, err
+	}
+
+	objPath = path.Join(gitDir, objPath)
+
+	if _, err = os.Stat(objPath); err == nil {
+		return objSha, nil
+	}
+
+	var buffer bytes.Buffer
+
+	w := zlib.NewWriter(&buffer)
+
+	if _, err = w.Write(raw); err != nil {
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(path.Dir(objPath), 0755); err != nil {
+		return nil, err
+	}
+
+	// written to a temp file and renamed like git so that readers
+	// never see a partial object
+	tmpFile, err := os.CreateTemp(path.Dir(objPath), "tmp_obj_")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(buffer.Bytes())
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Read only file
+	if err = os.Chmod(tmpFile.Name(), 0444); err != nil {
+		return nil, err
+	}
+
+	return objSha, os.Rename(tmpFile.Name(), objPath)
+}
+
 func FromData(r io.Reader) (ObjectContents, error) {
 	decompressedContents, err := Decompress(r)
 
@@ -91,6 +323,11 @@ func FromData(r io.Reader) (ObjectContents, error) {
 	return getContents(decompressedContents)
 }
 
+// Parses the decompressed loose object, "<type> <length>\x00<contents>"
+func FromRaw(decompressedContents *[]byte) (ObjectContents, error) {
+	return getContents(decompressedContents)
+}
+
 func getContents(decompressedContents *[]byte) (ObjectContents, error) {
 	headerEndIdx := slices.Index(*decompressedContents, 0x00)
 
@@ -112,13 +349,11 @@ func getContents(decompressedContents *[]byte) (ObjectContents, error) {
 	byteLen, err := strconv.Atoi(byteLenStr)
 
 	if err != nil {
-		fmt.Println("invalid bytelen", err)
-		return ObjectContents{}, ErrInvalidObj
+		return ObjectContents{}, fmt.Errorf("%w: invalid length %q", ErrInvalidObj, byteLenStr)
 	}
 
 	if byteLen != len(contents) {
-		fmt.Printf("expected bytelen to be %d but found %d\n", byteLen, len(contents))
-		return ObjectContents{}, ErrInvalidObj
+		return ObjectContents{}, fmt.Errorf("%w: expected length %d but found %d", ErrInvalidObj, byteLen, len(contents))
 	}
 
 	objType := string(header[:headerSpaceIdx])
@@ -142,8 +377,14 @@ func getContents(decompressedContents *[]byte) (ObjectContents, error) {
 			Contents: &contents,
 		}, nil
 
+	case TagObj:
+		return ObjectContents{
+			ObjType:  TagObj,
+			Contents: &contents,
+		}, nil
+
 	default:
-		return ObjectContents{}, ErrInvalidObj
+		return ObjectContents{}, fmt.Errorf("%w: unknown type %q", ErrInvalidObj, objType)
 
 	}
 }
@@ -0,0 +1,307 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+var ErrBadObject = errors.New("bad object")
+
+// Tree entry modes git writes, submodules are not followed as links
+const (
+	_ModeGitLink = "160000"
+	_ModeDir     = "40000"
+)
+
+var _ValidModes = map[string]bool{
+	"100644":     true,
+	"100755":     true,
+	"120000":     true,
+	_ModeDir:     true,
+	_ModeGitLink: true,
+}
+
+// Name <email> <unix timestamp> <+-hhmm>
+var _IdentRegex = regexp.MustCompile(`^[^<>\n]*<[^<>\n]*> [0-9]+ [+-][0-9]{4}$`)
+
+func badObject(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrBadObject, fmt.Sprintf(format, args...))
+}
+
+// Reads the "<key> <value>" headers till the blank line before the message
+func readHeaders(contents []byte) ([][2]string, error) {
+	var headers [][2]string
+
+	for len(contents) != 0 {
+		line, rest, found := bytes.Cut(contents, []byte("\n"))
+
+		if !found {
+			return nil, badObject("unterminated header")
+		}
+
+		contents = rest
+
+		if len(line) == 0 {
+			return headers, nil
+		}
+
+		// continuation lines of multi line headers like gpgsig
+		if line[0] == ' ' {
+			if len(headers) == 0 {
+				return nil, badObject("continuation line without a header")
+			}
+
+			continue
+		}
+
+		key, value, _ := strings.Cut(string(line), " ")
+
+		headers = append(headers, [2]string{key, value})
+	}
+
+	// objects without a message don't need the blank line
+	return headers, nil
+}
+
+// Checks that the next header has the key and returns its value
+func expectHeader(headers [][2]string, idx int, key string) (string, error) {
+	if idx >= len(headers) || headers[idx][0] != key {
+		return "", badObject("missing %s", key)
+	}
+
+	return headers[idx][1], nil
+}
+
+func parseLink(key, value string) (*sha.SHA, error) {
+	link, err := sha.FromString(value)
+
+	if err != nil {
+		return nil, badObject("invalid %s %q", key, value)
+	}
+
+	return link, nil
+}
+
+func checkIdent(key, value string) error {
+	if !_IdentRegex.MatchString(value) {
+		return badObject("invalid %s %q", key, value)
+	}
+
+	return nil
+}
+
+func checkCommit(contents []byte) ([]Link, error) {
+	headers, err := readHeaders(contents)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := expectHeader(headers, 0, "tree")
+
+	if err != nil {
+		return nil, err
+	}
+
+	treeSha, err := parseLink("tree", value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	links := []Link{{SHA: treeSha, Type: TreeObj}}
+	idx := 1
+
+	for ; idx < len(headers) && headers[idx][0] == "parent"; idx++ {
+		parent, err := parseLink("parent", headers[idx][1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, Link{SHA: parent, Type: CommitObj})
+	}
+
+	for _, key := range []string{"author", "committer"} {
+		if value, err = expectHeader(headers, idx, key); err != nil {
+			return nil, err
+		}
+
+		if err = checkIdent(key, value); err != nil {
+			return nil, err
+		}
+
+		idx++
+	}
+
+	return links, nil
+}
+
+func checkTag(contents []byte) ([]Link, error) {
+	headers, err := readHeaders(contents)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := expectHeader(headers, 0, "object")
+
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := parseLink("object", value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	targetType, err := expectHeader(headers, 1, "type")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsValidObjectType(targetType) {
+		return nil, badObject("invalid type %q", targetType)
+	}
+
+	if value, err = expectHeader(headers, 2, "tag"); err != nil {
+		return nil, err
+	}
+
+	if value == "" {
+		return nil, badObject("empty tag name")
+	}
+
+	// very old tags don't have a tagger
+	if len(headers) > 3 && headers[3][0] == "tagger" {
+		if err = checkIdent("tagger", headers[3][1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return []Link{{SHA: target, Type: ObjectType(targetType)}}, nil
+}
+
+// Same as git, directories are sorted as if their name ends with /
+func treeSortName(name, mode string) string {
+	if mode == _ModeDir {
+		return name + "/"
+	}
+
+	return name
+}
+
+func checkTree(contents []byte) ([]Link, error) {
+	var links []Link
+
+	seen := make(map[string]bool)
+	prevSortName := ""
+
+	for len(contents) != 0 {
+		mode, rest, found := bytes.Cut(contents, []byte(" "))
+
+		if !found {
+			return nil, badObject("truncated tree entry")
+		}
+
+		name, rest, found := bytes.Cut(rest, []byte{0})
+
+		if !found || len(rest) < sha.BYTES_LEN {
+			return nil, badObject("truncated tree entry")
+		}
+
+		shaBytes := bytes.Clone(rest[:sha.BYTES_LEN])
+		contents = rest[sha.BYTES_LEN:]
+
+		entryName := string(name)
+
+		switch {
+		case !_ValidModes[string(mode)]:
+			return nil, badObject("invalid mode %q of %q", mode, entryName)
+		case entryName == "" || entryName == "." || entryName == ".." || strings.Contains(entryName, "/"):
+			return nil, badObject("invalid entry name %q", entryName)
+		case strings.EqualFold(entryName, ".git"):
+			return nil, badObject("tree contains .git")
+		case seen[entryName]:
+			return nil, badObject("duplicate entry %q", entryName)
+		}
+
+		sortName := treeSortName(entryName, string(mode))
+
+		if sortName < prevSortName {
+			return nil, badObject("entry %q is not sorted", entryName)
+		}
+
+		seen[entryName] = true
+		prevSortName = sortName
+
+		if string(mode) == _ModeGitLink {
+			continue
+		}
+
+		link, err := sha.FromByteSlice(&shaBytes)
+
+		if err != nil {
+			return nil, err
+		}
+
+		linkType := BlobObj
+
+		if string(mode) == _ModeDir {
+			linkType = TreeObj
+		}
+
+		links = append(links, Link{SHA: link, Type: linkType})
+	}
+
+	return links, nil
+}
+
+// Object linked from another object along with its expected type
+type Link struct {
+	SHA  *sha.SHA
+	Type ObjectType
+}
+
+// Same as Check but the types of the linked objects are returned too,
+// ex: the parents of a commit are commits
+func CheckLinks(obj ObjectContents) ([]Link, error) {
+	switch obj.ObjType {
+	case BlobObj:
+		return nil, nil
+	case CommitObj:
+		return checkCommit(*obj.Contents)
+	case TreeObj:
+		return checkTree(*obj.Contents)
+	case TagObj:
+		return checkTag(*obj.Contents)
+	}
+
+	return nil, badObject("unknown type %q", obj.ObjType)
+}
+
+// Checks the formatting of the object like git fsck and returns the
+// objects it links to, ex: the tree and parents of a commit. Commits of
+// the submodules are not returned as they are in another repository
+func Check(obj ObjectContents) ([]*sha.SHA, error) {
+	links, err := CheckLinks(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shas := make([]*sha.SHA, 0, len(links))
+
+	for _, link := range links {
+		shas = append(shas, link.SHA)
+	}
+
+	return shas, nil
+}
@@ -0,0 +1,173 @@
+package object_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const (
+	_TreeSHA   = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	_ParentSHA = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+	_Ident     = "A U Thor <author@example.com> 1700000000 +0530"
+)
+
+func contents(objType object.ObjectType, data string) object.ObjectContents {
+	raw := []byte(data)
+
+	return object.ObjectContents{ObjType: objType, Contents: &raw}
+}
+
+func treeEntry(mode, name, hex string) string {
+	entrySha, _ := sha.FromString(hex)
+
+	return mode + " " + name + "\x00" + string(*entrySha.GetBytes())
+}
+
+func assertLinks(t *testing.T, expected []string, links []*sha.SHA) {
+	t.Helper()
+
+	if len(links) != len(expected) {
+		t.Fatalf("expected links %v but got %v", expected, links)
+	}
+
+	for idx, link := range links {
+		testutils.AssertString(t, "link", expected[idx], link.String())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("returns the tree and parents of a commit", func(t *testing.T) {
+		links, err := object.Check(contents(object.CommitObj,
+			"tree "+_TreeSHA+"\nparent "+_ParentSHA+"\nauthor "+_Ident+"\ncommitter "+_Ident+"\ngpgsig -----BEGIN-----\n sig\n -----END-----\n\nmessage\n"))
+
+		if err != nil {
+			t.Fatalf("Check failed with err %v", err)
+		}
+
+		assertLinks(t, []string{_TreeSHA, _ParentSHA}, links)
+	})
+
+	t.Run("returns the tree entries except submodules", func(t *testing.T) {
+		links, err := object.Check(contents(object.TreeObj,
+			treeEntry("100644", "a.txt", _ParentSHA)+treeEntry("40000", "a", _TreeSHA)+treeEntry("160000", "sub", _ParentSHA)))
+
+		if err != nil {
+			t.Fatalf("Check failed with err %v", err)
+		}
+
+		assertLinks(t, []string{_ParentSHA, _TreeSHA}, links)
+	})
+
+	t.Run("returns the object of a tag", func(t *testing.T) {
+		links, err := object.Check(contents(object.TagObj, "object "+_ParentSHA+"\ntype commit\ntag v1.0\ntagger "+_Ident+"\n\nrelease\n"))
+
+		if err != nil {
+			t.Fatalf("Check failed with err %v", err)
+		}
+
+		assertLinks(t, []string{_ParentSHA}, links)
+	})
+
+	for name, obj := range map[string]object.ObjectContents{
+		"commit without tree":        contents(object.CommitObj, "author "+_Ident+"\ncommitter "+_Ident+"\n\nmsg\n"),
+		"commit with invalid parent": contents(object.CommitObj, "tree "+_TreeSHA+"\nparent xyz\nauthor "+_Ident+"\ncommitter "+_Ident+"\n\nmsg\n"),
+		"commit with invalid author": contents(object.CommitObj, "tree "+_TreeSHA+"\nauthor nobody\ncommitter "+_Ident+"\n\nmsg\n"),
+		"commit without committer":   contents(object.CommitObj, "tree "+_TreeSHA+"\nauthor "+_Ident+"\n\nmsg\n"),
+		"tree with invalid mode":     contents(object.TreeObj, treeEntry("100600", "a", _ParentSHA)),
+		"tree with unsorted entries": contents(object.TreeObj, treeEntry("100644", "b", _ParentSHA)+treeEntry("100644", "a", _ParentSHA)),
+		"tree with duplicates":       contents(object.TreeObj, treeEntry("100644", "a", _ParentSHA)+treeEntry("40000", "a", _TreeSHA)),
+		"tree with .git":             contents(object.TreeObj, treeEntry("40000", ".GIT", _TreeSHA)),
+		"truncated tree":             contents(object.TreeObj, treeEntry("100644", "a", _ParentSHA)[:20]),
+		"tag with invalid type":      contents(object.TagObj, "object "+_ParentSHA+"\ntype note\ntag v1\n\nmsg\n"),
+	} {
+		t.Run("fails for "+name, func(t *testing.T) {
+			if _, err := object.Check(obj); !errors.Is(err, object.ErrBadObject) {
+				t.Errorf("expected ErrBadObject but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	for name, tc := range map[string]struct {
+		obj      object.ObjectContents
+		expected string
+	}{
+		"commit": {
+			obj:      contents(object.CommitObj, "tree "+_TreeSHA+"\nparent "+_ParentSHA+"\nauthor "+_Ident+"\ncommitter "+_Ident+"\n\nmsg\n"),
+			expected: "tree " + _TreeSHA + "\ncommit " + _ParentSHA + "\n",
+		},
+		"tree": {
+			obj:      contents(object.TreeObj, treeEntry("100755", "a.sh", _ParentSHA)+treeEntry("40000", "b", _TreeSHA)),
+			expected: "blob " + _ParentSHA + "\ntree " + _TreeSHA + "\n",
+		},
+		"tag": {
+			obj:      contents(object.TagObj, "object "+_TreeSHA+"\ntype tree\ntag v1\n\nmsg\n"),
+			expected: "tree " + _TreeSHA + "\n",
+		},
+	} {
+		t.Run("returns the link types of "+name, func(t *testing.T) {
+			links, err := object.CheckLinks(tc.obj)
+
+			if err != nil {
+				t.Fatalf("CheckLinks failed with err %v", err)
+			}
+
+			got := ""
+
+			for _, link := range links {
+				got += string(link.Type) + " " + link.SHA.String() + "\n"
+			}
+
+			testutils.AssertString(t, "links", tc.expected, got)
+		})
+	}
+}
+
+func TestWriteLoose(t *testing.T) {
+	gitDir := t.TempDir()
+	blob := contents(object.BlobObj, "hello\n")
+
+	objSha, err := object.WriteLoose(gitDir, blob)
+
+	if err != nil {
+		t.Fatalf("WriteLoose failed with err %v", err)
+	}
+
+	// same as git hash-object
+	testutils.AssertString(t, "sha", "ce013625030ba8dba906f756967f9e9ca394464a", objSha.String())
+
+	obj, err := object.FromSHA(objSha, os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("FromSHA failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "contents", "hello\n", string(*obj.Contents))
+
+	t.Run("renames the temp file into place", func(t *testing.T) {
+		entries, _ := os.ReadDir(path.Join(gitDir, "objects", "ce"))
+
+		if len(entries) != 1 || entries[0].Name() != "013625030ba8dba906f756967f9e9ca394464a" {
+			t.Fatalf("expected only the object but got %v", entries)
+		}
+
+		info, _ := entries[0].Info()
+
+		if info.Mode().Perm() != 0444 {
+			t.Errorf("expected read only object but got %v", info.Mode())
+		}
+	})
+
+	t.Run("keeps the existing object", func(t *testing.T) {
+		if _, err := object.WriteLoose(gitDir, blob); err != nil {
+			t.Errorf("WriteLoose failed for existing object with err %v", err)
+		}
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"compress/zlib"
 	"fmt"
 	"io/fs"
+	"os"
+	"path"
 	"testing"
 	"testing/fstest"
 
@@ -125,3 +127,60 @@ func TestFromSHA(t *testing.T) {
 
 	})
 }
+
+type fakePromisor struct {
+	fetched []*sha.SHA
+}
+
+func (p *fakePromisor) FetchMissing(shas []*sha.SHA, fsys fs.FS) error {
+	p.fetched = append(p.fetched, shas...)
+	return nil
+}
+
+func TestPrefetch(t *testing.T) {
+	gitDir := t.TempDir()
+	otherDir := t.TempDir()
+
+	// same repository through another path
+	linkDir := path.Join(t.TempDir(), "link")
+
+	if err := os.Symlink(gitDir, linkDir); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	promisor := &fakePromisor{}
+
+	if err := object.RegisterPromisor(os.DirFS(gitDir), promisor); err != nil {
+		t.Fatalf("RegisterPromisor failed with err %v", err)
+	}
+
+	missing, _ := sha.FromString("ce013625030ba8dba906f756967f9e9ca394464a")
+
+	t.Run("skips the other repositories", func(t *testing.T) {
+		if object.HasPromisor(os.DirFS(otherDir)) {
+			t.Errorf("expected no promisor for the other repository")
+		}
+
+		if err := object.Prefetch([]*sha.SHA{missing}, os.DirFS(otherDir)); err != nil {
+			t.Fatalf("Prefetch failed with err %v", err)
+		}
+
+		if len(promisor.fetched) != 0 {
+			t.Errorf("expected nothing to be fetched but got %v", promisor.fetched)
+		}
+	})
+
+	t.Run("fetches for the registered repository", func(t *testing.T) {
+		if !object.HasPromisor(os.DirFS(linkDir)) {
+			t.Errorf("expected the promisor for the registered repository")
+		}
+
+		if err := object.Prefetch([]*sha.SHA{missing}, os.DirFS(linkDir)); err != nil {
+			t.Fatalf("Prefetch failed with err %v", err)
+		}
+
+		if len(promisor.fetched) != 1 || !promisor.fetched[0].Eq(missing) {
+			t.Errorf("expected %s to be fetched but got %v", missing, promisor.fetched)
+		}
+	})
+}
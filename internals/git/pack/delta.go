@@ -0,0 +1,133 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrInvalidDelta = errors.New("invalid delta instructions")
+
+// Reads the little endian size encoding used in the delta header
+func readDeltaSize(r *bytes.Reader) (int, error) {
+	size := 0
+	shift := 0
+
+	for {
+		b, err := r.ReadByte()
+
+		if err != nil {
+			return 0, err
+		}
+
+		size |= int(b&0b0111_1111) << shift
+		shift += 7
+
+		if !shouldReadMore(b) {
+			return size, nil
+		}
+	}
+}
+
+// Applies the delta instructions on the base object
+// @see https://git-scm.com/docs/pack-format#_deltified_representation
+func ApplyDelta(base []byte, delta []byte) ([]byte, error) {
+	instructionsReader := bytes.NewReader(delta)
+
+	baseSize, err := readDeltaSize(instructionsReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if baseSize != len(base) {
+		return nil, ErrBaseObjSizeMismatch
+	}
+
+	objSize, err := readDeltaSize(instructionsReader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objData := make([]byte, 0, objSize)
+
+	for {
+		instruction, err := instructionsReader.ReadByte()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if (instruction & 0b1000_0000) != 0b1000_0000 {
+			// 0xxxxxxx means data to copy, 0 is reserved
+
+			if instruction == 0 {
+				return nil, ErrInvalidDelta
+			}
+
+			dataToCopy := make([]byte, instruction)
+
+			if _, err = io.ReadFull(instructionsReader, dataToCopy); err != nil {
+				return nil, ErrInvalidDelta
+			}
+
+			objData = append(objData, dataToCopy...)
+
+			continue
+		}
+
+		// 1xxxxxxx means copy from base object, lower 4 bits tell
+		// which offset bytes are present and next 3 bits tell which
+		// size bytes are present, both in little endian order
+		off := 0
+
+		for idx := range 4 {
+			if instruction&(1<<idx) != 0 {
+				b, err := instructionsReader.ReadByte()
+
+				if err != nil {
+					return nil, ErrInvalidDelta
+				}
+
+				off |= int(b) << (8 * idx)
+			}
+		}
+
+		size := 0
+
+		for idx := range 3 {
+			if instruction&(1<<(4+idx)) != 0 {
+				b, err := instructionsReader.ReadByte()
+
+				if err != nil {
+					return nil, ErrInvalidDelta
+				}
+
+				size |= int(b) << (8 * idx)
+			}
+		}
+
+		if size == 0 {
+			// size zero is automatically converted to 0x10000
+			size = 0x10000
+		}
+
+		if off+size > len(base) {
+			return nil, ErrInvalidDelta
+		}
+
+		objData = append(objData, base[off:off+size]...)
+	}
+
+	if len(objData) != objSize {
+		return nil, fmt.Errorf("%w: expected size %d but got %d", ErrInvalidDelta, objSize, len(objData))
+	}
+
+	return objData, nil
+}
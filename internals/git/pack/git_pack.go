@@ -1,10 +1,11 @@
 package pack
 
 import (
-	"bytes"
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"slices"
 
 	"github.com/uragirii/got/internals/git/object"
@@ -48,8 +49,10 @@ func (objType packObjType) ToGitObject() object.ObjectType {
 		return object.CommitObj
 	case _TREE:
 		return object.TreeObj
+	case _TAG:
+		return object.TagObj
 	default:
-		panic(fmt.Sprintf("ToGitObject can be called only on blob, commit or tree but called on %s", objType.String()))
+		panic(fmt.Sprintf("ToGitObject can be called only on blob, commit, tree or tag but called on %s", objType.String()))
 	}
 }
 
@@ -59,13 +62,19 @@ func (objType packObjType) ToGitObject() object.ObjectType {
 // store the map just in case
 
 type Pack struct {
-	idx        *PackIndex
-	fileReader bytes.Reader
+	idx *PackIndex
+	// Objects are read at their offsets, the pack isn't kept in memory
+	file io.ReaderAt
+}
+
+// Reader of an object in the pack, the object is parsed byte by byte
+type objReader interface {
+	io.Reader
+	io.ByteReader
 }
 
 var ErrCantReadPackFile = errors.New("cannot read pack file")
 var ErrObjNotFound = errors.New("object not found in pack file")
-var ErrRefDeltaNotImplemented = errors.New("REF_DELTA not implemented")
 var ErrBaseObjSizeMismatch = errors.New("base object size doesn't match")
 
 func shouldReadMore(b byte) bool {
@@ -77,7 +86,7 @@ func getObjType(b byte) packObjType {
 	return packObjType((b & 0b0111_0000) >> 4)
 }
 
-func parseSizeEncoding(r *bytes.Reader) int {
+func parseSizeEncoding(r objReader) int {
 	b := byte(0x80)
 	sizeBytes := []byte{}
 
@@ -101,7 +110,7 @@ func parseSizeEncoding(r *bytes.Reader) int {
 /**
 * Pass the reader seeked to the correct offset
  */
-func parseObjTypeAndSize(r *bytes.Reader) (packObjType, int, error) {
+func parseObjTypeAndSize(r objReader) (packObjType, int, error) {
 
 	firstByte, _ := r.ReadByte()
 
@@ -122,7 +131,8 @@ func parseObjTypeAndSize(r *bytes.Reader) (packObjType, int, error) {
 	return objType, size, nil
 }
 
-func (pack Pack) parseOFSDeltaObj(r *bytes.Reader, ogOffset int64) (object.ObjectContents, error) {
+// Reads the negative offset of the base object of OFS_DELTA
+func readOFSOffset(r objReader) int64 {
 	offsetBytes := []byte{}
 
 	var b byte = 0x80
@@ -151,131 +161,81 @@ func (pack Pack) parseOFSDeltaObj(r *bytes.Reader, ogOffset int64) (object.Objec
 		baseObjOffsetDiff = (baseObjOffsetDiff << 7) + int(b)
 	}
 
-	baseObjOffsetDiff += correction
-
-	baseObjOffset := ogOffset - int64(baseObjOffsetDiff)
-
-	baseObjContents, err := pack.GetObjAt(baseObjOffset)
-
-	if err != nil {
-		return object.ObjectContents{}, err
-	}
-
-	baseObj := *baseObjContents.Contents
+	return int64(baseObjOffsetDiff + correction)
+}
 
+func applyDeltaFrom(r objReader, baseObjContents object.ObjectContents) (object.ObjectContents, error) {
 	instructionsData, err := object.Decompress(r)
 
 	if err != nil {
 		return object.ObjectContents{}, fmt.Errorf("err while decompressing, %v", err)
 	}
 
-	instructionsReader := bytes.NewReader(*instructionsData)
-
-	parseSizeEncoding(instructionsReader)
-	objSize := parseSizeEncoding(instructionsReader)
-
-	objData := make([]byte, objSize)
-
-	for {
-		instruction, err := instructionsReader.ReadByte()
+	objData, err := ApplyDelta(*baseObjContents.Contents, *instructionsData)
 
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return object.ObjectContents{
-					ObjType:  baseObjContents.ObjType,
-					Contents: &objData,
-				}, nil
-			}
-
-			return object.ObjectContents{}, err
-		}
-
-		if (instruction & 0b1000_0000) != 0b1000_0000 {
-			// 0xxxxxxx means data to copy
-
-			dataToCopy := make([]byte, instruction)
-
-			instructionsReader.Read(dataToCopy)
-
-			objData = append(objData, dataToCopy...)
-
-			continue
-		}
-
-		offsetMask := instruction & 0b1111
-
-		var offsetSlice [4]byte
-
-		// i++
-		for idx := range 4 {
-
-			hasOffset := offsetMask & 0b1
-
-			if hasOffset == 1 {
-				offsetSlice[4-idx-1], _ = instructionsReader.ReadByte()
-			}
-
-			offsetMask = offsetMask >> 1
-		}
-
-		off := 0
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
 
-		for _, o := range offsetSlice {
-			off = (off << 8) + int(o)
-		}
+	return object.ObjectContents{
+		ObjType:  baseObjContents.ObjType,
+		Contents: &objData,
+	}, nil
+}
 
-		sizeMask := (instruction & 0b0111_0000) >> 4
+func (pack Pack) parseOFSDeltaObj(r objReader, ogOffset int64) (object.ObjectContents, error) {
+	baseObjOffset := ogOffset - readOFSOffset(r)
 
-		var sizeSlice [3]byte
+	// the base is read with its own reader, so reading it doesn't move r
+	baseObjContents, err := pack.GetObjAt(baseObjOffset)
 
-		for idx := range 3 {
-			hasSize := sizeMask & 0b1
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
 
-			if hasSize == 1 {
-				sizeSlice[3-idx-1], _ = instructionsReader.ReadByte()
-			}
+	return applyDeltaFrom(r, baseObjContents)
+}
 
-			sizeMask = sizeMask >> 1
-		}
+func (pack Pack) parseREFDeltaObj(r objReader) (object.ObjectContents, error) {
+	shaBytes := make([]byte, sha.BYTES_LEN)
 
-		size := 0
+	if _, err := io.ReadFull(r, shaBytes); err != nil {
+		return object.ObjectContents{}, err
+	}
 
-		for _, o := range sizeSlice {
-			size = (size << 8) + int(o)
-		}
+	baseSha, err := sha.FromByteSlice(&shaBytes)
 
-		if size == 0 {
-			// size zero is automatically converted to 0x10000
-			size = 0x10000
-		}
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
 
-		objData = append(objData, baseObj[off:off+size]...)
+	baseObjContents, err := pack.GetObj(baseSha)
 
+	if err != nil {
+		return object.ObjectContents{}, err
 	}
 
+	return applyDeltaFrom(r, baseObjContents)
 }
 
 func (pack Pack) GetObjAt(offset int64) (object.ObjectContents, error) {
+	r := bufio.NewReader(io.NewSectionReader(pack.file, offset, math.MaxInt64-offset))
 
-	pack.fileReader.Seek(int64(offset), io.SeekStart)
-
-	objType, size, err := parseObjTypeAndSize(&pack.fileReader)
+	objType, size, err := parseObjTypeAndSize(r)
 
 	if err != nil {
 		return object.ObjectContents{}, err
 	}
 
 	if objType == _REF_DELTA {
-		fmt.Println("REF DELTA CASE")
-
-		return object.ObjectContents{}, ErrRefDeltaNotImplemented
+		return pack.parseREFDeltaObj(r)
 	}
 
 	if objType == _OFS_DELTA {
-		return pack.parseOFSDeltaObj(&pack.fileReader, offset)
+		return pack.parseOFSDeltaObj(r, offset)
 	}
 
-	data, err := object.Decompress(&pack.fileReader)
+	data, err := object.Decompress(r)
 
 	if err != nil {
 		return object.ObjectContents{}, fmt.Errorf("err while decompressing data, %v", err)
@@ -303,9 +263,18 @@ func (pack Pack) GetObj(objSha *sha.SHA) (object.ObjectContents, error) {
 
 }
 
-func ParsePackFile(r bytes.Reader, idx *PackIndex) *Pack {
+func ParsePackFile(r io.ReaderAt, idx *PackIndex) *Pack {
 	return &Pack{
-		idx:        idx,
-		fileReader: r,
+		idx:  idx,
+		file: r,
 	}
 }
+
+// Closes the pack file opened for reading the objects
+func (pack Pack) Close() error {
+	if closer, ok := pack.file.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package pack
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Parsed idx and multi-pack-index files are kept for the next lookups
+// like git mmaps them, instead of reading them for every object. A cached
+// file is reused while its size and modification time are the same, the
+// pack files themselves are read at the offsets of the objects
+type cacheKey struct {
+	fsys fs.FS
+	name string
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	size    int64
+	modTime time.Time
+	value   any
+}
+
+// Total size of the cached files, the least recently used ones are
+// evicted past it like with core.packedGitLimit
+var _CacheLimit int64 = 256 << 20
+
+var _CacheMu sync.Mutex
+var _CacheSize int64
+var _CacheLRU = list.New()
+var _Cache = make(map[cacheKey]*list.Element)
+
+func evictLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+
+	_CacheLRU.Remove(elem)
+	delete(_Cache, entry.key)
+
+	_CacheSize -= entry.size
+}
+
+// Drops the file from the cache, ex: when it's removed
+func evictCached(fsys fs.FS, name string) {
+	if !reflect.TypeOf(fsys).Comparable() {
+		return
+	}
+
+	_CacheMu.Lock()
+	defer _CacheMu.Unlock()
+
+	if elem, ok := _Cache[cacheKey{fsys: fsys, name: name}]; ok {
+		evictLocked(elem)
+	}
+}
+
+func storeCached(key cacheKey, info fs.FileInfo, value any) {
+	_CacheMu.Lock()
+	defer _CacheMu.Unlock()
+
+	if elem, ok := _Cache[key]; ok {
+		evictLocked(elem)
+	}
+
+	if info.Size() > _CacheLimit {
+		return
+	}
+
+	for _CacheSize+info.Size() > _CacheLimit {
+		evictLocked(_CacheLRU.Back())
+	}
+
+	entry := &cacheEntry{key: key, size: info.Size(), modTime: info.ModTime(), value: value}
+
+	_Cache[key] = _CacheLRU.PushFront(entry)
+	_CacheSize += entry.size
+}
+
+// Returns the parsed file from the cache or reads and parses it. File
+// systems which can't be map keys, like fstest.MapFS, are not cached
+func readCached(fsys fs.FS, name string, parse func(data []byte) (any, error)) (any, error) {
+	key := cacheKey{fsys: fsys, name: name}
+	cacheable := reflect.TypeOf(fsys).Comparable()
+
+	info, err := fs.Stat(fsys, name)
+
+	if err != nil {
+		// the file was removed, ex: by a repack
+		evictCached(fsys, name)
+		return nil, err
+	}
+
+	if cacheable {
+		_CacheMu.Lock()
+
+		if elem, ok := _Cache[key]; ok {
+			entry := elem.Value.(*cacheEntry)
+
+			if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+				_CacheLRU.MoveToFront(elem)
+				_CacheMu.Unlock()
+
+				return entry.value, nil
+			}
+
+			// replaced by another file with the same name
+			evictLocked(elem)
+		}
+
+		_CacheMu.Unlock()
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := parse(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheable {
+		storeCached(key, info, value)
+	}
+
+	return value, nil
+}
+
+// Reads the idx of the pack, ex: readIdx(gitFs, "pack-<sha>")
+func readIdx(gitFs fs.FS, name string) (*PackIndex, error) {
+	value, err := readCached(gitFs, path.Join(_PackDir, name+".idx"), func(data []byte) (any, error) {
+		return FromIdxBytes(data)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*PackIndex), nil
+}
+
+// Opens the pack for reading its objects, ex: openPack(gitFs, "pack-<sha>").
+// The pack must be closed after reading
+func openPack(gitFs fs.FS, name string) (*Pack, error) {
+	idx, err := readIdx(gitFs, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return openPackFile(gitFs, name, idx)
+}
+
+// Opens the pack file to be read at the offsets of its objects instead
+// of reading it whole
+func openPackFile(gitFs fs.FS, name string, idx *PackIndex) (*Pack, error) {
+	file, err := gitFs.Open(path.Join(_PackDir, name+".pack"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if readerAt, ok := file.(io.ReaderAt); ok {
+		return &Pack{idx: idx, file: readerAt}, nil
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePackFile(bytes.NewReader(data), idx), nil
+}
+
+// Drops the idx of the removed pack from the cache
+func evictPack(gitDir, name string) {
+	evictCached(os.DirFS(gitDir), path.Join(_PackDir, name+".idx"))
+}
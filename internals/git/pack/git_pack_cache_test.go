@@ -0,0 +1,120 @@
+package pack
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReadCached(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	if err := os.MkdirAll(path.Join(gitDir, _PackDir), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	limit := _CacheLimit
+	_CacheLimit = 10
+	t.Cleanup(func() { _CacheLimit = limit })
+
+	parsed := 0
+
+	read := func(name string) (string, error) {
+		value, err := readCached(gitFs, path.Join(_PackDir, name), func(data []byte) (any, error) {
+			parsed++
+			return string(data), nil
+		})
+
+		if err != nil {
+			return "", err
+		}
+
+		return value.(string), nil
+	}
+
+	write := func(name, contents string) {
+		if err := os.WriteFile(path.Join(gitDir, _PackDir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	isCached := func(name string) bool {
+		_CacheMu.Lock()
+		defer _CacheMu.Unlock()
+
+		_, ok := _Cache[cacheKey{fsys: gitFs, name: path.Join(_PackDir, name)}]
+
+		return ok
+	}
+
+	write("a.idx", "aaaa")
+	write("b.idx", "bbbb")
+	write("c.idx", "cccc")
+
+	t.Run("reuses the cached file", func(t *testing.T) {
+		read("a.idx")
+		read("a.idx")
+
+		if parsed != 1 {
+			t.Errorf("expected the file to be parsed once but got %d", parsed)
+		}
+	})
+
+	t.Run("evicts the least recently used files past the limit", func(t *testing.T) {
+		read("b.idx")
+		read("a.idx")
+		read("c.idx")
+
+		if isCached("b.idx") || !isCached("a.idx") || !isCached("c.idx") {
+			t.Errorf("expected only b.idx to be evicted")
+		}
+
+		if _CacheSize > _CacheLimit {
+			t.Errorf("expected the cache to be at most %d bytes but got %d", _CacheLimit, _CacheSize)
+		}
+	})
+
+	t.Run("rereads the replaced files", func(t *testing.T) {
+		write("a.idx", "new")
+
+		if value, _ := read("a.idx"); value != "new" {
+			t.Errorf("expected the new contents but got %s", value)
+		}
+	})
+
+	t.Run("evicts the removed files", func(t *testing.T) {
+		os.Remove(path.Join(gitDir, _PackDir, "c.idx"))
+
+		if _, err := read("c.idx"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected ErrNotExist but got %v", err)
+		}
+
+		if isCached("c.idx") {
+			t.Errorf("expected the removed file to be evicted")
+		}
+	})
+
+	t.Run("does not cache files over the limit", func(t *testing.T) {
+		write("big.idx", "bigger than the limit")
+		read("big.idx")
+
+		if isCached("big.idx") {
+			t.Errorf("expected the file to not be cached")
+		}
+	})
+
+	t.Run("RemovePack evicts the idx", func(t *testing.T) {
+		read("a.idx")
+
+		if err := RemovePack(gitDir, "a"); err != nil {
+			t.Fatalf("RemovePack failed with err %v", err)
+		}
+
+		if isCached("a.idx") {
+			t.Errorf("expected the idx to be evicted")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package pack
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Default of core.deltaBaseCacheLimit
+const _DefaultDeltaBaseCacheLimit = 96 << 20
+
+// Contents of the resolved delta bases while a pack is indexed, the least
+// recently used bases are evicted past the limit and are rebuilt from the
+// pack if one of their deltas is resolved later
+// @see https://git-scm.com/docs/git-config#Documentation/git-config.txt-coredeltaBaseCacheLimit
+type deltaBaseCache struct {
+	mu    sync.Mutex
+	limit int
+	size  int
+	lru   *list.List
+	items map[*rawPackObj]*list.Element
+}
+
+type deltaBaseEntry struct {
+	obj  *rawPackObj
+	data []byte
+}
+
+// Zero limit uses the default of git
+func newDeltaBaseCache(limit int) *deltaBaseCache {
+	if limit <= 0 {
+		limit = _DefaultDeltaBaseCacheLimit
+	}
+
+	return &deltaBaseCache{
+		limit: limit,
+		lru:   list.New(),
+		items: make(map[*rawPackObj]*list.Element),
+	}
+}
+
+func (c *deltaBaseCache) get(obj *rawPackObj) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[obj]
+
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*deltaBaseEntry).data, true
+}
+
+func (c *deltaBaseCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*deltaBaseEntry)
+
+	c.lru.Remove(elem)
+	delete(c.items, entry.obj)
+
+	c.size -= len(entry.data)
+}
+
+// Bases bigger than the limit are not kept
+func (c *deltaBaseCache) add(obj *rawPackObj, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[obj]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	if len(data) > c.limit {
+		return
+	}
+
+	for c.size+len(data) > c.limit {
+		c.removeLocked(c.lru.Back())
+	}
+
+	c.items[obj] = c.lru.PushFront(&deltaBaseEntry{obj: obj, data: data})
+	c.size += len(data)
+}
+
+// Drops the base once all its deltas are resolved
+func (c *deltaBaseCache) remove(obj *rawPackObj) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[obj]; ok {
+		c.removeLocked(elem)
+	}
+}
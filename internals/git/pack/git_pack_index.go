@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"io"
 	"io/fs"
+	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/uragirii/got/internals/git/object"
@@ -39,6 +40,11 @@ func (idx PackIndex) GetObjOffset(sha *sha.SHA) (idxItem, bool) {
 	return offset, ok
 }
 
+// Returns the objects in the pack sorted by SHA like the idx
+func (idx PackIndex) Objects() []*sha.SHA {
+	return idx.offsetOrder
+}
+
 func verifyHeader(header []byte) error {
 	if len(header) != 8 {
 		panic("not-reachable: header should be 8 length")
@@ -78,9 +84,17 @@ func FromIdxFile(fsys fs.FS, path string) (*PackIndex, error) {
 		return nil, err
 	}
 
-	idxBytes := buf.Bytes()
+	return FromIdxBytes(buf.Bytes())
+}
 
-	verifyHeader(idxBytes[:_HeaderSize])
+func FromIdxBytes(idxBytes []byte) (*PackIndex, error) {
+	if len(idxBytes) < _HeaderSize+_FanoutTableSize {
+		return nil, ErrIndexParsing
+	}
+
+	if err := verifyHeader(idxBytes[:_HeaderSize]); err != nil {
+		return nil, err
+	}
 
 	fanoutTableBytes := idxBytes[_HeaderSize : _HeaderSize+_FanoutTableSize]
 
@@ -192,52 +206,155 @@ func FromIdxFile(fsys fs.FS, path string) (*PackIndex, error) {
 
 }
 
-func FindObj(sha *sha.SHA, gitFs fs.FS) (object.ObjectContents, error) {
+// Returns the names of the idx files present in objects/pack without
+// the extension, ex: pack-<checksum>
+func listIdxNames(gitFs fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(gitFs, _PackDir)
 
-	packs, err := fs.ReadDir(gitFs, _PackDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 
 	if err != nil {
-		return object.ObjectContents{}, err
+		return nil, err
 	}
 
-	for _, packFile := range packs {
-		if !strings.HasSuffix(packFile.Name(), ".idx") {
-			continue
+	var names []string
+
+	for _, entry := range entries {
+		if name, isIdx := strings.CutSuffix(entry.Name(), ".idx"); isIdx {
+			names = append(names, name)
 		}
+	}
+
+	return names, nil
+}
 
-		idx, err := FromIdxFile(gitFs, path.Join(_PackDir, packFile.Name()))
+// Returns the parsed idx files present in objects/pack along
+// with the name of their pack files
+func listPackIdx(gitFs fs.FS) (map[string]*PackIndex, error) {
+	names, err := listIdxNames(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idxMap := make(map[string]*PackIndex, len(names))
+
+	for _, name := range names {
+		idx, err := readIdx(gitFs, name)
 
 		if err != nil {
-			return object.ObjectContents{}, err
+			return nil, err
 		}
 
-		_, ok := idx.GetObjOffset(sha)
+		idxMap[name+".pack"] = idx
+	}
 
-		if !ok {
-			continue
-		}
+	return idxMap, nil
+}
 
-		packFileName := packFile.Name()[0:45] + ".pack"
+// Pack in objects/pack along with its parsed idx
+type PackFile struct {
+	// File name without the extension, ex: pack-<checksum>
+	Name string
+	Idx  *PackIndex
+	// Fetched from a promisor remote of a partial clone
+	Promisor bool
+	// Marked with a .keep file, repack must not remove it
+	Keep bool
+}
 
-		packFileReader, err := gitFs.Open(path.Join(_PackDir, packFileName))
+// Returns the packs present in objects/pack sorted by name
+func ListPacks(gitFs fs.FS) ([]PackFile, error) {
+	idxMap, err := listPackIdx(gitFs)
 
-		if err != nil {
-			return object.ObjectContents{}, err
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		b, err := io.ReadAll(packFileReader)
+	packList := make([]PackFile, 0, len(idxMap))
 
-		if err != nil {
-			return object.ObjectContents{}, err
+	for packFileName, idx := range idxMap {
+		name := strings.TrimSuffix(packFileName, ".pack")
+
+		_, promisorErr := fs.Stat(gitFs, path.Join(_PackDir, name+".promisor"))
+		_, keepErr := fs.Stat(gitFs, path.Join(_PackDir, name+".keep"))
+
+		packList = append(packList, PackFile{
+			Name:     name,
+			Idx:      idx,
+			Promisor: promisorErr == nil,
+			Keep:     keepErr == nil,
+		})
+	}
+
+	sort.Slice(packList, func(i, j int) bool {
+		return packList[i].Name < packList[j].Name
+	})
+
+	return packList, nil
+}
+
+// Opens the pack file for reading its objects, the pack must be closed
+// after reading
+func (p PackFile) Open(gitFs fs.FS) (*Pack, error) {
+	return openPackFile(gitFs, p.Name, p.Idx)
+}
+
+// Removes the pack and its idx, the idx is removed first
+// so that readers never see an idx without its pack
+func RemovePack(gitDir, name string) error {
+	evictPack(gitDir, name)
+
+	for _, ext := range []string{".idx", ".pack", ".rev", ".promisor"} {
+		err := os.Remove(path.Join(gitDir, _PackDir, name+ext))
+
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
 		}
+	}
 
-		r := bytes.NewReader(b)
+	return nil
+}
+
+// Reads the object from the packs, looking it up in the multi-pack-index
+// before the idx files of the packs
+func FindObj(sha *sha.SHA, gitFs fs.FS) (object.ObjectContents, error) {
+	name, offset, err := findPacked(gitFs, sha)
 
-		pack := ParsePackFile(*r, idx)
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
 
-		return pack.GetObj(sha)
+	pack, err := openPack(gitFs, name)
 
+	if err != nil {
+		return object.ObjectContents{}, err
 	}
 
-	return object.ObjectContents{}, nil
+	defer pack.Close()
+
+	return pack.GetObjAt(offset)
+}
+
+// Checks if any of the packs has the object
+func HasObj(sha *sha.SHA, gitFs fs.FS) bool {
+	_, _, err := findPacked(gitFs, sha)
+
+	return err == nil
+}
+
+type packedObjStore struct{}
+
+func (packedObjStore) Read(sha *sha.SHA, gitFs fs.FS) (object.ObjectContents, error) {
+	return FindObj(sha, gitFs)
+}
+
+func (packedObjStore) Has(sha *sha.SHA, gitFs fs.FS) bool {
+	return HasObj(sha, gitFs)
+}
+
+func init() {
+	object.RegisterPackedObjStore(packedObjStore{})
 }
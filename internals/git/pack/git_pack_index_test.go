@@ -22,6 +22,7 @@ type VerifyPackOutput struct {
 
 const _VERBOSE_OUTPUT_PATH = "pack/verify-pack-verbose-output.json"
 const _IDX_FILE_PATH = "pack/pack-9fd2cca459eacd57246d2ba2349866deea5ed542.idx"
+const _REV_FILE_PATH = "pack/pack-9fd2cca459eacd57246d2ba2349866deea5ed542.rev"
 
 func loadVerboseOutput(t *testing.T) ([]VerifyPackOutput, error) {
 	t.Helper()
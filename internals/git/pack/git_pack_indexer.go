@@ -0,0 +1,953 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var _PackSignature = []byte("PACK")
+
+const _PackHeaderSize = 12
+const _LargeOffsetFlag uint32 = 0x8000_0000
+
+var _RevMagicHeaderBytes = []byte("RIDX")
+
+const _RevVersion uint32 = 1
+const _RevHashSHA1 uint32 = 1
+
+var ErrInvalidPack = errors.New("invalid pack file")
+var ErrPackChecksumMismatch = errors.New("pack checksum mismatch")
+var ErrUnresolvedDelta = errors.New("pack has unresolved deltas")
+
+type indexEntry struct {
+	sha    *sha.SHA
+	offset uint64
+	crc    uint32
+}
+
+// Object of the pack being indexed, only where it is in the pack is kept
+// and the object is inflated again when it's resolved
+type rawPackObj struct {
+	offset  int64
+	objType packObjType
+	// Only set for OFS_DELTA
+	baseOffset int64
+	// Only set for REF_DELTA
+	baseSha *sha.SHA
+	// Offset of the compressed data and its decompressed size
+	dataOffset int64
+	size       int
+	crc        uint32
+	// Only set for the bases appended by FixThin, they have negative offsets
+	data []byte
+
+	// Resolved base of the delta
+	base *rawPackObj
+	// Deltas have the type of their base
+	resolvedType object.ObjectType
+	sha          *sha.SHA
+}
+
+// Pack in memory read like a pack file
+func packSection(packData []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(packData), 0, int64(len(packData)))
+}
+
+func fileSection(file *os.File) (*io.SectionReader, error) {
+	info, err := file.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(file, 0, info.Size()), nil
+}
+
+// Returns the trailing checksum of the pack
+func readPackTrailer(packFile *io.SectionReader) ([]byte, error) {
+	trailer := make([]byte, sha.BYTES_LEN)
+
+	if _, err := packFile.ReadAt(trailer, packFile.Size()-sha.BYTES_LEN); err != nil {
+		return nil, err
+	}
+
+	return trailer, nil
+}
+
+// Verifies the pack header and trailer, returns number of objects
+func verifyPack(packFile *io.SectionReader) (uint32, error) {
+	size := packFile.Size()
+	header := make([]byte, _PackHeaderSize)
+
+	if size < _PackHeaderSize+sha.BYTES_LEN {
+		return 0, ErrInvalidPack
+	}
+
+	if _, err := packFile.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(header[:4], _PackSignature) {
+		return 0, ErrInvalidPack
+	}
+
+	version := binary.BigEndian.Uint32(header[4:8])
+
+	if version != 2 && version != 3 {
+		return 0, fmt.Errorf("%w: unsupported version %d", ErrInvalidPack, version)
+	}
+
+	checksum := sha1.New()
+
+	if _, err := io.Copy(checksum, io.NewSectionReader(packFile, 0, size-sha.BYTES_LEN)); err != nil {
+		return 0, err
+	}
+
+	trailer, err := readPackTrailer(packFile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(checksum.Sum(nil), trailer) {
+		return 0, ErrPackChecksumMismatch
+	}
+
+	return binary.BigEndian.Uint32(header[8:12]), nil
+}
+
+// Keeps the offset in the pack and the CRC of the object being read, zlib
+// reads byte by byte from an io.ByteReader so nothing after its stream is
+// consumed
+type packObjReader struct {
+	r      *bufio.Reader
+	offset int64
+	crc    hash.Hash32
+}
+
+func (pr *packObjReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+
+	pr.offset += int64(n)
+	pr.crc.Write(p[:n])
+
+	return n, err
+}
+
+func (pr *packObjReader) ReadByte() (byte, error) {
+	b, err := pr.r.ReadByte()
+
+	if err == nil {
+		pr.offset++
+		pr.crc.Write([]byte{b})
+	}
+
+	return b, err
+}
+
+// Returns the decompressed size of the zlib stream without keeping the data
+func inflatedSize(r io.Reader) (int64, error) {
+	zr, err := zlib.NewReader(r)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(io.Discard, zr)
+}
+
+// Reads all the objects in the pack sequentially without resolving deltas.
+// The objects are inflated to find where they end but only their offset,
+// type and CRC are kept
+func readPackObjects(packFile *io.SectionReader, count uint32) ([]*rawPackObj, error) {
+	end := packFile.Size() - sha.BYTES_LEN
+
+	r := &packObjReader{
+		r:      bufio.NewReader(io.NewSectionReader(packFile, _PackHeaderSize, end-_PackHeaderSize)),
+		offset: _PackHeaderSize,
+		crc:    crc32.NewIEEE(),
+	}
+
+	objs := make([]*rawPackObj, 0, count)
+
+	for range count {
+		offset := r.offset
+
+		r.crc.Reset()
+
+		objType, size, err := parseObjTypeAndSize(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj := &rawPackObj{
+			offset:  offset,
+			objType: objType,
+			size:    size,
+		}
+
+		switch objType {
+		case _OFS_DELTA:
+			obj.baseOffset = offset - readOFSOffset(r)
+		case _REF_DELTA:
+			shaBytes := make([]byte, sha.BYTES_LEN)
+
+			if _, err = io.ReadFull(r, shaBytes); err != nil {
+				return nil, err
+			}
+
+			obj.baseSha, _ = sha.FromByteSlice(&shaBytes)
+		case _COMMIT, _TREE, _BLOB, _TAG:
+		default:
+			return nil, fmt.Errorf("%w: unknown object type %d at offset %d", ErrInvalidPack, objType, offset)
+		}
+
+		obj.dataOffset = r.offset
+
+		inflated, err := inflatedSize(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("err while decompressing object at offset %d, %v", offset, err)
+		}
+
+		if inflated != int64(size) {
+			return nil, fmt.Errorf("expected decompressed size to be %d but got %d", size, inflated)
+		}
+
+		obj.crc = r.crc.Sum32()
+
+		objs = append(objs, obj)
+	}
+
+	if r.offset != end {
+		return nil, fmt.Errorf("%w: garbage at the end of pack", ErrInvalidPack)
+	}
+
+	return objs, nil
+}
+
+// Resolves the objects of the pack. Deltas are rebuilt from the pack with
+// their bases kept in the delta base cache, so only the objects being
+// resolved and the cached bases are in memory
+type packResolver struct {
+	packFile *io.SectionReader
+	cache    *deltaBaseCache
+	// Deltas by the offset and the SHA of their base
+	ofsChildren map[int64][]*rawPackObj
+	refChildren map[string][]*rawPackObj
+}
+
+// Inflates the whole object or the delta instructions
+func (pr *packResolver) inflate(obj *rawPackObj) ([]byte, error) {
+	if obj.offset < 0 {
+		return obj.data, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(pr.packFile, obj.dataOffset, pr.packFile.Size()-obj.dataOffset))
+
+	data, err := object.Decompress(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("err while decompressing object at offset %d, %v", obj.offset, err)
+	}
+
+	if len(*data) != obj.size {
+		return nil, fmt.Errorf("expected decompressed size to be %d but got %d", obj.size, len(*data))
+	}
+
+	return *data, nil
+}
+
+// Returns the contents of the object, bases evicted from the cache are
+// rebuilt and cached again for their other deltas
+func (pr *packResolver) contents(obj *rawPackObj) ([]byte, error) {
+	if data, ok := pr.cache.get(obj); ok {
+		return data, nil
+	}
+
+	data, err := pr.inflate(obj)
+
+	if err != nil || obj.base == nil {
+		return data, err
+	}
+
+	base, err := pr.contents(obj.base)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pr.cache.add(obj.base, base)
+
+	contents, err := ApplyDelta(base, data)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: delta at offset %d: %v", ErrInvalidPack, obj.offset, err)
+	}
+
+	return contents, nil
+}
+
+// Resolves the object and calculates its SHA, the object is cached if
+// there are deltas based on it
+func (pr *packResolver) resolve(obj *rawPackObj) (object.ObjectContents, error) {
+	data, err := pr.contents(obj)
+
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
+
+	var objType object.ObjectType
+
+	if obj.base == nil {
+		objType = obj.objType.ToGitObject()
+	} else {
+		objType = obj.base.resolvedType
+	}
+
+	raw := object.WithHeader(objType, data)
+
+	objSha, err := sha.FromData(&raw)
+
+	if err != nil {
+		return object.ObjectContents{}, err
+	}
+
+	obj.resolvedType = objType
+	obj.sha = objSha
+
+	if len(pr.ofsChildren[obj.offset]) != 0 || len(pr.refChildren[objSha.String()]) != 0 {
+		pr.cache.add(obj, data)
+	}
+
+	return object.ObjectContents{ObjType: objType, Contents: &data}, nil
+}
+
+// Resolves the objects using all the cores, the objects don't depend on each
+// other. Objects are resolved a batch at a time and visited in order, so only
+// the contents of a batch are in memory
+func (pr *packResolver) resolveLevel(objs []*rawPackObj, visit func(*rawPackObj, object.ObjectContents) error) error {
+	batchSize := runtime.NumCPU()
+	contents := make([]object.ObjectContents, batchSize)
+	errs := make([]error, batchSize)
+
+	for start := 0; start < len(objs); start += batchSize {
+		batch := objs[start:min(start+batchSize, len(objs))]
+
+		var wg sync.WaitGroup
+
+		for idx, obj := range batch {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				contents[idx], errs[idx] = pr.resolve(obj)
+			}()
+		}
+
+		wg.Wait()
+
+		for idx, obj := range batch {
+			if errs[idx] != nil {
+				return errs[idx]
+			}
+
+			if visit != nil {
+				if err := visit(obj, contents[idx]); err != nil {
+					return err
+				}
+			}
+
+			contents[idx] = object.ObjectContents{}
+		}
+	}
+
+	return nil
+}
+
+// Resolves all the deltas and calculates the SHA of every object, the
+// resolved deltas are counted on the meter. Delta chains are resolved a
+// level at a time, starting with the whole objects followed by the deltas
+// based on them and so on. Every resolved object is visited if visit is
+// not nil. Bases are kept in a cache of cacheLimit bytes, zero for the
+// default of git
+func resolvePackObjects(packFile *io.SectionReader, objs []*rawPackObj, cacheLimit int, meter *progress.Meter, visit func(*rawPackObj, object.ObjectContents) error) ([]indexEntry, error) {
+	pr := &packResolver{
+		packFile:    packFile,
+		cache:       newDeltaBaseCache(cacheLimit),
+		ofsChildren: make(map[int64][]*rawPackObj),
+		refChildren: make(map[string][]*rawPackObj),
+	}
+
+	var level []*rawPackObj
+
+	for _, obj := range objs {
+		switch obj.objType {
+		case _OFS_DELTA:
+			pr.ofsChildren[obj.baseOffset] = append(pr.ofsChildren[obj.baseOffset], obj)
+		case _REF_DELTA:
+			pr.refChildren[obj.baseSha.String()] = append(pr.refChildren[obj.baseSha.String()], obj)
+		default:
+			level = append(level, obj)
+		}
+	}
+
+	entries := make([]indexEntry, 0, len(objs))
+	isDeltaLevel := false
+
+	for len(level) != 0 {
+		if err := pr.resolveLevel(level, visit); err != nil {
+			return nil, err
+		}
+
+		if isDeltaLevel {
+			meter.Add(uint64(len(level)))
+		}
+
+		var next []*rawPackObj
+
+		for _, obj := range level {
+			entries = append(entries, indexEntry{
+				sha:    obj.sha,
+				offset: uint64(obj.offset),
+				crc:    obj.crc,
+			})
+
+			children := append(pr.ofsChildren[obj.offset], pr.refChildren[obj.sha.String()]...)
+
+			// same object can be in the pack twice, its deltas are only resolved once
+			delete(pr.refChildren, obj.sha.String())
+
+			for _, child := range children {
+				child.base = obj
+			}
+
+			next = append(next, children...)
+		}
+
+		// bases of the previous level are not needed anymore
+		for _, obj := range level {
+			if obj.base != nil {
+				pr.cache.remove(obj.base)
+			}
+		}
+
+		level = next
+		isDeltaLevel = true
+	}
+
+	// entries are returned so the missing bases of a thin pack can be found
+	if len(entries) < len(objs) {
+		return entries, ErrUnresolvedDelta
+	}
+
+	meter.Done()
+
+	return entries, nil
+}
+
+// Returns the "Resolving deltas" meter, nil if the pack has no deltas
+func deltaMeter(w io.Writer, objs []*rawPackObj) *progress.Meter {
+	var deltas uint64
+
+	for _, obj := range objs {
+		if obj.objType == _OFS_DELTA || obj.objType == _REF_DELTA {
+			deltas++
+		}
+	}
+
+	if deltas == 0 {
+		return nil
+	}
+
+	return progress.New(w, "Resolving deltas", deltas)
+}
+
+func encodeIdx(entries []indexEntry, packChecksum []byte) []byte {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(*entries[i].sha.GetBytes(), *entries[j].sha.GetBytes()) < 0
+	})
+
+	var buffer bytes.Buffer
+
+	buffer.Write(_MagicHeaderBytes)
+	binary.Write(&buffer, binary.BigEndian, _SUPPORTED_VERSION)
+
+	var fanoutTable [_FanoutTableLen]uint32
+
+	for _, entry := range entries {
+		firstByte := (*entry.sha.GetBytes())[0]
+
+		for idx := int(firstByte); idx < _FanoutTableLen; idx++ {
+			fanoutTable[idx]++
+		}
+	}
+
+	binary.Write(&buffer, binary.BigEndian, fanoutTable)
+
+	for _, entry := range entries {
+		buffer.Write(*entry.sha.GetBytes())
+	}
+
+	for _, entry := range entries {
+		binary.Write(&buffer, binary.BigEndian, entry.crc)
+	}
+
+	var largeOffsets []uint64
+
+	for _, entry := range entries {
+		if entry.offset < uint64(_LargeOffsetFlag) {
+			binary.Write(&buffer, binary.BigEndian, uint32(entry.offset))
+			continue
+		}
+
+		binary.Write(&buffer, binary.BigEndian, _LargeOffsetFlag|uint32(len(largeOffsets)))
+		largeOffsets = append(largeOffsets, entry.offset)
+	}
+
+	for _, offset := range largeOffsets {
+		binary.Write(&buffer, binary.BigEndian, offset)
+	}
+
+	buffer.Write(packChecksum)
+
+	idxChecksum := sha1.Sum(buffer.Bytes())
+
+	buffer.Write(idxChecksum[:])
+
+	return buffer.Bytes()
+}
+
+// Encodes the reverse index which maps the pack order of the objects to
+// their position in the idx. Entries must be sorted like the idx
+// @see https://git-scm.com/docs/pack-format#_pack_rev_files_have_the_format
+func encodeRev(entries []indexEntry, packChecksum []byte) []byte {
+	positions := make([]uint32, len(entries))
+
+	for idx := range positions {
+		positions[idx] = uint32(idx)
+	}
+
+	sort.Slice(positions, func(i, j int) bool {
+		return entries[positions[i]].offset < entries[positions[j]].offset
+	})
+
+	var buffer bytes.Buffer
+
+	buffer.Write(_RevMagicHeaderBytes)
+	binary.Write(&buffer, binary.BigEndian, _RevVersion)
+	binary.Write(&buffer, binary.BigEndian, _RevHashSHA1)
+	binary.Write(&buffer, binary.BigEndian, positions)
+
+	buffer.Write(packChecksum)
+
+	revChecksum := sha1.Sum(buffer.Bytes())
+
+	buffer.Write(revChecksum[:])
+
+	return buffer.Bytes()
+}
+
+type IndexOptions struct {
+	// "Resolving deltas" progress is written here, nil to disable
+	Progress io.Writer
+	// Writes the .rev reverse index along with the idx
+	RevIndex bool
+	// Size of the delta base cache like core.deltaBaseCacheLimit, zero
+	// for the default of git
+	DeltaBaseCacheLimit int
+}
+
+// Reads the complete pack, resolves the deltas and returns the v2 idx file
+// @see https://git-scm.com/docs/pack-format#_version_2_pack_idx_files_support_packs_larger_than_4_gib_and
+func IndexPack(packData []byte) ([]byte, error) {
+	idxData, _, err := indexPack(packSection(packData), IndexOptions{})
+
+	return idxData, err
+}
+
+// Returns the idx and the rev index if asked for
+func indexPack(packFile *io.SectionReader, opts IndexOptions) ([]byte, []byte, error) {
+	count, err := verifyPack(packFile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objs, err := readPackObjects(packFile, count)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, err := resolvePackObjects(packFile, objs, opts.DeltaBaseCacheLimit, deltaMeter(opts.Progress, objs), nil)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packChecksum, err := readPackTrailer(packFile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// entries are sorted by the idx for the rev index
+	idxData := encodeIdx(entries, packChecksum)
+
+	if !opts.RevIndex {
+		return idxData, nil, nil
+	}
+
+	return idxData, encodeRev(entries, packChecksum), nil
+}
+
+// Indexes the pack and writes the idx to the path, the rev index is written
+// next to it if asked for. Returns the pack checksum
+func WriteIndex(idxPath string, packData []byte, opts IndexOptions) (*sha.SHA, error) {
+	return writeIndex(idxPath, packSection(packData), opts)
+}
+
+// Same as WriteIndex for the pack file, the file is read at the offsets
+// of its objects instead of being read whole
+func WriteIndexFromFile(idxPath, packPath string, opts IndexOptions) (*sha.SHA, error) {
+	file, err := os.Open(packPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	packFile, err := fileSection(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return writeIndex(idxPath, packFile, opts)
+}
+
+func writeIndex(idxPath string, packFile *io.SectionReader, opts IndexOptions) (*sha.SHA, error) {
+	idxData, revData, err := indexPack(packFile, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = writeIndexFiles(idxPath, idxData, revData); err != nil {
+		return nil, err
+	}
+
+	return packChecksum(packFile)
+}
+
+// Rev index is written before the idx, readers only look for the
+// other files of a pack once its idx is there
+func writeIndexFiles(idxPath string, idxData, revData []byte) error {
+	if revData != nil {
+		if err := os.WriteFile(strings.TrimSuffix(idxPath, ".idx")+".rev", revData, 0444); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(idxPath, idxData, 0444)
+}
+
+func packChecksum(packFile *io.SectionReader) (*sha.SHA, error) {
+	checksumBytes, err := readPackTrailer(packFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sha.FromByteSlice(&checksumBytes)
+}
+
+// Returns the number of objects in the pack and the bases of its deltas
+// which are missing from the pack, read from the repository
+func thinBases(gitFs fs.FS, packFile *io.SectionReader) (uint32, []object.ObjectContents, error) {
+	count, err := verifyPack(packFile)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	objs, err := readPackObjects(packFile, count)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	inPack := make(map[string]bool)
+
+	var bases []object.ObjectContents
+	var baseObjs []*rawPackObj
+
+	// bases of the deltas based on the missing bases are only known once those
+	// are resolved, so the bases are looked up in the repository in rounds
+	for {
+		entries, err := resolvePackObjects(packFile, append(objs, baseObjs...), 0, nil, nil)
+
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, ErrUnresolvedDelta) {
+			return 0, nil, err
+		}
+
+		for _, entry := range entries {
+			inPack[entry.sha.String()] = true
+		}
+
+		var missing *sha.SHA
+
+		found := false
+
+		for _, obj := range objs {
+			if obj.sha != nil || obj.objType != _REF_DELTA || inPack[obj.baseSha.String()] {
+				continue
+			}
+
+			base, err := object.FromSHA(obj.baseSha, gitFs)
+
+			if err != nil {
+				// can be a delta in the pack which isn't resolved yet
+				missing = obj.baseSha
+				continue
+			}
+
+			baseType, err := packObjTypeFrom(base.ObjType)
+
+			if err != nil {
+				return 0, nil, err
+			}
+
+			inPack[obj.baseSha.String()] = true
+			bases = append(bases, base)
+			baseObjs = append(baseObjs, &rawPackObj{
+				// never the base of an OFS_DELTA
+				offset:  -int64(len(baseObjs)) - 1,
+				objType: baseType,
+				size:    len(*base.Contents),
+				data:    *base.Contents,
+			})
+			found = true
+		}
+
+		if !found && missing == nil {
+			return 0, nil, ErrUnresolvedDelta
+		}
+
+		if !found {
+			return 0, nil, fmt.Errorf("%w: missing base %s", ErrUnresolvedDelta, missing)
+		}
+	}
+
+	return count, bases, nil
+}
+
+// Thin packs have deltas against objects which are not in the pack but the
+// receiver already has, ex: pushes. Those bases are read from the repository
+// and appended so the pack can be stored on its own, same as index-pack --fix-thin
+func FixThin(gitFs fs.FS, packData []byte) ([]byte, error) {
+	count, bases, err := thinBases(gitFs, packSection(packData))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bases) == 0 {
+		return packData, nil
+	}
+
+	var fixed bytes.Buffer
+
+	pw, err := NewWriter(&fixed, count+uint32(len(bases)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// offsets of the objects stay the same as the header size doesn't change
+	if _, err = pw.w.Write(packData[_PackHeaderSize : len(packData)-sha.BYTES_LEN]); err != nil {
+		return nil, err
+	}
+
+	pw.written = count
+
+	for _, base := range bases {
+		if err = pw.WriteObject(base); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = pw.Close(); err != nil {
+		return nil, err
+	}
+
+	return fixed.Bytes(), nil
+}
+
+// Same as FixThin for the pack file, the missing bases are appended to
+// the file in place of the checksum and the header and the checksum are
+// written again
+func FixThinFile(gitFs fs.FS, file *os.File) error {
+	packFile, err := fileSection(file)
+
+	if err != nil {
+		return err
+	}
+
+	count, bases, err := thinBases(gitFs, packFile)
+
+	if err != nil || len(bases) == 0 {
+		return err
+	}
+
+	end := packFile.Size() - sha.BYTES_LEN
+	total := count + uint32(len(bases))
+
+	if err = file.Truncate(end); err != nil {
+		return err
+	}
+
+	if _, err = file.WriteAt(binary.BigEndian.AppendUint32(nil, total), 8); err != nil {
+		return err
+	}
+
+	checksum := sha1.New()
+
+	if _, err = io.Copy(checksum, io.NewSectionReader(file, 0, end)); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(io.NewOffsetWriter(file, end))
+
+	// offsets of the objects stay the same as the header size doesn't change
+	pw := &Writer{
+		w:       io.MultiWriter(w, checksum),
+		hash:    checksum,
+		count:   total,
+		written: count,
+	}
+
+	for _, base := range bases {
+		if err = pw.WriteObject(base); err != nil {
+			return err
+		}
+	}
+
+	if _, err = pw.Close(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// Stores the pack along with its idx in objects/pack and
+// returns the pack checksum which is used as the pack name
+func Store(gitDir string, packData []byte) (*sha.SHA, error) {
+	return StoreWithOptions(gitDir, packData, IndexOptions{})
+}
+
+// Same as Store, the rev index is stored too if asked for
+func StoreWithOptions(gitDir string, packData []byte, opts IndexOptions) (*sha.SHA, error) {
+	return storePack(gitDir, packSection(packData), opts, func(packPath string) error {
+		return os.WriteFile(packPath, packData, 0444)
+	})
+}
+
+// Same as StoreWithOptions for the pack file, ex: a pack spooled to a temp
+// file. The file is moved to objects/pack unless the pack is already there
+func StoreFile(gitDir, filePath string, opts IndexOptions) (*sha.SHA, error) {
+	file, err := os.Open(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	packFile, err := fileSection(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storePack(gitDir, packFile, opts, func(packPath string) error {
+		if err := os.Chmod(filePath, 0444); err != nil {
+			return err
+		}
+
+		return os.Rename(filePath, packPath)
+	})
+}
+
+// Indexes the pack and stores it with writePack if it's not already there
+func storePack(gitDir string, packFile *io.SectionReader, opts IndexOptions, writePack func(packPath string) error) (*sha.SHA, error) {
+	idxData, revData, err := indexPack(packFile, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := packChecksum(packFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	packDir := path.Join(gitDir, _PackDir)
+
+	if err = os.MkdirAll(packDir, 0755); err != nil {
+		return nil, err
+	}
+
+	packPath := path.Join(packDir, fmt.Sprintf("pack-%s", checksum))
+
+	if _, err = os.Stat(packPath + ".idx"); err == nil {
+		// same pack is already present
+		return checksum, nil
+	}
+
+	// idx is written last, so readers never see an idx without its pack
+	if err = writePack(packPath + ".pack"); err != nil {
+		return nil, err
+	}
+
+	if err = writeIndexFiles(packPath+".idx", idxData, revData); err != nil {
+		return nil, err
+	}
+
+	return checksum, nil
+}
+
+// Marks the pack as fetched from a promisor remote, objects missing from
+// a partial clone are only expected behind the objects of such packs
+// @see https://git-scm.com/docs/partial-clone
+func MarkPromisor(gitDir string, checksum *sha.SHA) error {
+	return os.WriteFile(path.Join(gitDir, _PackDir, fmt.Sprintf("pack-%s.promisor", checksum)), nil, 0444)
+}
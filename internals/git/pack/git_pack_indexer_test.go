@@ -0,0 +1,350 @@
+package pack_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+	"github.com/uragirii/got/testdata"
+)
+
+func readTestPack(t *testing.T) []byte {
+	t.Helper()
+
+	file, err := testdata.TestData.Open(_PACK_FILE_PATH)
+
+	if err != nil {
+		t.Fatalf("error while opening pack file %v", err)
+	}
+
+	defer file.Close()
+
+	packData, err := io.ReadAll(file)
+
+	if err != nil {
+		t.Fatalf("error while reading pack file %v", err)
+	}
+
+	return packData
+}
+
+func TestIndexPack(t *testing.T) {
+	packData := readTestPack(t)
+
+	expectedIdx, err := testdata.TestData.ReadFile(_IDX_FILE_PATH)
+
+	if err != nil {
+		t.Fatalf("error while reading idx file %v", err)
+	}
+
+	t.Run("generates the same idx as git", func(t *testing.T) {
+		idx, err := pack.IndexPack(packData)
+
+		if err != nil {
+			t.Fatalf("IndexPack failed with err %v", err)
+		}
+
+		testutils.AssertBytes(t, "idx", expectedIdx, idx)
+	})
+
+	t.Run("fails for corrupted pack", func(t *testing.T) {
+		corrupted := append([]byte{}, packData...)
+		corrupted[100] ^= 0xff
+
+		if _, err := pack.IndexPack(corrupted); err == nil {
+			t.Errorf("expected error for corrupted pack")
+		}
+	})
+}
+
+func TestStore(t *testing.T) {
+	gitDir := t.TempDir()
+
+	checksum, err := pack.Store(gitDir, readTestPack(t))
+
+	if err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "checksum", "9fd2cca459eacd57246d2ba2349866deea5ed542", checksum.String())
+
+	for _, ext := range []string{".pack", ".idx"} {
+		if _, err := os.Stat(path.Join(gitDir, "objects/pack", "pack-"+checksum.String()+ext)); err != nil {
+			t.Errorf("expected %s file to be written but got %v", ext, err)
+		}
+	}
+}
+
+func TestStoreFile(t *testing.T) {
+	gitDir := t.TempDir()
+	filePath := path.Join(t.TempDir(), "tmp_pack")
+
+	os.WriteFile(filePath, readTestPack(t), 0644)
+
+	checksum, err := pack.StoreFile(gitDir, filePath, pack.IndexOptions{})
+
+	if err != nil {
+		t.Fatalf("StoreFile failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "checksum", "9fd2cca459eacd57246d2ba2349866deea5ed542", checksum.String())
+
+	packPath := path.Join(gitDir, "objects/pack", "pack-"+checksum.String()+".pack")
+
+	if packData, _ := os.ReadFile(packPath); !bytes.Equal(packData, readTestPack(t)) {
+		t.Errorf("expected the file to be moved to %s", packPath)
+	}
+
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the file to be moved but got %v", err)
+	}
+}
+
+func TestListPacks(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	checksum, _ := pack.Store(gitDir, readTestPack(t))
+	pack.MarkPromisor(gitDir, checksum)
+
+	packList, err := pack.ListPacks(gitFs)
+
+	if err != nil {
+		t.Fatalf("ListPacks failed with err %v", err)
+	}
+
+	if len(packList) != 1 || !packList[0].Promisor || packList[0].Keep {
+		t.Fatalf("expected a promisor pack but got %+v", packList)
+	}
+
+	testutils.AssertString(t, "name", "pack-"+checksum.String(), packList[0].Name)
+
+	t.Run("removes the pack files", func(t *testing.T) {
+		if err := pack.RemovePack(gitDir, packList[0].Name); err != nil {
+			t.Fatalf("RemovePack failed with err %v", err)
+		}
+
+		if entries, _ := os.ReadDir(path.Join(gitDir, "objects/pack")); len(entries) != 0 {
+			t.Errorf("expected no pack files but got %v", entries)
+		}
+	})
+}
+
+func TestWriteIndex(t *testing.T) {
+	packPath := path.Join(t.TempDir(), "test.pack")
+
+	expectedIdx, _ := testdata.TestData.ReadFile(_IDX_FILE_PATH)
+	expectedRev, err := testdata.TestData.ReadFile(_REV_FILE_PATH)
+
+	if err != nil {
+		t.Fatalf("error while reading rev file %v", err)
+	}
+
+	checksum, err := pack.WriteIndex(strings.TrimSuffix(packPath, ".pack")+".idx", readTestPack(t), pack.IndexOptions{RevIndex: true})
+
+	if err != nil {
+		t.Fatalf("WriteIndex failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "checksum", "9fd2cca459eacd57246d2ba2349866deea5ed542", checksum.String())
+
+	t.Run("writes the same idx and rev index as git", func(t *testing.T) {
+		idx, _ := os.ReadFile(path.Join(path.Dir(packPath), "test.idx"))
+		rev, _ := os.ReadFile(path.Join(path.Dir(packPath), "test.rev"))
+
+		testutils.AssertBytes(t, "idx", expectedIdx, idx)
+		testutils.AssertBytes(t, "rev", expectedRev, rev)
+	})
+
+	t.Run("indexes the pack file", func(t *testing.T) {
+		os.WriteFile(packPath, readTestPack(t), 0444)
+
+		idxPath := path.Join(t.TempDir(), "file.idx")
+
+		checksum, err := pack.WriteIndexFromFile(idxPath, packPath, pack.IndexOptions{})
+
+		if err != nil {
+			t.Fatalf("WriteIndexFromFile failed with err %v", err)
+		}
+
+		idx, _ := os.ReadFile(idxPath)
+
+		testutils.AssertString(t, "checksum", "9fd2cca459eacd57246d2ba2349866deea5ed542", checksum.String())
+		testutils.AssertBytes(t, "idx", expectedIdx, idx)
+	})
+
+	t.Run("rebuilds the delta bases evicted from the cache", func(t *testing.T) {
+		idxPath := path.Join(t.TempDir(), "small.idx")
+
+		if _, err := pack.WriteIndex(idxPath, readTestPack(t), pack.IndexOptions{DeltaBaseCacheLimit: 1}); err != nil {
+			t.Fatalf("WriteIndex failed with err %v", err)
+		}
+
+		idx, _ := os.ReadFile(idxPath)
+
+		testutils.AssertBytes(t, "idx", expectedIdx, idx)
+	})
+}
+
+func appendDeltaSize(delta []byte, size int) []byte {
+	for size >= 0x80 {
+		delta = append(delta, byte(size&0x7f)|0x80)
+		size >>= 7
+	}
+
+	return append(delta, byte(size))
+}
+
+// Delta which inserts the contents over the base
+type refDelta struct {
+	base     *sha.SHA
+	baseSize int
+	contents []byte
+}
+
+// Pack of REF_DELTAs which insert the contents over their bases
+func thinPack(t *testing.T, deltas ...refDelta) []byte {
+	t.Helper()
+
+	var packData bytes.Buffer
+
+	packData.Write([]byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, byte(len(deltas))})
+
+	for _, d := range deltas {
+		delta := appendDeltaSize(appendDeltaSize(nil, d.baseSize), len(d.contents))
+		delta = append(append(delta, byte(len(d.contents))), d.contents...)
+
+		// REF_DELTA is type 7, the size fits in the first byte
+		packData.WriteByte(7<<4 | byte(len(delta)&0x0f) | 0x80)
+		packData.WriteByte(byte(len(delta) >> 4))
+		packData.Write(*d.base.GetBytes())
+
+		zw := zlib.NewWriter(&packData)
+		zw.Write(delta)
+		zw.Close()
+	}
+
+	checksum := sha1.Sum(packData.Bytes())
+
+	return append(packData.Bytes(), checksum[:]...)
+}
+
+func TestFixThin(t *testing.T) {
+	gitDir := t.TempDir()
+
+	if _, err := pack.Store(gitDir, readTestPack(t)); err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	base, _ := sha.FromString("1555f0bf3c0caf8147af9efd42cee5842a3c6e00")
+	baseObj, _ := object.FromSHA(base, gitFs)
+
+	contents := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+
+	thin := thinPack(t, refDelta{base: base, baseSize: len(*baseObj.Contents), contents: contents})
+
+	if _, err := pack.IndexPack(thin); !errors.Is(err, pack.ErrUnresolvedDelta) {
+		t.Fatalf("expected ErrUnresolvedDelta for thin pack but got %v", err)
+	}
+
+	t.Run("appends the missing bases", func(t *testing.T) {
+		fixed, err := pack.FixThin(gitFs, thin)
+
+		if err != nil {
+			t.Fatalf("FixThin failed with err %v", err)
+		}
+
+		idxData, err := pack.IndexPack(fixed)
+
+		if err != nil {
+			t.Fatalf("IndexPack failed for fixed pack with err %v", err)
+		}
+
+		idx, _ := pack.FromIdxBytes(idxData)
+
+		if _, found := idx.GetObjOffset(base); !found || len(idx.Objects()) != 2 {
+			t.Errorf("expected fixed pack to have the delta and its base but got %v", idx.Objects())
+		}
+	})
+
+	t.Run("appends the bases of the deltas based on other deltas", func(t *testing.T) {
+		raw := object.WithHeader(object.CommitObj, contents)
+		deltaSha, _ := sha.FromData(&raw)
+
+		// the second delta is first so its base isn't resolved when it's read
+		chained := thinPack(t,
+			refDelta{base: deltaSha, baseSize: len(contents), contents: []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nchained\n")},
+			refDelta{base: base, baseSize: len(*baseObj.Contents), contents: contents},
+		)
+
+		fixed, err := pack.FixThin(gitFs, chained)
+
+		if err != nil {
+			t.Fatalf("FixThin failed with err %v", err)
+		}
+
+		idxData, err := pack.IndexPack(fixed)
+
+		if err != nil {
+			t.Fatalf("IndexPack failed for fixed pack with err %v", err)
+		}
+
+		idx, _ := pack.FromIdxBytes(idxData)
+
+		if len(idx.Objects()) != 3 {
+			t.Errorf("expected fixed pack to have both deltas and the base but got %v", idx.Objects())
+		}
+	})
+
+	t.Run("appends the missing bases to the pack file", func(t *testing.T) {
+		fixed, _ := pack.FixThin(gitFs, thin)
+
+		file, err := os.CreateTemp(t.TempDir(), "tmp_pack_")
+
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		defer file.Close()
+
+		file.Write(thin)
+
+		if err = pack.FixThinFile(gitFs, file); err != nil {
+			t.Fatalf("FixThinFile failed with err %v", err)
+		}
+
+		fixedFile, _ := os.ReadFile(file.Name())
+
+		testutils.AssertBytes(t, "pack", fixed, fixedFile)
+	})
+
+	t.Run("keeps complete packs as they are", func(t *testing.T) {
+		packData := readTestPack(t)
+
+		fixed, err := pack.FixThin(gitFs, packData)
+
+		if err != nil {
+			t.Fatalf("FixThin failed with err %v", err)
+		}
+
+		testutils.AssertBytes(t, "pack", packData, fixed)
+	})
+
+	t.Run("fails for missing bases", func(t *testing.T) {
+		if _, err := pack.FixThin(os.DirFS(t.TempDir()), thin); !errors.Is(err, pack.ErrUnresolvedDelta) {
+			t.Errorf("expected ErrUnresolvedDelta but got %v", err)
+		}
+	})
+}
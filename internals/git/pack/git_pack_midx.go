@@ -0,0 +1,289 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// multi-pack-index of objects/pack, a single lookup table for the
+// objects of all of its packs
+const MultiPackIndexFile = _PackDir + "/multi-pack-index"
+
+// signature, version, hash version, chunk count, base file count and
+// pack count
+const _MidxHeaderSize = 12
+const _MidxVersion = 1
+const _MidxHashVersion = 1
+
+// Set in the OOFF offsets which are an index into the LOFF chunk
+const _MidxLargeOffset = 0x80000000
+
+// pack int id and offset
+const _MidxObjectOffsetSize = 8
+
+var _MidxSignature = []byte("MIDX")
+
+var ErrInvalidMultiPackIndex = errors.New("invalid multi-pack-index")
+
+type MultiPackIndex struct {
+	// Names of the packs without the extension, ex: pack-<checksum>,
+	// sorted like their idx names
+	packNames    []string
+	fanout       []byte
+	oids         []byte
+	offsets      []byte
+	largeOffsets []byte
+	count        uint32
+}
+
+func invalidMidx(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMultiPackIndex, fmt.Sprintf(format, args...))
+}
+
+func parseMultiPackIndex(data []byte) (*MultiPackIndex, error) {
+	if len(data) < _MidxHeaderSize+sha.BYTES_LEN {
+		return nil, invalidMidx("file is too small")
+	}
+
+	if !bytes.Equal(data[:4], _MidxSignature) {
+		return nil, invalidMidx("signature 0x%x does not match signature 0x%x", data[:4], _MidxSignature)
+	}
+
+	if data[4] != _MidxVersion {
+		return nil, invalidMidx("version %d not recognized", data[4])
+	}
+
+	if data[5] != _MidxHashVersion {
+		return nil, invalidMidx("hash version %d not recognized", data[5])
+	}
+
+	if data[7] != 0 {
+		return nil, invalidMidx("base multi-pack-index files are not supported")
+	}
+
+	packCount := binary.BigEndian.Uint32(data[8:12])
+
+	chunks, err := chunk.Read(data, _MidxHeaderSize, int(data[6]))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultiPackIndex, err)
+	}
+
+	midx := &MultiPackIndex{
+		fanout:       chunks["OIDF"],
+		oids:         chunks["OIDL"],
+		offsets:      chunks["OOFF"],
+		largeOffsets: chunks["LOFF"],
+	}
+
+	if len(midx.fanout) != _FanoutTableSize {
+		return nil, invalidMidx("required OID fanout chunk missing or corrupted")
+	}
+
+	midx.count = binary.BigEndian.Uint32(midx.fanout[_FanoutTableSize-4:])
+
+	if uint64(len(midx.oids)) != uint64(midx.count)*sha.BYTES_LEN {
+		return nil, invalidMidx("required OID lookup chunk missing or corrupted")
+	}
+
+	if uint64(len(midx.offsets)) != uint64(midx.count)*_MidxObjectOffsetSize {
+		return nil, invalidMidx("required object offsets chunk missing or corrupted")
+	}
+
+	if len(midx.largeOffsets)%8 != 0 {
+		return nil, invalidMidx("large offsets chunk is corrupted")
+	}
+
+	names, found := chunks["PNAM"]
+
+	if !found {
+		return nil, invalidMidx("required pack-name chunk missing or corrupted")
+	}
+
+	for i := uint32(0); i < packCount; i++ {
+		end := bytes.IndexByte(names, 0)
+
+		if end == -1 {
+			return nil, invalidMidx("bad pack-int-id: %d (%d total packs)", i, packCount)
+		}
+
+		name, isIdx := strings.CutSuffix(string(names[:end]), ".idx")
+
+		if !isIdx {
+			return nil, invalidMidx("pack name %s is not an idx", names[:end])
+		}
+
+		if i > 0 && midx.packNames[i-1] >= name {
+			return nil, invalidMidx("pack names out of order: '%s.idx' before '%s.idx'", midx.packNames[i-1], name)
+		}
+
+		midx.packNames = append(midx.packNames, name)
+		names = names[end+1:]
+	}
+
+	return midx, nil
+}
+
+// Reads objects/pack/multi-pack-index, returns nil if the repository
+// doesn't have one
+func ReadMultiPackIndex(gitFs fs.FS) (*MultiPackIndex, error) {
+	value, err := readCached(gitFs, MultiPackIndexFile, func(data []byte) (any, error) {
+		return parseMultiPackIndex(data)
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*MultiPackIndex), nil
+}
+
+// Returns the names of the packs without the extension, ex: pack-<checksum>
+func (midx *MultiPackIndex) Packs() []string {
+	return midx.packNames
+}
+
+// Returns the number of objects in the multi-pack-index
+func (midx *MultiPackIndex) Len() int {
+	return int(midx.count)
+}
+
+func (midx *MultiPackIndex) oid(pos uint32) []byte {
+	return midx.oids[pos*sha.BYTES_LEN : (pos+1)*sha.BYTES_LEN]
+}
+
+func (midx *MultiPackIndex) fanoutAt(i int) uint32 {
+	return binary.BigEndian.Uint32(midx.fanout[i*4:])
+}
+
+// Position of the object in the OID lookup, searching between the
+// fanout entries of its first byte
+func (midx *MultiPackIndex) position(objSha *sha.SHA) (uint32, bool) {
+	oid := *objSha.GetBytes()
+
+	var start uint32
+
+	if oid[0] > 0 {
+		start = midx.fanoutAt(int(oid[0]) - 1)
+	}
+
+	end := midx.fanoutAt(int(oid[0]))
+
+	if start > end || end > midx.count {
+		return 0, false
+	}
+
+	pos := start + uint32(sort.Search(int(end-start), func(i int) bool {
+		return bytes.Compare(midx.oid(start+uint32(i)), oid) >= 0
+	}))
+
+	if pos == end || !bytes.Equal(midx.oid(pos), oid) {
+		return 0, false
+	}
+
+	return pos, true
+}
+
+// Pack int id and the offset of the object at the position
+func (midx *MultiPackIndex) objectAt(pos uint32) (uint32, uint64, bool) {
+	entry := midx.offsets[pos*_MidxObjectOffsetSize:]
+
+	packID := binary.BigEndian.Uint32(entry[:4])
+	offset := uint64(binary.BigEndian.Uint32(entry[4:8]))
+
+	if offset&_MidxLargeOffset != 0 && len(midx.largeOffsets) != 0 {
+		largeIdx := offset ^ _MidxLargeOffset
+
+		if (largeIdx+1)*8 > uint64(len(midx.largeOffsets)) {
+			return 0, 0, false
+		}
+
+		offset = binary.BigEndian.Uint64(midx.largeOffsets[largeIdx*8:])
+	}
+
+	if packID >= uint32(len(midx.packNames)) {
+		return 0, 0, false
+	}
+
+	return packID, offset, true
+}
+
+// Returns the pack name and the offset of the object in it
+func (midx *MultiPackIndex) find(objSha *sha.SHA) (string, int64, bool) {
+	pos, found := midx.position(objSha)
+
+	if !found {
+		return "", 0, false
+	}
+
+	packID, offset, ok := midx.objectAt(pos)
+
+	if !ok {
+		return "", 0, false
+	}
+
+	return midx.packNames[packID], int64(offset), true
+}
+
+// Finds the pack of the object using the multi-pack-index first and then
+// the idx of the packs which are not in it. A corrupted multi-pack-index
+// is skipped like git does, the idx files still have all the objects
+func findPacked(gitFs fs.FS, objSha *sha.SHA) (string, int64, error) {
+	midx, _ := ReadMultiPackIndex(gitFs)
+
+	covered := make(map[string]bool)
+
+	if midx != nil {
+		for _, name := range midx.packNames {
+			covered[name] = true
+		}
+
+		if name, offset, found := midx.find(objSha); found {
+			if _, err := fs.Stat(gitFs, path.Join(_PackDir, name+".idx")); err == nil {
+				return name, offset, nil
+			}
+
+			// the pack was removed after writing the multi-pack-index,
+			// the object may still be in the other packs
+			clear(covered)
+		}
+	}
+
+	names, err := listIdxNames(gitFs)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	for _, name := range names {
+		// the object would've been found in the multi-pack-index
+		if covered[name] {
+			continue
+		}
+
+		idx, err := readIdx(gitFs, name)
+
+		if err != nil {
+			return "", 0, err
+		}
+
+		if item, found := idx.GetObjOffset(objSha); found {
+			return name, int64(item.Offset), nil
+		}
+	}
+
+	return "", 0, ErrObjNotFound
+}
@@ -0,0 +1,275 @@
+package pack_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// commit, tree and blob of the test pack
+var _MidxDuplicates = []string{"1555f0bf3c0caf8147af9efd42cee5842a3c6e00", "df1611f7ecf067d011d91d5a5f5f397fb2417b89", "4746d9ca75d580f3639a163e847b894fffe92d3b"}
+
+// Stores the test pack and a newer pack with copies of some of its
+// objects, returns the names of both
+func setupMidxPacks(t *testing.T) (string, string, string) {
+	t.Helper()
+
+	gitDir := t.TempDir()
+
+	checksum, err := pack.Store(gitDir, readTestPack(t))
+
+	if err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	var objects []*sha.SHA
+
+	for _, shaStr := range _MidxDuplicates {
+		objSha, _ := sha.FromString(shaStr)
+		objects = append(objects, objSha)
+	}
+
+	var packData bytes.Buffer
+
+	if _, err = pack.WriteObjects(&packData, os.DirFS(gitDir), objects); err != nil {
+		t.Fatalf("WriteObjects failed with err %v", err)
+	}
+
+	smallChecksum, err := pack.Store(gitDir, packData.Bytes())
+
+	if err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	oldPack, newPack := "pack-"+checksum.String(), "pack-"+smallChecksum.String()
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path.Join(gitDir, "objects/pack", oldPack+".pack"), old, old)
+
+	return gitDir, oldPack, newPack
+}
+
+func TestWriteMultiPackIndex(t *testing.T) {
+	gitDir, oldPack, newPack := setupMidxPacks(t)
+	gitFs := os.DirFS(gitDir)
+
+	if err := pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{}); err != nil {
+		t.Fatalf("WriteMultiPackIndex failed with err %v", err)
+	}
+
+	midx, err := pack.ReadMultiPackIndex(gitFs)
+
+	if err != nil {
+		t.Fatalf("ReadMultiPackIndex failed with err %v", err)
+	}
+
+	expectedPacks := []string{oldPack, newPack}
+
+	if newPack < oldPack {
+		expectedPacks = []string{newPack, oldPack}
+	}
+
+	testutils.AssertString(t, "packs", strings.Join(expectedPacks, " "), strings.Join(midx.Packs(), " "))
+
+	idx, _ := pack.FromIdxFile(gitFs, path.Join("objects/pack", oldPack+".idx"))
+
+	if midx.Len() != len(idx.Objects()) {
+		t.Errorf("expected %d objects but got %d", len(idx.Objects()), midx.Len())
+	}
+
+	for _, objSha := range idx.Objects() {
+		if !pack.HasObj(objSha, gitFs) {
+			t.Fatalf("expected %s to be found", objSha)
+		}
+	}
+
+	packFile, _ := pack.PackFile{Name: oldPack, Idx: idx}.Open(gitFs)
+
+	defer packFile.Close()
+
+	for _, shaStr := range _MidxDuplicates {
+		objSha, _ := sha.FromString(shaStr)
+
+		obj, err := pack.FindObj(objSha, gitFs)
+
+		if err != nil {
+			t.Fatalf("FindObj failed for %s with err %v", objSha, err)
+		}
+
+		expected, _ := packFile.GetObj(objSha)
+
+		testutils.AssertString(t, "type", string(expected.ObjType), string(obj.ObjType))
+		testutils.AssertBytes(t, shaStr, *obj.Contents, *expected.Contents)
+	}
+
+	problems, err := pack.VerifyMultiPackIndex(gitFs, nil)
+
+	if err != nil || len(problems) != 0 {
+		t.Errorf("expected no problems but got %v, %v", problems, err)
+	}
+
+	t.Run("fails for unknown preferred pack", func(t *testing.T) {
+		err := pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{PreferredPack: "pack-unknown.pack"})
+
+		if !errors.Is(err, pack.ErrUnknownPreferredPack) {
+			t.Errorf("expected ErrUnknownPreferredPack but got %v", err)
+		}
+	})
+
+	t.Run("fails without packs", func(t *testing.T) {
+		err := pack.WriteMultiPackIndex(t.TempDir(), pack.MultiPackIndexOptions{})
+
+		if !errors.Is(err, pack.ErrNoPacksToIndex) {
+			t.Errorf("expected ErrNoPacksToIndex but got %v", err)
+		}
+	})
+
+	t.Run("finds objects of the removed packs in other packs", func(t *testing.T) {
+		if err := pack.RemovePack(gitDir, newPack); err != nil {
+			t.Fatalf("RemovePack failed with err %v", err)
+		}
+
+		for _, shaStr := range _MidxDuplicates {
+			objSha, _ := sha.FromString(shaStr)
+
+			if _, err := pack.FindObj(objSha, gitFs); err != nil {
+				t.Errorf("FindObj failed for %s with err %v", objSha, err)
+			}
+		}
+	})
+}
+
+func TestExpireMultiPackIndex(t *testing.T) {
+	t.Run("keeps the packs with used objects", func(t *testing.T) {
+		gitDir, _, _ := setupMidxPacks(t)
+
+		pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{})
+
+		if err := pack.ExpireMultiPackIndex(gitDir, nil); err != nil {
+			t.Fatalf("ExpireMultiPackIndex failed with err %v", err)
+		}
+
+		if packList, _ := pack.ListPacks(os.DirFS(gitDir)); len(packList) != 2 {
+			t.Errorf("expected 2 packs but got %d", len(packList))
+		}
+	})
+
+	t.Run("removes the packs whose objects are used from the preferred pack", func(t *testing.T) {
+		gitDir, oldPack, _ := setupMidxPacks(t)
+		gitFs := os.DirFS(gitDir)
+
+		pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{PreferredPack: oldPack + ".pack"})
+
+		if err := pack.ExpireMultiPackIndex(gitDir, nil); err != nil {
+			t.Fatalf("ExpireMultiPackIndex failed with err %v", err)
+		}
+
+		packList, _ := pack.ListPacks(gitFs)
+
+		if len(packList) != 1 || packList[0].Name != oldPack {
+			t.Fatalf("expected only %s but got %+v", oldPack, packList)
+		}
+
+		midx, _ := pack.ReadMultiPackIndex(gitFs)
+
+		testutils.AssertString(t, "packs", oldPack, strings.Join(midx.Packs(), " "))
+	})
+}
+
+func TestRepackMultiPackIndex(t *testing.T) {
+	gitDir, oldPack, newPack := setupMidxPacks(t)
+	gitFs := os.DirFS(gitDir)
+
+	idx, _ := pack.FromIdxFile(gitFs, path.Join("objects/pack", oldPack+".idx"))
+
+	pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{})
+
+	// the used part of the test pack is too big for the batch
+	if err := pack.RepackMultiPackIndex(gitDir, 1024, nil); err != nil {
+		t.Fatalf("RepackMultiPackIndex failed with err %v", err)
+	}
+
+	if packList, _ := pack.ListPacks(gitFs); len(packList) != 2 {
+		t.Fatalf("expected 2 packs but got %d", len(packList))
+	}
+
+	if err := pack.RepackMultiPackIndex(gitDir, 0, nil); err != nil {
+		t.Fatalf("RepackMultiPackIndex failed with err %v", err)
+	}
+
+	if err := pack.ExpireMultiPackIndex(gitDir, nil); err != nil {
+		t.Fatalf("ExpireMultiPackIndex failed with err %v", err)
+	}
+
+	packList, _ := pack.ListPacks(gitFs)
+
+	if len(packList) != 1 || packList[0].Name == oldPack || packList[0].Name == newPack {
+		t.Fatalf("expected only the repacked pack but got %+v", packList)
+	}
+
+	for _, objSha := range idx.Objects() {
+		if !pack.HasObj(objSha, gitFs) {
+			t.Fatalf("expected %s to be found", objSha)
+		}
+	}
+}
+
+func TestVerifyMultiPackIndex(t *testing.T) {
+	gitDir, _, _ := setupMidxPacks(t)
+	gitFs := os.DirFS(gitDir)
+
+	midxPath := path.Join(gitDir, pack.MultiPackIndexFile)
+
+	t.Run("nothing to verify", func(t *testing.T) {
+		problems, err := pack.VerifyMultiPackIndex(gitFs, nil)
+
+		if err != nil || len(problems) != 0 {
+			t.Errorf("expected no problems but got %v, %v", problems, err)
+		}
+	})
+
+	t.Run("reports incorrect offsets", func(t *testing.T) {
+		pack.WriteMultiPackIndex(gitDir, pack.MultiPackIndexOptions{})
+
+		data, _ := os.ReadFile(midxPath)
+		// last byte of the offset of the last object, before the trailer
+		data[len(data)-sha.BYTES_LEN-1] ^= 0xff
+		os.WriteFile(midxPath, data, 0644)
+
+		problems, err := pack.VerifyMultiPackIndex(gitFs, nil)
+
+		if err != nil {
+			t.Fatalf("VerifyMultiPackIndex failed with err %v", err)
+		}
+
+		if len(problems) != 2 {
+			t.Fatalf("expected 2 problems but got %v", problems)
+		}
+
+		testutils.AssertString(t, "checksum", "incorrect checksum", problems[0])
+
+		if !strings.HasPrefix(problems[1], "incorrect object offset for oid[") {
+			t.Errorf("expected incorrect offset but got %s", problems[1])
+		}
+	})
+
+	t.Run("reports unparsable file", func(t *testing.T) {
+		os.WriteFile(midxPath, []byte("not a multi-pack-index file"), 0644)
+
+		problems, err := pack.VerifyMultiPackIndex(gitFs, nil)
+
+		if err != nil || len(problems) == 0 {
+			t.Fatalf("expected problems but got %v, %v", problems, err)
+		}
+
+		testutils.AssertString(t, "problem", "multi-pack-index file exists, but failed to parse", problems[len(problems)-1])
+	})
+}
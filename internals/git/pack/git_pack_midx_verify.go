@@ -0,0 +1,136 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// Verifies the multi-pack-index like git multi-pack-index verify, the
+// checksum, the packs, the OID order and fanout, and the offsets of the
+// objects against the idx of their packs. Returns the problems found,
+// the error is for the failures to read the repository
+func VerifyMultiPackIndex(gitFs fs.FS, progressOut io.Writer) ([]string, error) {
+	data, err := fs.ReadFile(gitFs, MultiPackIndexFile)
+
+	// nothing to verify
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	midx, err := parseMultiPackIndex(data)
+
+	if err != nil {
+		return []string{err.Error(), "multi-pack-index file exists, but failed to parse"}, nil
+	}
+
+	var problems []string
+
+	if _, err = chunk.VerifyChecksum(data); err != nil {
+		problems = append(problems, "incorrect checksum")
+	}
+
+	meter := progress.New(progressOut, "Looking for referenced packfiles", uint64(len(midx.packNames)))
+
+	idxList := make([]*PackIndex, len(midx.packNames))
+
+	for packID, name := range midx.packNames {
+		meter.Add(1)
+
+		if _, err = fs.Stat(gitFs, path.Join(_PackDir, name+".pack")); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to load pack in position %d", packID))
+			continue
+		}
+
+		if idxList[packID], err = readIdx(gitFs, name); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to load pack in position %d", packID))
+		}
+	}
+
+	meter.Done()
+
+	for i := 0; i < _FanoutTableLen-1; i++ {
+		if fanout, next := midx.fanoutAt(i), midx.fanoutAt(i+1); fanout > next {
+			problems = append(problems, fmt.Sprintf("oid fanout out of order: fanout[%d] = %x > %x = fanout[%d]", i, fanout, next, i+1))
+		}
+	}
+
+	if midx.count == 0 {
+		return append(problems, "the midx contains no oid"), nil
+	}
+
+	meter = progress.New(progressOut, "Verifying OID order in multi-pack-index", uint64(midx.count-1))
+
+	for pos := uint32(0); pos+1 < midx.count; pos++ {
+		meter.Add(1)
+
+		if oid, next := midx.oid(pos), midx.oid(pos+1); bytes.Compare(oid, next) >= 0 {
+			problems = append(problems, fmt.Sprintf("oid lookup out of order: oid[%d] = %x >= %x = oid[%d]", pos, oid, next, pos+1))
+		}
+	}
+
+	meter.Done()
+
+	// git checks the objects pack by pack
+	positions := make([]uint32, midx.count)
+
+	for pos := range positions {
+		positions[pos] = uint32(pos)
+	}
+
+	packOf := func(pos uint32) uint32 {
+		packID, _, _ := midx.objectAt(pos)
+		return packID
+	}
+
+	sort.SliceStable(positions, func(i, j int) bool {
+		return packOf(positions[i]) < packOf(positions[j])
+	})
+
+	meter = progress.New(progressOut, "Verifying object offsets", uint64(midx.count))
+
+	for _, pos := range positions {
+		meter.Add(1)
+
+		oid := bytes.Clone(midx.oid(pos))
+
+		objSha, err := sha.FromByteSlice(&oid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		packID, offset, ok := midx.objectAt(pos)
+
+		if !ok || idxList[packID] == nil {
+			problems = append(problems, fmt.Sprintf("failed to load pack entry for oid[%d] = %s", pos, objSha))
+			continue
+		}
+
+		var packOffset uint64
+
+		if item, found := idxList[packID].GetObjOffset(objSha); found {
+			packOffset = uint64(item.Offset)
+		}
+
+		if offset != packOffset {
+			problems = append(problems, fmt.Sprintf("incorrect object offset for oid[%d] = %s: %x != %x", pos, objSha, offset, packOffset))
+		}
+	}
+
+	meter.Done()
+
+	return problems, nil
+}
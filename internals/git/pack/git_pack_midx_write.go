@@ -0,0 +1,467 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/uragirii/got/internals/git/chunk"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// Alignment of the pack names chunk
+const _MidxChunkAlignment = 4
+
+var ErrNoPacksToIndex = errors.New("no pack files to index")
+var ErrUnknownPreferredPack = errors.New("unknown preferred pack")
+
+type MultiPackIndexOptions struct {
+	// Pack whose copies are used for the objects present in several
+	// packs, ex: pack-<checksum>.pack or pack-<checksum>.idx
+	PreferredPack string
+	// "Adding packfiles to multi-pack-index" progress, nil to disable
+	Progress io.Writer
+}
+
+// Object of one of the packs, duplicates are resolved before writing
+type midxEntry struct {
+	oid       []byte
+	packID    uint32
+	offset    uint64
+	mtime     int64
+	preferred bool
+}
+
+// Same order as git, the copy of the preferred pack first and then the
+// copy of the newest pack
+func midxEntryLess(a, b *midxEntry) bool {
+	if cmp := bytes.Compare(a.oid, b.oid); cmp != 0 {
+		return cmp < 0
+	}
+
+	if a.preferred != b.preferred {
+		return a.preferred
+	}
+
+	if a.mtime != b.mtime {
+		return a.mtime > b.mtime
+	}
+
+	return a.packID < b.packID
+}
+
+func isPackNamed(p PackFile, name string) bool {
+	return name == p.Name+".pack" || name == p.Name+".idx"
+}
+
+// Collects the objects of the packs keeping a single copy of each
+func midxEntries(gitDir string, packList []PackFile, preferredPack string, meter *progress.Meter) ([]*midxEntry, error) {
+	var entries []*midxEntry
+
+	for packID, p := range packList {
+		info, err := os.Stat(path.Join(gitDir, _PackDir, p.Name+".pack"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		preferred := preferredPack != "" && isPackNamed(p, preferredPack)
+
+		for _, objSha := range p.Idx.Objects() {
+			item, _ := p.Idx.GetObjOffset(objSha)
+
+			entries = append(entries, &midxEntry{
+				oid:       *objSha.GetBytes(),
+				packID:    uint32(packID),
+				offset:    uint64(item.Offset),
+				mtime:     info.ModTime().Unix(),
+				preferred: preferred,
+			})
+		}
+
+		meter.Add(1)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return midxEntryLess(entries[i], entries[j])
+	})
+
+	unique := entries[:0]
+
+	for _, entry := range entries {
+		if len(unique) != 0 && bytes.Equal(unique[len(unique)-1].oid, entry.oid) {
+			continue
+		}
+
+		unique = append(unique, entry)
+	}
+
+	return unique, nil
+}
+
+// Pack names are terminated by NUL and padded to the chunk alignment
+func midxPackNames(packList []PackFile) []byte {
+	var names bytes.Buffer
+
+	for _, p := range packList {
+		names.WriteString(p.Name + ".idx")
+		names.WriteByte(0)
+	}
+
+	if padding := names.Len() % _MidxChunkAlignment; padding != 0 {
+		names.Write(make([]byte, _MidxChunkAlignment-padding))
+	}
+
+	return names.Bytes()
+}
+
+func encodeMultiPackIndex(packList []PackFile, entries []*midxEntry) []byte {
+	fanout := make([]byte, _FanoutTableSize)
+	oids := make([]byte, 0, len(entries)*sha.BYTES_LEN)
+	offsets := make([]byte, 0, len(entries)*_MidxObjectOffsetSize)
+
+	var counts [_FanoutTableLen]uint32
+
+	largeOffsetsNeeded := false
+
+	for _, entry := range entries {
+		counts[entry.oid[0]]++
+		oids = append(oids, entry.oid...)
+
+		if entry.offset > 0xffffffff {
+			largeOffsetsNeeded = true
+		}
+	}
+
+	var total uint32
+
+	for i, count := range counts {
+		total += count
+		binary.BigEndian.PutUint32(fanout[i*4:], total)
+	}
+
+	var largeOffsets []byte
+
+	for _, entry := range entries {
+		offsets = binary.BigEndian.AppendUint32(offsets, entry.packID)
+
+		// the offsets above 31 bits are only moved to LOFF if some
+		// offset doesn't fit in 32 bits, same as git
+		if largeOffsetsNeeded && entry.offset&^0x7fffffff != 0 {
+			offsets = binary.BigEndian.AppendUint32(offsets, _MidxLargeOffset|uint32(len(largeOffsets)/8))
+			largeOffsets = binary.BigEndian.AppendUint64(largeOffsets, entry.offset)
+
+			continue
+		}
+
+		offsets = binary.BigEndian.AppendUint32(offsets, uint32(entry.offset))
+	}
+
+	chunks := []chunk.Chunk{
+		{ID: "PNAM", Data: midxPackNames(packList)},
+		{ID: "OIDF", Data: fanout},
+		{ID: "OIDL", Data: oids},
+		{ID: "OOFF", Data: offsets},
+	}
+
+	if largeOffsetsNeeded {
+		chunks = append(chunks, chunk.Chunk{ID: "LOFF", Data: largeOffsets})
+	}
+
+	header := append([]byte{}, _MidxSignature...)
+	header = append(header, _MidxVersion, _MidxHashVersion, byte(len(chunks)), 0)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(packList)))
+
+	return chunk.Write(header, chunks)
+}
+
+// Writes the multi-pack-index of the packs, sorted like their idx names
+func writeMultiPackIndex(gitDir string, packList []PackFile, opts MultiPackIndexOptions) error {
+	if len(packList) == 0 {
+		return ErrNoPacksToIndex
+	}
+
+	packList = append([]PackFile{}, packList...)
+
+	sort.Slice(packList, func(i, j int) bool {
+		return packList[i].Name+".idx" < packList[j].Name+".idx"
+	})
+
+	if opts.PreferredPack != "" {
+		found := false
+
+		for _, p := range packList {
+			found = found || isPackNamed(p, opts.PreferredPack)
+		}
+
+		if !found {
+			return fmt.Errorf("%w: '%s'", ErrUnknownPreferredPack, opts.PreferredPack)
+		}
+	}
+
+	meter := progress.New(opts.Progress, "Adding packfiles to multi-pack-index", uint64(len(packList)))
+
+	entries, err := midxEntries(gitDir, packList, opts.PreferredPack, meter)
+
+	if err != nil {
+		return err
+	}
+
+	meter.Done()
+
+	midxPath := path.Join(gitDir, MultiPackIndexFile)
+	lockPath := midxPath + ".lock"
+
+	if err = os.WriteFile(lockPath, encodeMultiPackIndex(packList, entries), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(lockPath, midxPath)
+}
+
+// Writes objects/pack/multi-pack-index for all the packs of the
+// repository like git multi-pack-index write
+func WriteMultiPackIndex(gitDir string, opts MultiPackIndexOptions) error {
+	packList, err := ListPacks(os.DirFS(gitDir))
+
+	if err != nil {
+		return err
+	}
+
+	return writeMultiPackIndex(gitDir, packList, opts)
+}
+
+// Removes the multi-pack-index, ex: after repacking all the packs
+func RemoveMultiPackIndex(gitDir string) error {
+	err := os.Remove(path.Join(gitDir, MultiPackIndexFile))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Number of objects of each pack which the multi-pack-index uses
+func (midx *MultiPackIndex) referencedObjects() []uint32 {
+	counts := make([]uint32, len(midx.packNames))
+
+	for pos := uint32(0); pos < midx.count; pos++ {
+		if packID, _, ok := midx.objectAt(pos); ok {
+			counts[packID]++
+		}
+	}
+
+	return counts
+}
+
+// Deletes the packs of the multi-pack-index which have none of its
+// objects and rewrites it without them, like git multi-pack-index
+// expire. Packs with a .keep file are never deleted
+func ExpireMultiPackIndex(gitDir string, progressOut io.Writer) error {
+	gitFs := os.DirFS(gitDir)
+
+	midx, err := ReadMultiPackIndex(gitFs)
+
+	if err != nil || midx == nil {
+		return err
+	}
+
+	meter := progress.New(progressOut, "Finding and deleting unreferenced packfiles", uint64(len(midx.packNames)))
+
+	expired := make(map[string]bool)
+
+	for packID, count := range midx.referencedObjects() {
+		meter.Add(1)
+
+		name := midx.packNames[packID]
+
+		if count != 0 {
+			continue
+		}
+
+		if _, err = fs.Stat(gitFs, path.Join(_PackDir, name+".keep")); err == nil {
+			continue
+		}
+
+		if err = RemovePack(gitDir, name); err != nil {
+			return err
+		}
+
+		expired[name] = true
+	}
+
+	meter.Done()
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	packList, err := ListPacks(gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	remaining := make([]PackFile, 0, len(packList))
+
+	for _, p := range packList {
+		if !expired[p.Name] {
+			remaining = append(remaining, p)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return RemoveMultiPackIndex(gitDir)
+	}
+
+	return writeMultiPackIndex(gitDir, remaining, MultiPackIndexOptions{Progress: progressOut})
+}
+
+// Chooses the packs to repack like git, oldest first while their
+// expected size, the part of the pack used by the multi-pack-index,
+// adds up to less than the batch size. A batch size of 0 chooses all
+// the packs
+func repackBatch(gitDir string, midx *MultiPackIndex, packList map[string]PackFile, batchSize uint64) map[uint32]bool {
+	included := make(map[uint32]bool)
+
+	type packInfo struct {
+		packID uint32
+		mtime  int64
+		size   uint64
+	}
+
+	var infos []packInfo
+
+	for packID, name := range midx.packNames {
+		p, found := packList[name]
+
+		// missing and kept packs are never repacked
+		if !found || p.Keep {
+			continue
+		}
+
+		info, err := os.Stat(path.Join(gitDir, _PackDir, name+".pack"))
+
+		if err != nil {
+			continue
+		}
+
+		if batchSize == 0 {
+			included[uint32(packID)] = true
+			continue
+		}
+
+		infos = append(infos, packInfo{packID: uint32(packID), mtime: info.ModTime().Unix(), size: uint64(info.Size())})
+	}
+
+	if batchSize == 0 {
+		return included
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].mtime < infos[j].mtime
+	})
+
+	referenced := midx.referencedObjects()
+
+	var totalSize uint64
+
+	for _, info := range infos {
+		if totalSize >= batchSize {
+			break
+		}
+
+		objectCount := uint64(len(packList[midx.packNames[info.packID]].Idx.Objects()))
+
+		if objectCount == 0 {
+			continue
+		}
+
+		expectedSize := info.size * uint64(referenced[info.packID]) / objectCount
+
+		if expectedSize >= batchSize {
+			continue
+		}
+
+		totalSize += expectedSize
+		included[info.packID] = true
+	}
+
+	return included
+}
+
+// Writes the objects which the multi-pack-index uses from the chosen
+// packs into a new pack and adds it to the multi-pack-index, like git
+// multi-pack-index repack. The old packs are left for expire
+func RepackMultiPackIndex(gitDir string, batchSize uint64, progressOut io.Writer) error {
+	gitFs := os.DirFS(gitDir)
+
+	midx, err := ReadMultiPackIndex(gitFs)
+
+	if err != nil || midx == nil {
+		return err
+	}
+
+	packList, err := ListPacks(gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	packsByName := make(map[string]PackFile, len(packList))
+
+	for _, p := range packList {
+		packsByName[p.Name] = p
+	}
+
+	included := repackBatch(gitDir, midx, packsByName, batchSize)
+
+	// a single pack would be rewritten as is
+	if len(included) < 2 {
+		return nil
+	}
+
+	var objects []*sha.SHA
+
+	for pos := uint32(0); pos < midx.count; pos++ {
+		packID, _, ok := midx.objectAt(pos)
+
+		if !ok || !included[packID] {
+			continue
+		}
+
+		oid := bytes.Clone(midx.oid(pos))
+
+		objSha, err := sha.FromByteSlice(&oid)
+
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, objSha)
+	}
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+
+	if _, err = WriteObjectsWithProgress(&buffer, gitFs, objects, progressOut); err != nil {
+		return err
+	}
+
+	if _, err = Store(gitDir, buffer.Bytes()); err != nil {
+		return err
+	}
+
+	return WriteMultiPackIndex(gitDir, MultiPackIndexOptions{Progress: progressOut})
+}
@@ -0,0 +1,218 @@
+package pack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// Writes the bytes which are consumed to w, zlib reads byte by byte
+// from an io.ByteReader so nothing after its stream is consumed
+type recordingReader struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+
+	if _, writeErr := rr.w.Write(p[:n]); writeErr != nil {
+		return n, writeErr
+	}
+
+	return n, err
+}
+
+func (rr *recordingReader) ReadByte() (byte, error) {
+	b, err := rr.r.ReadByte()
+
+	if err != nil {
+		return b, err
+	}
+
+	return b, rr.w.WriteByte(b)
+}
+
+func (rr *recordingReader) skip(n int) error {
+	_, err := io.CopyN(io.Discard, rr, int64(n))
+
+	return err
+}
+
+// Reads one object, its header followed by the compressed data
+func (rr *recordingReader) readObject() error {
+	b, err := rr.ReadByte()
+
+	if err != nil {
+		return err
+	}
+
+	objType := getObjType(b)
+
+	for shouldReadMore(b) {
+		if b, err = rr.ReadByte(); err != nil {
+			return err
+		}
+	}
+
+	switch objType {
+	case _OFS_DELTA:
+		for b = 0x80; shouldReadMore(b); {
+			if b, err = rr.ReadByte(); err != nil {
+				return err
+			}
+		}
+	case _REF_DELTA:
+		if err = rr.skip(sha.BYTES_LEN); err != nil {
+			return err
+		}
+	}
+
+	_, err = object.Decompress(rr)
+
+	return err
+}
+
+// Reads a single pack from the stream without consuming anything after
+// its end, the objects are not resolved. Used for the pack sent after the
+// push commands as the client can keep the connection open for the report
+func ReadPack(r *bufio.Reader) ([]byte, error) {
+	var packData bytes.Buffer
+
+	if err := readPack(r, bufio.NewWriter(&packData), nil); err != nil {
+		return nil, err
+	}
+
+	return packData.Bytes(), nil
+}
+
+// Objects of the pack read so far, counted by the goroutine reading
+// the pack and shown by the one writing it
+type packCount struct {
+	total atomic.Uint64
+	read  atomic.Uint64
+}
+
+// Same as ReadPack, the pack is written to w and the read objects are
+// counted if count is not nil
+func readPack(r *bufio.Reader, w *bufio.Writer, count *packCount) error {
+	rr := &recordingReader{r: r, w: w}
+
+	header := make([]byte, _PackHeaderSize)
+
+	if _, err := io.ReadFull(rr, header); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPack, err)
+	}
+
+	if !bytes.Equal(header[:4], _PackSignature) {
+		return ErrInvalidPack
+	}
+
+	total := binary.BigEndian.Uint32(header[8:12])
+
+	if count != nil {
+		count.total.Store(uint64(total))
+	}
+
+	for idx := range total {
+		if err := rr.readObject(); err != nil {
+			return fmt.Errorf("%w: object %d: %v", ErrInvalidPack, idx, err)
+		}
+
+		if count != nil {
+			count.read.Store(uint64(idx) + 1)
+		}
+	}
+
+	if err := rr.skip(sha.BYTES_LEN); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPack, err)
+	}
+
+	return w.Flush()
+}
+
+// Collects the pack written to it while showing the "Receiving objects"
+// progress, the objects are counted as they arrive. The meter is only
+// drawn by the writer so it doesn't interleave with the other output
+// of the writer like the remote progress
+type Receiver struct {
+	pw    *io.PipeWriter
+	meter *progress.Meter
+	count packCount
+	done  chan struct{}
+	// Only set when the pack is collected in memory
+	data *bytes.Buffer
+	err  error
+}
+
+func NewReceiver(progressOut io.Writer) *Receiver {
+	var data bytes.Buffer
+
+	rc := NewReceiverTo(&data, progressOut)
+	rc.data = &data
+
+	return rc
+}
+
+// Same as NewReceiver, the pack is written to w as it arrives instead of
+// being collected, ex: spooled to a temp file. Close returns no data
+func NewReceiverTo(w io.Writer, progressOut io.Writer) *Receiver {
+	pr, pw := io.Pipe()
+
+	rc := &Receiver{
+		pw:    pw,
+		meter: progress.NewThroughput(progressOut, "Receiving objects", 0),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(rc.done)
+
+		rc.err = readPack(bufio.NewReader(pr), bufio.NewWriter(w), &rc.count)
+
+		// rest is drained so the writer never blocks on an invalid pack
+		io.Copy(io.Discard, pr)
+	}()
+
+	return rc
+}
+
+func (rc *Receiver) updateMeter() {
+	rc.meter.SetTotal(rc.count.total.Load())
+	rc.meter.Update(rc.count.read.Load())
+}
+
+func (rc *Receiver) Write(p []byte) (int, error) {
+	n, err := rc.pw.Write(p)
+
+	rc.meter.AddBytes(uint64(n))
+	rc.updateMeter()
+
+	return n, err
+}
+
+// Waits for the complete pack and returns it
+func (rc *Receiver) Close() ([]byte, error) {
+	rc.pw.Close()
+	<-rc.done
+
+	if rc.err != nil {
+		return nil, rc.err
+	}
+
+	rc.updateMeter()
+	rc.meter.Done()
+
+	if rc.data == nil {
+		return nil, nil
+	}
+
+	return rc.data.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package pack_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/pack"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestReadPack(t *testing.T) {
+	packData := readTestPack(t)
+
+	t.Run("stops at the end of the pack", func(t *testing.T) {
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(packData), bytes.NewReader([]byte("after"))))
+
+		read, err := pack.ReadPack(r)
+
+		if err != nil {
+			t.Fatalf("ReadPack failed with err %v", err)
+		}
+
+		testutils.AssertBytes(t, "pack", packData, read)
+
+		rest, _ := io.ReadAll(r)
+
+		testutils.AssertString(t, "rest", "after", string(rest))
+	})
+
+	t.Run("fails for truncated pack", func(t *testing.T) {
+		r := bufio.NewReader(bytes.NewReader(packData[:len(packData)/2]))
+
+		if _, err := pack.ReadPack(r); !errors.Is(err, pack.ErrInvalidPack) {
+			t.Errorf("expected ErrInvalidPack but got %v", err)
+		}
+	})
+}
+
+func TestReceiver(t *testing.T) {
+	packData := readTestPack(t)
+
+	t.Run("collects the pack and reports the received objects", func(t *testing.T) {
+		var progress bytes.Buffer
+
+		rc := pack.NewReceiver(&progress)
+
+		// written in small chunks like the sideband packets
+		for start := 0; start < len(packData); start += 1000 {
+			if _, err := rc.Write(packData[start:min(start+1000, len(packData))]); err != nil {
+				t.Fatalf("Write failed with err %v", err)
+			}
+		}
+
+		received, err := rc.Close()
+
+		if err != nil {
+			t.Fatalf("Close failed with err %v", err)
+		}
+
+		testutils.AssertBytes(t, "pack", packData, received)
+
+		if !bytes.Contains(progress.Bytes(), []byte("Receiving objects: 100% (")) || !bytes.HasSuffix(progress.Bytes(), []byte(", done.\n")) {
+			t.Errorf("expected receiving objects progress but got %q", progress.String())
+		}
+	})
+
+	t.Run("writes the pack to the writer", func(t *testing.T) {
+		var spooled bytes.Buffer
+
+		rc := pack.NewReceiverTo(&spooled, nil)
+
+		if _, err := rc.Write(packData); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		if received, err := rc.Close(); err != nil || received != nil {
+			t.Fatalf("expected no data from Close but got %d bytes and err %v", len(received), err)
+		}
+
+		testutils.AssertBytes(t, "pack", packData, spooled.Bytes())
+	})
+
+	t.Run("fails for invalid pack without blocking the writer", func(t *testing.T) {
+		rc := pack.NewReceiver(nil)
+
+		if _, err := rc.Write(bytes.Repeat([]byte("x"), 100_000)); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		if _, err := rc.Close(); !errors.Is(err, pack.ErrInvalidPack) {
+			t.Errorf("expected ErrInvalidPack but got %v", err)
+		}
+	})
+}
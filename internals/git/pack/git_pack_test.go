@@ -6,6 +6,7 @@ import (
 	"io"
 	"testing"
 
+	"github.com/uragirii/got/internals/git/object"
 	"github.com/uragirii/got/internals/git/pack"
 	"github.com/uragirii/got/internals/git/sha"
 	"github.com/uragirii/got/testdata"
@@ -50,7 +51,7 @@ func TestFromIdxFile(t *testing.T) {
 		t.Fatalf("error while reading output file %v", err)
 	}
 
-	p := pack.ParsePackFile(*packReader, idx)
+	p := pack.ParsePackFile(packReader, idx)
 
 	for _, item := range output {
 		t.Run(fmt.Sprintf("Testing for %s", item.SHA), func(t *testing.T) {
@@ -72,3 +73,43 @@ func TestFromIdxFile(t *testing.T) {
 		})
 	}
 }
+
+func TestGetObjContents(t *testing.T) {
+	idx, err := pack.FromIdxFile(testdata.TestData, _IDX_FILE_PATH)
+
+	if err != nil {
+		t.Fatalf("error while parsing index file %v", err)
+	}
+
+	packReader, err := getPackFileReader(t)
+
+	if err != nil {
+		t.Fatalf("error while reading pack file %v", err)
+	}
+
+	output, err := loadVerboseOutput(t)
+
+	if err != nil {
+		t.Fatalf("error while reading output file %v", err)
+	}
+
+	p := pack.ParsePackFile(packReader, idx)
+
+	for _, item := range output {
+		objSha, _ := sha.FromString(item.SHA)
+
+		obj, err := p.GetObj(objSha)
+
+		if err != nil {
+			t.Fatalf("expected not an error for %s but got %v", item.SHA, err)
+		}
+
+		raw := object.WithHeader(obj.ObjType, *obj.Contents)
+
+		contentSha, _ := sha.FromData(&raw)
+
+		if !contentSha.Eq(objSha) {
+			t.Errorf("expected contents of %s to hash to the same SHA but got %s", item.SHA, contentSha)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package pack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var ErrBrokenLink = errors.New("broken link")
+
+type UnpackOptions struct {
+	// Checks the pack without writing the objects
+	DryRun bool
+	// Checks the formatting of the objects and that the objects they link
+	// to are in the pack or the repository. Nothing is written if it fails
+	Strict bool
+	// "Unpacking objects" progress is written here, nil to disable
+	Progress io.Writer
+}
+
+// Link from an object to another, ex: from a commit to its tree
+type link struct {
+	from *sha.SHA
+	to   *sha.SHA
+}
+
+// Writes the objects of the pack as loose objects, same as git unpack-objects.
+// Deltas against the objects of the repository are resolved too, like for
+// the thin packs of pushes. Returns the number of objects in the pack
+func Unpack(gitDir string, packData []byte, opts UnpackOptions) (uint32, error) {
+	gitFs := os.DirFS(gitDir)
+
+	count, err := verifyPack(packSection(packData))
+
+	if err != nil {
+		return 0, err
+	}
+
+	// bases appended after the objects are already in the repository
+	thinEnd := int64(len(packData) - sha.BYTES_LEN)
+
+	if packData, err = FixThin(gitFs, packData); err != nil {
+		return 0, err
+	}
+
+	packFile := packSection(packData)
+
+	fixedCount, err := verifyPack(packFile)
+
+	if err != nil {
+		return 0, err
+	}
+
+	objs, err := readPackObjects(packFile, fixedCount)
+
+	if err != nil {
+		return 0, err
+	}
+
+	meter := progress.New(opts.Progress, "Unpacking objects", uint64(count))
+
+	// strict mode only writes once the links are checked
+	var checked []object.ObjectContents
+	var links []link
+
+	inPack := make(map[string]bool, count)
+
+	_, err = resolvePackObjects(packFile, objs, 0, nil, func(obj *rawPackObj, contents object.ObjectContents) error {
+		if obj.offset >= thinEnd {
+			return nil
+		}
+
+		meter.Add(1)
+
+		if opts.Strict {
+			objLinks, err := object.Check(contents)
+
+			if err != nil {
+				return fmt.Errorf("object %s: %w", obj.sha, err)
+			}
+
+			for _, to := range objLinks {
+				links = append(links, link{from: obj.sha, to: to})
+			}
+
+			inPack[obj.sha.String()] = true
+			checked = append(checked, contents)
+
+			return nil
+		}
+
+		if opts.DryRun {
+			return nil
+		}
+
+		_, err := object.WriteLoose(gitDir, contents)
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, l := range links {
+		if !inPack[l.to.String()] && !object.Exists(l.to, gitFs) {
+			return 0, fmt.Errorf("%w from %s to %s", ErrBrokenLink, l.from, l.to)
+		}
+	}
+
+	if !opts.DryRun {
+		for _, obj := range checked {
+			if _, err = object.WriteLoose(gitDir, obj); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	meter.Done()
+
+	return count, nil
+}
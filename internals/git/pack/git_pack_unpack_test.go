@@ -0,0 +1,108 @@
+package pack_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+func TestUnpack(t *testing.T) {
+	packData := readTestPack(t)
+
+	idxData, _ := pack.IndexPack(packData)
+	idx, _ := pack.FromIdxBytes(idxData)
+
+	t.Run("writes every object as a loose object", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		count, err := pack.Unpack(gitDir, packData, pack.UnpackOptions{})
+
+		if err != nil {
+			t.Fatalf("Unpack failed with err %v", err)
+		}
+
+		if int(count) != len(idx.Objects()) {
+			t.Errorf("expected %d objects but got %d", len(idx.Objects()), count)
+		}
+
+		for _, objSha := range idx.Objects() {
+			objPath, _ := objSha.GetObjPath()
+
+			if _, err := os.Stat(path.Join(gitDir, objPath)); err != nil {
+				t.Fatalf("expected loose object %s but got %v", objSha, err)
+			}
+		}
+	})
+
+	t.Run("writes nothing for dry run", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		if _, err := pack.Unpack(gitDir, packData, pack.UnpackOptions{DryRun: true, Strict: true}); err != nil {
+			t.Fatalf("Unpack failed with err %v", err)
+		}
+
+		if entries, _ := os.ReadDir(gitDir); len(entries) != 0 {
+			t.Errorf("expected no objects but got %v", entries)
+		}
+	})
+
+	t.Run("resolves deltas against the repository", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		if _, err := pack.Store(gitDir, packData); err != nil {
+			t.Fatalf("Store failed with err %v", err)
+		}
+
+		base, _ := sha.FromString("1555f0bf3c0caf8147af9efd42cee5842a3c6e00")
+		baseObj, _ := object.FromSHA(base, os.DirFS(gitDir))
+
+		thin := thinPack(t, refDelta{base: base, baseSize: len(*baseObj.Contents), contents: []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")})
+
+		count, err := pack.Unpack(gitDir, thin, pack.UnpackOptions{})
+
+		if err != nil {
+			t.Fatalf("Unpack failed with err %v", err)
+		}
+
+		if count != 1 {
+			t.Errorf("expected only the delta to be counted but got %d", count)
+		}
+
+		// base is only in the pack and not written loose
+		basePath, _ := base.GetObjPath()
+
+		if _, err := os.Stat(path.Join(gitDir, basePath)); err == nil {
+			t.Errorf("expected the base to not be written loose")
+		}
+	})
+
+	t.Run("fails for broken links in strict mode", func(t *testing.T) {
+		gitDir := t.TempDir()
+
+		commit := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\nauthor A <a@b.c> 1700000000 +0000\ncommitter A <a@b.c> 1700000000 +0000\n\nmsg\n")
+
+		var buffer bytes.Buffer
+
+		pw, _ := pack.NewWriter(&buffer, 1)
+		pw.WriteObject(object.ObjectContents{ObjType: object.CommitObj, Contents: &commit})
+		pw.Close()
+
+		if _, err := pack.Unpack(gitDir, buffer.Bytes(), pack.UnpackOptions{Strict: true}); !errors.Is(err, pack.ErrBrokenLink) {
+			t.Fatalf("expected ErrBrokenLink but got %v", err)
+		}
+
+		if entries, _ := os.ReadDir(gitDir); len(entries) != 0 {
+			t.Errorf("expected no objects to be written but got %v", entries)
+		}
+
+		if _, err := pack.Unpack(gitDir, buffer.Bytes(), pack.UnpackOptions{}); err != nil {
+			t.Errorf("expected the commit to be written without strict but got %v", err)
+		}
+	})
+}
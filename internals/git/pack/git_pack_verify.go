@@ -0,0 +1,102 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+var ErrIdxChecksumMismatch = errors.New("idx checksum mismatch")
+var ErrIdxMismatch = errors.New("idx doesn't match the pack")
+
+// Checks the trailer of the idx, its own checksum and the copy of
+// the pack checksum
+func verifyIdxChecksums(idxData, packData []byte) error {
+	if len(idxData) < sha.BYTES_LEN*2 {
+		return ErrIndexParsing
+	}
+
+	checksum := sha1.Sum(idxData[:len(idxData)-sha.BYTES_LEN])
+
+	if !bytes.Equal(checksum[:], idxData[len(idxData)-sha.BYTES_LEN:]) {
+		return ErrIdxChecksumMismatch
+	}
+
+	packChecksum := idxData[len(idxData)-sha.BYTES_LEN*2 : len(idxData)-sha.BYTES_LEN]
+
+	if !bytes.Equal(packChecksum, packData[len(packData)-sha.BYTES_LEN:]) {
+		return fmt.Errorf("%w: pack checksum differs", ErrIdxMismatch)
+	}
+
+	return nil
+}
+
+// Verifies the pack in objects/pack like git verify-pack, the checksums
+// of the pack and its idx and that the idx has all the objects of the pack
+// at their offsets. The resolved objects are passed to visit, the objects
+// visited before an error are not invalid. Ex: Verify(gitFs, "pack-<sha>", visit)
+func Verify(gitFs fs.FS, name string, visit func(objSha *sha.SHA, obj object.ObjectContents) error) error {
+	packData, err := fs.ReadFile(gitFs, path.Join(_PackDir, name+".pack"))
+
+	if err != nil {
+		return err
+	}
+
+	idxData, err := fs.ReadFile(gitFs, path.Join(_PackDir, name+".idx"))
+
+	if err != nil {
+		return err
+	}
+
+	packFile := packSection(packData)
+
+	count, err := verifyPack(packFile)
+
+	if err != nil {
+		return err
+	}
+
+	if err = verifyIdxChecksums(idxData, packData); err != nil {
+		return err
+	}
+
+	idx, err := FromIdxBytes(idxData)
+
+	if err != nil {
+		return err
+	}
+
+	objs, err := readPackObjects(packFile, count)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := resolvePackObjects(packFile, objs, 0, nil, func(obj *rawPackObj, contents object.ObjectContents) error {
+		return visit(obj.sha, contents)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(entries) != len(idx.Objects()) {
+		return fmt.Errorf("%w: idx has %d objects but pack has %d", ErrIdxMismatch, len(idx.Objects()), len(entries))
+	}
+
+	for _, entry := range entries {
+		item, ok := idx.GetObjOffset(entry.sha)
+
+		if !ok || uint64(item.Offset) != entry.offset {
+			return fmt.Errorf("%w: wrong offset of %s", ErrIdxMismatch, entry.sha)
+		}
+	}
+
+	return nil
+}
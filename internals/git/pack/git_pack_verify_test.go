@@ -0,0 +1,79 @@
+package pack_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+func TestVerify(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	checksum, err := pack.Store(gitDir, readTestPack(t))
+
+	if err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	name := "pack-" + checksum.String()
+	packPath := path.Join(gitDir, "objects/pack", name)
+
+	visited := 0
+
+	err = pack.Verify(gitFs, name, func(objSha *sha.SHA, obj object.ObjectContents) error {
+		visited++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Verify failed with err %v", err)
+	}
+
+	idx, _ := pack.FromIdxFile(gitFs, path.Join("objects/pack", name+".idx"))
+
+	if visited != len(idx.Objects()) {
+		t.Errorf("expected %d objects to be visited but got %d", len(idx.Objects()), visited)
+	}
+
+	// flips a byte in the middle of the file
+	corrupt := func(t *testing.T, filePath string) {
+		t.Helper()
+
+		data, _ := os.ReadFile(filePath)
+		data[len(data)/2] ^= 0xff
+
+		os.Chmod(filePath, 0644)
+
+		if err := os.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatalf("failed to write %v", err)
+		}
+	}
+
+	noop := func(*sha.SHA, object.ObjectContents) error { return nil }
+
+	t.Run("fails for corrupted idx", func(t *testing.T) {
+		original, _ := os.ReadFile(packPath + ".idx")
+		defer os.WriteFile(packPath+".idx", original, 0644)
+
+		corrupt(t, packPath+".idx")
+
+		if err := pack.Verify(gitFs, name, noop); !errors.Is(err, pack.ErrIdxChecksumMismatch) {
+			t.Errorf("expected ErrIdxChecksumMismatch but got %v", err)
+		}
+	})
+
+	t.Run("fails for corrupted pack", func(t *testing.T) {
+		corrupt(t, packPath+".pack")
+
+		if err := pack.Verify(gitFs, name, noop); !errors.Is(err, pack.ErrPackChecksumMismatch) {
+			t.Errorf("expected ErrPackChecksumMismatch but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package pack
+
+import (
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/progress"
+)
+
+const _PackVersion uint32 = 2
+
+var ErrObjCountMismatch = errors.New("pack object count mismatch")
+
+func packObjTypeFrom(objType object.ObjectType) (packObjType, error) {
+	switch objType {
+	case object.BlobObj:
+		return _BLOB, nil
+	case object.CommitObj:
+		return _COMMIT, nil
+	case object.TreeObj:
+		return _TREE, nil
+	case object.TagObj:
+		return _TAG, nil
+	}
+
+	return 0, fmt.Errorf("%w: invalid object type %s", ErrInvalidPack, objType)
+}
+
+// Type and size header of the object, the size is little endian
+// with 4 bits in the first byte and 7 bits in the rest
+func encodeObjHeader(objType packObjType, size int) []byte {
+	b := byte(objType)<<4 | byte(size&0x0f)
+	size >>= 4
+
+	var header []byte
+
+	for size > 0 {
+		header = append(header, b|0x80)
+		b = byte(size & 0x7f)
+		size >>= 7
+	}
+
+	return append(header, b)
+}
+
+// Writes a pack without deltas, count of the objects
+// is part of the header so it must be known beforehand
+// @see https://git-scm.com/docs/pack-format#_pack_pack_files_have_the_following_format
+type Writer struct {
+	w       io.Writer
+	hash    hash.Hash
+	count   uint32
+	written uint32
+}
+
+func NewWriter(w io.Writer, count uint32) (*Writer, error) {
+	h := sha1.New()
+
+	pw := &Writer{
+		w:     io.MultiWriter(w, h),
+		hash:  h,
+		count: count,
+	}
+
+	header := make([]byte, _PackHeaderSize)
+
+	copy(header, _PackSignature)
+	binary.BigEndian.PutUint32(header[4:8], _PackVersion)
+	binary.BigEndian.PutUint32(header[8:12], count)
+
+	if _, err := pw.w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+func (pw *Writer) WriteObject(obj object.ObjectContents) error {
+	if pw.written == pw.count {
+		return ErrObjCountMismatch
+	}
+
+	objType, err := packObjTypeFrom(obj.ObjType)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = pw.w.Write(encodeObjHeader(objType, len(*obj.Contents))); err != nil {
+		return err
+	}
+
+	zw := zlib.NewWriter(pw.w)
+
+	if _, err = zw.Write(*obj.Contents); err != nil {
+		return err
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	pw.written++
+
+	return nil
+}
+
+// Writes the trailing checksum and returns it, the checksum is the pack name
+func (pw *Writer) Close() (*sha.SHA, error) {
+	if pw.written != pw.count {
+		return nil, fmt.Errorf("%w: expected %d objects but wrote %d", ErrObjCountMismatch, pw.count, pw.written)
+	}
+
+	checksum := pw.hash.Sum(nil)
+
+	if _, err := pw.w.Write(checksum); err != nil {
+		return nil, err
+	}
+
+	return sha.FromByteSlice(&checksum)
+}
+
+// Writes the pack containing the objects read from the repository
+func WriteObjects(w io.Writer, gitFs fs.FS, objects []*sha.SHA) (*sha.SHA, error) {
+	return WriteObjectsWithProgress(w, gitFs, objects, nil)
+}
+
+// Counts the bytes written for the throughput of the meter
+type meterWriter struct {
+	w     io.Writer
+	meter *progress.Meter
+}
+
+func (mw meterWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	mw.meter.AddBytes(uint64(n))
+
+	return n, err
+}
+
+// Same as WriteObjects but the "Writing objects" progress is written to progress
+func WriteObjectsWithProgress(w io.Writer, gitFs fs.FS, objects []*sha.SHA, progressOut io.Writer) (*sha.SHA, error) {
+	meter := progress.NewThroughput(progressOut, "Writing objects", uint64(len(objects)))
+
+	pw, err := NewWriter(meterWriter{w: w, meter: meter}, uint32(len(objects)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, objSha := range objects {
+		obj, err := object.FromSHA(objSha, gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = pw.WriteObject(obj); err != nil {
+			return nil, err
+		}
+
+		meter.Update(uint64(idx) + 1)
+	}
+
+	checksum, err := pw.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	meter.Done()
+
+	return checksum, nil
+}
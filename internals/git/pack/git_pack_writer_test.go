@@ -0,0 +1,72 @@
+package pack_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestWriteObjects(t *testing.T) {
+	srcDir := t.TempDir()
+
+	if _, err := pack.Store(srcDir, readTestPack(t)); err != nil {
+		t.Fatalf("Store failed with err %v", err)
+	}
+
+	var objects []*sha.SHA
+
+	// commit, tree and blob
+	for _, shaStr := range []string{"1555f0bf3c0caf8147af9efd42cee5842a3c6e00", "df1611f7ecf067d011d91d5a5f5f397fb2417b89", "4746d9ca75d580f3639a163e847b894fffe92d3b"} {
+		objSha, _ := sha.FromString(shaStr)
+		objects = append(objects, objSha)
+	}
+
+	var packData bytes.Buffer
+
+	checksum, err := pack.WriteObjects(&packData, os.DirFS(srcDir), objects)
+
+	if err != nil {
+		t.Fatalf("WriteObjects failed with err %v", err)
+	}
+
+	destDir := t.TempDir()
+
+	stored, err := pack.Store(destDir, packData.Bytes())
+
+	if err != nil {
+		t.Fatalf("Store failed for written pack with err %v", err)
+	}
+
+	testutils.AssertString(t, "checksum", checksum.String(), stored.String())
+
+	for _, objSha := range objects {
+		expected, _ := object.FromSHA(objSha, os.DirFS(srcDir))
+
+		got, err := object.FromSHA(objSha, os.DirFS(destDir))
+
+		if err != nil {
+			t.Fatalf("failed to read %s from written pack %v", objSha, err)
+		}
+
+		testutils.AssertString(t, "type", string(expected.ObjType), string(got.ObjType))
+		testutils.AssertBytes(t, objSha.String(), *got.Contents, *expected.Contents)
+	}
+}
+
+func TestWriterCount(t *testing.T) {
+	pw, err := pack.NewWriter(&bytes.Buffer{}, 1)
+
+	if err != nil {
+		t.Fatalf("NewWriter failed with err %v", err)
+	}
+
+	if _, err = pw.Close(); !errors.Is(err, pack.ErrObjCountMismatch) {
+		t.Errorf("expected ErrObjCountMismatch but got %v", err)
+	}
+}
@@ -4,19 +4,38 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
+// @see https://git-scm.com/docs/protocol-common#_pkt_line_format
 const FlushPacket = "0000"
 
+// Separates sections of a message in protocol v2
+const DelimPacket = "0001"
+
+// Indicates the end of response for stateless connections in protocol v2
+const ResponseEndPacket = "0002"
+
+// Max length of a pkt-line including the 4 byte length
+const MaxPacketLen = 65520
+const _LenSize = 4
+const MaxDataLen = MaxPacketLen - _LenSize
+
 var ErrInvalidPktLine = errors.New("invalid pkt line")
 var ErrLengthMismatch = errors.New("pkt line didn't match")
+var ErrPacketTooLong = fmt.Errorf("pkt line exceeds %d bytes", MaxPacketLen)
 
+// Encodes the text line, LF is added if the line doesn't end with it
 func Encode(line string) string {
 	if len(line) == 0 {
 		return FlushPacket
 	}
 
-	return fmt.Sprintf("%04x%s\n", len(line)+5, line)
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+
+	return fmt.Sprintf("%04x%s", len(line)+_LenSize, line)
 }
 
 func EncodeBinary(data []byte) string {
@@ -25,12 +44,12 @@ func EncodeBinary(data []byte) string {
 		return FlushPacket
 	}
 
-	return fmt.Sprintf("%04x%s", len(data)+4, data)
+	return fmt.Sprintf("%04x%s", len(data)+_LenSize, data)
 }
 
 func Decode(line string) (*[]byte, error) {
 
-	if len(line) < 4 {
+	if len(line) < _LenSize {
 		return nil, ErrInvalidPktLine
 	}
 
@@ -39,7 +58,7 @@ func Decode(line string) (*[]byte, error) {
 		return &empty, nil
 	}
 
-	lineLen, err := strconv.ParseInt(line[0:4], 16, 64)
+	lineLen, err := strconv.ParseInt(line[0:_LenSize], 16, 64)
 
 	if err != nil {
 		return nil, err
@@ -49,7 +68,7 @@ func Decode(line string) (*[]byte, error) {
 		return nil, ErrLengthMismatch
 	}
 
-	lineBytes := []byte(line[4:])
+	lineBytes := []byte(line[_LenSize:])
 
 	return &lineBytes, nil
 }
@@ -31,6 +31,14 @@ func TestEncode(t *testing.T) {
 			t.Errorf("ascii data should include LF at the end")
 		}
 	})
+
+	t.Run("length includes the LF", func(t *testing.T) {
+		testutils.AssertString(t, "encoded", "0009want\n", pktline.Encode("want"))
+	})
+
+	t.Run("LF is not added twice", func(t *testing.T) {
+		testutils.AssertString(t, "encoded", "0009want\n", pktline.Encode("want\n"))
+	})
 }
 
 func TestDecode(t *testing.T) {
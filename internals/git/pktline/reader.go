@@ -0,0 +1,97 @@
+package pktline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type PacketType int
+
+const (
+	TypeData PacketType = iota
+	TypeFlush
+	TypeDelim
+	TypeResponseEnd
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case TypeFlush:
+		return "flush"
+	case TypeDelim:
+		return "delim"
+	case TypeResponseEnd:
+		return "response-end"
+	}
+
+	return "data"
+}
+
+const _ErrPrefix = "ERR "
+
+// Returned when the other side sends an ERR packet
+var ErrRemote = errors.New("remote error")
+
+// Reads pkt-lines from the underlying reader
+type Reader struct {
+	r      io.Reader
+	lenBuf [_LenSize]byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Reads the next packet, data is nil for flush, delim and
+// response-end packets. io.EOF is only returned if the stream
+// ends at the packet boundary, else io.ErrUnexpectedEOF
+func (r *Reader) ReadPacket() (PacketType, []byte, error) {
+	if _, err := io.ReadFull(r.r, r.lenBuf[:]); err != nil {
+		return TypeData, nil, err
+	}
+
+	switch string(r.lenBuf[:]) {
+	case FlushPacket:
+		return TypeFlush, nil, nil
+	case DelimPacket:
+		return TypeDelim, nil, nil
+	case ResponseEndPacket:
+		return TypeResponseEnd, nil, nil
+	}
+
+	pktLen, err := strconv.ParseUint(string(r.lenBuf[:]), 16, 16)
+
+	if err != nil || pktLen < _LenSize {
+		return TypeData, nil, fmt.Errorf("%w: bad length %q", ErrInvalidPktLine, r.lenBuf[:])
+	}
+
+	if pktLen > MaxPacketLen {
+		return TypeData, nil, ErrPacketTooLong
+	}
+
+	data := make([]byte, pktLen-_LenSize)
+
+	if _, err = io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return TypeData, nil, err
+	}
+
+	if strings.HasPrefix(string(data), _ErrPrefix) {
+		return TypeData, nil, fmt.Errorf("%w: %s", ErrRemote, strings.TrimSpace(string(data[len(_ErrPrefix):])))
+	}
+
+	return TypeData, data, nil
+}
+
+// Same as ReadPacket but returns the data as string with LF trimmed
+func (r *Reader) ReadLine() (PacketType, string, error) {
+	pktType, data, err := r.ReadPacket()
+
+	return pktType, strings.TrimSuffix(string(data), "\n"), err
+}
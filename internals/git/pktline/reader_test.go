@@ -0,0 +1,73 @@
+package pktline_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestReadPacket(t *testing.T) {
+	t.Run("reads data and special packets", func(t *testing.T) {
+		// one byte at a time to make sure short reads are handled
+		r := pktline.NewReader(iotest.OneByteReader(strings.NewReader("000bcommand0001000bfoobar\n00040002" + pktline.FlushPacket)))
+
+		expected := []struct {
+			pktType pktline.PacketType
+			data    string
+		}{
+			{pktline.TypeData, "command"},
+			{pktline.TypeDelim, ""},
+			{pktline.TypeData, "foobar"},
+			{pktline.TypeData, ""},
+			{pktline.TypeResponseEnd, ""},
+			{pktline.TypeFlush, ""},
+		}
+
+		for _, e := range expected {
+			pktType, line, err := r.ReadLine()
+
+			if err != nil {
+				t.Fatalf("ReadLine failed with err %v", err)
+			}
+
+			if pktType != e.pktType {
+				t.Errorf("expected %s packet but got %s", e.pktType, pktType)
+			}
+
+			testutils.AssertString(t, "line", e.data, line)
+		}
+
+		if _, _, err := r.ReadPacket(); err != io.EOF {
+			t.Errorf("expected EOF at the end but got %v", err)
+		}
+	})
+
+	t.Run("returns ErrRemote for ERR packet", func(t *testing.T) {
+		_, _, err := pktline.NewReader(strings.NewReader("0015ERR access denied")).ReadPacket()
+
+		if !errors.Is(err, pktline.ErrRemote) || !strings.Contains(err.Error(), "access denied") {
+			t.Errorf("expected ErrRemote but got %v", err)
+		}
+	})
+
+	t.Run("fails for invalid packets", func(t *testing.T) {
+		for input, expectedErr := range map[string]error{
+			"0003":     pktline.ErrInvalidPktLine,
+			"zzzzdata": pktline.ErrInvalidPktLine,
+			"fff5":     pktline.ErrPacketTooLong,
+			"000afoo":  io.ErrUnexpectedEOF,
+			"00":       io.ErrUnexpectedEOF,
+		} {
+			_, _, err := pktline.NewReader(strings.NewReader(input)).ReadPacket()
+
+			if !errors.Is(err, expectedErr) {
+				t.Errorf("expected %v for %q but got %v", expectedErr, input, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package pktline
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writes pkt-lines to the underlying writer
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Writes the data as single packet, data longer
+// than MaxDataLen returns ErrPacketTooLong
+func (w *Writer) WritePacket(data []byte) error {
+	if len(data) > MaxDataLen {
+		return ErrPacketTooLong
+	}
+
+	if _, err := fmt.Fprintf(w.w, "%04x", len(data)+_LenSize); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(data)
+
+	return err
+}
+
+// Writes the text line, LF is added if the line doesn't end with it
+func (w *Writer) WriteLine(line string) error {
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line += "\n"
+	}
+
+	return w.WritePacket([]byte(line))
+}
+
+// Same as WriteLine but formats the line like fmt.Sprintf
+func (w *Writer) WriteLinef(format string, args ...any) error {
+	return w.WriteLine(fmt.Sprintf(format, args...))
+}
+
+func (w *Writer) WriteFlush() error {
+	_, err := io.WriteString(w.w, FlushPacket)
+
+	return err
+}
+
+func (w *Writer) WriteDelim() error {
+	_, err := io.WriteString(w.w, DelimPacket)
+
+	return err
+}
+
+func (w *Writer) WriteResponseEnd() error {
+	_, err := io.WriteString(w.w, ResponseEndPacket)
+
+	return err
+}
@@ -0,0 +1,45 @@
+package pktline_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestWriter(t *testing.T) {
+	t.Run("writes lines and special packets", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		w := pktline.NewWriter(&buffer)
+
+		w.WriteLinef("command=%s", "fetch")
+		w.WriteDelim()
+		w.WriteLine("done\n")
+		w.WritePacket([]byte{1, 2})
+		w.WriteFlush()
+		w.WriteResponseEnd()
+
+		testutils.AssertString(t, "written", "0012command=fetch\n00010009done\n0006\x01\x0200000002", buffer.String())
+	})
+
+	t.Run("fails for packet over the limit", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		w := pktline.NewWriter(&buffer)
+
+		if err := w.WritePacket(make([]byte, pktline.MaxDataLen)); err != nil {
+			t.Errorf("expected max sized packet to be written but got %v", err)
+		}
+
+		if err := w.WritePacket(make([]byte, pktline.MaxDataLen+1)); !errors.Is(err, pktline.ErrPacketTooLong) {
+			t.Errorf("expected ErrPacketTooLong but got %v", err)
+		}
+
+		if buffer.Len() != pktline.MaxPacketLen {
+			t.Errorf("expected only one packet to be written")
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package reachable
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/reflog"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Returns the objects everything else is reached from, the refs,
+// HEAD, the old and new objects of the reflog entries, and the
+// index entries and cache tree. Roots missing from the repository
+// are skipped, like the objects of the expired reflog entries
+func Roots(gitFs fs.FS) ([]*sha.SHA, error) {
+	var roots []*sha.SHA
+
+	seen := make(map[string]bool)
+
+	addRoot := func(objSha *sha.SHA) {
+		if seen[objSha.String()] {
+			return
+		}
+
+		seen[objSha.String()] = true
+
+		if object.Exists(objSha, gitFs) {
+			roots = append(roots, objSha)
+		}
+	}
+
+	refList, err := refs.List(gitFs, "refs/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range refList {
+		addRoot(ref.SHA)
+	}
+
+	// detached or unborn HEAD
+	if headSha, err := refs.Read(gitFs, "HEAD"); err == nil {
+		addRoot(headSha)
+	}
+
+	logs, err := reflog.List(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range logs {
+		entries, err := reflog.Read(gitFs, ref)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			addRoot(entry.Old)
+			addRoot(entry.New)
+		}
+	}
+
+	indexFile, err := gitFs.Open(index.IndexFileName)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return roots, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer indexFile.Close()
+
+	idx, err := index.New(indexFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range idx.GetTrackedFiles() {
+		addRoot(entry.SHA)
+	}
+
+	for _, treeSha := range idx.CacheTreeSHAs() {
+		addRoot(treeSha)
+	}
+
+	return roots, nil
+}
+
+// Returns the commits, tags, trees and blobs reachable from the roots,
+// the history of a shallow repository stops at its shallow commits.
+// "Counting objects" progress is written to progressOut, nil to disable
+func Objects(gitFs fs.FS, progressOut io.Writer) ([]*sha.SHA, error) {
+	roots, err := Roots(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return revlist.ListObjects(gitFs, roots, nil, revlist.ListOptions{Progress: progressOut})
+}
+
+// Same as Objects but returns a set keyed by the SHA string
+func Set(gitFs fs.FS, progressOut io.Writer) (map[string]bool, error) {
+	objects, err := Objects(gitFs, progressOut)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(objects))
+
+	for _, objSha := range objects {
+		set[objSha.String()] = true
+	}
+
+	return set, nil
+}
+
+// Returns the commits the refs point to with the tags peeled, refs to
+// other objects are skipped. Used for writing the commit-graph
+func Commits(gitFs fs.FS) ([]*sha.SHA, error) {
+	refList, err := refs.List(gitFs, "refs/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*sha.SHA
+
+	seen := make(map[string]bool)
+
+	for _, ref := range refList {
+		target, err := revlist.Peel(gitFs, ref.SHA)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[target.String()] {
+			continue
+		}
+
+		seen[target.String()] = true
+
+		if _, err = revlist.ReadCommit(gitFs, target); errors.Is(err, revlist.ErrNotCommit) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, target)
+	}
+
+	return commits, nil
+}
@@ -0,0 +1,143 @@
+package reachable_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/reachable"
+	"github.com/uragirii/got/internals/git/reflog"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+	"github.com/uragirii/got/testdata"
+)
+
+const (
+	_ZeroSHA = "0000000000000000000000000000000000000000"
+	// .gitignore and the root of the cache tree of testdata/index/normal
+	_IndexBlobSHA = "66305f506530406dcb4bd5bf5534c00bbdb3cb35"
+	_IndexTreeSHA = "4815b7124d964006d38e5e893017e8038895deec"
+)
+
+func writeFile(t *testing.T, filePath string, contents []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatalf("failed to create dir %v", err)
+	}
+
+	if err := os.WriteFile(filePath, contents, 0644); err != nil {
+		t.Fatalf("failed to write %s %v", filePath, err)
+	}
+}
+
+func sorted(shas []*sha.SHA) string {
+	strs := make([]string, 0, len(shas))
+
+	for _, objSha := range shas {
+		strs = append(strs, objSha.String())
+	}
+
+	sort.Strings(strs)
+
+	return strings.Join(strs, "\n")
+}
+
+func TestRoots(t *testing.T) {
+	gitDir := t.TempDir()
+
+	branch, _, _ := testutils.WriteCommit(t, gitDir, "branch")
+	detached, _, _ := testutils.WriteCommit(t, gitDir, "detached")
+	logged, _, _ := testutils.WriteCommit(t, gitDir, "logged")
+
+	refs.Write(gitDir, "refs/heads/main", branch)
+	refs.Write(gitDir, "HEAD", detached)
+
+	writeFile(t, path.Join(gitDir, reflog.Dir, "HEAD"),
+		[]byte(fmt.Sprintf("%s %s A <a@b.c> 1700000000 +0000\tcommit: logged\n", _ZeroSHA, logged)))
+
+	indexData, _ := testdata.TestData.ReadFile("index/normal")
+	writeFile(t, path.Join(gitDir, index.IndexFileName), indexData)
+
+	// only the objects present in the repository are roots
+	for _, hex := range []string{_IndexBlobSHA, _IndexTreeSHA} {
+		objSha, _ := sha.FromString(hex)
+		objPath, _ := objSha.GetObjPath()
+
+		writeFile(t, path.Join(gitDir, objPath), nil)
+	}
+
+	roots, err := reachable.Roots(os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("Roots failed with err %v", err)
+	}
+
+	indexBlob, _ := sha.FromString(_IndexBlobSHA)
+	indexTree, _ := sha.FromString(_IndexTreeSHA)
+
+	testutils.AssertString(t, "roots", sorted([]*sha.SHA{branch, detached, logged, indexBlob, indexTree}), sorted(roots))
+}
+
+func TestObjects(t *testing.T) {
+	gitDir := t.TempDir()
+
+	tip, tipTree, tipBlob := testutils.WriteCommit(t, gitDir, "tip")
+	logged, loggedTree, loggedBlob := testutils.WriteCommit(t, gitDir, "logged")
+
+	expected := []*sha.SHA{tip, tipTree, tipBlob}
+	loggedObjs := []*sha.SHA{logged, loggedTree, loggedBlob}
+	testutils.WriteObj(t, gitDir, object.BlobObj, "unreachable")
+
+	refs.Write(gitDir, "refs/heads/main", tip)
+
+	writeFile(t, path.Join(gitDir, reflog.Dir, "refs/heads/main"),
+		[]byte(fmt.Sprintf("%s %s A <a@b.c> 1700000000 +0000\tcommit: logged\n", _ZeroSHA, logged)))
+
+	objects, err := reachable.Objects(os.DirFS(gitDir), nil)
+
+	if err != nil {
+		t.Fatalf("Objects failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "objects", sorted(append(expected, loggedObjs...)), sorted(objects))
+
+	t.Run("returns a set", func(t *testing.T) {
+		set, err := reachable.Set(os.DirFS(gitDir), nil)
+
+		if err != nil {
+			t.Fatalf("Set failed with err %v", err)
+		}
+
+		if len(set) != 6 || !set[tip.String()] || !set[logged.String()] {
+			t.Errorf("expected the 6 reachable objects but got %v", set)
+		}
+	})
+}
+
+func TestCommits(t *testing.T) {
+	gitDir := t.TempDir()
+
+	branch, _, _ := testutils.WriteCommit(t, gitDir, "branch")
+	blobSha := testutils.WriteObj(t, gitDir, object.BlobObj, "blob")
+	tagSha := testutils.WriteObj(t, gitDir, object.TagObj,
+		"object "+branch.String()+"\ntype commit\ntag v1\ntagger A <a@b.c> 1700000000 +0000\n\nv1\n")
+
+	refs.Write(gitDir, "refs/heads/main", branch)
+	refs.Write(gitDir, "refs/tags/v1", tagSha)
+	refs.Write(gitDir, "refs/tags/blob", blobSha)
+
+	commits, err := reachable.Commits(os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("Commits failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "commits", branch.String(), sorted(commits))
+}
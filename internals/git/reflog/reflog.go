@@ -0,0 +1,161 @@
+package reflog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Dir in the git dir with one log per ref, ex: logs/refs/heads/main
+// @see https://git-scm.com/docs/git-reflog
+const Dir = "logs"
+
+var ErrInvalidEntry = errors.New("invalid reflog entry")
+
+// Update of a ref, Old is the zero SHA when the ref was created
+type Entry struct {
+	Old     *sha.SHA
+	New     *sha.SHA
+	Ident   string
+	Time    time.Time
+	Message string
+	// written back as is on expire
+	line string
+}
+
+// Parses "<old> <new> <name> <<email>> <unix> <zone>\t<message>"
+func parseEntry(line string) (Entry, error) {
+	oldStr, rest, _ := strings.Cut(line, " ")
+	newStr, rest, _ := strings.Cut(rest, " ")
+	ident, message, _ := strings.Cut(rest, "\t")
+
+	oldSha, err := sha.FromString(oldStr)
+
+	if err != nil {
+		return Entry{}, fmt.Errorf("%w: %q", ErrInvalidEntry, line)
+	}
+
+	newSha, err := sha.FromString(newStr)
+
+	if err != nil {
+		return Entry{}, fmt.Errorf("%w: %q", ErrInvalidEntry, line)
+	}
+
+	// time and zone are after the email
+	_, timeStr, found := strings.Cut(ident, "> ")
+	unixStr, _, _ := strings.Cut(timeStr, " ")
+
+	unix, err := strconv.ParseInt(unixStr, 10, 64)
+
+	if !found || err != nil {
+		return Entry{}, fmt.Errorf("%w: %q", ErrInvalidEntry, line)
+	}
+
+	return Entry{
+		Old:     oldSha,
+		New:     newSha,
+		Ident:   ident,
+		Time:    time.Unix(unix, 0),
+		Message: message,
+		line:    line,
+	}, nil
+}
+
+// Returns the entries of the ref's log oldest first, nil if the ref has no log
+func Read(gitFs fs.FS, ref string) ([]Entry, error) {
+	contents, err := fs.ReadFile(gitFs, path.Join(Dir, ref))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+
+		entry, err := parseEntry(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Returns the refs having a log, ex: HEAD and refs/heads/main
+func List(gitFs fs.FS) ([]string, error) {
+	var refList []string
+
+	err := fs.WalkDir(gitFs, Dir, func(logPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || strings.HasSuffix(logPath, ".lock") {
+			return nil
+		}
+
+		refList = append(refList, strings.TrimPrefix(logPath, Dir+"/"))
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return refList, err
+}
+
+// Removes the entries of the ref's log for which keep returns false
+// and returns the number of removed entries
+func Expire(gitDir, ref string, keep func(Entry) bool) (int, error) {
+	entries, err := Read(os.DirFS(gitDir), ref)
+
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	var sb strings.Builder
+
+	removed := 0
+
+	for _, entry := range entries {
+		if !keep(entry) {
+			removed++
+			continue
+		}
+
+		sb.WriteString(entry.line + "\n")
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	logPath := path.Join(gitDir, Dir, ref)
+	lockPath := logPath + ".lock"
+
+	if err = os.WriteFile(lockPath, []byte(sb.String()), 0644); err != nil {
+		return 0, err
+	}
+
+	return removed, os.Rename(lockPath, logPath)
+}
@@ -0,0 +1,110 @@
+package reflog_test
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/reflog"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const (
+	_ZeroSHA   = "0000000000000000000000000000000000000000"
+	_FirstSHA  = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+	_SecondSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+)
+
+var _Log = _ZeroSHA + " " + _FirstSHA + " A U Thor <author@example.com> 1700000000 +0530\tcommit (initial): first\n" +
+	_FirstSHA + " " + _SecondSHA + " A U Thor <author@example.com> 1700000100 +0530\tcommit: second\n"
+
+func writeLog(t *testing.T, gitDir, ref, contents string) {
+	t.Helper()
+
+	logPath := path.Join(gitDir, reflog.Dir, ref)
+
+	if err := os.MkdirAll(path.Dir(logPath), 0755); err != nil {
+		t.Fatalf("failed to create logs dir %v", err)
+	}
+
+	if err := os.WriteFile(logPath, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write log %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	writeLog(t, gitDir, "HEAD", _Log)
+	writeLog(t, gitDir, "refs/heads/main", _Log)
+
+	entries, err := reflog.Read(gitFs, "HEAD")
+
+	if err != nil {
+		t.Fatalf("Read failed with err %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries but got %d", len(entries))
+	}
+
+	testutils.AssertString(t, "old", _ZeroSHA, entries[0].Old.String())
+	testutils.AssertString(t, "new", _SecondSHA, entries[1].New.String())
+	testutils.AssertString(t, "ident", "A U Thor <author@example.com> 1700000100 +0530", entries[1].Ident)
+	testutils.AssertString(t, "message", "commit: second", entries[1].Message)
+
+	if entries[1].Time.Unix() != 1700000100 {
+		t.Errorf("expected time 1700000100 but got %d", entries[1].Time.Unix())
+	}
+
+	t.Run("lists the refs with a log", func(t *testing.T) {
+		refList, err := reflog.List(gitFs)
+
+		if err != nil {
+			t.Fatalf("List failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "refs", "HEAD refs/heads/main", strings.Join(refList, " "))
+	})
+
+	t.Run("returns nil for a ref without log", func(t *testing.T) {
+		if entries, err := reflog.Read(gitFs, "refs/heads/missing"); err != nil || entries != nil {
+			t.Errorf("expected no entries but got %v %v", entries, err)
+		}
+	})
+
+	t.Run("fails for invalid entries", func(t *testing.T) {
+		writeLog(t, gitDir, "refs/heads/broken", "not a reflog\n")
+
+		if _, err := reflog.Read(gitFs, "refs/heads/broken"); !errors.Is(err, reflog.ErrInvalidEntry) {
+			t.Errorf("expected ErrInvalidEntry but got %v", err)
+		}
+	})
+}
+
+func TestExpire(t *testing.T) {
+	gitDir := t.TempDir()
+
+	writeLog(t, gitDir, "HEAD", _Log)
+
+	removed, err := reflog.Expire(gitDir, "HEAD", func(entry reflog.Entry) bool {
+		return entry.Time.Unix() > 1700000000
+	})
+
+	if err != nil {
+		t.Fatalf("Expire failed with err %v", err)
+	}
+
+	if removed != 1 {
+		t.Errorf("expected 1 removed entry but got %d", removed)
+	}
+
+	contents, _ := os.ReadFile(path.Join(gitDir, reflog.Dir, "HEAD"))
+
+	_, expected, _ := strings.Cut(_Log, "\n")
+
+	testutils.AssertString(t, "log", expected, string(contents))
+}
@@ -0,0 +1,170 @@
+package refs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+const _LockSuffix = ".lock"
+
+// Same as the default core.packedRefsTimeout, packed-refs is shared
+// by all the refs so its lock is retried for a while
+const _PackedRefsLockTimeout = time.Second
+
+var ErrLocked = errors.New("unable to create lock file")
+var ErrRefChanged = errors.New("ref changed")
+
+// <file>.lock created with O_EXCL, holding it keeps the other writers
+// out of the file until it's committed or rolled back
+type lockFile struct {
+	filePath string
+	file     *os.File
+}
+
+func newLockFile(filePath string) (*lockFile, error) {
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filePath+_LockSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%w '%s%s': File exists", ErrLocked, filePath, _LockSuffix)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &lockFile{filePath: filePath, file: file}, nil
+}
+
+// Retries the lock until the timeout in case another writer holds it
+func newLockFileTimeout(filePath string, timeout time.Duration) (*lockFile, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		lock, err := newLockFile(filePath)
+
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return lock, err
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Writes the contents to the lock and renames it over the file so
+// that readers never see a partial file
+func (l *lockFile) commit(contents []byte) error {
+	if _, err := l.file.Write(contents); err != nil {
+		l.rollback()
+		return err
+	}
+
+	if err := l.file.Close(); err != nil {
+		l.rollback()
+		return err
+	}
+
+	if err := os.Rename(l.filePath+_LockSuffix, l.filePath); err != nil {
+		os.Remove(l.filePath + _LockSuffix)
+		return err
+	}
+
+	l.file = nil
+
+	return nil
+}
+
+// Releases the lock leaving the file untouched, no-op once committed
+func (l *lockFile) rollback() {
+	if l.file == nil {
+		return
+	}
+
+	l.file.Close()
+	os.Remove(l.filePath + _LockSuffix)
+
+	l.file = nil
+}
+
+// Lock of a loose ref, the ref can only be changed by its holder
+type RefLock struct {
+	gitDir string
+	name   string
+	lock   *lockFile
+}
+
+// Locks the ref like git, fails with ErrLocked if it's already locked
+func Lock(gitDir, name string) (*RefLock, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	lock, err := newLockFile(path.Join(gitDir, name))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RefLock{gitDir: gitDir, name: name, lock: lock}, nil
+}
+
+// Fails with ErrRefChanged unless the ref is at the expected value,
+// nil expects the ref to not exist
+func (l *RefLock) Verify(expected *sha.SHA) error {
+	current, err := Read(os.DirFS(l.gitDir), l.name)
+
+	if errors.Is(err, ErrRefNotFound) {
+		current, err = nil, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if (current == nil) != (expected == nil) || (current != nil && !current.Eq(expected)) {
+		return fmt.Errorf("%w: %s", ErrRefChanged, l.name)
+	}
+
+	return nil
+}
+
+// Writes the ref and releases the lock
+func (l *RefLock) Write(objSha *sha.SHA) error {
+	return l.lock.commit([]byte(objSha.String() + "\n"))
+}
+
+func (l *RefLock) writeSymbolic(target string) error {
+	return l.lock.commit([]byte(_SymRefPrefix + target + "\n"))
+}
+
+// Deletes the loose and the packed ref and releases the lock
+func (l *RefLock) Delete() error {
+	defer l.lock.rollback()
+
+	// packed first, so the old value never shows up from packed-refs
+	if err := deletePacked(l.gitDir, l.name); err != nil {
+		return err
+	}
+
+	err := os.Remove(path.Join(l.gitDir, l.name))
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Releases the lock without changing the ref, no-op after Write or Delete
+func (l *RefLock) Unlock() {
+	l.lock.rollback()
+}
@@ -0,0 +1,415 @@
+package refs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+const HeadsPrefix = "refs/heads/"
+const TagsPrefix = "refs/tags/"
+const RemotesPrefix = "refs/remotes/"
+
+const _PackedRefsFile = "packed-refs"
+
+var _SymRefPrefix = "ref: "
+
+// git gives up after 5 levels of symbolic refs
+const _MaxSymRefDepth = 5
+
+type Ref struct {
+	Name string
+	SHA  *sha.SHA
+	// Set for symbolic refs like refs/remotes/origin/HEAD
+	SymrefTarget string
+}
+
+var ErrRefNotFound = errors.New("ref not found")
+var ErrInvalidRefName = errors.New("invalid ref name")
+var ErrSymRefLoop = errors.New("too many levels of symbolic refs")
+
+// Returns all the refs in packed-refs in the file order
+func readPackedRefs(gitFs fs.FS) ([]Ref, error) {
+	packedRefsFile, err := gitFs.Open(_PackedRefsFile)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer packedRefsFile.Close()
+
+	var packedRefs []Ref
+
+	scanner := bufio.NewScanner(packedRefsFile)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// header and peeled lines
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		shaStr, refName, ok := strings.Cut(line, " ")
+
+		if !ok {
+			continue
+		}
+
+		refSha, err := sha.FromString(shaStr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		packedRefs = append(packedRefs, Ref{Name: refName, SHA: refSha})
+	}
+
+	return packedRefs, scanner.Err()
+}
+
+// Reads the SHA for the ref from packed-refs
+func readPacked(gitFs fs.FS, name string) (*sha.SHA, error) {
+	packedRefs, err := readPackedRefs(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range packedRefs {
+		if ref.Name == name {
+			return ref.SHA, nil
+		}
+	}
+
+	return nil, ErrRefNotFound
+}
+
+// Resolves the ref to SHA, following symbolic refs. Loose refs
+// are preferred over the packed refs like git
+func Read(gitFs fs.FS, name string) (*sha.SHA, error) {
+	for range _MaxSymRefDepth {
+		contents, err := fs.ReadFile(gitFs, name)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return readPacked(gitFs, name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line := strings.TrimSpace(string(contents))
+
+		if !strings.HasPrefix(line, _SymRefPrefix) {
+			return sha.FromString(line)
+		}
+
+		name = line[len(_SymRefPrefix):]
+	}
+
+	return nil, ErrSymRefLoop
+}
+
+// Returns the target of a symbolic ref, ok is false if
+// the ref is not symbolic
+func ReadSymbolic(gitFs fs.FS, name string) (string, bool, error) {
+	contents, err := fs.ReadFile(gitFs, name)
+
+	if err != nil {
+		return "", false, err
+	}
+
+	line := strings.TrimSpace(string(contents))
+
+	if !strings.HasPrefix(line, _SymRefPrefix) {
+		return "", false, nil
+	}
+
+	return line[len(_SymRefPrefix):], true, nil
+}
+
+// Basic checks from git check-ref-format so that
+// a remote can't make us write outside the refs dir
+func validateName(name string) error {
+	if name != "HEAD" && !strings.HasPrefix(name, "refs/") {
+		return fmt.Errorf("%w: %s", ErrInvalidRefName, name)
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("%w: %s", ErrInvalidRefName, name)
+		}
+	}
+
+	if strings.Contains(name, "..") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return fmt.Errorf("%w: %s", ErrInvalidRefName, name)
+	}
+
+	return nil
+}
+
+// Writes the loose ref, ex: Write(gitDir, "refs/heads/main", sha)
+func Write(gitDir, name string, objSha *sha.SHA) error {
+	lock, err := Lock(gitDir, name)
+
+	if err != nil {
+		return err
+	}
+
+	return lock.Write(objSha)
+}
+
+// Writes a symbolic ref pointing to target, ex: HEAD -> refs/heads/main
+func WriteSymbolic(gitDir, name, target string) error {
+	if err := validateName(target); err != nil {
+		return err
+	}
+
+	lock, err := Lock(gitDir, name)
+
+	if err != nil {
+		return err
+	}
+
+	return lock.writeSymbolic(target)
+}
+
+// Lists the loose and packed refs starting with prefix sorted
+// by name, ex: List(gitFs, "refs/remotes/origin/")
+func List(gitFs fs.FS, prefix string) ([]Ref, error) {
+	refMap := make(map[string]Ref)
+
+	packedRefs, err := readPackedRefs(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range packedRefs {
+		if strings.HasPrefix(ref.Name, prefix) {
+			refMap[ref.Name] = ref
+		}
+	}
+
+	err = fs.WalkDir(gitFs, "refs", func(refPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasPrefix(refPath, prefix) || strings.HasSuffix(refPath, ".lock") {
+			return nil
+		}
+
+		target, isSymbolic, err := ReadSymbolic(gitFs, refPath)
+
+		if err != nil {
+			return err
+		}
+
+		refSha, err := Read(gitFs, refPath)
+
+		// dangling symbolic ref, ex: origin/HEAD to a deleted branch
+		if errors.Is(err, ErrRefNotFound) && isSymbolic {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid ref %s: %w", refPath, err)
+		}
+
+		ref := Ref{Name: refPath, SHA: refSha}
+
+		if isSymbolic {
+			ref.SymrefTarget = target
+		}
+
+		refMap[refPath] = ref
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	refList := make([]Ref, 0, len(refMap))
+
+	for _, ref := range refMap {
+		refList = append(refList, ref)
+	}
+
+	sort.Slice(refList, func(i, j int) bool {
+		return refList[i].Name < refList[j].Name
+	})
+
+	return refList, nil
+}
+
+// Removes the ref from packed-refs by rewriting the file
+func deletePacked(gitDir, name string) error {
+	lock, err := newLockFileTimeout(path.Join(gitDir, _PackedRefsFile), _PackedRefsLockTimeout)
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.rollback()
+
+	contents, err := os.ReadFile(lock.filePath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	lines := strings.SplitAfter(string(contents), "\n")
+
+	var sb strings.Builder
+
+	found := false
+
+	for idx := 0; idx < len(lines); idx++ {
+		_, refName, _ := strings.Cut(strings.TrimSuffix(lines[idx], "\n"), " ")
+
+		if !strings.HasPrefix(lines[idx], "#") && refName == name {
+			found = true
+
+			// skip the peeled line of the tag too
+			if idx+1 < len(lines) && strings.HasPrefix(lines[idx+1], "^") {
+				idx++
+			}
+
+			continue
+		}
+
+		sb.WriteString(lines[idx])
+	}
+
+	if !found {
+		return nil
+	}
+
+	return lock.commit([]byte(sb.String()))
+}
+
+// Deletes the loose and the packed ref
+func Delete(gitDir, name string) error {
+	lock, err := Lock(gitDir, name)
+
+	if err != nil {
+		return err
+	}
+
+	return lock.Delete()
+}
+
+// Header of the packed-refs written by Pack, the tags are not peeled
+const _PackedRefsHeader = "# pack-refs with: sorted \n"
+
+// Moves all the loose refs to packed-refs like git pack-refs --all,
+// symbolic refs are kept loose as packed-refs can't have them
+func Pack(gitDir string) error {
+	// held while reading the refs so that no packed ref is lost
+	lock, err := newLockFileTimeout(path.Join(gitDir, _PackedRefsFile), _PackedRefsLockTimeout)
+
+	if err != nil {
+		return err
+	}
+
+	defer lock.rollback()
+
+	refList, err := List(os.DirFS(gitDir), "refs/")
+
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(_PackedRefsHeader)
+
+	for _, ref := range refList {
+		if ref.SymrefTarget != "" {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("%s %s\n", ref.SHA, ref.Name))
+	}
+
+	if err = lock.commit([]byte(sb.String())); err != nil {
+		return err
+	}
+
+	for _, ref := range refList {
+		if ref.SymrefTarget != "" {
+			continue
+		}
+
+		if err = pruneLoose(gitDir, ref); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes the loose ref after packing it unless it was updated since
+// it was packed, the loose ref is newer then. Same as git the ref is
+// kept loose if it's locked by another writer
+func pruneLoose(gitDir string, ref Ref) error {
+	lock, err := Lock(gitDir, ref.Name)
+
+	if errors.Is(err, ErrLocked) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	refPath := path.Join(gitDir, ref.Name)
+
+	contents, err := os.ReadFile(refPath)
+
+	if err == nil && strings.TrimSpace(string(contents)) == ref.SHA.String() {
+		err = os.Remove(refPath)
+	}
+
+	lock.Unlock()
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	removeEmptyDirs(gitDir, path.Dir(ref.Name))
+
+	return nil
+}
+
+// Removes the empty parent dirs of a deleted ref, the top level
+// dirs like refs/heads are kept like git
+func removeEmptyDirs(gitDir, dir string) {
+	for strings.Count(dir, "/") > 1 {
+		// fails for non empty dirs
+		if os.Remove(path.Join(gitDir, dir)) != nil {
+			return
+		}
+
+		dir = path.Dir(dir)
+	}
+}
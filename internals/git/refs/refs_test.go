@@ -0,0 +1,330 @@
+package refs_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const _TestSHA = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+const _PackedSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+func TestReadWrite(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	objSha, _ := sha.FromString(_TestSHA)
+
+	if err := refs.Write(gitDir, "refs/heads/main", objSha); err != nil {
+		t.Fatalf("Write failed with err %v", err)
+	}
+
+	if err := refs.WriteSymbolic(gitDir, "HEAD", "refs/heads/main"); err != nil {
+		t.Fatalf("WriteSymbolic failed with err %v", err)
+	}
+
+	packedRefs := "# pack-refs with: peeled fully-peeled sorted \n" + _PackedSHA + " refs/tags/v1\n^" + _TestSHA + "\n"
+
+	if err := os.WriteFile(path.Join(gitDir, "packed-refs"), []byte(packedRefs), 0644); err != nil {
+		t.Fatalf("failed to write packed-refs %v", err)
+	}
+
+	t.Run("follows symbolic refs", func(t *testing.T) {
+		got, err := refs.Read(gitFs, "HEAD")
+
+		if err != nil {
+			t.Fatalf("Read failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "HEAD", _TestSHA, got.String())
+
+		target, ok, err := refs.ReadSymbolic(gitFs, "HEAD")
+
+		if err != nil || !ok {
+			t.Fatalf("expected HEAD to be symbolic, got %v", err)
+		}
+
+		testutils.AssertString(t, "target", "refs/heads/main", target)
+	})
+
+	t.Run("reads packed refs", func(t *testing.T) {
+		got, err := refs.Read(gitFs, "refs/tags/v1")
+
+		if err != nil {
+			t.Fatalf("Read failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "tag", _PackedSHA, got.String())
+	})
+
+	t.Run("returns ErrRefNotFound for missing ref", func(t *testing.T) {
+		_, err := refs.Read(gitFs, "refs/heads/missing")
+
+		if !errors.Is(err, refs.ErrRefNotFound) {
+			t.Errorf("expected ErrRefNotFound but got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		for _, name := range []string{"refs/../config", "refs/heads/a..b", "objects/foo", "refs/heads/x.lock"} {
+			if err := refs.Write(gitDir, name, objSha); !errors.Is(err, refs.ErrInvalidRefName) {
+				t.Errorf("expected ErrInvalidRefName for %s but got %v", name, err)
+			}
+		}
+	})
+}
+
+func TestListDelete(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	objSha, _ := sha.FromString(_TestSHA)
+
+	for _, name := range []string{"refs/remotes/origin/main", "refs/remotes/origin/feature/a", "refs/heads/main"} {
+		if err := refs.Write(gitDir, name, objSha); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+	}
+
+	if err := refs.WriteSymbolic(gitDir, "refs/remotes/origin/HEAD", "refs/remotes/origin/main"); err != nil {
+		t.Fatalf("WriteSymbolic failed with err %v", err)
+	}
+
+	packedRefs := "# pack-refs with: peeled fully-peeled sorted \n" +
+		_PackedSHA + " refs/remotes/origin/packed\n" +
+		_PackedSHA + " refs/remotes/origin/main\n" +
+		_PackedSHA + " refs/tags/v1\n^" + _TestSHA + "\n"
+
+	if err := os.WriteFile(path.Join(gitDir, "packed-refs"), []byte(packedRefs), 0644); err != nil {
+		t.Fatalf("failed to write packed-refs %v", err)
+	}
+
+	names := func(refList []refs.Ref) string {
+		var sb strings.Builder
+
+		for _, ref := range refList {
+			fmt.Fprintf(&sb, "%s %s %s\n", ref.SHA, ref.Name, ref.SymrefTarget)
+		}
+
+		return sb.String()
+	}
+
+	t.Run("lists loose refs over packed refs", func(t *testing.T) {
+		refList, err := refs.List(gitFs, "refs/remotes/origin/")
+
+		if err != nil {
+			t.Fatalf("List failed with err %v", err)
+		}
+
+		expected := _TestSHA + " refs/remotes/origin/HEAD refs/remotes/origin/main\n" +
+			_TestSHA + " refs/remotes/origin/feature/a \n" +
+			_TestSHA + " refs/remotes/origin/main \n" +
+			_PackedSHA + " refs/remotes/origin/packed \n"
+
+		testutils.AssertString(t, "refs", expected, names(refList))
+	})
+
+	t.Run("deletes loose and packed refs", func(t *testing.T) {
+		for _, name := range []string{"refs/remotes/origin/main", "refs/tags/v1"} {
+			if err := refs.Delete(gitDir, name); err != nil {
+				t.Fatalf("Delete failed with err %v", err)
+			}
+
+			if _, err := refs.Read(gitFs, name); !errors.Is(err, refs.ErrRefNotFound) {
+				t.Errorf("expected %s to be deleted but got %v", name, err)
+			}
+		}
+
+		contents, _ := os.ReadFile(path.Join(gitDir, "packed-refs"))
+
+		testutils.AssertString(t, "packed-refs", "# pack-refs with: peeled fully-peeled sorted \n"+_PackedSHA+" refs/remotes/origin/packed\n", string(contents))
+	})
+
+	t.Run("skips dangling symbolic refs", func(t *testing.T) {
+		refList, err := refs.List(gitFs, "refs/remotes/origin/")
+
+		if err != nil {
+			t.Fatalf("List failed with err %v", err)
+		}
+
+		expected := _TestSHA + " refs/remotes/origin/feature/a \n" +
+			_PackedSHA + " refs/remotes/origin/packed \n"
+
+		testutils.AssertString(t, "refs", expected, names(refList))
+	})
+}
+
+func TestPack(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	objSha, _ := sha.FromString(_TestSHA)
+
+	for _, name := range []string{"refs/heads/main", "refs/heads/feature/a", "refs/heads/locked", "refs/remotes/origin/main"} {
+		if err := refs.Write(gitDir, name, objSha); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+	}
+
+	// being updated by another writer
+	lock, err := refs.Lock(gitDir, "refs/heads/locked")
+
+	if err != nil {
+		t.Fatalf("Lock failed with err %v", err)
+	}
+
+	defer lock.Unlock()
+
+	if err := refs.WriteSymbolic(gitDir, "refs/remotes/origin/HEAD", "refs/remotes/origin/main"); err != nil {
+		t.Fatalf("WriteSymbolic failed with err %v", err)
+	}
+
+	packedRefs := "# pack-refs with: peeled fully-peeled sorted \n" + _PackedSHA + " refs/tags/v1\n^" + _TestSHA + "\n"
+
+	if err := os.WriteFile(path.Join(gitDir, "packed-refs"), []byte(packedRefs), 0644); err != nil {
+		t.Fatalf("failed to write packed-refs %v", err)
+	}
+
+	if err := refs.Pack(gitDir); err != nil {
+		t.Fatalf("Pack failed with err %v", err)
+	}
+
+	contents, _ := os.ReadFile(path.Join(gitDir, "packed-refs"))
+
+	expected := "# pack-refs with: sorted \n" +
+		_TestSHA + " refs/heads/feature/a\n" +
+		_TestSHA + " refs/heads/locked\n" +
+		_TestSHA + " refs/heads/main\n" +
+		_TestSHA + " refs/remotes/origin/main\n" +
+		_PackedSHA + " refs/tags/v1\n"
+
+	testutils.AssertString(t, "packed-refs", expected, string(contents))
+
+	t.Run("removes the loose refs", func(t *testing.T) {
+		for _, name := range []string{"refs/heads/main", "refs/heads/feature"} {
+			if _, err := os.Stat(path.Join(gitDir, name)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected %s to be removed but got %v", name, err)
+			}
+		}
+
+		if _, err := os.Stat(path.Join(gitDir, "refs/heads")); err != nil {
+			t.Errorf("expected refs/heads to be kept but got %v", err)
+		}
+	})
+
+	t.Run("keeps the locked refs loose", func(t *testing.T) {
+		if _, err := os.Stat(path.Join(gitDir, "refs/heads/locked")); err != nil {
+			t.Errorf("expected the locked ref to be kept but got %v", err)
+		}
+	})
+
+	t.Run("fails while packed-refs is locked", func(t *testing.T) {
+		lockPath := path.Join(gitDir, "packed-refs.lock")
+
+		os.WriteFile(lockPath, nil, 0644)
+		defer os.Remove(lockPath)
+
+		if err := refs.Pack(gitDir); !errors.Is(err, refs.ErrLocked) {
+			t.Errorf("expected ErrLocked but got %v", err)
+		}
+	})
+
+	t.Run("keeps the symbolic refs loose", func(t *testing.T) {
+		target, ok, err := refs.ReadSymbolic(gitFs, "refs/remotes/origin/HEAD")
+
+		if err != nil || !ok {
+			t.Fatalf("expected a symbolic ref but got %v", err)
+		}
+
+		testutils.AssertString(t, "target", "refs/remotes/origin/main", target)
+
+		got, err := refs.Read(gitFs, "refs/remotes/origin/HEAD")
+
+		if err != nil {
+			t.Fatalf("Read failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "HEAD", _TestSHA, got.String())
+	})
+}
+
+func TestLock(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	objSha, _ := sha.FromString(_TestSHA)
+	packedSha, _ := sha.FromString(_PackedSHA)
+
+	lock, err := refs.Lock(gitDir, "refs/heads/main")
+
+	if err != nil {
+		t.Fatalf("Lock failed with err %v", err)
+	}
+
+	t.Run("other writers fail while locked", func(t *testing.T) {
+		if _, err := refs.Lock(gitDir, "refs/heads/main"); !errors.Is(err, refs.ErrLocked) {
+			t.Errorf("expected ErrLocked but got %v", err)
+		}
+
+		if err := refs.Write(gitDir, "refs/heads/main", packedSha); !errors.Is(err, refs.ErrLocked) {
+			t.Errorf("expected ErrLocked but got %v", err)
+		}
+
+		if err := refs.Delete(gitDir, "refs/heads/main"); !errors.Is(err, refs.ErrLocked) {
+			t.Errorf("expected ErrLocked but got %v", err)
+		}
+	})
+
+	t.Run("verifies the value", func(t *testing.T) {
+		if err := lock.Verify(nil); err != nil {
+			t.Errorf("expected missing ref to match nil but got %v", err)
+		}
+
+		if err := lock.Verify(objSha); !errors.Is(err, refs.ErrRefChanged) {
+			t.Errorf("expected ErrRefChanged but got %v", err)
+		}
+	})
+
+	t.Run("write releases the lock", func(t *testing.T) {
+		if err := lock.Write(objSha); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		got, err := refs.Read(gitFs, "refs/heads/main")
+
+		if err != nil {
+			t.Fatalf("Read failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "main", _TestSHA, got.String())
+
+		if err := refs.Write(gitDir, "refs/heads/main", packedSha); err != nil {
+			t.Errorf("expected the lock to be released but got %v", err)
+		}
+	})
+
+	t.Run("unlock keeps the ref", func(t *testing.T) {
+		lock, err := refs.Lock(gitDir, "refs/heads/main")
+
+		if err != nil {
+			t.Fatalf("Lock failed with err %v", err)
+		}
+
+		lock.Unlock()
+
+		if _, err = os.Stat(path.Join(gitDir, "refs/heads/main.lock")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the lock file to be removed but got %v", err)
+		}
+
+		got, _ := refs.Read(gitFs, "refs/heads/main")
+
+		testutils.AssertString(t, "main", _PackedSHA, got.String())
+	})
+}
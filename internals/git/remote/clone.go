@@ -0,0 +1,363 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/commit"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/hooks"
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/transport/local"
+	"github.com/uragirii/got/internals/git/worktree"
+)
+
+var ErrDestinationExists = errors.New("destination path already exists and is not an empty directory")
+
+type CloneOptions struct {
+	// Name of the remote, defaults to origin
+	RemoteName string
+	// Remote progress and warnings are written here, nil to disable
+	Progress io.Writer
+	// Fetch over the protocol instead of linking the objects
+	// when cloning from a local path, like git clone --no-local
+	NoLocal bool
+	// Shallow clone of the history, like git clone --depth,
+	// --shallow-since and --shallow-exclude
+	Depth          int
+	ShallowSince   time.Time
+	ShallowExclude []string
+	// Filter spec of a partial clone, like git clone --filter=blob:none
+	Filter string
+}
+
+func (opts CloneOptions) isShallow() bool {
+	return opts.Depth > 0 || !opts.ShallowSince.IsZero() || len(opts.ShallowExclude) != 0
+}
+
+// Shallow history of the clone
+func (opts CloneOptions) fetchRequest(wants []*sha.SHA) transport.FetchRequest {
+	return transport.FetchRequest{
+		Wants:       wants,
+		Depth:       opts.Depth,
+		DeepenSince: opts.ShallowSince,
+		DeepenNot:   opts.ShallowExclude,
+		Filter:      opts.Filter,
+		// tags are not fetched when only a branch is cloned
+		IncludeTag: opts.isShallow(),
+	}
+}
+
+// Returns the remote HEAD and the rest of the refs
+func splitHead(remoteRefs []transport.Ref) (*transport.Ref, []transport.Ref) {
+	var remoteHead *transport.Ref
+	others := make([]transport.Ref, 0, len(remoteRefs))
+
+	for idx, ref := range remoteRefs {
+		if ref.Name == "HEAD" {
+			remoteHead = &remoteRefs[idx]
+			continue
+		}
+
+		others = append(others, ref)
+	}
+
+	return remoteHead, others
+}
+
+// Maps the remote ref to the local ref, branches are stored as
+// remote tracking refs and tags are stored as it is
+func localRefName(remoteName, refName string) (string, bool) {
+	switch {
+	case strings.HasPrefix(refName, refs.HeadsPrefix):
+		return refs.RemotesPrefix + remoteName + "/" + refName[len(refs.HeadsPrefix):], true
+	case strings.HasPrefix(refName, refs.TagsPrefix):
+		return refName, true
+	}
+
+	return "", false
+}
+
+func fetchPack(conn transport.Conn, gitDir string, remoteRefs []transport.Ref, opts CloneOptions) error {
+	seen := make(map[string]bool, len(remoteRefs))
+	wants := make([]*sha.SHA, 0, len(remoteRefs))
+
+	for _, ref := range remoteRefs {
+		if seen[ref.SHA.String()] {
+			continue
+		}
+
+		seen[ref.SHA.String()] = true
+		wants = append(wants, ref.SHA)
+	}
+
+	return fetchObjects(conn, gitDir, opts.fetchRequest(wants), opts.Progress)
+}
+
+func writeIndex(gitDir string, i *index.Index) error {
+	indexFile, err := os.Create(path.Join(gitDir, index.IndexFileName))
+
+	if err != nil {
+		return err
+	}
+
+	defer indexFile.Close()
+
+	return i.Write(indexFile)
+}
+
+func checkout(gitDir, dir string, commitSha *sha.SHA, progress io.Writer) error {
+	gitFs := os.DirFS(gitDir)
+
+	c, err := commit.FromSHA(commitSha, gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	i, err := worktree.Checkout(gitFs, dir, c.Tree, progress)
+
+	if err != nil {
+		return err
+	}
+
+	if err = writeIndex(gitDir, i); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	// post-checkout can't affect the outcome of the clone
+	hooks.New(gitDir, dir, cfg).Run(hooks.PostCheckout, nil, sha.ZERO_STR, commitSha.String(), "1")
+
+	return nil
+}
+
+func clone(url, dir string, opts CloneOptions) error {
+	progress := opts.Progress
+
+	if progress == nil {
+		progress = io.Discard
+	}
+
+	var conn transport.Conn
+	var err error
+
+	// file:// urls always use the protocol like git
+	if IsLocalPath(url) && !opts.NoLocal {
+		if opts.isShallow() {
+			fmt.Fprintln(progress, "warning: --depth is ignored in local clones; use file:// instead.")
+			opts.Depth, opts.ShallowSince, opts.ShallowExclude = 0, time.Time{}, nil
+		}
+
+		if opts.Filter != "" {
+			fmt.Fprintln(progress, "warning: --filter is ignored in local clones; use file:// instead.")
+			opts.Filter = ""
+		}
+
+		conn, err = local.ConnectLink(url)
+	} else {
+		// nothing is cloned yet, only the global config has the helpers
+		var cfg *config.Config
+
+		if cfg, err = config.Load(nil); err == nil {
+			conn, err = Dial(url, cfg)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	remoteRefs, err := transport.LsRefs(conn, []string{"HEAD", refs.HeadsPrefix, refs.TagsPrefix})
+
+	if err != nil {
+		return err
+	}
+
+	remoteHead, remoteRefs := splitHead(remoteRefs)
+
+	branch := ""
+
+	if remoteHead != nil && strings.HasPrefix(remoteHead.SymrefTarget, refs.HeadsPrefix) {
+		branch = remoteHead.SymrefTarget[len(refs.HeadsPrefix):]
+	}
+
+	gitDir := path.Join(dir, ".git")
+
+	if err = repository.Init(gitDir, branch); err != nil {
+		return err
+	}
+
+	configPath := path.Join(gitDir, config.RepoConfigFile)
+
+	if err = config.Set(configPath, fmt.Sprintf("remote.%s.url", opts.RemoteName), url); err != nil {
+		return err
+	}
+
+	fetchRefspec := DefaultFetchRefspec(opts.RemoteName)
+
+	// same as git, a shallow clone only fetches the branch of HEAD
+	if opts.isShallow() && branch != "" {
+		fetchRefspec = fmt.Sprintf("+%s%s:%s%s/%s", refs.HeadsPrefix, branch, refs.RemotesPrefix, opts.RemoteName, branch)
+	}
+
+	if err = config.Set(configPath, fmt.Sprintf("remote.%s.fetch", opts.RemoteName), fetchRefspec); err != nil {
+		return err
+	}
+
+	if opts.Filter != "" {
+		if err = setupPartialClone(gitDir, opts.RemoteName, opts.Filter); err != nil {
+			return err
+		}
+	}
+
+	if remoteHead == nil && len(remoteRefs) == 0 {
+		fmt.Fprintln(progress, "warning: You appear to have cloned an empty repository.")
+		return nil
+	}
+
+	fetchRefs := remoteRefs
+
+	if opts.isShallow() && remoteHead != nil {
+		fetchRefs = nil
+	}
+
+	if remoteHead != nil {
+		// HEAD can be detached at a commit which no branch points to
+		fetchRefs = append(fetchRefs, *remoteHead)
+	}
+
+	if err = fetchPack(conn, gitDir, fetchRefs, opts); err != nil {
+		return err
+	}
+
+	// the checkout fetches the omitted blobs it needs
+	if err = EnableLazyFetch(gitDir); err != nil {
+		return err
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	for _, ref := range remoteRefs {
+		localRef, ok := localRefName(opts.RemoteName, ref.Name)
+
+		if !ok {
+			continue
+		}
+
+		// the other branches are not fetched and only the
+		// tags sent with the branch are stored
+		if opts.isShallow() && remoteHead != nil && ref.Name != remoteHead.SymrefTarget &&
+			!(strings.HasPrefix(ref.Name, refs.TagsPrefix) && object.Exists(ref.SHA, gitFs)) {
+			continue
+		}
+
+		if err = refs.Write(gitDir, localRef, ref.SHA); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case remoteHead == nil:
+		fmt.Fprintln(progress, "warning: remote HEAD refers to nonexistent ref, unable to checkout")
+		return nil
+	case branch == "":
+		// detached remote HEAD is checked out as detached
+		if err = refs.Write(gitDir, "HEAD", remoteHead.SHA); err != nil {
+			return err
+		}
+	default:
+		remoteHeadRef := refs.RemotesPrefix + opts.RemoteName + "/HEAD"
+
+		if err = refs.WriteSymbolic(gitDir, remoteHeadRef, refs.RemotesPrefix+opts.RemoteName+"/"+branch); err != nil {
+			return err
+		}
+
+		if err = refs.Write(gitDir, remoteHead.SymrefTarget, remoteHead.SHA); err != nil {
+			return err
+		}
+
+		if err = config.Set(configPath, fmt.Sprintf("branch.%s.remote", branch), opts.RemoteName); err != nil {
+			return err
+		}
+
+		if err = config.Set(configPath, fmt.Sprintf("branch.%s.merge", branch), remoteHead.SymrefTarget); err != nil {
+			return err
+		}
+	}
+
+	return checkout(gitDir, dir, remoteHead.SHA, progress)
+}
+
+// Clones the repository at url into dir, the dir is created
+// if missing and removed if the clone fails
+func Clone(url, dir string, opts CloneOptions) error {
+	if opts.RemoteName == "" {
+		opts.RemoteName = DefaultName
+	}
+
+	if opts.Filter != "" {
+		if _, err := revlist.ParseFilter(opts.Filter); err != nil {
+			return err
+		}
+	}
+
+	// the url is stored in the config so it shouldn't depend on the cwd
+	if IsLocalPath(url) {
+		absUrl, err := filepath.Abs(url)
+
+		if err != nil {
+			return err
+		}
+
+		url = absUrl
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if len(entries) != 0 {
+		return fmt.Errorf("%w: '%s'", ErrDestinationExists, dir)
+	}
+
+	createdDir := errors.Is(err, fs.ErrNotExist)
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	err = clone(url, dir, opts)
+
+	if err != nil {
+		if createdDir {
+			os.RemoveAll(dir)
+		} else {
+			os.RemoveAll(path.Join(dir, ".git"))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,530 @@
+package remote_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/remote"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// 1 byte of side-band-64k packet is used by the channel
+const _MaxSidebandData = pktline.MaxDataLen - 1
+
+func writeAdvertisement(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+
+	pw := pktline.NewWriter(w)
+
+	pw.WriteLine("# service=git-upload-pack")
+	pw.WriteFlush()
+
+	for _, line := range []string{"version 2", "agent=git/2.45.0", "ls-refs=unborn", "fetch=shallow wait-for-done", "server-option", "object-format=sha1"} {
+		pw.WriteLine(line)
+	}
+
+	pw.WriteFlush()
+}
+
+// Writes the packfile section with side-band-64k
+func writePackfile(pw *pktline.Writer, packData []byte) {
+	pw.WriteLine("packfile")
+	pw.WritePacket(append([]byte{2}, "Enumerating objects: done.\n"...))
+
+	for start := 0; start < len(packData); start += _MaxSidebandData {
+		end := min(start+_MaxSidebandData, len(packData))
+
+		pw.WritePacket(append([]byte{1}, packData[start:end]...))
+	}
+
+	pw.WriteFlush()
+}
+
+// Serves the testdata pack over protocol v2 like git-http-backend
+func newFixtureServer(t *testing.T, emptyRepo bool) *httptest.Server {
+	t.Helper()
+
+	packData := testutils.ReadTestPack(t)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /repo.git/info/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "git-upload-pack" || r.Header.Get("Git-Protocol") != "version=2" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		writeAdvertisement(w)
+	})
+
+	mux.HandleFunc("POST /repo.git/git-upload-pack", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		pw := pktline.NewWriter(w)
+
+		switch {
+		case bytes.Contains(body, []byte("command=ls-refs")):
+			if !emptyRepo {
+				pw.WriteLine(testutils.PackTipSHA + " HEAD symref-target:refs/heads/main")
+				pw.WriteLine(testutils.PackTipSHA + " refs/heads/main")
+			}
+
+			pw.WriteFlush()
+		case bytes.Contains(body, []byte("command=fetch")):
+			if !bytes.Contains(body, []byte("want "+testutils.PackTipSHA)) || !bytes.Contains(body, []byte("done")) {
+				http.Error(w, "unexpected fetch request", http.StatusBadRequest)
+				return
+			}
+
+			writePackfile(pw, packData)
+		default:
+			http.Error(w, "unknown command", http.StatusBadRequest)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestClone(t *testing.T) {
+	server := newFixtureServer(t, false)
+
+	dir := path.Join(t.TempDir(), "repo")
+	gitDir := path.Join(dir, ".git")
+
+	var progress bytes.Buffer
+
+	err := remote.Clone(server.URL+"/repo.git", dir, remote.CloneOptions{Progress: &progress})
+
+	if err != nil {
+		t.Fatalf("Clone failed with err %v", err)
+	}
+
+	t.Run("shows remote and local progress", func(t *testing.T) {
+		if !strings.HasPrefix(progress.String(), "remote: Enumerating objects: done.\n") {
+			t.Errorf("expected remote progress first but got %q", progress.String())
+		}
+
+		for _, done := range []string{
+			"\rReceiving objects: 100% (515/515), ",
+			"\rResolving deltas: 100% (316/316), done.\n",
+			"\rChecking out files: 100% (32/32), done.\n",
+		} {
+			if !strings.Contains(progress.String(), done) {
+				t.Errorf("expected %q in progress %q", done, progress.String())
+			}
+		}
+	})
+
+	t.Run("writes refs", func(t *testing.T) {
+		for refPath, expected := range map[string]string{
+			"HEAD":                     "ref: refs/heads/main\n",
+			"refs/heads/main":          testutils.PackTipSHA + "\n",
+			"refs/remotes/origin/main": testutils.PackTipSHA + "\n",
+			"refs/remotes/origin/HEAD": "ref: refs/remotes/origin/main\n",
+		} {
+			contents, err := os.ReadFile(path.Join(gitDir, refPath))
+
+			if err != nil {
+				t.Fatalf("failed to read %s %v", refPath, err)
+			}
+
+			testutils.AssertString(t, refPath, expected, string(contents))
+		}
+	})
+
+	t.Run("sets up remote config", func(t *testing.T) {
+		c, err := config.Load(os.DirFS(gitDir))
+
+		if err != nil {
+			t.Fatalf("failed to load config %v", err)
+		}
+
+		for key, expected := range map[string]string{
+			"remote.origin.url":   server.URL + "/repo.git",
+			"remote.origin.fetch": "+refs/heads/*:refs/remotes/origin/*",
+			"branch.main.remote":  "origin",
+			"branch.main.merge":   "refs/heads/main",
+		} {
+			value, _ := c.Get(key)
+			testutils.AssertString(t, key, expected, value)
+		}
+	})
+
+	t.Run("checks out the default branch", func(t *testing.T) {
+		contents, err := os.ReadFile(path.Join(dir, "internals/git/sha/sha.go"))
+
+		if err != nil {
+			t.Fatalf("failed to read checked out file %v", err)
+		}
+
+		raw := []byte(fmt.Sprintf("blob %d\x00%s", len(contents), contents))
+
+		fileSha, _ := sha.FromData(&raw)
+
+		testutils.AssertString(t, "file sha", "4746d9ca75d580f3639a163e847b894fffe92d3b", fileSha.String())
+
+		indexFile, err := os.Open(path.Join(gitDir, index.IndexFileName))
+
+		if err != nil {
+			t.Fatalf("failed to open index %v", err)
+		}
+
+		defer indexFile.Close()
+
+		i, err := index.New(indexFile)
+
+		if err != nil {
+			t.Fatalf("failed to parse index %v", err)
+		}
+
+		if len(i.GetTrackedFiles()) != 32 {
+			t.Errorf("expected 32 files in index but got %d", len(i.GetTrackedFiles()))
+		}
+
+		testutils.AssertString(t, "index tree", "df1611f7ecf067d011d91d5a5f5f397fb2417b89", i.GetTreeSHA().String())
+	})
+}
+
+func TestCloneEmpty(t *testing.T) {
+	server := newFixtureServer(t, true)
+
+	dir := path.Join(t.TempDir(), "empty")
+
+	var progress bytes.Buffer
+
+	if err := remote.Clone(server.URL+"/repo.git", dir, remote.CloneOptions{Progress: &progress}); err != nil {
+		t.Fatalf("Clone failed with err %v", err)
+	}
+
+	if !strings.Contains(progress.String(), "cloned an empty repository") {
+		t.Errorf("expected empty repository warning but got %q", progress.String())
+	}
+}
+
+func TestCloneFailures(t *testing.T) {
+	server := newFixtureServer(t, false)
+
+	t.Run("fails for non empty dir", func(t *testing.T) {
+		dir := t.TempDir()
+
+		os.WriteFile(path.Join(dir, "file"), []byte("data"), 0644)
+
+		if err := remote.Clone(server.URL+"/repo.git", dir, remote.CloneOptions{}); err == nil {
+			t.Errorf("expected error for non empty dir")
+		}
+	})
+
+	t.Run("removes the dir for missing repo", func(t *testing.T) {
+		dir := path.Join(t.TempDir(), "missing")
+
+		if err := remote.Clone(server.URL+"/missing.git", dir, remote.CloneOptions{}); err == nil {
+			t.Errorf("expected error for missing repo")
+		}
+
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected dir to be removed but got %v", err)
+		}
+	})
+}
+
+// Writes the files a dumb http client reads, like git update-server-info
+func updateServerInfo(t *testing.T, gitDir string, mainSha string) {
+	t.Helper()
+
+	os.MkdirAll(path.Join(gitDir, "info"), 0755)
+	os.MkdirAll(path.Join(gitDir, "objects/info"), 0755)
+
+	os.WriteFile(path.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	os.WriteFile(path.Join(gitDir, "info/refs"), []byte(mainSha+"\trefs/heads/main\n"), 0644)
+
+	packs, _ := os.ReadDir(path.Join(gitDir, "objects/pack"))
+
+	var packList strings.Builder
+
+	for _, packFile := range packs {
+		if strings.HasSuffix(packFile.Name(), ".pack") {
+			fmt.Fprintf(&packList, "P %s\n", packFile.Name())
+		}
+	}
+
+	os.WriteFile(path.Join(gitDir, "objects/info/packs"), []byte(packList.String()+"\n"), 0644)
+}
+
+func TestCloneDumbHTTP(t *testing.T) {
+	serverDir := t.TempDir()
+	remoteDir := path.Join(serverDir, "repo.git")
+
+	testutils.StoreTestPack(t, remoteDir)
+	updateServerInfo(t, remoteDir, testutils.PackTipSHA)
+
+	server := httptest.NewServer(http.FileServer(http.Dir(serverDir)))
+
+	t.Cleanup(server.Close)
+
+	dir := path.Join(t.TempDir(), "repo")
+	gitDir := path.Join(dir, ".git")
+
+	var progress bytes.Buffer
+
+	if err := remote.Clone(server.URL+"/repo.git", dir, remote.CloneOptions{Progress: &progress}); err != nil {
+		t.Fatalf("Clone failed with err %v", err)
+	}
+
+	t.Run("downloads the pack and checks out", func(t *testing.T) {
+		if !strings.Contains(progress.String(), "Downloading pack-") {
+			t.Errorf("expected pack to be downloaded but got %q", progress.String())
+		}
+
+		for refPath, expected := range map[string]string{
+			"HEAD":                     "ref: refs/heads/main\n",
+			"refs/remotes/origin/main": testutils.PackTipSHA + "\n",
+		} {
+			contents, err := os.ReadFile(path.Join(gitDir, refPath))
+
+			if err != nil {
+				t.Fatalf("failed to read %s %v", refPath, err)
+			}
+
+			testutils.AssertString(t, refPath, expected, string(contents))
+		}
+
+		if _, err := os.Stat(path.Join(dir, "internals/git/sha/sha.go")); err != nil {
+			t.Errorf("expected file to be checked out but got %v", err)
+		}
+	})
+
+	t.Run("fetches loose objects", func(t *testing.T) {
+		blobSha := testutils.WriteObj(t, remoteDir, object.BlobObj, "dumb\n")
+		treeSha := testutils.WriteObj(t, remoteDir, object.TreeObj, "100644 dumb.txt\x00"+string(*blobSha.GetBytes()))
+
+		tip, _ := sha.FromString(testutils.PackTipSHA)
+		commitSha := writeCommit(t, remoteDir, treeSha.String(), tip, 1900000000)
+
+		updateServerInfo(t, remoteDir, commitSha.String())
+
+		result, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{})
+
+		if err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		if len(result.Updates) != 1 || result.Updates[0].Status != remote.FastForward {
+			t.Fatalf("expected main to be fast-forwarded but got %+v", result.Updates)
+		}
+
+		for _, objSha := range []*sha.SHA{commitSha, treeSha, blobSha} {
+			objPath, _ := objSha.GetObjPath()
+
+			if _, err := os.Stat(path.Join(gitDir, objPath)); err != nil {
+				t.Errorf("expected loose object %s but got %v", objSha, err)
+			}
+		}
+	})
+}
+
+func TestCloneLocal(t *testing.T) {
+	srcDir := t.TempDir()
+	srcGitDir := path.Join(srcDir, ".git")
+
+	testutils.InitTestRepo(t, srcGitDir)
+
+	for name, url := range map[string]string{
+		"links objects for paths": srcDir,
+		"fetches for file urls":   "file://" + srcDir,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := path.Join(t.TempDir(), "repo")
+			gitDir := path.Join(dir, ".git")
+
+			var progress bytes.Buffer
+
+			if err := remote.Clone(url, dir, remote.CloneOptions{Progress: &progress}); err != nil {
+				t.Fatalf("Clone failed with err %v", err)
+			}
+
+			expectedProgress := "remote: Enumerating objects: 509, done."
+
+			if url == srcDir {
+				expectedProgress = "Linked 2 object files, done."
+			}
+
+			if !strings.Contains(progress.String(), expectedProgress) {
+				t.Errorf("expected %q in progress but got %q", expectedProgress, progress.String())
+			}
+
+			mainSha, err := refs.Read(os.DirFS(gitDir), "refs/remotes/origin/main")
+
+			if err != nil {
+				t.Fatalf("failed to read origin/main %v", err)
+			}
+
+			testutils.AssertString(t, "origin/main", testutils.PackTipSHA, mainSha.String())
+
+			if _, err := os.Stat(path.Join(dir, "internals/git/sha/sha.go")); err != nil {
+				t.Errorf("expected file to be checked out but got %v", err)
+			}
+		})
+	}
+}
+
+func readShallow(t *testing.T, gitDir string) string {
+	t.Helper()
+
+	commits, err := shallow.Read(os.DirFS(gitDir))
+
+	if err != nil {
+		t.Fatalf("failed to read shallow %v", err)
+	}
+
+	lines := make([]string, len(commits))
+
+	for idx, commitSha := range commits {
+		lines[idx] = commitSha.String()
+	}
+
+	return strings.Join(lines, ",")
+}
+
+func TestCloneShallow(t *testing.T) {
+	srcDir := t.TempDir()
+	srcGitDir := path.Join(srcDir, ".git")
+
+	if err := repository.Init(srcGitDir, "main"); err != nil {
+		t.Fatalf("Init failed with err %v", err)
+	}
+
+	history := writeHistory(t, srcGitDir, 6)
+	tip := history[len(history)-1]
+
+	refs.Write(srcGitDir, "refs/heads/main", tip)
+	refs.Write(srcGitDir, "refs/heads/other", history[1])
+	refs.Write(srcGitDir, "refs/tags/v1", history[4])
+	refs.Write(srcGitDir, "refs/tags/v0", history[0])
+
+	dir := path.Join(t.TempDir(), "repo")
+	gitDir := path.Join(dir, ".git")
+	gitFs := os.DirFS(gitDir)
+
+	if err := remote.Clone("file://"+srcDir, dir, remote.CloneOptions{Depth: 2}); err != nil {
+		t.Fatalf("Clone failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "shallow", history[4].String(), readShallow(t, gitDir))
+
+	for idx, commitSha := range history {
+		testutils.AssertString(t, fmt.Sprintf("commit %d exists", idx), fmt.Sprint(idx >= 4), fmt.Sprint(object.Exists(commitSha, gitFs)))
+	}
+
+	cfg, _ := config.Load(gitFs)
+	refspec, _ := cfg.Get("remote.origin.fetch")
+
+	testutils.AssertString(t, "refspec", "+refs/heads/main:refs/remotes/origin/main", refspec)
+
+	for refName, exists := range map[string]bool{
+		"refs/remotes/origin/main":  true,
+		"refs/remotes/origin/other": false,
+		"refs/tags/v1":              true,
+		"refs/tags/v0":              false,
+	} {
+		_, err := refs.Read(gitFs, refName)
+
+		testutils.AssertString(t, refName+" exists", fmt.Sprint(exists), fmt.Sprint(err == nil))
+	}
+
+	if _, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Deepen: 2}); err != nil {
+		t.Fatalf("Fetch --deepen failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "shallow after deepen", history[2].String(), readShallow(t, gitDir))
+
+	if !object.Exists(history[2], gitFs) || object.Exists(history[1], gitFs) {
+		t.Errorf("expected the history to be deepened till commit 2")
+	}
+
+	if _, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Unshallow: true}); err != nil {
+		t.Fatalf("Fetch --unshallow failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "shallow after unshallow", "", readShallow(t, gitDir))
+
+	if !object.Exists(history[0], gitFs) {
+		t.Errorf("expected the whole history after unshallow")
+	}
+
+	if _, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Unshallow: true}); !errors.Is(err, remote.ErrNotShallow) {
+		t.Errorf("expected ErrNotShallow but got %v", err)
+	}
+}
+
+func TestClonePartial(t *testing.T) {
+	srcDir := t.TempDir()
+	srcGitDir := path.Join(srcDir, ".git")
+
+	testutils.InitTestRepo(t, srcGitDir)
+	config.Set(path.Join(srcGitDir, config.RepoConfigFile), "uploadpack.allowFilter", "true")
+
+	dir := path.Join(t.TempDir(), "repo")
+	gitDir := path.Join(dir, ".git")
+
+	var progress bytes.Buffer
+
+	if err := remote.Clone("file://"+srcDir, dir, remote.CloneOptions{Filter: "blob:none", Progress: &progress}); err != nil {
+		t.Fatalf("Clone failed with err %v", err)
+	}
+
+	if !strings.Contains(progress.String(), "remote: Enumerating objects: 330, done.") {
+		t.Errorf("expected the blobs to be omitted but got %q", progress.String())
+	}
+
+	cfg, _ := config.Load(os.DirFS(gitDir))
+
+	for key, expected := range map[string]string{
+		"extensions.partialClone":          "origin",
+		"remote.origin.promisor":           "true",
+		"remote.origin.partialCloneFilter": "blob:none",
+	} {
+		value, _ := cfg.Get(key)
+
+		testutils.AssertString(t, key, expected, value)
+	}
+
+	packs, _ := filepath.Glob(path.Join(gitDir, "objects/pack/*.promisor"))
+
+	if len(packs) < 2 {
+		t.Errorf("expected the clone and the lazy fetches to be promisor packs but got %v", packs)
+	}
+
+	// the blobs of the checkout are fetched lazily
+	if _, err := os.Stat(path.Join(dir, "internals/git/sha/sha.go")); err != nil {
+		t.Errorf("expected file to be checked out but got %v", err)
+	}
+
+	if _, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Filter: "blob:none"}); err != nil {
+		t.Errorf("Fetch with filter failed with err %v", err)
+	}
+
+	if err := remote.Clone("file://"+srcDir, path.Join(t.TempDir(), "bad"), remote.CloneOptions{Filter: "blob:some"}); err == nil {
+		t.Errorf("expected the invalid filter to fail")
+	}
+}
@@ -0,0 +1,941 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+const _FetchHeadFile = "FETCH_HEAD"
+
+// Same as git, the summary shows 7 chars of the SHA and
+// the refs are aligned to at least 10 chars
+const (
+	_AbbrevLen    = 7
+	_SummaryWidth = 2*_AbbrevLen + 3
+	_MinRefWidth  = 10
+)
+
+var ErrRemoteNotFound = errors.New("does not appear to be a git repository")
+var ErrRemoteRefNotFound = errors.New("couldn't find remote ref")
+var ErrFetchIntoCurrentBranch = errors.New("refusing to fetch into current branch")
+
+type FetchOptions struct {
+	// Delete the remote tracking refs which no longer exist on the remote
+	Prune bool
+	// Update the refs even if they are not fast-forward
+	Force bool
+	// Remote progress and warnings are written here, nil to disable
+	Progress io.Writer
+	// Limits the history to the commits at most Depth away from the
+	// fetched refs, Deepen instead deepens the current shallow history
+	Depth  int
+	Deepen int
+	// Limits the history to the commits newer than ShallowSince
+	// and not reachable from the ShallowExclude refs of the remote
+	ShallowSince   time.Time
+	ShallowExclude []string
+	// Fetches the whole history of a shallow repository
+	Unshallow bool
+	// Filter spec for a partial clone, defaults to the
+	// remote.<name>.partialclonefilter of a promisor remote
+	Filter string
+}
+
+// Same as git, unshallow asks for the largest depth
+const _InfiniteDepth = math.MaxInt32
+
+var ErrNotShallow = errors.New("--unshallow on a complete repository does not make sense")
+var ErrNotPromisor = errors.New("--filter can only be used with the remote configured in extensions.partialclone")
+
+// Asks to change the depth of the history
+func (opts FetchOptions) deepens() bool {
+	return opts.Depth > 0 || opts.Deepen > 0 || !opts.ShallowSince.IsZero() || len(opts.ShallowExclude) != 0 || opts.Unshallow
+}
+
+type UpdateStatus int
+
+const (
+	UpToDate UpdateStatus = iota
+	NewRef
+	FastForward
+	ForcedUpdate
+	Rejected
+	Deleted
+	// Only written to FETCH_HEAD
+	FetchHeadOnly
+	// Pushed update was declined by the remote, ex: by a hook
+	RemoteRejected
+)
+
+type RefUpdate struct {
+	// Ref the update is from, the remote ref for fetch and the local
+	// ref for push. Empty for pruned and deleted refs
+	Src string
+	// Ref being updated, empty if the ref is only written to FETCH_HEAD
+	Dst    string
+	Old    *sha.SHA
+	New    *sha.SHA
+	Status UpdateStatus
+	// Set for rejected updates
+	Reason string
+}
+
+type FetchResult struct {
+	URL     string
+	Updates []RefUpdate
+}
+
+func (r *FetchResult) HasRejected() bool {
+	for _, update := range r.Updates {
+		if update.Status == Rejected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Remote ref to fetch and where to store it
+type fetchTarget struct {
+	ref   transport.Ref
+	dst   string
+	force bool
+	// marked for merge in FETCH_HEAD
+	forMerge bool
+}
+
+type fetcher struct {
+	gitDir string
+	gitFs  fs.FS
+	cfg    *config.Config
+	// empty when fetching from a url directly
+	remoteName string
+	url        string
+	opts       FetchOptions
+}
+
+// Returns the url and configured refspecs of the remote, the remote
+// can also be a url in which case there are no configured refspecs
+func resolveRemote(cfg *config.Config, remote string) (string, []Refspec, error) {
+	url, ok := cfg.Get(fmt.Sprintf("remote.%s.url", remote))
+
+	if !ok {
+		// remote names can't have slashes or colons, so it's an url or a path
+		if strings.ContainsAny(remote, "/:") {
+			return remote, nil, nil
+		}
+
+		return "", nil, fmt.Errorf("'%s' %w", remote, ErrRemoteNotFound)
+	}
+
+	var refspecs []Refspec
+
+	for _, spec := range cfg.GetAll(fmt.Sprintf("remote.%s.fetch", remote)) {
+		refspec, err := ParseRefspec(spec)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		refspecs = append(refspecs, refspec)
+	}
+
+	return url, refspecs, nil
+}
+
+// Returns the remote of the current branch, origin otherwise
+func DefaultRemote(gitFs fs.FS) (string, error) {
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return "", err
+	}
+
+	target, isSymbolic, err := refs.ReadSymbolic(gitFs, "HEAD")
+
+	if err != nil {
+		return "", err
+	}
+
+	if isSymbolic && strings.HasPrefix(target, refs.HeadsPrefix) {
+		if remote, ok := cfg.Get(fmt.Sprintf("branch.%s.remote", target[len(refs.HeadsPrefix):])); ok {
+			return remote, nil
+		}
+	}
+
+	return DefaultName, nil
+}
+
+// Prefixes for ls-refs so the remote only advertises the refs we need
+func lsRefsPrefixes(refspecs []Refspec, followTags bool) []string {
+	var prefixes []string
+
+	for _, refspec := range refspecs {
+		switch {
+		case refspec.IsPattern():
+			prefixes = append(prefixes, refspec.Src[:strings.IndexByte(refspec.Src, '*')])
+		case refspec.Src == "HEAD", strings.HasPrefix(refspec.Src, "refs/"):
+			prefixes = append(prefixes, refspec.Src)
+		default:
+			for _, rule := range _RefRevParseRules {
+				prefixes = append(prefixes, fmt.Sprintf(rule, refspec.Src))
+			}
+		}
+	}
+
+	if followTags {
+		prefixes = append(prefixes, refs.TagsPrefix)
+	}
+
+	return prefixes
+}
+
+// Local ref for short dst like main:feature
+func expandDst(src, dst string) string {
+	if dst == "" || strings.HasPrefix(dst, "refs/") {
+		return dst
+	}
+
+	if strings.HasPrefix(src, refs.TagsPrefix) {
+		return refs.TagsPrefix + dst
+	}
+
+	return refs.HeadsPrefix + dst
+}
+
+// Matches the remote refs against the refspecs, the refspecs given on
+// the command line must match a remote ref
+func matchRefspecs(remoteRefs []transport.Ref, refspecs []Refspec, explicit bool) ([]fetchTarget, error) {
+	remoteRefMap := make(map[string]transport.Ref, len(remoteRefs))
+
+	for _, ref := range remoteRefs {
+		remoteRefMap[ref.Name] = ref
+	}
+
+	var targets []fetchTarget
+
+	for _, refspec := range refspecs {
+		if !refspec.IsPattern() {
+			src, ok := expandRefName(refspec.Src, func(name string) bool {
+				_, ok := remoteRefMap[name]
+				return ok
+			})
+
+			if !ok {
+				if explicit {
+					return nil, fmt.Errorf("%w %s", ErrRemoteRefNotFound, refspec.Src)
+				}
+
+				continue
+			}
+
+			targets = append(targets, fetchTarget{
+				ref:      remoteRefMap[src],
+				dst:      expandDst(src, refspec.Dst),
+				force:    refspec.Force,
+				forMerge: explicit,
+			})
+
+			continue
+		}
+
+		for _, ref := range remoteRefs {
+			dst, ok := refspec.MapToDst(ref.Name)
+
+			if !ok {
+				continue
+			}
+
+			targets = append(targets, fetchTarget{ref: ref, dst: dst, force: refspec.Force})
+		}
+	}
+
+	return targets, nil
+}
+
+// Negotiates with the commits reachable from our refs, commits the
+// remote has are hidden so their ancestors are not sent as haves
+type walkNegotiator struct {
+	walker *revlist.Walker
+}
+
+func (n walkNegotiator) Next() (*sha.SHA, error) {
+	c, err := n.walker.Next()
+
+	if err != nil || c == nil {
+		return nil, err
+	}
+
+	return c.SHA, nil
+}
+
+func (n walkNegotiator) Ack(commitSha *sha.SHA) {
+	n.walker.Hide(commitSha)
+}
+
+func (f *fetcher) negotiator() (transport.Negotiator, error) {
+	localRefs, err := refs.List(f.gitFs, "refs/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	localRefs = append(localRefs, refs.Ref{Name: "HEAD"})
+
+	var tips []*sha.SHA
+
+	for _, ref := range localRefs {
+		refSha := ref.SHA
+
+		if refSha == nil {
+			// HEAD can be unborn
+			if refSha, err = refs.Read(f.gitFs, ref.Name); err != nil {
+				continue
+			}
+		}
+
+		// tags can point to any object
+		if _, err := revlist.ReadCommit(f.gitFs, refSha); err != nil {
+			continue
+		}
+
+		tips = append(tips, refSha)
+	}
+
+	if len(tips) == 0 {
+		return nil, nil
+	}
+
+	walker, err := revlist.NewWalker(f.gitFs, tips)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return walkNegotiator{walker: walker}, nil
+}
+
+func (f *fetcher) fetchPack(conn transport.Conn, wants []*sha.SHA) error {
+	negotiator, err := f.negotiator()
+
+	if err != nil {
+		return err
+	}
+
+	shallowCommits, err := shallow.Read(f.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	req := transport.FetchRequest{
+		Wants:          wants,
+		Negotiator:     negotiator,
+		IncludeTag:     true,
+		Shallow:        shallowCommits,
+		Depth:          f.opts.Depth,
+		DeepenSince:    f.opts.ShallowSince,
+		DeepenNot:      f.opts.ShallowExclude,
+		DeepenRelative: f.opts.Deepen > 0,
+		Filter:         f.opts.Filter,
+	}
+
+	if req.Filter == "" && f.remoteName != "" && f.cfg.GetBool(fmt.Sprintf("remote.%s.promisor", f.remoteName), false) {
+		req.Filter, _ = f.cfg.Get(fmt.Sprintf("remote.%s.partialclonefilter", f.remoteName))
+	}
+
+	switch {
+	case f.opts.Unshallow:
+		if len(shallowCommits) == 0 {
+			return ErrNotShallow
+		}
+
+		req.Depth = _InfiniteDepth
+		req.DeepenRelative = false
+	case f.opts.Deepen > 0:
+		req.Depth = f.opts.Deepen
+	}
+
+	return fetchObjects(conn, f.gitDir, req, f.opts.Progress)
+}
+
+// Remote tags which we don't have but the objects
+// they point to are now present locally
+func followTags(gitFs fs.FS, remoteRefs []transport.Ref, targets []fetchTarget) []fetchTarget {
+	targeted := make(map[string]bool, len(targets))
+
+	for _, target := range targets {
+		targeted[target.ref.Name] = true
+	}
+
+	var followed []fetchTarget
+
+	for _, ref := range remoteRefs {
+		if !strings.HasPrefix(ref.Name, refs.TagsPrefix) || targeted[ref.Name] {
+			continue
+		}
+
+		if _, err := refs.Read(gitFs, ref.Name); err == nil {
+			continue
+		}
+
+		if !object.Exists(ref.SHA, gitFs) {
+			continue
+		}
+
+		followed = append(followed, fetchTarget{ref: ref, dst: ref.Name})
+	}
+
+	return followed
+}
+
+// Checks if the remote tag points to an object we already have, such tags
+// are followed even if the pack won't contain their objects
+func tagTargetsExist(gitFs fs.FS, ref transport.Ref) bool {
+	if !strings.HasPrefix(ref.Name, refs.TagsPrefix) {
+		return false
+	}
+
+	if ref.Peeled != nil {
+		return object.Exists(ref.Peeled, gitFs)
+	}
+
+	return object.Exists(ref.SHA, gitFs)
+}
+
+// Same as git, the checked out branch of a non bare repository can't be
+// updated by fetch since the worktree and index would be out of sync
+func (f *fetcher) checkCurrentBranch(targets []fetchTarget) error {
+	if f.cfg.GetBool("core.bare", false) {
+		return nil
+	}
+
+	current, isSymbolic, err := refs.ReadSymbolic(f.gitFs, "HEAD")
+
+	if err != nil || !isSymbolic {
+		return err
+	}
+
+	currentSha, err := refs.Read(f.gitFs, current)
+
+	if errors.Is(err, refs.ErrRefNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if target.dst == current && !target.ref.SHA.Eq(currentSha) {
+			return fmt.Errorf("%w: '%s'", ErrFetchIntoCurrentBranch, current)
+		}
+	}
+
+	return nil
+}
+
+func (f *fetcher) refUpdate(target fetchTarget) (RefUpdate, error) {
+	update := RefUpdate{
+		Src: target.ref.Name,
+		Dst: target.dst,
+		New: target.ref.SHA,
+	}
+
+	if target.dst == "" {
+		update.Status = FetchHeadOnly
+		return update, nil
+	}
+
+	oldSha, err := refs.Read(f.gitFs, target.dst)
+
+	if errors.Is(err, refs.ErrRefNotFound) {
+		update.Status = NewRef
+		return update, nil
+	}
+
+	if err != nil {
+		return RefUpdate{}, err
+	}
+
+	update.Old = oldSha
+
+	force := target.force || f.opts.Force
+
+	switch {
+	case oldSha.Eq(target.ref.SHA):
+		update.Status = UpToDate
+		return update, nil
+	case strings.HasPrefix(target.dst, refs.TagsPrefix):
+		// tags are not expected to move so even fast-forwards are rejected
+		if force {
+			update.Status = ForcedUpdate
+		} else {
+			update.Status = Rejected
+			update.Reason = "would clobber existing tag"
+		}
+
+		return update, nil
+	}
+
+	isFastForward, err := revlist.IsAncestor(f.gitFs, oldSha, target.ref.SHA)
+
+	// tag or tree refs can't be fast-forwarded
+	if err != nil && !errors.Is(err, revlist.ErrNotCommit) {
+		return RefUpdate{}, err
+	}
+
+	switch {
+	case isFastForward:
+		update.Status = FastForward
+	case force:
+		update.Status = ForcedUpdate
+	default:
+		update.Status = Rejected
+		update.Reason = "non-fast-forward"
+	}
+
+	return update, nil
+}
+
+// Remote tracking refs matching the refspecs which are not on the remote anymore
+func (f *fetcher) staleRefs(remoteRefs []transport.Ref, refspecs []Refspec) ([]RefUpdate, error) {
+	remoteRefSet := make(map[string]bool, len(remoteRefs))
+
+	for _, ref := range remoteRefs {
+		remoteRefSet[ref.Name] = true
+	}
+
+	var stale []RefUpdate
+
+	seen := make(map[string]bool)
+
+	for _, refspec := range refspecs {
+		if !refspec.IsPattern() || refspec.Dst == "" {
+			continue
+		}
+
+		localRefs, err := refs.List(f.gitFs, refspec.Dst[:strings.IndexByte(refspec.Dst, '*')])
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range localRefs {
+			src, ok := refspec.MapToSrc(ref.Name)
+
+			// symbolic refs like origin/HEAD are not on the remote
+			if !ok || ref.SymrefTarget != "" || remoteRefSet[src] || seen[ref.Name] {
+				continue
+			}
+
+			seen[ref.Name] = true
+
+			stale = append(stale, RefUpdate{Dst: ref.Name, Old: ref.SHA, Status: Deleted})
+		}
+	}
+
+	return stale, nil
+}
+
+// "branch 'main' of https://github.com/uragirii/got"
+func fetchHeadDesc(refName, url string) string {
+	switch {
+	case refName == "HEAD":
+		return url
+	case strings.HasPrefix(refName, refs.HeadsPrefix):
+		return fmt.Sprintf("branch '%s' of %s", refName[len(refs.HeadsPrefix):], url)
+	case strings.HasPrefix(refName, refs.TagsPrefix):
+		return fmt.Sprintf("tag '%s' of %s", refName[len(refs.TagsPrefix):], url)
+	}
+
+	return fmt.Sprintf("'%s' of %s", refName, url)
+}
+
+// Writes the fetched refs to FETCH_HEAD, refs for merge are written first
+// @see https://git-scm.com/docs/git-fetch#_output
+func (f *fetcher) writeFetchHead(targets []fetchTarget) error {
+	sorted := make([]fetchTarget, len(targets))
+	copy(sorted, targets)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].forMerge && !sorted[j].forMerge
+	})
+
+	var sb strings.Builder
+
+	seen := make(map[string]bool, len(sorted))
+
+	for _, target := range sorted {
+		if seen[target.ref.Name] {
+			continue
+		}
+
+		seen[target.ref.Name] = true
+
+		mergeStatus := "not-for-merge"
+
+		if target.forMerge {
+			mergeStatus = ""
+		}
+
+		fmt.Fprintf(&sb, "%s\t%s\t%s\n", target.ref.SHA, mergeStatus, fetchHeadDesc(target.ref.Name, f.url))
+	}
+
+	return os.WriteFile(path.Join(f.gitDir, _FetchHeadFile), []byte(sb.String()), 0644)
+}
+
+// Marks the merge ref of the current branch for merge in FETCH_HEAD
+func (f *fetcher) markForMerge(targets []fetchTarget) {
+	current, isSymbolic, err := refs.ReadSymbolic(f.gitFs, "HEAD")
+
+	if err != nil || !isSymbolic || !strings.HasPrefix(current, refs.HeadsPrefix) {
+		return
+	}
+
+	branch := current[len(refs.HeadsPrefix):]
+
+	if remote, _ := f.cfg.Get(fmt.Sprintf("branch.%s.remote", branch)); remote != f.remoteName {
+		return
+	}
+
+	mergeRef, ok := f.cfg.Get(fmt.Sprintf("branch.%s.merge", branch))
+
+	if !ok {
+		return
+	}
+
+	for idx := range targets {
+		if targets[idx].ref.Name == mergeRef {
+			targets[idx].forMerge = true
+		}
+	}
+}
+
+func (f *fetcher) fetch(cliRefspecs []string) (*FetchResult, error) {
+	url, configured, err := resolveRemote(f.cfg, f.remoteName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.url = url
+
+	if configured == nil {
+		// fetching from a url directly, there is no remote to name the refs
+		f.remoteName = ""
+	}
+
+	explicit := make([]Refspec, 0, len(cliRefspecs))
+
+	for _, spec := range cliRefspecs {
+		refspec, err := ParseRefspec(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		explicit = append(explicit, refspec)
+	}
+
+	refspecs := configured
+
+	switch {
+	case len(explicit) != 0:
+		refspecs = explicit
+	case len(configured) == 0:
+		refspecs = []Refspec{{Src: "HEAD"}}
+	}
+
+	storesRefs := false
+
+	for _, refspec := range refspecs {
+		storesRefs = storesRefs || refspec.Dst != ""
+	}
+
+	// configured refspecs are also used for updating the remote
+	// tracking refs of the explicitly fetched refs
+	lsRefspecs := append(append([]Refspec{}, refspecs...), configured...)
+
+	conn, err := Dial(url, f.cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	remoteRefs, err := transport.LsRefs(conn, lsRefsPrefixes(lsRefspecs, storesRefs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := matchRefspecs(remoteRefs, refspecs, len(explicit) != 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(explicit) != 0 {
+		fetched := make([]transport.Ref, len(targets))
+
+		for idx, target := range targets {
+			fetched[idx] = target.ref
+		}
+
+		opportunistic, err := matchRefspecs(fetched, configured, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for idx := range opportunistic {
+			opportunistic[idx].forMerge = false
+		}
+
+		targets = append(targets, opportunistic...)
+	} else {
+		f.markForMerge(targets)
+	}
+
+	if err = f.checkCurrentBranch(targets); err != nil {
+		return nil, err
+	}
+
+	seenWants := make(map[string]bool)
+	var wants []*sha.SHA
+
+	addWant := func(wantSha *sha.SHA) {
+		if seenWants[wantSha.String()] {
+			return
+		}
+
+		// the objects exist but the history behind them is fetched
+		if !f.opts.deepens() && object.Exists(wantSha, f.gitFs) {
+			return
+		}
+
+		seenWants[wantSha.String()] = true
+		wants = append(wants, wantSha)
+	}
+
+	for _, target := range targets {
+		addWant(target.ref.SHA)
+	}
+
+	if storesRefs {
+		for _, ref := range remoteRefs {
+			if _, err := refs.Read(f.gitFs, ref.Name); err != nil && tagTargetsExist(f.gitFs, ref) {
+				addWant(ref.SHA)
+			}
+		}
+	}
+
+	if len(wants) != 0 {
+		if err = f.fetchPack(conn, wants); err != nil {
+			return nil, err
+		}
+	}
+
+	if storesRefs {
+		targets = append(targets, followTags(f.gitFs, remoteRefs, targets)...)
+	}
+
+	result := &FetchResult{URL: url}
+
+	prune := f.opts.Prune
+
+	if f.remoteName != "" && !prune {
+		prune = f.cfg.GetBool(fmt.Sprintf("remote.%s.prune", f.remoteName), f.cfg.GetBool("fetch.prune", false))
+	}
+
+	if prune {
+		// pruning before updating avoids conflicts like origin/a and origin/a/b
+		stale, err := f.staleRefs(remoteRefs, refspecs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, update := range stale {
+			if err = refs.Delete(f.gitDir, update.Dst); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Updates = append(result.Updates, stale...)
+	}
+
+	updatedDst := make(map[string]bool, len(targets))
+
+	for _, target := range targets {
+		if target.dst != "" && updatedDst[target.dst] {
+			continue
+		}
+
+		updatedDst[target.dst] = true
+
+		update, err := f.refUpdate(target)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch update.Status {
+		case NewRef, FastForward, ForcedUpdate:
+			if err = refs.Write(f.gitDir, update.Dst, update.New); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Updates = append(result.Updates, update)
+	}
+
+	if err = f.writeFetchHead(targets); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Fetches the refs matching the refspecs from the remote, the refspecs of the
+// remote in the config are used if none are given. The remote can be a url
+func Fetch(gitDir, remote string, refspecs []string, opts FetchOptions) (*FetchResult, error) {
+	gitFs := os.DirFS(gitDir)
+
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Filter != "" {
+		if _, err = revlist.ParseFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+
+		if partialClone, _ := cfg.Get(_PartialCloneKey); partialClone != remote {
+			return nil, ErrNotPromisor
+		}
+	}
+
+	f := &fetcher{
+		gitDir:     gitDir,
+		gitFs:      gitFs,
+		cfg:        cfg,
+		remoteName: remote,
+		opts:       opts,
+	}
+
+	return f.fetch(refspecs)
+}
+
+func abbrev(objSha *sha.SHA) string {
+	return objSha.String()[:_AbbrevLen]
+}
+
+// Kind of the remote ref shown for refs only written to FETCH_HEAD
+func refKind(refName string) string {
+	switch {
+	case strings.HasPrefix(refName, refs.HeadsPrefix):
+		return "branch"
+	case strings.HasPrefix(refName, refs.TagsPrefix):
+		return "tag"
+	case strings.HasPrefix(refName, refs.RemotesPrefix):
+		return "remote-tracking branch"
+	}
+
+	return "branch"
+}
+
+// Returns the flag, summary and the suffix of the update line
+func (update RefUpdate) display() (byte, string, string) {
+	switch update.Status {
+	case NewRef:
+		switch {
+		case strings.HasPrefix(update.Dst, refs.TagsPrefix):
+			return '*', "[new tag]", ""
+		case strings.HasPrefix(update.Src, refs.HeadsPrefix):
+			return '*', "[new branch]", ""
+		}
+
+		return '*', "[new ref]", ""
+	case FastForward:
+		return ' ', abbrev(update.Old) + ".." + abbrev(update.New), ""
+	case ForcedUpdate:
+		if strings.HasPrefix(update.Dst, refs.TagsPrefix) {
+			return 't', "[tag update]", ""
+		}
+
+		return '+', abbrev(update.Old) + "..." + abbrev(update.New), "  (forced update)"
+	case Rejected:
+		return '!', "[rejected]", fmt.Sprintf("  (%s)", update.Reason)
+	case Deleted:
+		return '-', "[deleted]", ""
+	case FetchHeadOnly:
+		return '*', refKind(update.Src), ""
+	}
+
+	return '=', "[up to date]", ""
+}
+
+// Writes the summary of the updated refs like git, up to date refs are skipped
+//
+//	From https://github.com/uragirii/got
+//	 * [new branch]      feature    -> origin/feature
+func (r *FetchResult) WriteSummary(w io.Writer) {
+	refWidth := _MinRefWidth
+
+	var updates []RefUpdate
+
+	for _, update := range r.Updates {
+		if update.Status == UpToDate {
+			continue
+		}
+
+		updates = append(updates, update)
+
+		refWidth = max(refWidth, len(shortRefName(update.Src)))
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "From %s\n", r.URL)
+
+	for _, update := range updates {
+		flag, summary, suffix := update.display()
+
+		src := shortRefName(update.Src)
+
+		if update.Status == Deleted {
+			src = "(none)"
+		}
+
+		dst := shortRefName(update.Dst)
+
+		if update.Status == FetchHeadOnly {
+			dst = _FetchHeadFile
+		}
+
+		fmt.Fprintf(w, " %c %-*s %-*s -> %s%s\n", flag, _SummaryWidth, summary, refWidth, src, dst, suffix)
+	}
+}
@@ -0,0 +1,272 @@
+package remote_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/remote"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/tree"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Serves main, feature and the v1 tag, the haves matching ackSha are
+// acknowledged and the pack is only sent once the client is done
+func newFetchServer(t *testing.T, ackSha string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	packData := testutils.ReadTestPack(t)
+
+	var fetches []string
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /repo.git/info/refs", func(w http.ResponseWriter, r *http.Request) {
+		writeAdvertisement(w)
+	})
+
+	mux.HandleFunc("POST /repo.git/git-upload-pack", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		pw := pktline.NewWriter(w)
+
+		switch {
+		case bytes.Contains(body, []byte("command=ls-refs")):
+			pw.WriteLine(testutils.PackTipSHA + " HEAD symref-target:refs/heads/main")
+			pw.WriteLine(testutils.PackParentSHA + " refs/heads/feature")
+			pw.WriteLine(testutils.PackTipSHA + " refs/heads/main")
+			pw.WriteLine(testutils.PackRootSHA + " refs/tags/v1")
+			pw.WriteFlush()
+		case bytes.Contains(body, []byte("command=fetch")):
+			fetches = append(fetches, string(body))
+
+			if bytes.Contains(body, []byte("done")) {
+				writePackfile(pw, packData)
+				return
+			}
+
+			pw.WriteLine("acknowledgments")
+
+			if bytes.Contains(body, []byte("have "+ackSha)) {
+				pw.WriteLine("ACK " + ackSha)
+			} else {
+				pw.WriteLine("NAK")
+			}
+
+			pw.WriteFlush()
+		default:
+			http.Error(w, "unknown command", http.StatusBadRequest)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+
+	t.Cleanup(server.Close)
+
+	return server, &fetches
+}
+
+func writeCommit(t *testing.T, gitDir string, treeSha string, parent *sha.SHA, time int) *sha.SHA {
+	t.Helper()
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "tree %s\n", treeSha)
+
+	if parent != nil {
+		fmt.Fprintf(&sb, "parent %s\n", parent)
+	}
+
+	ident := fmt.Sprintf("A U Thor <author@example.com> %d +0000", time)
+
+	fmt.Fprintf(&sb, "author %s\ncommitter %s\n\ncommit %d\n", ident, ident, time)
+
+	return testutils.WriteObj(t, gitDir, object.CommitObj, sb.String())
+}
+
+// Creates a linear history of n commits with the empty tree, oldest first
+func writeHistory(t *testing.T, gitDir string, n int) []*sha.SHA {
+	t.Helper()
+
+	testutils.WriteObj(t, gitDir, object.TreeObj, "")
+
+	history := make([]*sha.SHA, 0, n)
+
+	var parent *sha.SHA
+
+	for idx := 0; idx < n; idx++ {
+		parent = writeCommit(t, gitDir, tree.EmptyTreeSHA, parent, 1800000000+idx)
+		history = append(history, parent)
+	}
+
+	return history
+}
+
+func TestFetch(t *testing.T) {
+	gitDir := path.Join(t.TempDir(), ".git")
+
+	if err := repository.Init(gitDir, "main"); err != nil {
+		t.Fatalf("Init failed with err %v", err)
+	}
+
+	history := writeHistory(t, gitDir, 20)
+	tip := history[len(history)-1]
+	ackSha := history[10]
+
+	server, fetches := newFetchServer(t, ackSha.String())
+	url := server.URL + "/repo.git"
+
+	configPath := path.Join(gitDir, config.RepoConfigFile)
+
+	config.Set(configPath, "remote.origin.url", url)
+	config.Set(configPath, "remote.origin.fetch", "refs/heads/*:refs/remotes/origin/*")
+
+	for _, name := range []string{"refs/heads/main", "refs/remotes/origin/main", "refs/remotes/origin/gone"} {
+		if err := refs.Write(gitDir, name, tip); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+	}
+
+	result, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Prune: true})
+
+	if err != nil {
+		t.Fatalf("Fetch failed with err %v", err)
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	t.Run("negotiates the common commits", func(t *testing.T) {
+		if len(*fetches) != 2 {
+			t.Fatalf("expected 2 fetch rounds but got %d", len(*fetches))
+		}
+
+		first, second := (*fetches)[0], (*fetches)[1]
+
+		if strings.Count(first, "have ") != 16 || strings.Contains(first, "done") {
+			t.Errorf("expected 16 haves without done in first round but got %q", first)
+		}
+
+		if !strings.Contains(second, "have "+ackSha.String()) || !strings.Contains(second, "done") {
+			t.Errorf("expected common have and done in second round but got %q", second)
+		}
+
+		// ancestors of the acknowledged commit are not sent
+		if strings.Contains(second, "have "+history[3].String()) {
+			t.Errorf("expected ancestors of common commit to be skipped but got %q", second)
+		}
+	})
+
+	t.Run("prints the updated refs", func(t *testing.T) {
+		var summary bytes.Buffer
+
+		result.WriteSummary(&summary)
+
+		expected := "From " + url + "\n" +
+			" - [deleted]         (none)     -> origin/gone\n" +
+			" * [new branch]      feature    -> origin/feature\n" +
+			" ! [rejected]        main       -> origin/main  (non-fast-forward)\n" +
+			" * [new tag]         v1         -> v1\n"
+
+		testutils.AssertString(t, "summary", expected, summary.String())
+
+		if !result.HasRejected() {
+			t.Errorf("expected rejected update")
+		}
+	})
+
+	t.Run("updates the refs", func(t *testing.T) {
+		for name, expected := range map[string]string{
+			"refs/remotes/origin/feature": testutils.PackParentSHA,
+			"refs/remotes/origin/main":    tip.String(),
+			"refs/tags/v1":                testutils.PackRootSHA,
+		} {
+			got, err := refs.Read(gitFs, name)
+
+			if err != nil {
+				t.Fatalf("Read failed for %s with err %v", name, err)
+			}
+
+			testutils.AssertString(t, name, expected, got.String())
+		}
+
+		if _, err := refs.Read(gitFs, "refs/remotes/origin/gone"); !errors.Is(err, refs.ErrRefNotFound) {
+			t.Errorf("expected origin/gone to be pruned but got %v", err)
+		}
+	})
+
+	t.Run("writes FETCH_HEAD", func(t *testing.T) {
+		contents, _ := os.ReadFile(path.Join(gitDir, "FETCH_HEAD"))
+
+		expected := testutils.PackParentSHA + "\tnot-for-merge\tbranch 'feature' of " + url + "\n" +
+			testutils.PackTipSHA + "\tnot-for-merge\tbranch 'main' of " + url + "\n" +
+			testutils.PackRootSHA + "\tnot-for-merge\ttag 'v1' of " + url + "\n"
+
+		testutils.AssertString(t, "FETCH_HEAD", expected, string(contents))
+	})
+
+	t.Run("fetches explicit refspecs", func(t *testing.T) {
+		result, err := remote.Fetch(gitDir, "origin", []string{"feature:topic"}, remote.FetchOptions{})
+
+		if err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		var summary bytes.Buffer
+
+		result.WriteSummary(&summary)
+
+		testutils.AssertString(t, "summary", "From "+url+"\n * [new branch]      feature    -> topic\n", summary.String())
+
+		got, _ := refs.Read(gitFs, "refs/heads/topic")
+
+		testutils.AssertString(t, "topic", testutils.PackParentSHA, got.String())
+
+		contents, _ := os.ReadFile(path.Join(gitDir, "FETCH_HEAD"))
+
+		testutils.AssertString(t, "FETCH_HEAD", testutils.PackParentSHA+"\t\tbranch 'feature' of "+url+"\n", string(contents))
+
+		// objects are present so nothing is fetched
+		if len(*fetches) != 2 {
+			t.Errorf("expected no new fetch rounds but got %d", len(*fetches))
+		}
+	})
+
+	t.Run("forces non-fast-forward updates", func(t *testing.T) {
+		result, err := remote.Fetch(gitDir, "origin", nil, remote.FetchOptions{Force: true})
+
+		if err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		var summary bytes.Buffer
+
+		result.WriteSummary(&summary)
+
+		expected := fmt.Sprintf("From %s\n + %s...%s main       -> origin/main  (forced update)\n", url, tip.String()[:7], testutils.PackTipSHA[:7])
+
+		testutils.AssertString(t, "summary", expected, summary.String())
+	})
+
+	t.Run("fails for missing remote refs", func(t *testing.T) {
+		if _, err := remote.Fetch(gitDir, "origin", []string{"missing"}, remote.FetchOptions{}); !errors.Is(err, remote.ErrRemoteRefNotFound) {
+			t.Errorf("expected ErrRemoteRefNotFound but got %v", err)
+		}
+
+		if _, err := remote.Fetch(gitDir, "upstream", nil, remote.FetchOptions{}); !errors.Is(err, remote.ErrRemoteNotFound) {
+			t.Errorf("expected ErrRemoteNotFound but got %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+// Remote of a partial clone the omitted objects are fetched from
+// @see https://git-scm.com/docs/partial-clone
+const _PartialCloneKey = "extensions.partialClone"
+
+// Same as git, the lazy fetches only ask for the objects themselves
+// and not for the blobs of the wanted trees
+const _LazyFetchFilter = "blob:none"
+
+var ErrNotPromisorRepository = errors.New("objects can only be fetched for the partial clone")
+
+// Lazily fetches the objects missing from a partial clone
+type promisor struct {
+	gitDir string
+	gitFs  fs.FS
+}
+
+func (p *promisor) FetchMissing(shas []*sha.SHA, fsys fs.FS) error {
+	// objects of the other repositories like the one served by
+	// the local transport are never fetched
+	if !object.SameRepository(fsys, p.gitFs) {
+		return fmt.Errorf("%w: %s", ErrNotPromisorRepository, p.gitDir)
+	}
+
+	cfg, err := config.Load(p.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	remoteName, _ := cfg.Get(_PartialCloneKey)
+
+	url, ok := cfg.Get(fmt.Sprintf("remote.%s.url", remoteName))
+
+	if !ok {
+		return fmt.Errorf("'%s' %w", remoteName, ErrRemoteNotFound)
+	}
+
+	conn, err := Dial(url, cfg)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	return fetchObjects(conn, p.gitDir, transport.FetchRequest{Wants: shas, Filter: _LazyFetchFilter}, nil)
+}
+
+// Makes the objects missing from the repository to be fetched when read
+// if it's a partial clone, otherwise missing objects are an error
+func EnableLazyFetch(gitDir string) error {
+	gitFs := os.DirFS(gitDir)
+
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := cfg.Get(_PartialCloneKey); ok {
+		return object.RegisterPromisor(gitFs, &promisor{gitDir: gitDir, gitFs: gitFs})
+	}
+
+	return nil
+}
+
+// Records the remote as the promisor of the partial clone, the filter
+// is used for the later fetches from the remote too
+func setupPartialClone(gitDir, remoteName, filter string) error {
+	configPath := path.Join(gitDir, config.RepoConfigFile)
+
+	for _, kv := range [][2]string{
+		// extensions need the repository format version 1
+		{"core.repositoryformatversion", "1"},
+		{_PartialCloneKey, remoteName},
+		{fmt.Sprintf("remote.%s.promisor", remoteName), "true"},
+		{fmt.Sprintf("remote.%s.partialclonefilter", remoteName), filter},
+	} {
+		if err := config.Set(configPath, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
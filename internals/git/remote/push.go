@@ -0,0 +1,651 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/hooks"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+var ErrNoUpstream = errors.New("current branch has no upstream branch")
+var ErrNotOnBranch = errors.New("you are not currently on a branch")
+var ErrSrcRefNotFound = errors.New("src refspec does not match any")
+var ErrDeleteWithoutRefs = errors.New("--delete doesn't make sense without any refs")
+
+type PushOptions struct {
+	// Update the remote refs even if they are not fast-forward
+	Force bool
+	// Force update only if the remote ref is at the expected value. Each
+	// lease is <ref>[:<expect>], empty lease uses the remote tracking refs
+	ForceWithLease []string
+	// The refspecs are the remote refs to delete
+	Delete bool
+	// Remote progress and warnings are written here, nil to disable
+	Progress io.Writer
+	// Skip the pre-push hook, same as --no-verify
+	NoVerify bool
+}
+
+type PushResult struct {
+	URL     string
+	Updates []RefUpdate
+}
+
+func (r *PushResult) HasRejected() bool {
+	for _, update := range r.Updates {
+		if update.Status == Rejected || update.Status == RemoteRejected {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Local object to push to the remote ref
+type pushTarget struct {
+	src string
+	// nil when deleting the remote ref
+	sha   *sha.SHA
+	dst   string
+	force bool
+}
+
+type pusher struct {
+	gitDir string
+	gitFs  fs.FS
+	cfg    *config.Config
+	// name of the remote or its url, passed to the pre-push hook
+	remote string
+	// refspecs of the remote for finding the remote tracking refs
+	fetchRefspecs []Refspec
+	remoteRefs    map[string]*sha.SHA
+	opts          PushOptions
+}
+
+// Same as push.default=simple, the current branch is pushed
+// to its upstream branch which must have the same name
+func (p *pusher) defaultRefspec(remote string) (string, error) {
+	current, isSymbolic, err := refs.ReadSymbolic(p.gitFs, "HEAD")
+
+	if err != nil {
+		return "", err
+	}
+
+	if !isSymbolic || !strings.HasPrefix(current, refs.HeadsPrefix) {
+		return "", ErrNotOnBranch
+	}
+
+	branch := current[len(refs.HeadsPrefix):]
+
+	upstreamRemote, _ := p.cfg.Get(fmt.Sprintf("branch.%s.remote", branch))
+	merge, hasMerge := p.cfg.Get(fmt.Sprintf("branch.%s.merge", branch))
+
+	if upstreamRemote != remote || !hasMerge || merge != current {
+		return "", fmt.Errorf("%w: %s", ErrNoUpstream, branch)
+	}
+
+	return current, nil
+}
+
+func (p *pusher) localRefExists(name string) bool {
+	_, err := refs.Read(p.gitFs, name)
+
+	return err == nil
+}
+
+func (p *pusher) remoteRefExists(name string) bool {
+	_, ok := p.remoteRefs[name]
+
+	return ok
+}
+
+// Resolves the src of the refspec to the local ref
+func (p *pusher) resolveSrc(src string) (string, *sha.SHA, error) {
+	if src == "HEAD" {
+		current, isSymbolic, err := refs.ReadSymbolic(p.gitFs, "HEAD")
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		headSha, err := refs.Read(p.gitFs, "HEAD")
+
+		if err != nil {
+			return "", nil, fmt.Errorf("%w %s", ErrSrcRefNotFound, src)
+		}
+
+		if !isSymbolic {
+			current = "HEAD"
+		}
+
+		return current, headSha, nil
+	}
+
+	if name, ok := expandRefName(src, p.localRefExists); ok {
+		refSha, err := refs.Read(p.gitFs, name)
+
+		return name, refSha, err
+	}
+
+	// full SHA can be pushed to an explicit dst
+	if objSha, err := sha.FromString(src); err == nil && object.Exists(objSha, p.gitFs) {
+		return src, objSha, nil
+	}
+
+	return "", nil, fmt.Errorf("%w %s", ErrSrcRefNotFound, src)
+}
+
+// Matches the refspec against the local refs
+func (p *pusher) pushTargets(spec string) ([]pushTarget, error) {
+	force := strings.HasPrefix(spec, "+")
+
+	// :dst deletes the remote ref
+	if dst, ok := strings.CutPrefix(strings.TrimPrefix(spec, "+"), ":"); ok {
+		if name, ok := expandRefName(dst, p.remoteRefExists); ok {
+			dst = name
+		}
+
+		return []pushTarget{{dst: dst, force: force}}, nil
+	}
+
+	refspec, err := ParseRefspec(spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if refspec.IsPattern() {
+		localRefs, err := refs.List(p.gitFs, refspec.Src[:strings.IndexByte(refspec.Src, '*')])
+
+		if err != nil {
+			return nil, err
+		}
+
+		var targets []pushTarget
+
+		for _, ref := range localRefs {
+			dst, ok := refspec.MapToDst(ref.Name)
+
+			if !ok || ref.SymrefTarget != "" {
+				continue
+			}
+
+			targets = append(targets, pushTarget{src: ref.Name, sha: ref.SHA, dst: dst, force: refspec.Force})
+		}
+
+		return targets, nil
+	}
+
+	src, srcSha, err := p.resolveSrc(refspec.Src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dst := refspec.Dst
+
+	switch {
+	case dst == "" && src == "HEAD":
+		return nil, fmt.Errorf("%w: HEAD can't be pushed without a destination", ErrNotOnBranch)
+	case dst == "":
+		dst = src
+	default:
+		if name, ok := expandRefName(dst, p.remoteRefExists); ok {
+			dst = name
+		} else {
+			dst = expandDst(src, dst)
+		}
+	}
+
+	return []pushTarget{{src: src, sha: srcSha, dst: dst, force: refspec.Force}}, nil
+}
+
+// Returns the remote tracking ref of the remote ref using the fetch refspecs
+func (p *pusher) trackingRef(remoteRef string) (string, bool) {
+	for _, refspec := range p.fetchRefspecs {
+		if dst, ok := refspec.MapToDst(remoteRef); ok && dst != "" {
+			return dst, true
+		}
+	}
+
+	return "", false
+}
+
+// Returns the value the remote ref is expected to have for the lease,
+// nil expectation means the ref shouldn't exist on the remote
+// @see https://git-scm.com/docs/git-push#Documentation/git-push.txt---force-with-leaseltrefnamegt
+func (p *pusher) lease(dst string) (*sha.SHA, bool, error) {
+	leased := false
+	fromTracking := false
+
+	var expect *sha.SHA
+
+	for _, lease := range p.opts.ForceWithLease {
+		if lease == "" {
+			leased, fromTracking = true, true
+			continue
+		}
+
+		name, expectStr, hasExpect := strings.Cut(lease, ":")
+
+		if _, ok := expandRefName(name, func(fullName string) bool { return fullName == dst }); !ok {
+			continue
+		}
+
+		leased = true
+		fromTracking = !hasExpect
+
+		if !hasExpect || expectStr == "" {
+			expect = nil
+			break
+		}
+
+		expectRef, ok := expandRefName(expectStr, p.localRefExists)
+
+		var err error
+
+		if ok {
+			expect, err = refs.Read(p.gitFs, expectRef)
+		} else {
+			expect, err = sha.FromString(expectStr)
+		}
+
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot parse expected object name '%s'", expectStr)
+		}
+
+		break
+	}
+
+	if !leased || !fromTracking {
+		return expect, leased, nil
+	}
+
+	trackingRef, ok := p.trackingRef(dst)
+
+	if !ok {
+		return nil, true, nil
+	}
+
+	expect, err := refs.Read(p.gitFs, trackingRef)
+
+	if errors.Is(err, refs.ErrRefNotFound) {
+		return nil, true, nil
+	}
+
+	return expect, true, err
+}
+
+func (p *pusher) refUpdate(target pushTarget) (RefUpdate, error) {
+	oldSha := p.remoteRefs[target.dst]
+
+	update := RefUpdate{
+		Src: target.src,
+		Dst: target.dst,
+		Old: oldSha,
+		New: target.sha,
+	}
+
+	expect, leased, err := p.lease(target.dst)
+
+	if err != nil {
+		return RefUpdate{}, err
+	}
+
+	isStale := leased && !(expect == nil && oldSha == nil || expect != nil && oldSha != nil && expect.Eq(oldSha))
+
+	force := target.force || p.opts.Force || leased
+
+	switch {
+	case target.sha == nil && oldSha == nil:
+		update.Status = Rejected
+		update.Reason = "remote ref does not exist"
+		return update, nil
+	case target.sha != nil && oldSha != nil && oldSha.Eq(target.sha):
+		update.Status = UpToDate
+		return update, nil
+	case isStale:
+		update.Status = Rejected
+		update.Reason = "stale info"
+		return update, nil
+	case target.sha == nil:
+		update.Status = Deleted
+		return update, nil
+	case oldSha == nil:
+		update.Status = NewRef
+		return update, nil
+	case !object.Exists(oldSha, p.gitFs):
+		// can't check if it's fast-forward without the remote commit
+		if force {
+			update.Status = ForcedUpdate
+		} else {
+			update.Status = Rejected
+			update.Reason = "fetch first"
+		}
+
+		return update, nil
+	case strings.HasPrefix(target.dst, refs.TagsPrefix):
+		if force {
+			update.Status = ForcedUpdate
+		} else {
+			update.Status = Rejected
+			update.Reason = "already exists"
+		}
+
+		return update, nil
+	}
+
+	isFastForward, err := revlist.IsAncestor(p.gitFs, oldSha, target.sha)
+
+	if err != nil && !errors.Is(err, revlist.ErrNotCommit) {
+		return RefUpdate{}, err
+	}
+
+	switch {
+	case isFastForward:
+		update.Status = FastForward
+	case force:
+		update.Status = ForcedUpdate
+	default:
+		update.Status = Rejected
+		update.Reason = "non-fast-forward"
+	}
+
+	return update, nil
+}
+
+// Updates the remote tracking ref of the pushed ref, same as git
+// as the next fetch would anyway update it to this value
+func (p *pusher) updateTrackingRef(update RefUpdate) error {
+	trackingRef, ok := p.trackingRef(update.Dst)
+
+	if !ok {
+		return nil
+	}
+
+	if update.Status == Deleted {
+		return refs.Delete(p.gitDir, trackingRef)
+	}
+
+	return refs.Write(p.gitDir, trackingRef, update.New)
+}
+
+// Runs the pre-push hook with a line for each ref the remote will update
+// in "<local ref> <local sha> <remote ref> <remote sha>" format
+// @see https://git-scm.com/docs/githooks#_pre_push
+func (p *pusher) runPrePush(remoteUrl string, updates []RefUpdate) error {
+	var stdin bytes.Buffer
+
+	for _, update := range updates {
+		switch update.Status {
+		case UpToDate, Rejected:
+			continue
+		}
+
+		localRef, localSha, remoteSha := update.Src, sha.ZERO_STR, sha.ZERO_STR
+
+		if update.New == nil {
+			localRef = "(delete)"
+		} else {
+			localSha = update.New.String()
+		}
+
+		if update.Old != nil {
+			remoteSha = update.Old.String()
+		}
+
+		fmt.Fprintf(&stdin, "%s %s %s %s\n", localRef, localSha, update.Dst, remoteSha)
+	}
+
+	workDir := path.Dir(p.gitDir)
+
+	if p.cfg.GetBool("core.bare", false) {
+		workDir = p.gitDir
+	}
+
+	return hooks.New(p.gitDir, workDir, p.cfg).Run(hooks.PrePush, &stdin, p.remote, remoteUrl)
+}
+
+func (p *pusher) push(conn transport.PushConn, remoteUrl string, specs []string) (*PushResult, error) {
+	var targets []pushTarget
+
+	for _, spec := range specs {
+		specTargets, err := p.pushTargets(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, specTargets...)
+	}
+
+	result := &PushResult{URL: remoteUrl}
+
+	var commands []transport.PushCommand
+	var tips []*sha.SHA
+
+	for _, target := range targets {
+		update, err := p.refUpdate(target)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Updates = append(result.Updates, update)
+
+		switch update.Status {
+		case UpToDate, Rejected:
+			continue
+		}
+
+		commands = append(commands, transport.PushCommand{Name: update.Dst, Old: update.Old, New: update.New})
+
+		if update.New != nil {
+			tips = append(tips, update.New)
+		}
+	}
+
+	// the result is returned for reporting the failed push
+	if !p.opts.NoVerify {
+		if err := p.runPrePush(remoteUrl, result.Updates); err != nil {
+			return result, err
+		}
+	}
+
+	if len(commands) == 0 {
+		return result, nil
+	}
+
+	var exclude []*sha.SHA
+
+	for _, remoteSha := range p.remoteRefs {
+		exclude = append(exclude, remoteSha)
+	}
+
+	objects, err := revlist.ListObjects(p.gitFs, tips, exclude, revlist.ListOptions{Progress: p.opts.Progress})
+
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := transport.Push(conn, commands, func(w io.Writer) error {
+		_, err := pack.WriteObjectsWithProgress(w, p.gitFs, objects, p.opts.Progress)
+		return err
+	}, p.opts.Progress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remoteErrors := make(map[string]string, len(report.Refs))
+
+	for _, status := range report.Refs {
+		remoteErrors[status.Name] = status.Error
+	}
+
+	for idx, update := range result.Updates {
+		switch update.Status {
+		case UpToDate, Rejected:
+			continue
+		}
+
+		if reason := remoteErrors[update.Dst]; reason != "" {
+			result.Updates[idx].Status = RemoteRejected
+			result.Updates[idx].Reason = reason
+			continue
+		}
+
+		if err = p.updateTrackingRef(update); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Pushes the local refs matching the refspecs to the remote, the current
+// branch is pushed to its upstream if there are no refspecs
+func Push(gitDir, remote string, refspecs []string, opts PushOptions) (*PushResult, error) {
+	gitFs := os.DirFS(gitDir)
+
+	cfg, err := config.Load(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remoteUrl, fetchRefspecs, err := resolveRemote(cfg, remote)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pushUrl, ok := cfg.Get(fmt.Sprintf("remote.%s.pushurl", remote)); ok {
+		remoteUrl = pushUrl
+	}
+
+	p := &pusher{
+		gitDir:        gitDir,
+		gitFs:         gitFs,
+		cfg:           cfg,
+		remote:        remote,
+		fetchRefspecs: fetchRefspecs,
+		opts:          opts,
+	}
+
+	switch {
+	case opts.Delete && len(refspecs) == 0:
+		return nil, ErrDeleteWithoutRefs
+	case opts.Delete:
+		deletes := make([]string, len(refspecs))
+
+		for idx, ref := range refspecs {
+			deletes[idx] = ":" + ref
+		}
+
+		refspecs = deletes
+	case len(refspecs) == 0:
+		refspec, err := p.defaultRefspec(remote)
+
+		if err != nil {
+			return nil, err
+		}
+
+		refspecs = []string{refspec}
+	}
+
+	conn, err := DialPush(remoteUrl, p.cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	p.remoteRefs = make(map[string]*sha.SHA)
+
+	for _, ref := range conn.Advertisement().Refs {
+		p.remoteRefs[ref.Name] = ref.SHA
+	}
+
+	return p.push(conn, remoteUrl, refspecs)
+}
+
+// Returns the flag, summary and reason of the update line
+func (update RefUpdate) pushDisplay() (byte, string, string) {
+	switch update.Status {
+	case NewRef:
+		switch {
+		case strings.HasPrefix(update.Dst, refs.TagsPrefix):
+			return '*', "[new tag]", ""
+		case strings.HasPrefix(update.Dst, refs.HeadsPrefix):
+			return '*', "[new branch]", ""
+		}
+
+		return '*', "[new reference]", ""
+	case FastForward:
+		return ' ', abbrev(update.Old) + ".." + abbrev(update.New), ""
+	case ForcedUpdate:
+		return '+', abbrev(update.Old) + "..." + abbrev(update.New), "forced update"
+	case Rejected:
+		return '!', "[rejected]", update.Reason
+	case RemoteRejected:
+		return '!', "[remote rejected]", update.Reason
+	case Deleted:
+		return '-', "[deleted]", ""
+	}
+
+	return '=', "[up to date]", ""
+}
+
+// Writes the summary of the pushed refs like git, up to date refs are skipped
+//
+//	To https://github.com/uragirii/got
+//	   1555f0b..f4f3eb8  main -> main
+func (r *PushResult) WriteSummary(w io.Writer) {
+	var updates []RefUpdate
+
+	for _, update := range r.Updates {
+		if update.Status != UpToDate {
+			updates = append(updates, update)
+		}
+	}
+
+	if len(updates) == 0 {
+		fmt.Fprintln(w, "Everything up-to-date")
+		return
+	}
+
+	fmt.Fprintf(w, "To %s\n", r.URL)
+
+	for _, update := range updates {
+		flag, summary, reason := update.pushDisplay()
+
+		fmt.Fprintf(w, " %c %-*s ", flag, _SummaryWidth, summary)
+
+		if update.Src != "" {
+			fmt.Fprintf(w, "%s -> %s", shortRefName(update.Src), shortRefName(update.Dst))
+		} else {
+			fmt.Fprint(w, shortRefName(update.Dst))
+		}
+
+		if reason != "" {
+			fmt.Fprintf(w, " (%s)", reason)
+		}
+
+		fmt.Fprintln(w)
+	}
+}
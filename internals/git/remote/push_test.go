@@ -0,0 +1,356 @@
+package remote_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/hooks"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/remote"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Stand-in for git-receive-pack, refs/heads/protected
+// is declined like a pre-receive hook would
+type receivePackServer struct {
+	gitDir string
+	refs   map[string]string
+	// objects in the last received pack, -1 if there was no pack
+	packObjects int
+}
+
+func (s *receivePackServer) advertise(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("service") != "git-receive-pack" {
+		http.Error(w, "unexpected service", http.StatusBadRequest)
+		return
+	}
+
+	pw := pktline.NewWriter(w)
+
+	pw.WriteLine("# service=git-receive-pack")
+	pw.WriteFlush()
+
+	capabilities := "\x00report-status delete-refs side-band-64k quiet agent=git/2.45.0"
+
+	names := make([]string, 0, len(s.refs))
+
+	for name := range s.refs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		pw.WriteLine(sha.ZERO_STR + " capabilities^{}" + capabilities)
+	}
+
+	for idx, name := range names {
+		line := s.refs[name] + " " + name
+
+		if idx == 0 {
+			line += capabilities
+		}
+
+		pw.WriteLine(line)
+	}
+
+	pw.WriteFlush()
+}
+
+func (s *receivePackServer) receivePack(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	br := bytes.NewReader(body)
+	pr := pktline.NewReader(br)
+
+	var report bytes.Buffer
+
+	rw := pktline.NewWriter(&report)
+
+	var commands [][]string
+
+	for {
+		pktType, line, err := pr.ReadLine()
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if pktType == pktline.TypeFlush {
+			break
+		}
+
+		line, _, _ = strings.Cut(line, "\x00")
+
+		commands = append(commands, strings.Fields(line))
+	}
+
+	packData, _ := io.ReadAll(br)
+
+	s.packObjects = -1
+
+	if len(packData) != 0 {
+		if _, err := pack.Store(s.gitDir, packData); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.packObjects = int(binary.BigEndian.Uint32(packData[8:12]))
+	}
+
+	rw.WriteLine("unpack ok")
+
+	for _, command := range commands {
+		oldSha, newSha, name := command[0], command[1], command[2]
+
+		current, ok := s.refs[name]
+
+		switch {
+		case name == "refs/heads/protected":
+			rw.WriteLine("ng " + name + " pre-receive hook declined")
+			continue
+		case ok && current != oldSha, !ok && oldSha != sha.ZERO_STR:
+			rw.WriteLine("ng " + name + " failed to lock")
+			continue
+		case newSha == sha.ZERO_STR:
+			delete(s.refs, name)
+		default:
+			s.refs[name] = newSha
+		}
+
+		rw.WriteLine("ok " + name)
+	}
+
+	rw.WriteFlush()
+
+	pw := pktline.NewWriter(w)
+
+	pw.WritePacket(append([]byte{2}, "Resolving deltas: done.\n"...))
+	pw.WritePacket(append([]byte{1}, report.Bytes()...))
+	pw.WriteFlush()
+}
+
+func newReceivePackServer(t *testing.T) (*httptest.Server, *receivePackServer) {
+	t.Helper()
+
+	s := &receivePackServer{
+		gitDir: t.TempDir(),
+		refs: map[string]string{
+			"refs/heads/main":    testutils.PackParentSHA,
+			"refs/heads/feature": testutils.PackTipSHA,
+			"refs/heads/old":     testutils.PackRootSHA,
+		},
+	}
+
+	testutils.StoreTestPack(t, s.gitDir)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /repo.git/info/refs", s.advertise)
+	mux.HandleFunc("POST /repo.git/git-receive-pack", s.receivePack)
+
+	server := httptest.NewServer(mux)
+
+	t.Cleanup(server.Close)
+
+	return server, s
+}
+
+func TestPush(t *testing.T) {
+	server, remoteRepo := newReceivePackServer(t)
+	url := server.URL + "/repo.git"
+
+	gitDir := path.Join(t.TempDir(), ".git")
+
+	if err := repository.Init(gitDir, "main"); err != nil {
+		t.Fatalf("Init failed with err %v", err)
+	}
+
+	testutils.StoreTestPack(t, gitDir)
+
+	configPath := path.Join(gitDir, config.RepoConfigFile)
+
+	config.Set(configPath, "remote.origin.url", url)
+	config.Set(configPath, "remote.origin.fetch", remote.DefaultFetchRefspec("origin"))
+
+	// commit on top of the remote feature with a new file
+	blobSha := testutils.WriteObj(t, gitDir, object.BlobObj, "hello\n")
+	treeSha := testutils.WriteObj(t, gitDir, object.TreeObj, "100644 hello.txt\x00"+string(*blobSha.GetBytes()))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	newCommit := writeCommit(t, gitDir, treeSha.String(), tip, 1900000000)
+
+	for name, refSha := range map[string]string{
+		"refs/heads/main":             newCommit.String(),
+		"refs/heads/stale":            testutils.PackRootSHA,
+		"refs/heads/protected":        testutils.PackTipSHA,
+		"refs/remotes/origin/old":     testutils.PackParentSHA,
+		"refs/remotes/origin/feature": testutils.PackTipSHA,
+	} {
+		objSha, _ := sha.FromString(refSha)
+
+		if err := refs.Write(gitDir, name, objSha); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	push := func(t *testing.T, refspecs []string, opts remote.PushOptions) string {
+		t.Helper()
+
+		result, err := remote.Push(gitDir, "origin", refspecs, opts)
+
+		if err != nil {
+			t.Fatalf("Push failed with err %v", err)
+		}
+
+		var summary bytes.Buffer
+
+		result.WriteSummary(&summary)
+
+		return summary.String()
+	}
+
+	t.Run("pushes fast-forwards and reports rejections", func(t *testing.T) {
+		var progress bytes.Buffer
+
+		summary := push(t, []string{"main", "stale:feature", "protected"}, remote.PushOptions{Progress: &progress})
+
+		expected := fmt.Sprintf("To %s\n", url) +
+			fmt.Sprintf("   %s..%s  main -> main\n", testutils.PackParentSHA[:7], newCommit.String()[:7]) +
+			" ! [rejected]        stale -> feature (non-fast-forward)\n" +
+			" ! [remote rejected] protected -> protected (pre-receive hook declined)\n"
+
+		testutils.AssertString(t, "summary", expected, summary)
+		if !strings.Contains(progress.String(), "Counting objects: 3, done.\n") || !strings.Contains(progress.String(), "\rWriting objects: 100% (3/3), ") {
+			t.Errorf("expected counting and writing objects progress but got %q", progress.String())
+		}
+
+		if !strings.HasSuffix(progress.String(), "remote: Resolving deltas: done.\n") {
+			t.Errorf("expected remote progress but got %q", progress.String())
+		}
+
+		// only the commit, tree and blob the remote doesn't have
+		if remoteRepo.packObjects != 3 {
+			t.Errorf("expected 3 objects in pack but got %d", remoteRepo.packObjects)
+		}
+
+		if !object.Exists(blobSha, os.DirFS(remoteRepo.gitDir)) {
+			t.Errorf("expected remote to have the pushed blob")
+		}
+
+		testutils.AssertString(t, "remote main", newCommit.String(), remoteRepo.refs["refs/heads/main"])
+
+		tracking, err := refs.Read(gitFs, "refs/remotes/origin/main")
+
+		if err != nil {
+			t.Fatalf("expected tracking ref to be updated but got %v", err)
+		}
+
+		testutils.AssertString(t, "origin/main", newCommit.String(), tracking.String())
+
+		if _, err := refs.Read(gitFs, "refs/remotes/origin/protected"); !errors.Is(err, refs.ErrRefNotFound) {
+			t.Errorf("expected no tracking ref for rejected push but got %v", err)
+		}
+	})
+
+	t.Run("skips up to date refs", func(t *testing.T) {
+		testutils.AssertString(t, "summary", "Everything up-to-date\n", push(t, []string{"main"}, remote.PushOptions{}))
+	})
+
+	t.Run("forces non-fast-forward updates", func(t *testing.T) {
+		summary := push(t, []string{"stale:feature"}, remote.PushOptions{Force: true})
+
+		expected := fmt.Sprintf("To %s\n + %s...%s stale -> feature (forced update)\n", url, testutils.PackTipSHA[:7], testutils.PackRootSHA[:7])
+
+		testutils.AssertString(t, "summary", expected, summary)
+		testutils.AssertString(t, "remote feature", testutils.PackRootSHA, remoteRepo.refs["refs/heads/feature"])
+	})
+
+	t.Run("rejects stale leases", func(t *testing.T) {
+		// origin/old is at the parent but the remote old is at the root
+		summary := push(t, []string{"protected:old"}, remote.PushOptions{ForceWithLease: []string{""}})
+
+		testutils.AssertString(t, "summary", fmt.Sprintf("To %s\n ! [rejected]        protected -> old (stale info)\n", url), summary)
+
+		summary = push(t, []string{"protected:old"}, remote.PushOptions{ForceWithLease: []string{"old:" + testutils.PackRootSHA}})
+
+		testutils.AssertString(t, "summary", fmt.Sprintf("To %s\n   %s..%s  protected -> old\n", url, testutils.PackRootSHA[:7], testutils.PackTipSHA[:7]), summary)
+	})
+
+	t.Run("deletes remote refs", func(t *testing.T) {
+		summary := push(t, []string{"feature", "missing"}, remote.PushOptions{Delete: true})
+
+		expected := fmt.Sprintf("To %s\n", url) +
+			" - [deleted]         feature\n" +
+			" ! [rejected]        missing (remote ref does not exist)\n"
+
+		testutils.AssertString(t, "summary", expected, summary)
+
+		if _, ok := remoteRepo.refs["refs/heads/feature"]; ok || remoteRepo.packObjects != -1 {
+			t.Errorf("expected feature to be deleted without a pack but got %v %d", remoteRepo.refs, remoteRepo.packObjects)
+		}
+
+		if _, err := refs.Read(gitFs, "refs/remotes/origin/feature"); !errors.Is(err, refs.ErrRefNotFound) {
+			t.Errorf("expected tracking ref to be deleted but got %v", err)
+		}
+	})
+
+	t.Run("aborts when pre-push fails", func(t *testing.T) {
+		hookOutput := path.Join(t.TempDir(), "pre-push.out")
+		hookPath := path.Join(gitDir, "hooks", "pre-push")
+
+		os.MkdirAll(path.Dir(hookPath), 0755)
+		os.WriteFile(hookPath, []byte(fmt.Sprintf("#!/bin/sh\necho \"$1 $2\" > %s\ncat >> %s\nexit 1\n", hookOutput, hookOutput)), 0755)
+
+		t.Cleanup(func() { os.Remove(hookPath) })
+
+		_, err := remote.Push(gitDir, "origin", []string{"protected:hooked"}, remote.PushOptions{})
+
+		if !errors.Is(err, hooks.ErrHookFailed) {
+			t.Fatalf("expected ErrHookFailed but got %v", err)
+		}
+
+		hookInput, _ := os.ReadFile(hookOutput)
+
+		expected := fmt.Sprintf("origin %s\nrefs/heads/protected %s refs/heads/hooked %s\n", url, testutils.PackTipSHA, sha.ZERO_STR)
+
+		testutils.AssertString(t, "hook input", expected, string(hookInput))
+
+		if _, ok := remoteRepo.refs["refs/heads/hooked"]; ok {
+			t.Errorf("expected the push to be aborted but remote has %v", remoteRepo.refs)
+		}
+
+		summary := push(t, []string{"protected:hooked"}, remote.PushOptions{NoVerify: true})
+
+		testutils.AssertString(t, "summary", fmt.Sprintf("To %s\n * [new branch]      protected -> hooked\n", url), summary)
+	})
+
+	t.Run("fails without upstream", func(t *testing.T) {
+		if _, err := remote.Push(gitDir, "origin", nil, remote.PushOptions{}); !errors.Is(err, remote.ErrNoUpstream) {
+			t.Errorf("expected ErrNoUpstream but got %v", err)
+		}
+
+		if _, err := remote.Push(gitDir, "origin", []string{"missing"}, remote.PushOptions{}); !errors.Is(err, remote.ErrSrcRefNotFound) {
+			t.Errorf("expected ErrSrcRefNotFound but got %v", err)
+		}
+	})
+}
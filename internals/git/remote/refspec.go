@@ -0,0 +1,143 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/refs"
+)
+
+var ErrInvalidRefspec = errors.New("invalid refspec")
+
+// Maps the remote refs to the local refs, ex: +refs/heads/*:refs/remotes/origin/*
+// @see https://git-scm.com/book/en/v2/Git-Internals-The-Refspec
+type Refspec struct {
+	Src string
+	// Empty if the ref is only fetched and not stored
+	Dst   string
+	Force bool
+}
+
+func ParseRefspec(spec string) (Refspec, error) {
+	refspec := Refspec{}
+
+	if strings.HasPrefix(spec, "+") {
+		refspec.Force = true
+		spec = spec[1:]
+	}
+
+	if strings.HasPrefix(spec, "^") {
+		return Refspec{}, fmt.Errorf("%w: negative refspecs are not supported: %s", ErrInvalidRefspec, spec)
+	}
+
+	src, dst, _ := strings.Cut(spec, ":")
+
+	srcStars := strings.Count(src, "*")
+	dstStars := strings.Count(dst, "*")
+
+	if src == "" || srcStars > 1 || dstStars > 1 || (dst != "" && srcStars != dstStars) {
+		return Refspec{}, fmt.Errorf("%w: %s", ErrInvalidRefspec, spec)
+	}
+
+	refspec.Src = src
+	refspec.Dst = dst
+
+	return refspec, nil
+}
+
+func (r Refspec) IsPattern() bool {
+	return strings.Contains(r.Src, "*")
+}
+
+func (r Refspec) String() string {
+	spec := r.Src
+
+	if r.Dst != "" {
+		spec += ":" + r.Dst
+	}
+
+	if r.Force {
+		spec = "+" + spec
+	}
+
+	return spec
+}
+
+// Matches the name against the pattern with a single *
+// and returns the part matched by the *
+func matchPattern(pattern, name string) (string, bool) {
+	prefix, suffix, isPattern := strings.Cut(pattern, "*")
+
+	if !isPattern {
+		return "", pattern == name
+	}
+
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// Returns the local ref for the remote ref if the src matches
+func (r Refspec) MapToDst(remoteRef string) (string, bool) {
+	matched, ok := matchPattern(r.Src, remoteRef)
+
+	if !ok {
+		return "", false
+	}
+
+	return strings.Replace(r.Dst, "*", matched, 1), true
+}
+
+// Reverse of MapToDst, used to find the remote ref for a local ref
+func (r Refspec) MapToSrc(localRef string) (string, bool) {
+	if r.Dst == "" {
+		return "", false
+	}
+
+	matched, ok := matchPattern(r.Dst, localRef)
+
+	if !ok {
+		return "", false
+	}
+
+	return strings.Replace(r.Src, "*", matched, 1), true
+}
+
+// Order in which git expands short ref names
+// @see https://git-scm.com/docs/gitrevisions#_specifying_revisions
+var _RefRevParseRules = []string{
+	"%s",
+	"refs/%s",
+	refs.TagsPrefix + "%s",
+	refs.HeadsPrefix + "%s",
+	refs.RemotesPrefix + "%s",
+	refs.RemotesPrefix + "%s/HEAD",
+}
+
+// Expands the short name like main to the full ref name
+// using the first rule matching any of the given refs
+func expandRefName(name string, exists func(string) bool) (string, bool) {
+	for _, rule := range _RefRevParseRules {
+		fullName := fmt.Sprintf(rule, name)
+
+		if exists(fullName) {
+			return fullName, true
+		}
+	}
+
+	return "", false
+}
+
+// Short name of the ref used in the output, ex: refs/heads/main -> main
+func shortRefName(name string) string {
+	for _, prefix := range []string{refs.HeadsPrefix, refs.TagsPrefix, refs.RemotesPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+
+	return name
+}
@@ -0,0 +1,67 @@
+package remote_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/remote"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestRefspec(t *testing.T) {
+	t.Run("maps pattern refspecs", func(t *testing.T) {
+		refspec, err := remote.ParseRefspec("+refs/heads/*:refs/remotes/origin/*")
+
+		if err != nil {
+			t.Fatalf("ParseRefspec failed with err %v", err)
+		}
+
+		if !refspec.Force || !refspec.IsPattern() {
+			t.Errorf("expected forced pattern refspec but got %+v", refspec)
+		}
+
+		dst, ok := refspec.MapToDst("refs/heads/feature/login")
+
+		if !ok {
+			t.Fatalf("expected refspec to match")
+		}
+
+		testutils.AssertString(t, "dst", "refs/remotes/origin/feature/login", dst)
+
+		src, ok := refspec.MapToSrc("refs/remotes/origin/main")
+
+		if !ok {
+			t.Fatalf("expected refspec to match dst")
+		}
+
+		testutils.AssertString(t, "src", "refs/heads/main", src)
+
+		if _, ok := refspec.MapToDst("refs/tags/v1"); ok {
+			t.Errorf("expected tags to not match")
+		}
+	})
+
+	t.Run("exact refspec without dst", func(t *testing.T) {
+		refspec, err := remote.ParseRefspec("refs/heads/main")
+
+		if err != nil {
+			t.Fatalf("ParseRefspec failed with err %v", err)
+		}
+
+		dst, ok := refspec.MapToDst("refs/heads/main")
+
+		if !ok || dst != "" {
+			t.Errorf("expected match without dst but got %q %v", dst, ok)
+		}
+
+		testutils.AssertString(t, "string", "refs/heads/main", refspec.String())
+	})
+
+	t.Run("rejects invalid refspecs", func(t *testing.T) {
+		for _, spec := range []string{"", "refs/heads/*:refs/remotes/origin/main", "refs/*/*:refs/*", "^refs/heads/main"} {
+			if _, err := remote.ParseRefspec(spec); !errors.Is(err, remote.ErrInvalidRefspec) {
+				t.Errorf("expected ErrInvalidRefspec for %q but got %v", spec, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/transport/http"
+	"github.com/uragirii/got/internals/git/transport/local"
+	"github.com/uragirii/got/internals/git/transport/ssh"
+)
+
+const DefaultName = "origin"
+
+var ErrUnsupportedURL = errors.New("unsupported remote url")
+
+const _FileScheme = "file://"
+
+// Same as git, the url is a local path if there is no colon
+// or a slash comes before it, else it's an url or host:path
+func IsLocalPath(url string) bool {
+	colon := strings.Index(url, ":")
+	slash := strings.Index(url, "/")
+
+	return colon < 0 || (slash >= 0 && slash < colon)
+}
+
+// Connects to the remote using the transport for the url scheme,
+// cfg provides the credential helpers for the http remotes
+func Dial(url string, cfg *config.Config) (transport.Conn, error) {
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		return http.Connect(url, cfg)
+	case strings.HasPrefix(url, _FileScheme):
+		return local.Connect(url[len(_FileScheme):])
+	case IsLocalPath(url):
+		return local.Connect(url)
+	case ssh.IsURL(url):
+		return ssh.Connect(url)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, url)
+}
+
+// Default refspec used for fetching the branches of the remote
+func DefaultFetchRefspec(name string) string {
+	return fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", name)
+}
+
+// Connects to the receive-pack of the remote for pushing
+func DialPush(url string, cfg *config.Config) (transport.PushConn, error) {
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		return http.ConnectPush(url, cfg)
+	case strings.HasPrefix(url, _FileScheme):
+		return local.ConnectPush(url[len(_FileScheme):])
+	case IsLocalPath(url):
+		return local.ConnectPush(url)
+	case ssh.IsURL(url):
+		return ssh.ConnectPush(url)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedURL, url)
+}
+
+// Fetches the objects for the request into the repository, either
+// as a pack or by copying them for the remotes which can't send packs.
+// The shallow commits sent by the remote are recorded in the repository,
+// the packs of filtered fetches are marked as promisor packs
+func fetchObjects(conn transport.Conn, gitDir string, req transport.FetchRequest, progress io.Writer) error {
+	if fetcher, ok := conn.(transport.ObjectFetcher); ok {
+		if req.IsShallow() || req.Filter != "" {
+			return fmt.Errorf("%w: shallow or filtered fetch", transport.ErrNotSupported)
+		}
+
+		return fetcher.FetchObjects(gitDir, req.Wants, progress)
+	}
+
+	receiver := pack.NewReceiver(progress)
+
+	info, err := transport.Fetch(conn, req, receiver, progress)
+
+	packData, packErr := receiver.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if packErr != nil {
+		return packErr
+	}
+
+	checksum, err := pack.StoreWithOptions(gitDir, packData, pack.IndexOptions{Progress: progress})
+
+	if err != nil {
+		return err
+	}
+
+	if req.Filter != "" {
+		if err = pack.MarkPromisor(gitDir, checksum); err != nil {
+			return err
+		}
+	}
+
+	if len(info.Shallow) == 0 && len(info.Unshallow) == 0 {
+		return nil
+	}
+
+	return shallow.Update(gitDir, info.Shallow, info.Unshallow)
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"os"
+	"path"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/refs"
+)
+
+const DefaultBranch = "main"
+
+var initFoldersList = [6]string{
+	"info",
+	path.Join("objects", "info"),
+	path.Join("objects", "pack"),
+	path.Join("refs", "heads"),
+	path.Join("refs", "tags"),
+	"hooks",
+}
+
+const _DefaultConfig = `[core]
+	repositoryformatversion = 0
+	filemode = true
+	bare = false
+	logallrefupdates = true
+	ignorecase = true
+	precomposeunicode = true
+`
+
+/*
+Creates the git dir with
+HEAD = ref: refs/heads/<branch>
+config = [core] section
+info/exclude, hooks, objects/{info,pack}, refs/{heads,tags}
+*/
+func Init(gitDir string, branch string) error {
+	if branch == "" {
+		branch = DefaultBranch
+	}
+
+	if err := os.Mkdir(gitDir, 0750); err != nil {
+		return err
+	}
+
+	for _, folderLoc := range initFoldersList {
+		if err := os.MkdirAll(path.Join(gitDir, folderLoc), 0750); err != nil {
+			return err
+		}
+	}
+
+	if err := refs.WriteSymbolic(gitDir, "HEAD", refs.HeadsPrefix+branch); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path.Join(gitDir, "info", "exclude"), []byte{}, 0644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join(gitDir, config.RepoConfigFile), []byte(_DefaultConfig), 0644)
+}
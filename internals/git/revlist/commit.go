@@ -0,0 +1,141 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+)
+
+var ErrNotCommit = errors.New("object is not a commit")
+
+// Commit with only the headers needed for walking the history,
+// this avoids reading the tree like commit.FromSHA
+type Commit struct {
+	SHA     *sha.SHA
+	Tree    *sha.SHA
+	Parents []*sha.SHA
+	// Committer time, used for ordering the walk
+	Time time.Time
+	// Generation of the commit-graph, 0 if the commit is not in it
+	Generation uint64
+}
+
+// "Name <email> 1723625479 +0530" => 1723625479
+func parseIdentTime(ident string) time.Time {
+	emailEndIdx := strings.LastIndexByte(ident, '>')
+
+	if emailEndIdx == -1 {
+		return time.Time{}
+	}
+
+	fields := strings.Fields(ident[emailEndIdx+1:])
+
+	if len(fields) == 0 {
+		return time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(fields[0], 10, 64)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// Reads the commit, shallow commits of the repository are parentless
+// as their parents are not in the repository
+func ReadCommit(gitFs fs.FS, commitSha *sha.SHA) (*Commit, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readCommit(gitFs, nil, commitSha, shallowSet)
+}
+
+// Returns the commit-graph of the repository, a missing or corrupted
+// graph is ignored and the commits are read from the objects
+func loadGraph(gitFs fs.FS) *commitgraph.Graph {
+	graph, err := commitgraph.Load(gitFs)
+
+	if err != nil {
+		return nil
+	}
+
+	return graph
+}
+
+// Reads the commit from the commit-graph or the object, without the
+// parents if it's in the shallow set
+func readCommit(gitFs fs.FS, graph *commitgraph.Graph, commitSha *sha.SHA, shallowSet map[string]bool) (*Commit, error) {
+	if graphCommit, ok := graph.Lookup(commitSha); ok {
+		c := &Commit{
+			SHA:        commitSha,
+			Tree:       graphCommit.Tree,
+			Parents:    graphCommit.Parents,
+			Time:       graphCommit.Time,
+			Generation: graphCommit.Generation,
+		}
+
+		if shallowSet[commitSha.String()] {
+			c.Parents = nil
+		}
+
+		return c, nil
+	}
+
+	obj, err := object.FromSHA(commitSha, gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.ObjType != object.CommitObj {
+		return nil, fmt.Errorf("%w: %s", ErrNotCommit, commitSha)
+	}
+
+	headers, _, _ := strings.Cut(string(*obj.Contents), "\n\n")
+
+	c := &Commit{
+		SHA: commitSha,
+	}
+
+	for _, line := range strings.Split(headers, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "tree":
+			c.Tree, err = sha.FromString(value)
+		case "parent":
+			var parentSha *sha.SHA
+			parentSha, err = sha.FromString(value)
+			c.Parents = append(c.Parents, parentSha)
+		case "committer":
+			c.Time = parseIdentTime(value)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Tree == nil {
+		return nil, fmt.Errorf("%w: %s has no tree", ErrNotCommit, commitSha)
+	}
+
+	if shallowSet[commitSha.String()] {
+		c.Parents = nil
+	}
+
+	return c, nil
+}
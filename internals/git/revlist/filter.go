@@ -0,0 +1,113 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter-spec")
+
+// Omits objects from the listed objects for a partial clone, same as
+// git rev-list --filter. A nil filter doesn't omit anything
+// @see https://git-scm.com/docs/git-rev-list#Documentation/git-rev-list.txt---filterltfilter-specgt
+type Filter struct {
+	Spec string
+	// blobs of at least this size are omitted, negative for no limit
+	blobLimit int64
+	// trees and blobs at least this deep are omitted, the root tree is
+	// at depth 0. Negative for no limit
+	treeDepth int
+}
+
+// Parses the size with an optional k, m or g suffix like git
+func parseSize(value string) (int64, error) {
+	multiplier := int64(1)
+
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return size * multiplier, nil
+}
+
+// Parses blob:none, blob:limit=<n>[kmg] and tree:<depth>
+func ParseFilter(spec string) (*Filter, error) {
+	f := &Filter{Spec: spec, blobLimit: -1, treeDepth: -1}
+
+	kind, value, _ := strings.Cut(spec, ":")
+
+	switch {
+	case spec == "blob:none":
+		f.blobLimit = 0
+	case kind == "blob" && strings.HasPrefix(value, "limit=") && len(value) > len("limit="):
+		limit, err := parseSize(value[len("limit="):])
+
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s': %v", ErrInvalidFilter, spec, err)
+		}
+
+		f.blobLimit = limit
+	case kind == "tree":
+		depth, err := strconv.Atoi(value)
+
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("%w '%s': expected tree:<depth>", ErrInvalidFilter, spec)
+		}
+
+		f.treeDepth = depth
+	default:
+		return nil, fmt.Errorf("%w '%s'", ErrInvalidFilter, spec)
+	}
+
+	return f, nil
+}
+
+func (f *Filter) limitsDepth() bool {
+	return f != nil && f.treeDepth >= 0
+}
+
+// Checks if the tree or blob at the depth is omitted
+func (f *Filter) omitsDepth(depth int) bool {
+	return f.limitsDepth() && depth >= f.treeDepth
+}
+
+// Checks if the blob of the size is omitted, size is
+// only called when the filter depends on it
+func (f *Filter) omitsBlob(depth int, size func() (int64, error)) (bool, error) {
+	if f == nil {
+		return false, nil
+	}
+
+	if f.omitsDepth(depth) || f.blobLimit == 0 {
+		return true, nil
+	}
+
+	if f.blobLimit < 0 {
+		return false, nil
+	}
+
+	blobSize, err := size()
+
+	if err != nil {
+		return false, err
+	}
+
+	return blobSize >= f.blobLimit, nil
+}
@@ -0,0 +1,62 @@
+package revlist_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, spec := range []string{"blob:none", "blob:limit=0", "blob:limit=10k", "blob:limit=2M", "tree:0", "tree:3"} {
+		if _, err := revlist.ParseFilter(spec); err != nil {
+			t.Errorf("expected %s to be valid but got %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"", "blob", "blob:limit=", "blob:limit=1x", "tree:", "tree:-1", "sparse:oid=abc"} {
+		if _, err := revlist.ParseFilter(spec); !errors.Is(err, revlist.ErrInvalidFilter) {
+			t.Errorf("expected ErrInvalidFilter for %q but got %v", spec, err)
+		}
+	}
+}
+
+func TestFilteredObjects(t *testing.T) {
+	gitFs := os.DirFS(setupRepo(t))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	// git rev-list --objects --filter=<spec> 1555f0bf | wc -l
+	for spec, expected := range map[string]int{
+		"blob:none":     330,
+		"blob:limit=1k": 387,
+		"tree:0":        76,
+		"tree:1":        149,
+		"tree:2":        248,
+	} {
+		filter, _ := revlist.ParseFilter(spec)
+
+		objects, err := revlist.ListObjects(gitFs, []*sha.SHA{tip}, nil, revlist.ListOptions{Filter: filter})
+
+		if err != nil {
+			t.Fatalf("ListObjects failed with err %v", err)
+		}
+
+		if len(objects) != expected {
+			t.Errorf("expected %d objects for %s but got %d", expected, spec, len(objects))
+		}
+	}
+
+	c, _ := revlist.ReadCommit(gitFs, tip)
+	filter, _ := revlist.ParseFilter("tree:0")
+
+	// trees asked for explicitly are listed
+	objects, err := revlist.ListObjects(gitFs, []*sha.SHA{c.Tree}, nil, revlist.ListOptions{Filter: filter})
+
+	if err != nil || len(objects) != 1 || !objects[0].Eq(c.Tree) {
+		t.Errorf("expected only the tree but got %v %v", objects, err)
+	}
+}
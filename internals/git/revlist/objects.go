@@ -0,0 +1,368 @@
+package revlist
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/tree"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// Lists the objects reachable from the tips but not from the excluded
+// objects, excluded objects missing locally are ignored
+type objectLister struct {
+	gitFs    fs.FS
+	graph    *commitgraph.Graph
+	shallow  map[string]bool
+	filter   *Filter
+	excluded map[string]bool
+	seen     map[string]bool
+	// smallest depth each tree was walked at, a tree can be
+	// omitted at one depth and not at a smaller one
+	treeDepth map[string]int
+	objects   []*sha.SHA
+	meter     *progress.Meter
+}
+
+// Returns the object the tag points to
+func readTagTarget(gitFs fs.FS, tagSha *sha.SHA) (*sha.SHA, error) {
+	obj, err := object.FromSHA(tagSha, gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(*obj.Contents), "\n") {
+		if target, ok := strings.CutPrefix(line, "object "); ok {
+			return sha.FromString(target)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: tag %s has no object", object.ErrInvalidObj, tagSha)
+}
+
+// Follows the tags till a non tag object, the tags are returned separately
+func peel(gitFs fs.FS, objSha *sha.SHA) ([]*sha.SHA, *sha.SHA, object.ObjectType, error) {
+	var tags []*sha.SHA
+
+	for {
+		obj, err := object.FromSHA(objSha, gitFs)
+
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		if obj.ObjType != object.TagObj {
+			return tags, objSha, obj.ObjType, nil
+		}
+
+		tags = append(tags, objSha)
+
+		if objSha, err = readTagTarget(gitFs, objSha); err != nil {
+			return nil, nil, "", err
+		}
+	}
+}
+
+// Follows the tags till a non tag object and returns it,
+// the object itself is returned if it's not a tag
+func Peel(gitFs fs.FS, objSha *sha.SHA) (*sha.SHA, error) {
+	_, target, _, err := peel(gitFs, objSha)
+
+	return target, err
+}
+
+func (l *objectLister) add(objSha *sha.SHA) {
+	if l.excluded[objSha.String()] || l.seen[objSha.String()] {
+		return
+	}
+
+	l.seen[objSha.String()] = true
+	l.objects = append(l.objects, objSha)
+	l.meter.Add(1)
+}
+
+// Excludes the tree and everything in it
+func (l *objectLister) excludeTree(treeSha *sha.SHA) error {
+	if l.excluded[treeSha.String()] {
+		return nil
+	}
+
+	l.excluded[treeSha.String()] = true
+
+	t, err := tree.FromSHA(treeSha, l.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range t.Entries() {
+		switch entry.Mode {
+		case tree.ModeDir:
+			if err = l.excludeTree(entry.SHA); err != nil {
+				return err
+			}
+		case tree.ModeGitLink:
+			// submodule commits are not in this repository
+		default:
+			l.excluded[entry.SHA.String()] = true
+		}
+	}
+
+	return nil
+}
+
+func (l *objectLister) addTree(treeSha *sha.SHA, depth int) error {
+	if l.excluded[treeSha.String()] {
+		return nil
+	}
+
+	if prevDepth, ok := l.treeDepth[treeSha.String()]; ok && (prevDepth <= depth || !l.filter.limitsDepth()) {
+		return nil
+	}
+
+	l.treeDepth[treeSha.String()] = depth
+
+	if l.filter.omitsDepth(depth) {
+		return nil
+	}
+
+	l.add(treeSha)
+
+	t, err := tree.FromSHA(treeSha, l.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range t.Entries() {
+		switch entry.Mode {
+		case tree.ModeDir:
+			if err = l.addTree(entry.SHA, depth+1); err != nil {
+				return err
+			}
+		case tree.ModeGitLink:
+		default:
+			if err = l.addBlob(entry.SHA, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *objectLister) addBlob(blobSha *sha.SHA, depth int) error {
+	if l.excluded[blobSha.String()] || l.seen[blobSha.String()] {
+		return nil
+	}
+
+	omitted, err := l.filter.omitsBlob(depth, func() (int64, error) {
+		obj, err := object.FromSHA(blobSha, l.gitFs)
+
+		if err != nil {
+			return 0, err
+		}
+
+		return int64(len(*obj.Contents)), nil
+	})
+
+	if err != nil || omitted {
+		return err
+	}
+
+	l.add(blobSha)
+
+	return nil
+}
+
+func (l *objectLister) excludeCommitTree(commitSha *sha.SHA) error {
+	c, err := readCommit(l.gitFs, l.graph, commitSha, l.shallow)
+
+	if err != nil {
+		return err
+	}
+
+	return l.excludeTree(c.Tree)
+}
+
+// Limits the objects listed for a fetch, for shallow and partial clones
+type ListOptions struct {
+	// Parents of these are not listed, the shallow commits the client ends up with
+	Boundary []*sha.SHA
+	// Shallow commits of the client, it has these commits but not their
+	// parents so only the commits themselves are excluded
+	ClientShallow []*sha.SHA
+	// Trees and blobs omitted for a partial clone, the trees and
+	// blobs given as the tips are always listed
+	Filter *Filter
+	// "Counting objects" progress is written here, nil to disable
+	Progress io.Writer
+}
+
+func toSet(shas []*sha.SHA) map[string]bool {
+	set := make(map[string]bool, len(shas))
+
+	for _, objSha := range shas {
+		set[objSha.String()] = true
+	}
+
+	return set
+}
+
+// Returns the objects reachable from the tips but not from the excluded
+// objects, ex: the objects the remote doesn't have when pushing.
+// Commits are returned first followed by the tags, trees and blobs
+func Objects(gitFs fs.FS, tips, exclude []*sha.SHA) ([]*sha.SHA, error) {
+	return ListObjects(gitFs, tips, exclude, ListOptions{})
+}
+
+// Same as Objects but the history is cut at the boundary of the
+// shallow fetch and the objects are filtered for a partial clone
+func ListObjects(gitFs fs.FS, tips, exclude []*sha.SHA, opts ListOptions) ([]*sha.SHA, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commitSha := range opts.Boundary {
+		shallowSet[commitSha.String()] = true
+	}
+
+	l := &objectLister{
+		gitFs:     gitFs,
+		graph:     loadGraph(gitFs),
+		shallow:   shallowSet,
+		filter:    opts.Filter,
+		excluded:  make(map[string]bool),
+		seen:      make(map[string]bool),
+		treeDepth: make(map[string]int),
+		meter:     progress.New(opts.Progress, "Counting objects", 0),
+	}
+
+	var commitTips, excludedCommits, trees, others []*sha.SHA
+
+	for _, objSha := range exclude {
+		// remote can have objects we never fetched
+		if !object.Exists(objSha, gitFs) {
+			continue
+		}
+
+		tags, target, objType, err := peel(gitFs, objSha)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			l.excluded[tag.String()] = true
+		}
+
+		switch objType {
+		case object.CommitObj:
+			excludedCommits = append(excludedCommits, target)
+
+			if err = l.excludeCommitTree(target); err != nil {
+				return nil, err
+			}
+		case object.TreeObj:
+			if err = l.excludeTree(target); err != nil {
+				return nil, err
+			}
+		default:
+			l.excluded[target.String()] = true
+		}
+	}
+
+	for _, objSha := range tips {
+		tags, target, objType, err := peel(gitFs, objSha)
+
+		if err != nil {
+			return nil, err
+		}
+
+		others = append(others, tags...)
+
+		switch objType {
+		case object.CommitObj:
+			commitTips = append(commitTips, target)
+		case object.TreeObj:
+			trees = append(trees, target)
+		default:
+			others = append(others, target)
+		}
+	}
+
+	w, err := newWalker(gitFs, l.graph, append(commitTips, excludedCommits...), shallowSet, toSet(opts.ClientShallow))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commitSha := range excludedCommits {
+		w.Hide(commitSha)
+	}
+
+	var commits []*Commit
+
+	for {
+		c, err := w.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			break
+		}
+
+		commits = append(commits, c)
+		l.add(c.SHA)
+	}
+
+	// trees of the commits the remote has are excluded so
+	// the unchanged files of the walked commits are not sent
+	for _, c := range commits {
+		for _, parent := range c.Parents {
+			if l.seen[parent.String()] {
+				continue
+			}
+
+			if err = l.excludeCommitTree(parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, objSha := range others {
+		l.add(objSha)
+	}
+
+	tipTrees := len(trees)
+
+	for _, c := range commits {
+		trees = append(trees, c.Tree)
+	}
+
+	for idx, treeSha := range trees {
+		// trees asked for explicitly are not filtered
+		if idx < tipTrees {
+			l.add(treeSha)
+		}
+
+		if err = l.addTree(treeSha, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	l.meter.Done()
+
+	return l.objects, nil
+}
@@ -0,0 +1,73 @@
+package revlist_test
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestObjects(t *testing.T) {
+	gitFs := os.DirFS(setupRepo(t))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	t.Run("lists objects missing from the excluded commits", func(t *testing.T) {
+		objects, err := revlist.Objects(gitFs, []*sha.SHA{tip}, []*sha.SHA{parent})
+
+		if err != nil {
+			t.Fatalf("Objects failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "first", testutils.PackTipSHA, objects[0].String())
+
+		var shas []string
+
+		for _, objSha := range objects {
+			shas = append(shas, objSha.String())
+		}
+
+		sort.Strings(shas)
+
+		// git rev-list --objects f4f3eb87..1555f0bf
+		expected := []string{
+			"1555f0bf3c0caf8147af9efd42cee5842a3c6e00",
+			"3b27a10fb93287611e53c4fd3ba759b1c444c4e3",
+			"538ad83bc4518c40918781b828c5c594552e7bc1",
+			"8b87691c9836a75c8a81ec4a57a777010c7be876",
+			"a6617571cb35ada54f6c45f01505475f403a7501",
+			"d6e6dfec10f4f4ef8a1cd684ba8e54d82941b2c0",
+			"df1611f7ecf067d011d91d5a5f5f397fb2417b89",
+			"e66b3e5ded91ae7771b8cfe56b592b01487729ed",
+		}
+
+		testutils.AssertString(t, "objects", strings.Join(expected, "\n"), strings.Join(shas, "\n"))
+	})
+
+	t.Run("lists all objects without exclusions", func(t *testing.T) {
+		objects, err := revlist.Objects(gitFs, []*sha.SHA{tip}, nil)
+
+		if err != nil {
+			t.Fatalf("Objects failed with err %v", err)
+		}
+
+		if len(objects) != 509 {
+			t.Errorf("expected 509 objects but got %d", len(objects))
+		}
+	})
+
+	t.Run("ignores missing excluded objects", func(t *testing.T) {
+		missing, _ := sha.FromString("1111111111111111111111111111111111111111")
+
+		objects, err := revlist.Objects(gitFs, []*sha.SHA{tip}, []*sha.SHA{missing, tip})
+
+		if err != nil || len(objects) != 0 {
+			t.Errorf("expected no objects but got %d %v", len(objects), err)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package revlist
+
+import (
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+)
+
+var ErrNoShallowCommits = errors.New("no commits selected for shallow requests")
+
+// Returns the commits at the depth from the tips which have parents, the
+// history is cut at these for a fetch with --depth. The tips are at depth 1
+func DepthBoundary(gitFs fs.FS, tips []*sha.SHA, depth int) ([]*sha.SHA, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	graph := loadGraph(gitFs)
+
+	// walked level by level so every commit is seen at its smallest depth
+	seen := make(map[string]bool)
+	level := tips
+	var boundary []*sha.SHA
+
+	for current := 1; len(level) != 0; current++ {
+		var next []*sha.SHA
+
+		for _, commitSha := range level {
+			if seen[commitSha.String()] {
+				continue
+			}
+
+			seen[commitSha.String()] = true
+
+			c, err := readCommit(gitFs, graph, commitSha, shallowSet)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if len(c.Parents) == 0 {
+				continue
+			}
+
+			if current == depth {
+				boundary = append(boundary, commitSha)
+				continue
+			}
+
+			next = append(next, c.Parents...)
+		}
+
+		level = next
+	}
+
+	return boundary, nil
+}
+
+// Returns the commits reachable from the tips which are not older than
+// since and not reachable from the excluded commits, but have a parent which
+// is. Used for a fetch with --shallow-since and --shallow-exclude
+func RevBoundary(gitFs fs.FS, tips []*sha.SHA, since time.Time, exclude []*sha.SHA) ([]*sha.SHA, error) {
+	w, err := NewWalker(gitFs, append(append([]*sha.SHA{}, tips...), exclude...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commitSha := range exclude {
+		w.Hide(commitSha)
+	}
+
+	var included []*Commit
+	isIncluded := make(map[string]bool)
+
+	for {
+		c, err := w.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			break
+		}
+
+		if c.Time.Before(since) {
+			continue
+		}
+
+		included = append(included, c)
+		isIncluded[c.SHA.String()] = true
+	}
+
+	if len(included) == 0 {
+		return nil, ErrNoShallowCommits
+	}
+
+	var boundary []*sha.SHA
+
+	for _, c := range included {
+		for _, parent := range c.Parents {
+			if !isIncluded[parent.String()] {
+				boundary = append(boundary, c.SHA)
+				break
+			}
+		}
+	}
+
+	return boundary, nil
+}
+
+// Returns the commits reachable from the tips when the history is cut
+// at the boundary, the boundary commits are included
+func Reachable(gitFs fs.FS, tips, boundary []*sha.SHA) (map[string]bool, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commitSha := range boundary {
+		shallowSet[commitSha.String()] = true
+	}
+
+	w, err := newWalker(gitFs, loadGraph(gitFs), tips, shallowSet, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := make(map[string]bool)
+
+	for {
+		c, err := w.Next()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			return reachable, nil
+		}
+
+		reachable[c.SHA.String()] = true
+	}
+}
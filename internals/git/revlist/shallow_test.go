@@ -0,0 +1,143 @@
+package revlist_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func joinSHAs(shas []*sha.SHA) string {
+	strs := make([]string, len(shas))
+
+	for idx, objSha := range shas {
+		strs[idx] = objSha.String()
+	}
+
+	return strings.Join(strs, ",")
+}
+
+func TestDepthBoundary(t *testing.T) {
+	gitFs := os.DirFS(setupRepo(t))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	for depth, expected := range map[int]string{1: testutils.PackTipSHA, 2: testutils.PackParentSHA} {
+		boundary, err := revlist.DepthBoundary(gitFs, []*sha.SHA{tip}, depth)
+
+		if err != nil {
+			t.Fatalf("DepthBoundary failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "boundary", expected, joinSHAs(boundary))
+	}
+
+	root, _ := sha.FromString(testutils.PackRootSHA)
+
+	// the root has no history to cut
+	if boundary, _ := revlist.DepthBoundary(gitFs, []*sha.SHA{root}, 1); len(boundary) != 0 {
+		t.Errorf("expected no boundary for the root but got %v", boundary)
+	}
+}
+
+func TestRevBoundary(t *testing.T) {
+	gitFs := os.DirFS(setupRepo(t))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	tipCommit, _ := revlist.ReadCommit(gitFs, tip)
+
+	boundary, err := revlist.RevBoundary(gitFs, []*sha.SHA{tip}, tipCommit.Time, nil)
+
+	if err != nil {
+		t.Fatalf("RevBoundary failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "since boundary", testutils.PackTipSHA, joinSHAs(boundary))
+
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	if boundary, err = revlist.RevBoundary(gitFs, []*sha.SHA{tip}, time.Time{}, []*sha.SHA{parent}); err != nil {
+		t.Fatalf("RevBoundary failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "exclude boundary", testutils.PackTipSHA, joinSHAs(boundary))
+
+	if _, err = revlist.RevBoundary(gitFs, []*sha.SHA{tip}, tipCommit.Time.Add(time.Hour), nil); !errors.Is(err, revlist.ErrNoShallowCommits) {
+		t.Errorf("expected ErrNoShallowCommits but got %v", err)
+	}
+}
+
+func TestShallow(t *testing.T) {
+	gitDir := setupRepo(t)
+	gitFs := os.DirFS(gitDir)
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	t.Run("client shallow commits are walked past", func(t *testing.T) {
+		objects, err := revlist.ListObjects(gitFs, []*sha.SHA{tip}, []*sha.SHA{tip}, revlist.ListOptions{
+			Boundary:      []*sha.SHA{parent},
+			ClientShallow: []*sha.SHA{tip},
+		})
+
+		if err != nil {
+			t.Fatalf("ListObjects failed with err %v", err)
+		}
+
+		if len(objects) == 0 || !objects[0].Eq(parent) {
+			t.Errorf("expected the parent to be sent first but got %v", objects)
+		}
+
+		for _, objSha := range objects {
+			if objSha.Eq(tip) {
+				t.Errorf("expected the client commit to be excluded")
+			}
+		}
+	})
+
+	t.Run("reachable stops at the boundary", func(t *testing.T) {
+		reachable, err := revlist.Reachable(gitFs, []*sha.SHA{tip}, []*sha.SHA{parent})
+
+		if err != nil {
+			t.Fatalf("Reachable failed with err %v", err)
+		}
+
+		if len(reachable) != 2 || !reachable[testutils.PackTipSHA] || !reachable[testutils.PackParentSHA] {
+			t.Errorf("expected the tip and parent but got %v", reachable)
+		}
+	})
+
+	t.Run("shallow commits are parentless", func(t *testing.T) {
+		if err := shallow.Write(gitDir, []*sha.SHA{parent}); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		c, err := revlist.ReadCommit(gitFs, parent)
+
+		if err != nil {
+			t.Fatalf("ReadCommit failed with err %v", err)
+		}
+
+		if len(c.Parents) != 0 {
+			t.Errorf("expected no parents but got %v", c.Parents)
+		}
+
+		w, _ := revlist.NewWalker(gitFs, []*sha.SHA{tip})
+
+		walked := 0
+
+		for c, err := w.Next(); c != nil && err == nil; c, err = w.Next() {
+			walked++
+		}
+
+		if walked != 2 {
+			t.Errorf("expected 2 commits but got %d", walked)
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package revlist
+
+import (
+	"container/heap"
+	"io/fs"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+)
+
+// Max heap on the commit time, so newer commits are walked first
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int           { return len(q) }
+func (q commitQueue) Less(i, j int) bool { return q[i].Time.After(q[j].Time) }
+func (q commitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *commitQueue) Push(x any) {
+	*q = append(*q, x.(*Commit))
+}
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	n := len(old)
+	c := old[n-1]
+	*q = old[:n-1]
+
+	return c
+}
+
+// Walks the commits reachable from the tips, newest first
+type Walker struct {
+	gitFs fs.FS
+	// commits are read from the commit-graph when present
+	graph *commitgraph.Graph
+	queue commitQueue
+	seen  map[string]bool
+	// commits read so far, used for hiding their ancestors
+	commits map[string]*Commit
+	// ancestors of hidden commits are not walked
+	hidden map[string]bool
+	// parents of the shallow commits are not walked
+	shallow map[string]bool
+	// hiding stops at these, used for the shallow commits of a client
+	// which has the commits but not their parents
+	hideBoundary map[string]bool
+	// commits of the graph with a smaller generation are not walked,
+	// they can't reach a commit with this generation
+	minGeneration uint64
+}
+
+// Walks from the tips, the shallow commits of the repository are parentless
+func NewWalker(gitFs fs.FS, tips []*sha.SHA) (*Walker, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newWalker(gitFs, loadGraph(gitFs), tips, shallowSet, nil)
+}
+
+func newWalker(gitFs fs.FS, graph *commitgraph.Graph, tips []*sha.SHA, shallowSet, hideBoundary map[string]bool) (*Walker, error) {
+	w := &Walker{
+		gitFs:        gitFs,
+		graph:        graph,
+		seen:         make(map[string]bool),
+		commits:      make(map[string]*Commit),
+		hidden:       make(map[string]bool),
+		shallow:      shallowSet,
+		hideBoundary: hideBoundary,
+	}
+
+	for _, tip := range tips {
+		if err := w.push(tip); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func (w *Walker) push(commitSha *sha.SHA) error {
+	if w.seen[commitSha.String()] {
+		return nil
+	}
+
+	w.seen[commitSha.String()] = true
+
+	c, err := readCommit(w.gitFs, w.graph, commitSha, w.shallow)
+
+	if err != nil {
+		return err
+	}
+
+	if c.Generation != 0 && c.Generation < w.minGeneration {
+		return nil
+	}
+
+	w.commits[commitSha.String()] = c
+
+	heap.Push(&w.queue, c)
+
+	return nil
+}
+
+// Stops walking the commit and its ancestors, commits which
+// were already returned by Next are not affected
+func (w *Walker) Hide(commitSha *sha.SHA) {
+	if w.hidden[commitSha.String()] {
+		return
+	}
+
+	w.hidden[commitSha.String()] = true
+
+	// parents of the commit could already be queued
+	if c, ok := w.commits[commitSha.String()]; ok && !w.hideBoundary[commitSha.String()] {
+		for _, parent := range c.Parents {
+			w.Hide(parent)
+		}
+	}
+}
+
+// Same as git, the walk ends once only hidden commits are queued
+// as nothing reachable from them can be returned. Parents of the
+// hide boundary are not hidden so those commits still have to be walked
+func (w *Walker) onlyHidden() bool {
+	for _, c := range w.queue {
+		if !w.hidden[c.SHA.String()] || w.hideBoundary[c.SHA.String()] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the next commit, nil when all commits are walked
+func (w *Walker) Next() (*Commit, error) {
+	for w.queue.Len() > 0 && !w.onlyHidden() {
+		c := heap.Pop(&w.queue).(*Commit)
+
+		isHidden := w.hidden[c.SHA.String()]
+		hidesParents := isHidden && !w.hideBoundary[c.SHA.String()]
+
+		for _, parent := range c.Parents {
+			// parents can be reachable from the other tips too,
+			// so hidden commits are walked to hide their ancestors
+			if hidesParents {
+				w.hidden[parent.String()] = true
+			}
+
+			if err := w.push(parent); err != nil {
+				return nil, err
+			}
+		}
+
+		if !isHidden {
+			return c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Checks if ancestor is reachable from the descendant, with a
+// commit-graph only the commits with a larger generation are walked
+func IsAncestor(gitFs fs.FS, ancestor, descendant *sha.SHA) (bool, error) {
+	shallowSet, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		return false, err
+	}
+
+	graph := loadGraph(gitFs)
+
+	w, err := newWalker(gitFs, graph, nil, shallowSet, nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	// the ancestor could be missing locally, then the whole history is walked
+	if c, err := readCommit(gitFs, graph, ancestor, shallowSet); err == nil {
+		w.minGeneration = c.Generation
+	}
+
+	if err = w.push(descendant); err != nil {
+		return false, err
+	}
+
+	for {
+		c, err := w.Next()
+
+		if err != nil || c == nil {
+			return false, err
+		}
+
+		if c.SHA.Eq(ancestor) {
+			return true, nil
+		}
+	}
+}
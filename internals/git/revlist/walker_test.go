@@ -0,0 +1,115 @@
+package revlist_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/commitgraph"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func setupRepo(t *testing.T) string {
+	t.Helper()
+
+	gitDir := t.TempDir()
+
+	testutils.StoreTestPack(t, gitDir)
+
+	return gitDir
+}
+
+func TestWalker(t *testing.T) {
+	gitFs := os.DirFS(setupRepo(t))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	t.Run("walks all commits newest first", func(t *testing.T) {
+		w, err := revlist.NewWalker(gitFs, []*sha.SHA{tip})
+
+		if err != nil {
+			t.Fatalf("NewWalker failed with err %v", err)
+		}
+
+		var walked []string
+
+		for {
+			c, err := w.Next()
+
+			if err != nil {
+				t.Fatalf("Next failed with err %v", err)
+			}
+
+			if c == nil {
+				break
+			}
+
+			walked = append(walked, c.SHA.String())
+		}
+
+		if len(walked) != 76 {
+			t.Fatalf("expected 76 commits but got %d", len(walked))
+		}
+
+		testutils.AssertString(t, "first", testutils.PackTipSHA, walked[0])
+		testutils.AssertString(t, "second", testutils.PackParentSHA, walked[1])
+		testutils.AssertString(t, "last", testutils.PackRootSHA, walked[len(walked)-1])
+	})
+
+	t.Run("skips hidden commits and their ancestors", func(t *testing.T) {
+		w, err := revlist.NewWalker(gitFs, []*sha.SHA{tip})
+
+		if err != nil {
+			t.Fatalf("NewWalker failed with err %v", err)
+		}
+
+		c, _ := w.Next()
+
+		testutils.AssertString(t, "first", testutils.PackTipSHA, c.SHA.String())
+
+		parent, _ := sha.FromString(testutils.PackParentSHA)
+
+		w.Hide(parent)
+
+		if c, err = w.Next(); err != nil || c != nil {
+			t.Errorf("expected walk to end but got %v %v", c, err)
+		}
+	})
+}
+
+func TestIsAncestor(t *testing.T) {
+	gitDir := setupRepo(t)
+	gitFs := os.DirFS(gitDir)
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	root, _ := sha.FromString(testutils.PackRootSHA)
+
+	assertAncestry := func(t *testing.T) {
+		t.Helper()
+
+		if ok, err := revlist.IsAncestor(gitFs, root, tip); err != nil || !ok {
+			t.Errorf("expected root to be ancestor of tip but got %v %v", ok, err)
+		}
+
+		if ok, err := revlist.IsAncestor(gitFs, tip, root); err != nil || ok {
+			t.Errorf("expected tip to not be ancestor of root but got %v %v", ok, err)
+		}
+	}
+
+	assertAncestry(t)
+
+	t.Run("uses the commit-graph", func(t *testing.T) {
+		if err := commitgraph.Write(gitDir, []*sha.SHA{tip}, commitgraph.WriteOptions{}); err != nil {
+			t.Fatalf("Write failed with err %v", err)
+		}
+
+		w, _ := revlist.NewWalker(gitFs, []*sha.SHA{tip})
+
+		if c, _ := w.Next(); c == nil || c.Generation == 0 {
+			t.Fatalf("expected the tip to be read from the graph but got %+v", c)
+		}
+
+		assertAncestry(t)
+	})
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pktline"
+)
+
+const (
+	_UploadPackService  = "git-upload-pack"
+	_ReceivePackService = "git-receive-pack"
+)
+
+const (
+	_InfoRefsPath    = "/info/refs"
+	_UploadPackPath  = "/" + _UploadPackService
+	_ReceivePackPath = "/" + _ReceivePackService
+)
+
+// Serves the smart HTTP endpoints of the repositories under root like
+// git http-backend, ex: /org/repo.git/info/refs is served from root/org/repo.git
+// @see https://git-scm.com/docs/http-protocol#_smart_clients
+type HTTPHandler struct {
+	root string
+	// Accept pushes to the repositories which don't set http.receivepack,
+	// git http-backend accepts them only from authenticated users
+	ReceivePack bool
+}
+
+func NewHTTPHandler(root string) *HTTPHandler {
+	return &HTTPHandler{root: root}
+}
+
+// Keeps track if anything was written, errors can be sent
+// as http status only before the response has started
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.written = true
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var repoPath, endpoint string
+
+	for _, suffix := range []string{_InfoRefsPath, _UploadPackPath, _ReceivePackPath} {
+		if prefix, ok := strings.CutSuffix(r.URL.Path, suffix); ok {
+			repoPath, endpoint = prefix, suffix
+			break
+		}
+	}
+
+	if endpoint == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// cleaning a rooted path removes the .. which would escape the root
+	gitDir, err := FindGitDir(path.Join(h.root, path.Clean("/"+repoPath)))
+
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch endpoint {
+	case _InfoRefsPath:
+		h.infoRefs(w, r, gitDir)
+	case _UploadPackPath:
+		h.uploadPack(w, r, gitDir)
+	case _ReceivePackPath:
+		h.receivePack(w, r, gitDir)
+	}
+}
+
+// upload-pack is always enabled, receive-pack is enabled by http.receivepack
+// of the repository and falls back to the handler default
+func (h *HTTPHandler) isEnabled(gitDir, service string) bool {
+	switch service {
+	case _UploadPackService:
+		return true
+	case _ReceivePackService:
+		c, err := config.Load(os.DirFS(gitDir))
+
+		if err != nil {
+			return h.ReceivePack
+		}
+
+		return c.GetBool("http.receivepack", h.ReceivePack)
+	}
+
+	return false
+}
+
+// Only the smart clients are served, dumb clients don't send the service
+func (h *HTTPHandler) infoRefs(w http.ResponseWriter, r *http.Request, gitDir string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	service := r.URL.Query().Get("service")
+
+	if !h.isEnabled(gitDir, service) {
+		http.Error(w, "service not enabled", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	// receive-pack only speaks v0, the refs follow the service header
+	if service == _ReceivePackService {
+		pw := pktline.NewWriter(w)
+
+		pw.WriteLine("# service=" + service)
+		pw.WriteFlush()
+
+		NewReceivePack(gitDir).WriteAdvertisement(w)
+		return
+	}
+
+	// v0 clients expect the service header before the refs, the
+	// error is sent there so the client shows it to the user
+	if !IsProtocolV2(r.Header.Get("Git-Protocol")) {
+		pw := pktline.NewWriter(w)
+
+		pw.WriteLine("# service=" + service)
+		pw.WriteFlush()
+
+		WriteError(w, _UploadPackName, ErrProtocolV2Required)
+		return
+	}
+
+	NewUploadPack(gitDir).WriteCapabilities(w)
+}
+
+// Checks the method and the content type of the service request and
+// returns the body, git compresses the larger requests
+func readServiceRequest(w http.ResponseWriter, r *http.Request, service string) (io.ReadCloser, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	if r.Header.Get("Content-Type") != fmt.Sprintf("application/x-%s-request", service) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return r.Body, true
+	}
+
+	gzipReader, err := gzip.NewReader(r.Body)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return gzipReader, true
+}
+
+// Sends the error as http status if the response hasn't started yet
+func writeServiceError(w *responseWriter, err error) {
+	if err == nil || w.written {
+		return
+	}
+
+	status := http.StatusInternalServerError
+
+	if errors.Is(err, ErrInvalidRequest) || errors.Is(err, ErrUnknownCommand) {
+		status = http.StatusBadRequest
+	}
+
+	http.Error(w.ResponseWriter, err.Error(), status)
+}
+
+func (h *HTTPHandler) uploadPack(w http.ResponseWriter, r *http.Request, gitDir string) {
+	body, ok := readServiceRequest(w, r, _UploadPackService)
+
+	if !ok {
+		return
+	}
+
+	defer body.Close()
+
+	if !IsProtocolV2(r.Header.Get("Git-Protocol")) {
+		http.Error(w, ErrProtocolV2Required.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", _UploadPackService))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rw := &responseWriter{ResponseWriter: w}
+
+	writeServiceError(rw, NewUploadPack(gitDir).Command(body, rw))
+}
+
+func (h *HTTPHandler) receivePack(w http.ResponseWriter, r *http.Request, gitDir string) {
+	if !h.isEnabled(gitDir, _ReceivePackService) {
+		http.Error(w, "service not enabled", http.StatusForbidden)
+		return
+	}
+
+	body, ok := readServiceRequest(w, r, _ReceivePackService)
+
+	if !ok {
+		return
+	}
+
+	defer body.Close()
+
+	w.Header().Set("Content-Type", fmt.Sprintf("application/x-%s-result", _ReceivePackService))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rw := &responseWriter{ResponseWriter: w}
+
+	writeServiceError(rw, NewReceivePack(gitDir).Serve(body, rw))
+}
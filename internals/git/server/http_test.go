@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/remote"
+	"github.com/uragirii/got/internals/git/server"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Creates a bare repository with the testdata pack and main at the tip
+func setupBareRepo(t *testing.T, gitDir string) {
+	t.Helper()
+
+	os.MkdirAll(path.Dir(gitDir), 0755)
+
+	testutils.InitTestRepo(t, gitDir)
+
+	config.Set(path.Join(gitDir, config.RepoConfigFile), "core.bare", "true")
+}
+
+func TestHTTPHandler(t *testing.T) {
+	dir := t.TempDir()
+	root := path.Join(dir, "root")
+
+	setupBareRepo(t, path.Join(root, "org", "repo.git"))
+	setupBareRepo(t, path.Join(dir, "outside.git"))
+
+	handler := server.NewHTTPHandler(root)
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	repoURL := srv.URL + "/org/repo.git"
+
+	t.Run("clones the repository", func(t *testing.T) {
+		cloneDir := path.Join(t.TempDir(), "repo")
+
+		if err := remote.Clone(repoURL, cloneDir, remote.CloneOptions{}); err != nil {
+			t.Fatalf("Clone failed with err %v", err)
+		}
+
+		head, err := refs.Read(os.DirFS(path.Join(cloneDir, ".git")), "HEAD")
+
+		if err != nil {
+			t.Fatalf("failed to read HEAD %v", err)
+		}
+
+		testutils.AssertString(t, "HEAD", testutils.PackTipSHA, head.String())
+	})
+
+	t.Run("sends error to v0 clients", func(t *testing.T) {
+		resp, err := http.Get(repoURL + "/info/refs?service=git-upload-pack")
+
+		if err != nil {
+			t.Fatalf("GET failed with err %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		if !strings.Contains(string(body), "ERR upload-pack: protocol v2 is required") {
+			t.Errorf("expected error in advertisement but got %q", body)
+		}
+	})
+
+	t.Run("reads gzip requests", func(t *testing.T) {
+		var reqBody bytes.Buffer
+
+		gzipWriter := gzip.NewWriter(&reqBody)
+		pw := pktline.NewWriter(gzipWriter)
+
+		pw.WriteLine("command=ls-refs")
+		pw.WriteDelim()
+		pw.WriteLine("ref-prefix refs/heads/")
+		pw.WriteFlush()
+		gzipWriter.Close()
+
+		req, _ := http.NewRequest(http.MethodPost, repoURL+"/git-upload-pack", &reqBody)
+
+		req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Git-Protocol", "version=2")
+
+		resp, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatalf("POST failed with err %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		testutils.AssertString(t, "ls-refs", "003d"+testutils.PackTipSHA+" refs/heads/main\n0000", string(body))
+	})
+
+	statusTests := []struct {
+		name   string
+		method string
+		target string
+		status int
+	}{
+		{"missing repository", http.MethodGet, "/missing.git/info/refs?service=git-upload-pack", http.StatusNotFound},
+		{"outside root", http.MethodGet, "/../outside.git/info/refs?service=git-upload-pack", http.StatusNotFound},
+		{"disabled service", http.MethodGet, "/org/repo.git/info/refs?service=git-receive-pack", http.StatusForbidden},
+		{"dumb client", http.MethodGet, "/org/repo.git/info/refs", http.StatusForbidden},
+		{"unknown path", http.MethodGet, "/org/repo.git/HEAD", http.StatusNotFound},
+		{"get upload-pack", http.MethodGet, "/org/repo.git/git-upload-pack", http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range statusTests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, httptest.NewRequest(test.method, test.target, nil))
+
+			if recorder.Code != test.status {
+				t.Errorf("expected status %d but got %d", test.status, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,589 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/hooks"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+var _ReceivePackCapabilities = []string{"report-status", "delete-refs", "side-band-64k", "quiet", "atomic", "ofs-delta"}
+
+// Accepts the pushes into the repository, receive-pack only speaks protocol v0
+// @see https://git-scm.com/docs/pack-protocol#_pushing_data_to_a_server
+type ReceivePack struct {
+	gitDir string
+	gitFs  fs.FS
+}
+
+func NewReceivePack(gitDir string) *ReceivePack {
+	return &ReceivePack{
+		gitDir: gitDir,
+		gitFs:  os.DirFS(gitDir),
+	}
+}
+
+// Refs and the capabilities sent to the pushing client,
+// HEAD is not advertised as it can't be pushed to
+func (r *ReceivePack) Advertisement() (*transport.Advertisement, error) {
+	refList, err := listRefs(r.gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	advertisement := &transport.Advertisement{
+		Capabilities: append(append([]string{}, _ReceivePackCapabilities...), "agent="+internals.Agent(), "object-format=sha1"),
+	}
+
+	for _, ref := range refList {
+		if ref.Name != "HEAD" {
+			advertisement.Refs = append(advertisement.Refs, transport.Ref{Name: ref.Name, SHA: ref.SHA})
+		}
+	}
+
+	return advertisement, nil
+}
+
+// Writes the refs with the capabilities after NUL on the first line,
+// empty repositories send the capabilities on a placeholder ref
+// @see https://git-scm.com/docs/pack-protocol#_reference_discovery
+func (r *ReceivePack) WriteAdvertisement(w io.Writer) error {
+	advertisement, err := r.Advertisement()
+
+	if err != nil {
+		return err
+	}
+
+	pw := pktline.NewWriter(w)
+
+	capabilities := "\x00" + strings.Join(advertisement.Capabilities, " ")
+
+	if len(advertisement.Refs) == 0 {
+		pw.WriteLine(sha.ZERO_STR + " capabilities^{}" + capabilities)
+	}
+
+	for idx, ref := range advertisement.Refs {
+		line := fmt.Sprintf("%s %s", ref.SHA, ref.Name)
+
+		if idx == 0 {
+			line += capabilities
+		}
+
+		if err = pw.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteFlush()
+}
+
+type receiveCommand struct {
+	name string
+	// nil for the zero id
+	old *sha.SHA
+	new *sha.SHA
+	// Reason the ref was not updated
+	err string
+}
+
+func shaOrNil(shaStr string) (*sha.SHA, error) {
+	if shaStr == sha.ZERO_STR {
+		return nil, nil
+	}
+
+	return sha.FromString(shaStr)
+}
+
+// <old> <new> <name>, the first command has the capabilities after NUL
+func readCommands(r *pktline.Reader) ([]*receiveCommand, []string, error) {
+	var commands []*receiveCommand
+	var capabilities []string
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if pktType == pktline.TypeFlush {
+			return commands, capabilities, nil
+		}
+
+		if len(commands) == 0 {
+			var rawCapabilities string
+
+			line, rawCapabilities, _ = strings.Cut(line, "\x00")
+
+			capabilities = strings.Fields(rawCapabilities)
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("%w: invalid command %q", ErrInvalidRequest, line)
+		}
+
+		oldSha, err := shaOrNil(fields[0])
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid command %q", ErrInvalidRequest, line)
+		}
+
+		newSha, err := shaOrNil(fields[1])
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid command %q", ErrInvalidRequest, line)
+		}
+
+		commands = append(commands, &receiveCommand{name: fields[2], old: oldSha, new: newSha})
+	}
+}
+
+// Branch checked out in the working tree, empty for bare repositories
+func (r *ReceivePack) checkedOutBranch(c *config.Config) string {
+	if c == nil || c.GetBool("core.bare", false) {
+		return ""
+	}
+
+	target, _, err := refs.ReadSymbolic(r.gitFs, "HEAD")
+
+	if err != nil {
+		return ""
+	}
+
+	return target
+}
+
+// The new tip and everything reachable from it must be in the repository,
+// the objects reachable from the existing refs are not walked
+func (r *ReceivePack) isConnected(newSha *sha.SHA, existing []*sha.SHA) bool {
+	objects, err := revlist.Objects(r.gitFs, []*sha.SHA{newSha}, existing)
+
+	if err != nil {
+		return false
+	}
+
+	for _, objSha := range objects {
+		if !object.Exists(objSha, r.gitFs) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the reason if the ref can't be updated
+func (r *ReceivePack) check(cmd *receiveCommand, checkedOut string, existing []*sha.SHA) string {
+	if !strings.HasPrefix(cmd.name, "refs/") {
+		return "funny refname"
+	}
+
+	if cmd.name == checkedOut {
+		if cmd.new == nil {
+			return "deletion of the current branch prohibited"
+		}
+
+		return "branch is currently checked out"
+	}
+
+	current, err := refs.Read(r.gitFs, cmd.name)
+
+	switch {
+	case errors.Is(err, refs.ErrRefNotFound):
+		current = nil
+	case err != nil:
+		return "failed to lock"
+	}
+
+	if (current == nil) != (cmd.old == nil) || (current != nil && !current.Eq(cmd.old)) {
+		return "failed to update ref"
+	}
+
+	if cmd.new != nil && !r.isConnected(cmd.new, existing) {
+		return "missing necessary objects"
+	}
+
+	return ""
+}
+
+// Locks the ref and checks that it's still at the old value of the
+// command, returns the reason if it can't be updated
+func (r *ReceivePack) lock(cmd *receiveCommand) (*refs.RefLock, string) {
+	lock, err := refs.Lock(r.gitDir, cmd.name)
+
+	if err != nil {
+		return nil, "failed to lock"
+	}
+
+	// the ref could've changed while the hooks were running
+	if err = lock.Verify(cmd.old); err != nil {
+		lock.Unlock()
+		return nil, "failed to update ref"
+	}
+
+	return lock, ""
+}
+
+// Updates the locked ref, the lock is released
+func update(lock *refs.RefLock, cmd *receiveCommand) error {
+	if cmd.new == nil {
+		return lock.Delete()
+	}
+
+	return lock.Write(cmd.new)
+}
+
+// Puts the refs back to their old values after a failed atomic push
+func (r *ReceivePack) rollback(applied []*receiveCommand) {
+	for _, cmd := range applied {
+		lock, err := refs.Lock(r.gitDir, cmd.name)
+
+		if err != nil {
+			continue
+		}
+
+		if cmd.old == nil {
+			lock.Delete()
+		} else {
+			lock.Write(cmd.old)
+		}
+	}
+}
+
+// Lines of the pre-receive and post-receive hook input, <old> <new> <name>
+func hookInput(commands []*receiveCommand) string {
+	var sb strings.Builder
+
+	for _, cmd := range commands {
+		if cmd.err == "" {
+			fmt.Fprintf(&sb, "%s %s %s\n", shaOrZero(cmd.old), shaOrZero(cmd.new), cmd.name)
+		}
+	}
+
+	return sb.String()
+}
+
+func shaOrZero(objSha *sha.SHA) string {
+	if objSha == nil {
+		return sha.ZERO_STR
+	}
+
+	return objSha.String()
+}
+
+// Fails the commands which haven't failed yet with the reason
+func failPending(commands []*receiveCommand, reason string) {
+	for _, cmd := range commands {
+		if cmd.err == "" {
+			cmd.err = reason
+		}
+	}
+}
+
+func hasFailed(commands []*receiveCommand) bool {
+	for _, cmd := range commands {
+		if cmd.err != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks the commands, runs the hooks and updates the refs, the reason
+// is set on the commands which fail. With atomic either every ref is
+// updated or none of them are
+// @see https://git-scm.com/docs/git-receive-pack#_pre_receive_hook
+func (r *ReceivePack) execute(commands []*receiveCommand, atomic bool, out io.Writer) error {
+	c, err := config.Load(r.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	// hooks run in the git dir like git receive-pack
+	runner := hooks.New(r.gitDir, r.gitDir, c)
+	runner.Env = []string{"GIT_DIR=."}
+	// same writer for both so the output isn't interleaved mid line
+	runner.Stdout, runner.Stderr = out, out
+
+	refList, err := listRefs(r.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	existing := make([]*sha.SHA, 0, len(refList))
+
+	for _, ref := range refList {
+		existing = append(existing, ref.SHA)
+	}
+
+	checkedOut := r.checkedOutBranch(c)
+
+	for _, cmd := range commands {
+		cmd.err = r.check(cmd, checkedOut, existing)
+	}
+
+	if atomic && hasFailed(commands) {
+		failPending(commands, "atomic push failure")
+	}
+
+	if input := hookInput(commands); input != "" {
+		if runner.Run(hooks.PreReceive, strings.NewReader(input)) != nil {
+			failPending(commands, "pre-receive hook declined")
+		}
+	}
+
+	for _, cmd := range commands {
+		if cmd.err != "" {
+			continue
+		}
+
+		if runner.Run(hooks.Update, nil, cmd.name, shaOrZero(cmd.old), shaOrZero(cmd.new)) != nil {
+			cmd.err = "hook declined"
+		}
+	}
+
+	if atomic && hasFailed(commands) {
+		failPending(commands, "atomic push failure")
+	}
+
+	var pending []*receiveCommand
+
+	for _, cmd := range commands {
+		if cmd.err == "" {
+			pending = append(pending, cmd)
+		}
+	}
+
+	locks := make(map[*receiveCommand]*refs.RefLock, len(pending))
+
+	unlockAll := func() {
+		// no-op for the refs which are already updated
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}
+
+	// every ref is locked before any of them is updated
+	if atomic {
+		for _, cmd := range pending {
+			lock, reason := r.lock(cmd)
+
+			if reason != "" {
+				cmd.err = reason
+				break
+			}
+
+			locks[cmd] = lock
+		}
+
+		if hasFailed(commands) {
+			unlockAll()
+			failPending(commands, "atomic push failure")
+
+			return nil
+		}
+	}
+
+	var applied []*receiveCommand
+
+	for _, cmd := range pending {
+		lock, locked := locks[cmd]
+
+		if !locked {
+			var reason string
+
+			if lock, reason = r.lock(cmd); reason != "" {
+				cmd.err = reason
+				continue
+			}
+		}
+
+		if err = update(lock, cmd); err != nil {
+			cmd.err = "failed to update ref"
+
+			if atomic {
+				unlockAll()
+				r.rollback(applied)
+
+				for _, appliedCmd := range applied {
+					appliedCmd.err = "atomic push failure"
+				}
+
+				failPending(commands, "atomic push failure")
+
+				return nil
+			}
+
+			continue
+		}
+
+		applied = append(applied, cmd)
+	}
+
+	if len(applied) == 0 {
+		return nil
+	}
+
+	// the refs are already updated, so failures of these hooks are ignored
+	runner.Run(hooks.PostReceive, strings.NewReader(hookInput(applied)))
+
+	names := make([]string, 0, len(applied))
+
+	for _, cmd := range applied {
+		names = append(names, cmd.name)
+	}
+
+	runner.Run(hooks.PostUpdate, nil, names...)
+
+	return nil
+}
+
+func writeReport(w io.Writer, unpackErr error, commands []*receiveCommand, useSideband bool) error {
+	var report bytes.Buffer
+
+	rw := pktline.NewWriter(&report)
+
+	if unpackErr != nil {
+		rw.WriteLine("unpack " + unpackErr.Error())
+	} else {
+		rw.WriteLine("unpack ok")
+	}
+
+	for _, cmd := range commands {
+		if cmd.err != "" {
+			rw.WriteLine(fmt.Sprintf("ng %s %s", cmd.name, cmd.err))
+		} else {
+			rw.WriteLine("ok " + cmd.name)
+		}
+	}
+
+	rw.WriteFlush()
+
+	if !useSideband {
+		_, err := w.Write(report.Bytes())
+		return err
+	}
+
+	pw := pktline.NewWriter(w)
+
+	if _, err := transport.NewSidebandWriter(pw, transport.SidebandData).Write(report.Bytes()); err != nil {
+		return err
+	}
+
+	return pw.WriteFlush()
+}
+
+// Serves a whole connection like ssh, the refs are advertised
+// and then the push is handled
+func (r *ReceivePack) ServeStream(req io.Reader, w io.Writer) error {
+	if err := r.WriteAdvertisement(w); err != nil {
+		return err
+	}
+
+	return r.Serve(req, w)
+}
+
+func onlyDeletes(commands []*receiveCommand) bool {
+	for _, cmd := range commands {
+		if cmd.new != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Reads the pack and stores it, thin packs are completed with
+// the bases from the repository
+func (r *ReceivePack) receivePack(br *bufio.Reader) error {
+	packData, err := pack.ReadPack(br)
+
+	if err != nil {
+		return err
+	}
+
+	packData, err = pack.FixThin(r.gitFs, packData)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = pack.Store(r.gitDir, packData)
+
+	return err
+}
+
+// Reads the commands and the pack, updates the refs and writes the report.
+// Output of the hooks is sent as progress if the client asked for side-band
+func (r *ReceivePack) Serve(req io.Reader, w io.Writer) error {
+	br := bufio.NewReader(req)
+
+	commands, capabilities, err := readCommands(pktline.NewReader(br))
+
+	if err != nil {
+		return err
+	}
+
+	// nothing to update, the client doesn't expect any response
+	if len(commands) == 0 {
+		return nil
+	}
+
+	reportStatus, useSideband, atomic := false, false, false
+
+	for _, capability := range capabilities {
+		switch capability {
+		case "report-status":
+			reportStatus = true
+		case "side-band-64k":
+			useSideband = true
+		case "atomic":
+			atomic = true
+		}
+	}
+
+	var hookOut io.Writer = os.Stderr
+
+	if useSideband {
+		hookOut = transport.NewSidebandWriter(pktline.NewWriter(w), transport.SidebandProgress)
+	}
+
+	var unpackErr error
+
+	// clients don't send the pack if every command is a delete
+	if !onlyDeletes(commands) {
+		unpackErr = r.receivePack(br)
+	}
+
+	if unpackErr != nil {
+		failPending(commands, "unpacker error")
+	} else if err = r.execute(commands, atomic, hookOut); err != nil {
+		return err
+	}
+
+	if !reportStatus {
+		return nil
+	}
+
+	return writeReport(w, unpackErr, commands, useSideband)
+}
@@ -0,0 +1,289 @@
+package server_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/server"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/transport/http"
+	"github.com/uragirii/got/internals/git/transport/local"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func writeHook(t *testing.T, gitDir, name, script string) {
+	t.Helper()
+
+	hook := path.Join(gitDir, "hooks", name)
+
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write hook %v", err)
+	}
+
+	t.Cleanup(func() { os.Remove(hook) })
+}
+
+// Sends the push request straight to receive-pack and returns the report lines,
+// commands are expected to have at least one create or update
+func receive(t *testing.T, gitDir string, commands []string, capabilities string, packData []byte) []string {
+	t.Helper()
+
+	var req, resp bytes.Buffer
+
+	pw := pktline.NewWriter(&req)
+
+	for idx, command := range commands {
+		if idx == 0 {
+			command += "\x00" + capabilities
+		}
+
+		pw.WriteLine(command)
+	}
+
+	pw.WriteFlush()
+
+	// empty pack like git sends when the remote has all the objects
+	if packData == nil {
+		pack.WriteObjects(&req, nil, nil)
+	} else {
+		req.Write(packData)
+	}
+
+	if err := server.NewReceivePack(gitDir).Serve(&req, &resp); err != nil {
+		t.Fatalf("Serve failed with err %v", err)
+	}
+
+	var report []string
+
+	r := pktline.NewReader(&resp)
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			t.Fatalf("failed to read report %v", err)
+		}
+
+		if pktType == pktline.TypeFlush {
+			return report
+		}
+
+		report = append(report, line)
+	}
+}
+
+func assertReport(t *testing.T, expected, report []string) {
+	t.Helper()
+
+	if strings.Join(expected, "\n") != strings.Join(report, "\n") {
+		t.Errorf("expected report %q but got %q", expected, report)
+	}
+}
+
+func assertRef(t *testing.T, gitDir, name, expected string) {
+	t.Helper()
+
+	refSha, err := refs.Read(os.DirFS(gitDir), name)
+
+	switch {
+	case expected == "" && !errors.Is(err, refs.ErrRefNotFound):
+		t.Errorf("expected %s to not exist but got %v %v", name, refSha, err)
+	case expected != "" && (err != nil || refSha.String() != expected):
+		t.Errorf("expected %s at %s but got %v %v", name, expected, refSha, err)
+	}
+}
+
+func TestReceivePackHooks(t *testing.T) {
+	gitDir := path.Join(t.TempDir(), "repo.git")
+
+	setupBareRepo(t, gitDir)
+
+	create := sha.ZERO_STR + " " + testutils.PackParentSHA + " "
+
+	t.Run("runs the hooks with the updates", func(t *testing.T) {
+		logFile := path.Join(t.TempDir(), "log")
+
+		writeHook(t, gitDir, "pre-receive", "cat > "+logFile+".pre\n")
+		writeHook(t, gitDir, "update", "echo \"$@\" >> "+logFile+".update\n")
+		writeHook(t, gitDir, "post-receive", "cat > "+logFile+".post\n")
+
+		report := receive(t, gitDir, []string{create + "refs/heads/a", create + "refs/heads/b"}, "report-status", nil)
+
+		assertReport(t, []string{"unpack ok", "ok refs/heads/a", "ok refs/heads/b"}, report)
+		assertRef(t, gitDir, "refs/heads/a", testutils.PackParentSHA)
+
+		input := create + "refs/heads/a\n" + create + "refs/heads/b\n"
+
+		for ext, expected := range map[string]string{
+			".pre":    input,
+			".update": "refs/heads/a " + sha.ZERO_STR + " " + testutils.PackParentSHA + "\nrefs/heads/b " + sha.ZERO_STR + " " + testutils.PackParentSHA + "\n",
+			".post":   input,
+		} {
+			data, _ := os.ReadFile(logFile + ext)
+
+			if string(data) != expected {
+				t.Errorf("expected %s hook input %q but got %q", ext, expected, data)
+			}
+		}
+	})
+
+	t.Run("pre-receive declines every ref", func(t *testing.T) {
+		writeHook(t, gitDir, "pre-receive", "exit 1\n")
+
+		report := receive(t, gitDir, []string{create + "refs/heads/c"}, "report-status", nil)
+
+		assertReport(t, []string{"unpack ok", "ng refs/heads/c pre-receive hook declined"}, report)
+		assertRef(t, gitDir, "refs/heads/c", "")
+	})
+
+	t.Run("update declines a single ref", func(t *testing.T) {
+		writeHook(t, gitDir, "update", "test \"$1\" != refs/heads/protected\n")
+
+		report := receive(t, gitDir, []string{create + "refs/heads/protected", create + "refs/heads/d"}, "report-status", nil)
+
+		assertReport(t, []string{"unpack ok", "ng refs/heads/protected hook declined", "ok refs/heads/d"}, report)
+		assertRef(t, gitDir, "refs/heads/protected", "")
+		assertRef(t, gitDir, "refs/heads/d", testutils.PackParentSHA)
+
+		t.Run("with atomic none are updated", func(t *testing.T) {
+			report := receive(t, gitDir, []string{create + "refs/heads/protected", create + "refs/heads/e"}, "report-status atomic", nil)
+
+			assertReport(t, []string{"unpack ok", "ng refs/heads/protected hook declined", "ng refs/heads/e atomic push failure"}, report)
+			assertRef(t, gitDir, "refs/heads/e", "")
+		})
+	})
+
+	t.Run("re-checks the refs under the lock", func(t *testing.T) {
+		// the ref is created after the commands are checked
+		writeHook(t, gitDir, "pre-receive", "echo "+testutils.PackTipSHA+" > refs/heads/g\n")
+
+		report := receive(t, gitDir, []string{create + "refs/heads/g", create + "refs/heads/h"}, "report-status atomic", nil)
+
+		assertReport(t, []string{"unpack ok", "ng refs/heads/g failed to update ref", "ng refs/heads/h atomic push failure"}, report)
+		assertRef(t, gitDir, "refs/heads/g", testutils.PackTipSHA)
+		assertRef(t, gitDir, "refs/heads/h", "")
+
+		if _, err := os.Stat(path.Join(gitDir, "refs/heads/h.lock")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the locks to be released but got %v", err)
+		}
+	})
+
+	t.Run("fails for locked refs", func(t *testing.T) {
+		lockPath := path.Join(gitDir, "refs/heads/i.lock")
+
+		os.WriteFile(lockPath, nil, 0644)
+
+		report := receive(t, gitDir, []string{create + "refs/heads/i"}, "report-status", nil)
+
+		assertReport(t, []string{"unpack ok", "ng refs/heads/i failed to lock"}, report)
+		assertRef(t, gitDir, "refs/heads/i", "")
+
+		if _, err := os.Stat(lockPath); err != nil {
+			t.Errorf("expected the lock of the other writer to be kept but got %v", err)
+		}
+	})
+
+	t.Run("sends hook output as progress", func(t *testing.T) {
+		writeHook(t, gitDir, "post-receive", "echo updated by hook\n")
+
+		conn, err := local.ConnectPush(gitDir)
+
+		if err != nil {
+			t.Fatalf("ConnectPush failed with err %v", err)
+		}
+
+		parent, _ := sha.FromString(testutils.PackParentSHA)
+
+		var progress bytes.Buffer
+
+		if _, err = transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/f", New: parent}}, func(w io.Writer) error {
+			_, err := pack.WriteObjects(w, os.DirFS(gitDir), nil)
+			return err
+		}, &progress); err != nil {
+			t.Fatalf("Push failed with err %v", err)
+		}
+
+		if !strings.Contains(progress.String(), "remote: updated by hook\n") {
+			t.Errorf("expected hook output in progress but got %q", progress.String())
+		}
+	})
+}
+
+func TestReceivePackConnectivity(t *testing.T) {
+	srcDir := path.Join(t.TempDir(), "src.git")
+	gitDir := path.Join(t.TempDir(), "repo.git")
+
+	setupBareRepo(t, srcDir)
+	setupBareRepo(t, gitDir)
+	os.RemoveAll(path.Join(gitDir, "objects", "pack"))
+	os.Remove(path.Join(gitDir, "refs", "heads", "main"))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	// only the commit without its tree and parents
+	var packData bytes.Buffer
+
+	if _, err := pack.WriteObjects(&packData, os.DirFS(srcDir), []*sha.SHA{tip}); err != nil {
+		t.Fatalf("failed to write pack %v", err)
+	}
+
+	report := receive(t, gitDir, []string{sha.ZERO_STR + " " + testutils.PackTipSHA + " refs/heads/main"}, "report-status", packData.Bytes())
+
+	assertReport(t, []string{"unpack ok", "ng refs/heads/main missing necessary objects"}, report)
+	assertRef(t, gitDir, "refs/heads/main", "")
+}
+
+func TestHTTPHandlerReceivePack(t *testing.T) {
+	root := t.TempDir()
+	gitDir := path.Join(root, "repo.git")
+
+	setupBareRepo(t, gitDir)
+
+	handler := server.NewHTTPHandler(root)
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	if _, err := http.ConnectPush(srv.URL+"/repo.git", nil); err == nil {
+		t.Fatalf("expected push to be disabled by default")
+	}
+
+	handler.ReceivePack = true
+
+	conn, err := http.ConnectPush(srv.URL+"/repo.git", nil)
+
+	if err != nil {
+		t.Fatalf("ConnectPush failed with err %v", err)
+	}
+
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	report, err := transport.Push(conn, []transport.PushCommand{
+		{Name: "refs/heads/main", Old: tip, New: parent},
+		{Name: "refs/heads/stale", Old: parent},
+	}, func(w io.Writer) error {
+		_, err := pack.WriteObjects(w, os.DirFS(gitDir), nil)
+		return err
+	}, nil)
+
+	if err != nil {
+		t.Fatalf("Push failed with err %v", err)
+	}
+
+	if report.Refs[0].Error != "" || report.Refs[1].Error != "failed to update ref" {
+		t.Errorf("unexpected report %+v", report.Refs)
+	}
+
+	assertRef(t, gitDir, "refs/heads/main", testutils.PackParentSHA)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+var ErrNotRepository = errors.New("not a git repository")
+var ErrProtocolV2Required = errors.New("protocol v2 is required")
+
+// Returns true if the client asked for v2 in GIT_PROTOCOL or
+// the Git-Protocol header, ex: version=2:object-format=sha1
+// @see https://git-scm.com/docs/gitprotocol-v2#_initial_client_request
+func IsProtocolV2(gitProtocol string) bool {
+	for _, param := range strings.Split(gitProtocol, ":") {
+		if param == "version=2" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sends the error as ERR packet, clients of every protocol version show it
+func WriteError(w io.Writer, service string, err error) error {
+	return pktline.NewWriter(w).WriteLinef("ERR %s: %v", service, err)
+}
+
+// Returns the git dir of the repository at dir, which
+// is either a working tree or a bare repository
+func FindGitDir(dir string) (string, error) {
+	for _, gitDir := range []string{path.Join(dir, ".git"), dir} {
+		info, err := os.Stat(path.Join(gitDir, "objects"))
+
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		if _, err = os.Stat(path.Join(gitDir, "HEAD")); err == nil {
+			return gitDir, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: '%s'", ErrNotRepository, dir)
+}
+
+// Lists HEAD followed by the refs sorted by name, annotated tags
+// have the peeled object set. Unborn HEAD is skipped
+func listRefs(gitFs fs.FS) ([]transport.Ref, error) {
+	var refList []transport.Ref
+
+	head, err := refs.Read(gitFs, "HEAD")
+
+	switch {
+	case errors.Is(err, refs.ErrRefNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		target, _, err := refs.ReadSymbolic(gitFs, "HEAD")
+
+		if err != nil {
+			return nil, err
+		}
+
+		refList = append(refList, transport.Ref{Name: "HEAD", SHA: head, SymrefTarget: target})
+	}
+
+	allRefs, err := refs.List(gitFs, "refs/")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range allRefs {
+		remoteRef := transport.Ref{Name: ref.Name, SHA: ref.SHA, SymrefTarget: ref.SymrefTarget}
+
+		if strings.HasPrefix(ref.Name, refs.TagsPrefix) {
+			obj, err := object.FromSHA(ref.SHA, gitFs)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if obj.ObjType == object.TagObj {
+				if remoteRef.Peeled, err = revlist.Peel(gitFs, ref.SHA); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		refList = append(refList, remoteRef)
+	}
+
+	return refList, nil
+}
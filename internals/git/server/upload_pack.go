@@ -0,0 +1,622 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+const _UploadPackName = "upload-pack"
+
+var ErrUnknownCommand = errors.New("unknown command")
+var ErrInvalidRequest = errors.New("invalid request")
+var ErrNotOurRef = errors.New("not our ref")
+var ErrFilterNotAllowed = errors.New("filtering capability not negotiated")
+
+// Client sends a flush instead of a command to end the session
+var errEndOfSession = errors.New("end of session")
+
+// Serves the protocol v2 commands of upload-pack for the repository
+// @see https://git-scm.com/docs/protocol-v2
+type UploadPack struct {
+	gitFs fs.FS
+}
+
+func NewUploadPack(gitDir string) *UploadPack {
+	return &UploadPack{
+		gitFs: os.DirFS(gitDir),
+	}
+}
+
+func (u *UploadPack) Capabilities() *transport.Capability {
+	fetch := []string{"shallow"}
+
+	// same as git, filters are only allowed with uploadpack.allowFilter
+	if c, err := config.Load(u.gitFs); err == nil && c.GetBool("uploadpack.allowFilter", false) {
+		fetch = append(fetch, "filter")
+	}
+
+	return &transport.Capability{
+		Agent:        internals.Agent(),
+		Fetch:        fetch,
+		ObjectFormat: "sha1",
+	}
+}
+
+// Reads the command request, the capabilities are ignored
+// as only the ones which don't change the response are advertised
+func readCommandRequest(r *pktline.Reader) (command string, args []string, err error) {
+	for first := true; ; first = false {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		if first && pktType == pktline.TypeFlush {
+			return "", nil, errEndOfSession
+		}
+
+		if pktType == pktline.TypeDelim {
+			break
+		}
+
+		if pktType != pktline.TypeData {
+			return "", nil, fmt.Errorf("%w: unexpected %s packet", ErrInvalidRequest, pktType)
+		}
+
+		if name, ok := strings.CutPrefix(line, "command="); ok {
+			command = name
+		}
+	}
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		if pktType == pktline.TypeFlush {
+			return command, args, nil
+		}
+
+		if pktType != pktline.TypeData {
+			return "", nil, fmt.Errorf("%w: unexpected %s packet", ErrInvalidRequest, pktType)
+		}
+
+		args = append(args, line)
+	}
+}
+
+// Writes the capability advertisement which starts the v2 conversation
+// @see https://git-scm.com/docs/protocol-v2#_capability_advertisement
+func (u *UploadPack) WriteCapabilities(w io.Writer) error {
+	c := u.Capabilities()
+
+	pw := pktline.NewWriter(w)
+
+	lines := []string{
+		"version 2",
+		"agent=" + c.Agent,
+		"ls-refs",
+		"fetch=" + strings.Join(c.Fetch, " "),
+		"object-format=" + c.ObjectFormat,
+	}
+
+	for _, line := range lines {
+		if err := pw.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteFlush()
+}
+
+func (u *UploadPack) command(r *pktline.Reader, w io.Writer) error {
+	command, args, err := readCommandRequest(r)
+
+	if err != nil {
+		return err
+	}
+
+	pw := pktline.NewWriter(w)
+
+	switch command {
+	case "ls-refs":
+		return u.lsRefs(args, pw)
+	case "fetch":
+		return u.fetch(args, pw)
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownCommand, command)
+}
+
+// Handles a single command request and writes the response
+func (u *UploadPack) Command(req io.Reader, w io.Writer) error {
+	return u.command(pktline.NewReader(req), w)
+}
+
+// Serves a whole connection like ssh, the capabilities are advertised
+// and the commands are handled till the client closes the connection
+func (u *UploadPack) ServeStream(r io.Reader, w io.Writer) error {
+	if err := u.WriteCapabilities(w); err != nil {
+		return err
+	}
+
+	pr := pktline.NewReader(r)
+
+	for {
+		err := u.command(pr, w)
+
+		if errors.Is(err, io.EOF) || errors.Is(err, errEndOfSession) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// @see https://git-scm.com/docs/protocol-v2#_ls_refs
+func (u *UploadPack) lsRefs(args []string, pw *pktline.Writer) error {
+	var prefixes []string
+	symrefs, peel := false, false
+
+	for _, arg := range args {
+		switch {
+		case arg == "symrefs":
+			symrefs = true
+		case arg == "peel":
+			peel = true
+		case strings.HasPrefix(arg, "ref-prefix "):
+			prefixes = append(prefixes, arg[len("ref-prefix "):])
+		}
+	}
+
+	refList, err := listRefs(u.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refList {
+		matches := len(prefixes) == 0
+
+		for _, prefix := range prefixes {
+			matches = matches || strings.HasPrefix(ref.Name, prefix)
+		}
+
+		if !matches {
+			continue
+		}
+
+		line := fmt.Sprintf("%s %s", ref.SHA, ref.Name)
+
+		if symrefs && ref.SymrefTarget != "" {
+			line += " symref-target:" + ref.SymrefTarget
+		}
+
+		if peel && ref.Peeled != nil {
+			line += " peeled:" + ref.Peeled.String()
+		}
+
+		if err = pw.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteFlush()
+}
+
+type fetchArgs struct {
+	wants      []*sha.SHA
+	haves      []*sha.SHA
+	done       bool
+	noProgress bool
+	includeTag bool
+	// shallow commits of the client
+	shallow        []*sha.SHA
+	depth          int
+	deepenRelative bool
+	deepenSince    time.Time
+	deepenNot      []string
+	// objects omitted for a partial clone
+	filter *revlist.Filter
+}
+
+func (f *fetchArgs) deepens() bool {
+	return f.depth > 0 || !f.deepenSince.IsZero() || len(f.deepenNot) != 0
+}
+
+func parseFetchArgs(args []string) (*fetchArgs, error) {
+	f := &fetchArgs{}
+
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, " ")
+
+		switch name {
+		case "want", "have", "shallow":
+			objSha, err := sha.FromString(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidRequest, arg)
+			}
+
+			switch name {
+			case "want":
+				f.wants = append(f.wants, objSha)
+			case "have":
+				f.haves = append(f.haves, objSha)
+			default:
+				f.shallow = append(f.shallow, objSha)
+			}
+		case "deepen", "deepen-since":
+			num, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil || num <= 0 {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidRequest, arg)
+			}
+
+			if name == "deepen" {
+				f.depth = int(min(num, math.MaxInt32))
+			} else {
+				f.deepenSince = time.Unix(num, 0)
+			}
+		case "deepen-relative":
+			f.deepenRelative = true
+		case "deepen-not":
+			f.deepenNot = append(f.deepenNot, value)
+		case "filter":
+			filter, err := revlist.ParseFilter(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+			}
+
+			f.filter = filter
+		case "done":
+			f.done = true
+		case "no-progress":
+			f.noProgress = true
+		case "include-tag":
+			f.includeTag = true
+		}
+	}
+
+	if len(f.wants) == 0 {
+		return nil, fmt.Errorf("%w: no wants", ErrInvalidRequest)
+	}
+
+	if f.depth > 0 && (!f.deepenSince.IsZero() || len(f.deepenNot) != 0) {
+		return nil, fmt.Errorf("%w: deepen and deepen-since (or deepen-not) cannot be used together", ErrInvalidRequest)
+	}
+
+	return f, nil
+}
+
+// Same as git, the negotiation can stop once every
+// want has one of the common commits as its ancestor
+func (u *UploadPack) okToGiveUp(wants, common []*sha.SHA) (bool, error) {
+	if len(common) == 0 {
+		return false, nil
+	}
+
+	for _, want := range wants {
+		found := false
+
+		for _, commonSha := range common {
+			isAncestor, err := revlist.IsAncestor(u.gitFs, commonSha, want)
+
+			if err != nil {
+				return false, err
+			}
+
+			if isAncestor {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Annotated tags pointing to the objects which are being sent
+func (u *UploadPack) includedTags(objects []*sha.SHA) ([]*sha.SHA, error) {
+	sending := make(map[string]bool, len(objects))
+
+	for _, objSha := range objects {
+		sending[objSha.String()] = true
+	}
+
+	refList, err := listRefs(u.gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []*sha.SHA
+
+	for _, ref := range refList {
+		if ref.Peeled == nil || sending[ref.SHA.String()] || !sending[ref.Peeled.String()] {
+			continue
+		}
+
+		sending[ref.SHA.String()] = true
+		tags = append(tags, ref.SHA)
+	}
+
+	return tags, nil
+}
+
+// Resolves the deepen-not rev like git rev-parse, a full SHA or a ref name
+func (u *UploadPack) resolveRev(rev string) (*sha.SHA, error) {
+	if objSha, err := sha.FromString(rev); err == nil && object.Exists(objSha, u.gitFs) {
+		return objSha, nil
+	}
+
+	for _, name := range []string{rev, "refs/" + rev, refs.TagsPrefix + rev, refs.HeadsPrefix + rev} {
+		if refSha, err := refs.Read(u.gitFs, name); err == nil {
+			return revlist.Peel(u.gitFs, refSha)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: git upload-pack: ambiguous argument '%s'", ErrInvalidRequest, rev)
+}
+
+// Commits the wants point to, wants which don't lead to a commit have no history
+func (u *UploadPack) wantedCommits(wants []*sha.SHA) ([]*sha.SHA, error) {
+	var commits []*sha.SHA
+
+	for _, want := range wants {
+		target, err := revlist.Peel(u.gitFs, want)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = revlist.ReadCommit(u.gitFs, target); err == nil {
+			commits = append(commits, target)
+		}
+	}
+
+	return commits, nil
+}
+
+// Commits where the history sent to the client is cut, these are the
+// shallow commits the client ends up with
+func (u *UploadPack) shallowBoundary(f *fetchArgs, commits []*sha.SHA) ([]*sha.SHA, error) {
+	switch {
+	case f.depth > 0 && f.deepenRelative:
+		// counted from the current shallow commits, which are at depth 1
+		return revlist.DepthBoundary(u.gitFs, f.shallow, f.depth+1)
+	case f.depth > 0:
+		return revlist.DepthBoundary(u.gitFs, commits, f.depth)
+	case f.deepens():
+		var exclude []*sha.SHA
+
+		for _, rev := range f.deepenNot {
+			revSha, err := u.resolveRev(rev)
+
+			if err != nil {
+				return nil, err
+			}
+
+			exclude = append(exclude, revSha)
+		}
+
+		return revlist.RevBoundary(u.gitFs, commits, f.deepenSince, exclude)
+	}
+
+	// history isn't deepened, it stays cut where the client has it cut
+	return f.shallow, nil
+}
+
+// Writes the shallow-info section when the client's shallow commits
+// change, the new boundary commits are shallow and the client's shallow
+// commits which now have their parents sent are unshallow
+// @see https://git-scm.com/docs/protocol-v2#_fetch
+func (u *UploadPack) writeShallowInfo(f *fetchArgs, commits, boundary []*sha.SHA, pw *pktline.Writer) error {
+	serverShallow, err := shallow.Read(u.gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	if !f.deepens() && len(f.shallow) == 0 && len(serverShallow) == 0 {
+		return nil
+	}
+
+	reachable, err := revlist.Reachable(u.gitFs, commits, boundary)
+
+	if err != nil {
+		return err
+	}
+
+	clientShallow := make(map[string]bool, len(f.shallow))
+
+	for _, commitSha := range f.shallow {
+		clientShallow[commitSha.String()] = true
+	}
+
+	isBoundary := make(map[string]bool, len(boundary))
+	var lines []string
+
+	// shallow commits of this repository are a boundary for every client
+	for _, commitSha := range append(append([]*sha.SHA{}, boundary...), serverShallow...) {
+		if isBoundary[commitSha.String()] || !reachable[commitSha.String()] {
+			continue
+		}
+
+		isBoundary[commitSha.String()] = true
+
+		if !clientShallow[commitSha.String()] {
+			lines = append(lines, "shallow "+commitSha.String())
+		}
+	}
+
+	if f.deepens() {
+		for _, commitSha := range f.shallow {
+			if reachable[commitSha.String()] && !isBoundary[commitSha.String()] {
+				lines = append(lines, "unshallow "+commitSha.String())
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if err = pw.WriteLine("shallow-info"); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if err = pw.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteDelim()
+}
+
+func (u *UploadPack) writePackfile(f *fetchArgs, common []*sha.SHA, pw *pktline.Writer) error {
+	commits, err := u.wantedCommits(f.wants)
+
+	if err != nil {
+		return err
+	}
+
+	boundary, err := u.shallowBoundary(f, commits)
+
+	if err != nil {
+		return err
+	}
+
+	if err = u.writeShallowInfo(f, commits, boundary, pw); err != nil {
+		return err
+	}
+
+	objects, err := revlist.ListObjects(u.gitFs, f.wants, common, revlist.ListOptions{
+		Boundary:      boundary,
+		ClientShallow: f.shallow,
+		Filter:        f.filter,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if f.includeTag {
+		tags, err := u.includedTags(objects)
+
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, tags...)
+	}
+
+	if err = pw.WriteLine("packfile"); err != nil {
+		return err
+	}
+
+	progress := io.Discard
+
+	if !f.noProgress {
+		progress = transport.NewSidebandWriter(pw, transport.SidebandProgress)
+	}
+
+	fmt.Fprintf(progress, "Enumerating objects: %d, done.\n", len(objects))
+
+	if _, err = pack.WriteObjects(transport.NewSidebandWriter(pw, transport.SidebandData), u.gitFs, objects); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(progress, "Total %d (delta 0), reused 0 (delta 0), pack-reused 0\n", len(objects))
+
+	return pw.WriteFlush()
+}
+
+// @see https://git-scm.com/docs/protocol-v2#_fetch
+func (u *UploadPack) fetch(args []string, pw *pktline.Writer) error {
+	f, err := parseFetchArgs(args)
+
+	if err != nil {
+		return err
+	}
+
+	if f.filter != nil && !u.Capabilities().FetchSupports("filter") {
+		pw.WriteLinef("ERR %s: %s", _UploadPackName, ErrFilterNotAllowed)
+		return ErrFilterNotAllowed
+	}
+
+	for _, want := range f.wants {
+		if !object.Exists(want, u.gitFs) {
+			pw.WriteLinef("ERR %s: %s %s", _UploadPackName, ErrNotOurRef, want)
+			return fmt.Errorf("%w: %s", ErrNotOurRef, want)
+		}
+	}
+
+	var common []*sha.SHA
+
+	for _, have := range f.haves {
+		if object.Exists(have, u.gitFs) {
+			common = append(common, have)
+		}
+	}
+
+	if f.done {
+		return u.writePackfile(f, common, pw)
+	}
+
+	ready, err := u.okToGiveUp(f.wants, common)
+
+	if err != nil {
+		return err
+	}
+
+	if err = pw.WriteLine("acknowledgments"); err != nil {
+		return err
+	}
+
+	if len(common) == 0 {
+		pw.WriteLine("NAK")
+	}
+
+	for _, commonSha := range common {
+		pw.WriteLine("ACK " + commonSha.String())
+	}
+
+	if !ready {
+		return pw.WriteFlush()
+	}
+
+	pw.WriteLine("ready")
+	pw.WriteDelim()
+
+	return u.writePackfile(f, common, pw)
+}
@@ -11,6 +11,9 @@ import (
 
 const BYTES_LEN = 20
 const STR_LEN = BYTES_LEN * 2
+
+// Used by git in place of a missing object, ex: old value of a new ref
+const ZERO_STR = "0000000000000000000000000000000000000000"
 const _ObjectsDir string = "objects"
 
 type SHA struct {
@@ -0,0 +1,128 @@
+package shallow
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// File in the git dir listing the shallow commits, one per line.
+// Parents of these commits are not in the repository
+// @see https://git-scm.com/docs/shallow
+const File = "shallow"
+
+// Returns the shallow commits, nil if the repository isn't shallow
+func Read(gitFs fs.FS) ([]*sha.SHA, error) {
+	data, err := fs.ReadFile(gitFs, File)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*sha.SHA
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		commitSha, err := sha.FromString(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, commitSha)
+	}
+
+	return commits, nil
+}
+
+// Returns the shallow commits as a set keyed by the SHA string
+func ReadSet(gitFs fs.FS) (map[string]bool, error) {
+	commits, err := Read(gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(commits))
+
+	for _, commitSha := range commits {
+		set[commitSha.String()] = true
+	}
+
+	return set, nil
+}
+
+// Writes the shallow commits sorted like git, the
+// file is removed when the repository isn't shallow anymore
+func Write(gitDir string, commits []*sha.SHA) error {
+	filePath := path.Join(gitDir, File)
+
+	if len(commits) == 0 {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	lines := make([]string, len(commits))
+
+	for idx, commitSha := range commits {
+		lines[idx] = commitSha.String()
+	}
+
+	sort.Strings(lines)
+
+	// write and rename so that readers never see a partial file
+	lockPath := filePath + ".lock"
+
+	if err := os.WriteFile(lockPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(lockPath, filePath)
+}
+
+// Adds the new shallow commits and removes the unshallowed ones,
+// ex: with the shallow-info sent by the remote after a fetch
+func Update(gitDir string, added, removed []*sha.SHA) error {
+	current, err := ReadSet(os.DirFS(gitDir))
+
+	if err != nil {
+		return err
+	}
+
+	for _, commitSha := range added {
+		current[commitSha.String()] = true
+	}
+
+	for _, commitSha := range removed {
+		delete(current, commitSha.String())
+	}
+
+	commits := make([]*sha.SHA, 0, len(current))
+
+	for commitStr := range current {
+		commitSha, err := sha.FromString(commitStr)
+
+		if err != nil {
+			return err
+		}
+
+		commits = append(commits, commitSha)
+	}
+
+	return Write(gitDir, commits)
+}
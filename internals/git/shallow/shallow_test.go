@@ -0,0 +1,58 @@
+package shallow_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const (
+	_FirstSHA  = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+	_SecondSHA = "f4f3eb879f52ee3b46f67318aa657235d89aebfc"
+)
+
+func TestShallow(t *testing.T) {
+	gitDir := t.TempDir()
+	gitFs := os.DirFS(gitDir)
+
+	first, _ := sha.FromString(_FirstSHA)
+	second, _ := sha.FromString(_SecondSHA)
+
+	if commits, err := shallow.Read(gitFs); err != nil || commits != nil {
+		t.Fatalf("expected no shallow commits but got %v %v", commits, err)
+	}
+
+	if err := shallow.Update(gitDir, []*sha.SHA{second, first}, nil); err != nil {
+		t.Fatalf("Update failed with err %v", err)
+	}
+
+	data, _ := os.ReadFile(path.Join(gitDir, shallow.File))
+
+	testutils.AssertString(t, "file", _FirstSHA+"\n"+_SecondSHA+"\n", string(data))
+
+	if err := shallow.Update(gitDir, nil, []*sha.SHA{first}); err != nil {
+		t.Fatalf("Update failed with err %v", err)
+	}
+
+	set, err := shallow.ReadSet(gitFs)
+
+	if err != nil {
+		t.Fatalf("ReadSet failed with err %v", err)
+	}
+
+	if len(set) != 1 || !set[_SecondSHA] {
+		t.Errorf("expected only the second commit but got %v", set)
+	}
+
+	if err = shallow.Update(gitDir, nil, []*sha.SHA{second}); err != nil {
+		t.Fatalf("Update failed with err %v", err)
+	}
+
+	if _, err = os.Stat(path.Join(gitDir, shallow.File)); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be removed but got %v", err)
+	}
+}
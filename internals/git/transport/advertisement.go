@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Ref name used by empty repositories to send the capabilities
+const _CapabilitiesRef = "capabilities^{}"
+
+const _PeeledSuffix = "^{}"
+
+// Refs and capabilities advertised by protocol v0 and v1,
+// receive-pack always uses these as there is no push in v2
+// @see https://git-scm.com/docs/pack-protocol#_reference_discovery
+type Advertisement struct {
+	Refs         []Ref
+	Capabilities []string
+}
+
+// Returns the value of the capability, ex: agent=git/2.45.0
+func (a *Advertisement) Capability(name string) (string, bool) {
+	for _, capability := range a.Capabilities {
+		key, value, _ := strings.Cut(capability, "=")
+
+		if key == name {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+func (a *Advertisement) Supports(name string) bool {
+	_, ok := a.Capability(name)
+
+	return ok
+}
+
+// symref=HEAD:refs/heads/main
+func (a *Advertisement) applySymrefs() {
+	for _, capability := range a.Capabilities {
+		symref, ok := strings.CutPrefix(capability, "symref=")
+
+		if !ok {
+			continue
+		}
+
+		name, target, _ := strings.Cut(symref, ":")
+
+		for idx := range a.Refs {
+			if a.Refs[idx].Name == name {
+				a.Refs[idx].SymrefTarget = target
+			}
+		}
+	}
+}
+
+// Parses the advertisement till the flush packet, the service header
+// should already be consumed by the caller
+func ParseAdvertisement(r *pktline.Reader) (*Advertisement, error) {
+	pktType, line, err := r.ReadLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// no refs and no capabilities
+	if pktType == pktline.TypeFlush {
+		return &Advertisement{}, nil
+	}
+
+	if pktType != pktline.TypeData {
+		return nil, fmt.Errorf("%w: unexpected %s in ref advertisement", ErrUnexpectedResponse, pktType)
+	}
+
+	return ParseAdvertisementFrom(line, r)
+}
+
+// Same as ParseAdvertisement but the first line is already read
+// by the caller, ex: to check the protocol version of the response
+func ParseAdvertisementFrom(line string, r *pktline.Reader) (*Advertisement, error) {
+	// v1 is same as v0 with the version line at the start
+	if line == "version 1" {
+		return ParseAdvertisement(r)
+	}
+
+	advertisement := &Advertisement{}
+
+	line, capabilities, _ := strings.Cut(line, "\x00")
+
+	advertisement.Capabilities = strings.Fields(capabilities)
+
+	for {
+		if err := advertisement.parseRefLine(line); err != nil {
+			return nil, err
+		}
+
+		pktType, next, err := r.ReadLine()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if pktType == pktline.TypeFlush {
+			advertisement.applySymrefs()
+			return advertisement, nil
+		}
+
+		if pktType != pktline.TypeData {
+			return nil, fmt.Errorf("%w: unexpected %s in ref advertisement", ErrUnexpectedResponse, pktType)
+		}
+
+		line = next
+	}
+}
+
+// <oid> <refname>
+func (a *Advertisement) parseRefLine(line string) error {
+	refShaStr, name, ok := strings.Cut(line, " ")
+
+	if !ok {
+		return fmt.Errorf("%w: invalid ref line %q", ErrUnexpectedResponse, line)
+	}
+
+	refSha, err := sha.FromString(refShaStr)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid ref line %q", ErrUnexpectedResponse, line)
+	}
+
+	switch {
+	case name == _CapabilitiesRef:
+		// empty repository, there are no refs
+	case strings.HasSuffix(name, _PeeledSuffix):
+		last := len(a.Refs) - 1
+
+		if last < 0 || a.Refs[last].Name != strings.TrimSuffix(name, _PeeledSuffix) {
+			return fmt.Errorf("%w: peeled ref without tag %q", ErrUnexpectedResponse, name)
+		}
+
+		a.Refs[last].Peeled = refSha
+	default:
+		a.Refs = append(a.Refs, Ref{Name: name, SHA: refSha})
+	}
+
+	return nil
+}
@@ -0,0 +1,374 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Same as git, haves are sent in growing batches and negotiation is
+// given up after these many haves without any new ACK
+const (
+	_InitialHaves = 16
+	_MaxHaves     = 1024
+	_MaxInVain    = 256
+)
+
+// Supplies the local commits to the remote during negotiation
+type Negotiator interface {
+	// Returns the next commit to send as have, nil when there are none left
+	Next() (*sha.SHA, error)
+	// Called for the haves the remote also has
+	Ack(*sha.SHA)
+}
+
+type FetchRequest struct {
+	Wants []*sha.SHA
+	// nil when there are no local commits, ex: clone
+	Negotiator Negotiator
+	// Ask the remote to send annotated tags pointing to the fetched objects
+	IncludeTag bool
+	// Shallow commits of the repository, the remote doesn't have
+	// to send their parents unless the history is deepened
+	Shallow []*sha.SHA
+	// Limits the history to the commits at most Depth away from the wants,
+	// with DeepenRelative it's counted from the shallow commits instead
+	Depth          int
+	DeepenRelative bool
+	// Limits the history to the commits newer than DeepenSince and
+	// not reachable from the DeepenNot refs
+	DeepenSince time.Time
+	DeepenNot   []string
+	// Filter spec of a partial clone like blob:none, the remote omits
+	// the filtered objects which are fetched later when needed
+	Filter string
+}
+
+// Asks for a shallow history or is made from a shallow repository
+func (req FetchRequest) IsShallow() bool {
+	return len(req.Shallow) != 0 || req.Depth > 0 || !req.DeepenSince.IsZero() || len(req.DeepenNot) != 0
+}
+
+// Changes to the shallow commits sent by the remote in shallow-info
+type ShallowInfo struct {
+	Shallow   []*sha.SHA
+	Unshallow []*sha.SHA
+}
+
+// Reads the shallow-info section till the delim packet
+// @see https://git-scm.com/docs/protocol-v2#_fetch
+func readShallowInfo(r *pktline.Reader, info *ShallowInfo) error {
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return err
+		}
+
+		switch pktType {
+		case pktline.TypeDelim:
+			return nil
+		case pktline.TypeFlush:
+			return fmt.Errorf("%w: response ended without packfile", ErrUnexpectedResponse)
+		}
+
+		name, value, _ := strings.Cut(line, " ")
+
+		commitSha, err := sha.FromString(value)
+
+		if err != nil {
+			return fmt.Errorf("%w: invalid shallow-info %q", ErrUnexpectedResponse, line)
+		}
+
+		switch name {
+		case "shallow":
+			info.Shallow = append(info.Shallow, commitSha)
+		case "unshallow":
+			info.Unshallow = append(info.Unshallow, commitSha)
+		default:
+			return fmt.Errorf("%w: invalid shallow-info %q", ErrUnexpectedResponse, line)
+		}
+	}
+}
+
+// Skips the section till the delim packet
+func skipSection(r *pktline.Reader) error {
+	for {
+		pktType, _, err := r.ReadPacket()
+
+		if err != nil {
+			return err
+		}
+
+		switch pktType {
+		case pktline.TypeDelim:
+			return nil
+		case pktline.TypeFlush:
+			return fmt.Errorf("%w: response ended without packfile", ErrUnexpectedResponse)
+		}
+	}
+}
+
+// Reads the acknowledgments section, packfile follows
+// the section only if the remote is ready
+// @see https://git-scm.com/docs/protocol-v2#_fetch
+func readAcknowledgments(r *pktline.Reader) (acks []*sha.SHA, hasPack bool, err error) {
+	pktType, section, err := r.ReadLine()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if pktType != pktline.TypeData || section != "acknowledgments" {
+		return nil, false, fmt.Errorf("%w: expected acknowledgments but got %q", ErrUnexpectedResponse, section)
+	}
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch pktType {
+		case pktline.TypeFlush:
+			return acks, false, nil
+		case pktline.TypeDelim:
+			return acks, true, nil
+		}
+
+		switch {
+		case line == "NAK", line == "ready":
+		case strings.HasPrefix(line, "ACK "):
+			ackSha, err := sha.FromString(line[len("ACK "):])
+
+			if err != nil {
+				return nil, false, err
+			}
+
+			acks = append(acks, ackSha)
+		default:
+			return nil, false, fmt.Errorf("%w: invalid acknowledgment %q", ErrUnexpectedResponse, line)
+		}
+	}
+}
+
+// Reads the sections till the packfile and demuxes it
+func readPackfile(r *pktline.Reader, packWriter io.Writer, progress io.Writer, info *ShallowInfo) error {
+	for {
+		pktType, section, err := r.ReadLine()
+
+		if err != nil {
+			return err
+		}
+
+		if pktType != pktline.TypeData {
+			return fmt.Errorf("%w: expected section header", ErrUnexpectedResponse)
+		}
+
+		switch section {
+		case "packfile":
+			return demuxSideband(r, packWriter, progress)
+		case "shallow-info":
+			err = readShallowInfo(r, info)
+		default:
+			// wanted-refs and packfile-uris are not requested so can be skipped
+			err = skipSection(r)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Sends a single round of the negotiation with the haves and returns
+// the common commits acked by the remote. hasPack is true if the pack
+// was written to the pack writer, either due to done or the remote being ready
+type fetchRound func(haves []*sha.SHA, done bool) (acks []*sha.SHA, hasPack bool, err error)
+
+// Rounds of the v2 fetch command
+// @see https://git-scm.com/docs/protocol-v2#_fetch
+func v2FetchRound(conn Conn, req FetchRequest, packWriter io.Writer, progress io.Writer, info *ShallowInfo) fetchRound {
+	baseArgs := []string{"ofs-delta"}
+
+	if noProgress(progress) {
+		baseArgs = append(baseArgs, "no-progress")
+	}
+
+	if req.IncludeTag {
+		baseArgs = append(baseArgs, "include-tag")
+	}
+
+	for _, want := range req.Wants {
+		baseArgs = append(baseArgs, fmt.Sprintf("want %s", want))
+	}
+
+	for _, shallowSha := range req.Shallow {
+		baseArgs = append(baseArgs, fmt.Sprintf("shallow %s", shallowSha))
+	}
+
+	if req.Depth > 0 {
+		baseArgs = append(baseArgs, fmt.Sprintf("deepen %d", req.Depth))
+
+		if req.DeepenRelative {
+			baseArgs = append(baseArgs, "deepen-relative")
+		}
+	}
+
+	if !req.DeepenSince.IsZero() {
+		baseArgs = append(baseArgs, fmt.Sprintf("deepen-since %d", req.DeepenSince.Unix()))
+	}
+
+	for _, rev := range req.DeepenNot {
+		baseArgs = append(baseArgs, fmt.Sprintf("deepen-not %s", rev))
+	}
+
+	if req.Filter != "" {
+		baseArgs = append(baseArgs, fmt.Sprintf("filter %s", req.Filter))
+	}
+
+	return func(haves []*sha.SHA, done bool) ([]*sha.SHA, bool, error) {
+		args := append([]string{}, baseArgs...)
+
+		for _, have := range haves {
+			args = append(args, fmt.Sprintf("have %s", have))
+		}
+
+		if done {
+			args = append(args, "done")
+		}
+
+		resp, err := conn.Command(commandRequest(conn.Capabilities(), "fetch", args))
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		defer resp.Close()
+
+		r := pktline.NewReader(resp)
+
+		var acks []*sha.SHA
+
+		hasPack := done
+
+		if !done {
+			if acks, hasPack, err = readAcknowledgments(r); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if !hasPack {
+			return acks, false, nil
+		}
+
+		return acks, true, readPackfile(r, packWriter, progress, info)
+	}
+}
+
+// Fetches the pack containing the wanted objects and writes it to
+// packWriter. The haves are negotiated in multiple rounds, every round
+// resends the common commits found so far as each request is stateless.
+// Remote progress is written to progress if it's not nil. The changes
+// to the shallow commits are returned for the shallow requests
+func Fetch(conn Conn, req FetchRequest, packWriter io.Writer, progress io.Writer) (*ShallowInfo, error) {
+	var round fetchRound
+
+	info := &ShallowInfo{}
+
+	if req.IsShallow() && (conn.Version() == ProtocolV0 || !conn.Capabilities().FetchSupports("shallow")) {
+		return nil, fmt.Errorf("%w: shallow fetch", ErrNotSupported)
+	}
+
+	// same as git, the whole objects are fetched instead
+	if req.Filter != "" && (conn.Version() == ProtocolV0 || !conn.Capabilities().FetchSupports("filter")) {
+		if progress != nil {
+			fmt.Fprintln(progress, "warning: filtering not recognized by server, ignoring")
+		}
+
+		req.Filter = ""
+	}
+
+	if conn.Version() == ProtocolV0 {
+		// haves can't be negotiated statelessly without multi_ack_detailed,
+		// the whole history is fetched instead
+		if !conn.Advertisement().Supports("multi_ack_detailed") {
+			req.Negotiator = nil
+		}
+
+		round = v0FetchRound(conn, req, packWriter, progress)
+	} else {
+		round = v2FetchRound(conn, req, packWriter, progress, info)
+	}
+
+	var common []*sha.SHA
+	isCommon := make(map[string]bool)
+
+	batchSize := _InitialHaves
+	inVain := 0
+	gotAck := false
+
+	for {
+		var haves []*sha.SHA
+
+		done := req.Negotiator == nil
+
+		for !done && len(haves) < batchSize {
+			have, err := req.Negotiator.Next()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if have == nil {
+				done = true
+				break
+			}
+
+			if !isCommon[have.String()] {
+				haves = append(haves, have)
+			}
+		}
+
+		if gotAck && inVain >= _MaxInVain {
+			done = true
+		}
+
+		acks, hasPack, err := round(append(append([]*sha.SHA{}, common...), haves...), done)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hasPack {
+			return info, nil
+		}
+
+		newAcks := 0
+
+		for _, ack := range acks {
+			if isCommon[ack.String()] {
+				continue
+			}
+
+			isCommon[ack.String()] = true
+			common = append(common, ack)
+			req.Negotiator.Ack(ack)
+			newAcks++
+		}
+
+		if newAcks > 0 {
+			gotAck = true
+			inVain = 0
+		} else if gotAck {
+			inVain += len(haves)
+		}
+
+		batchSize = min(batchSize*2, _MaxHaves)
+	}
+}
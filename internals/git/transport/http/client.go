@@ -0,0 +1,162 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/credential"
+)
+
+var ErrAuthFailed = errors.New("authentication failed")
+
+// Sends the requests of a connection to the repository, the credentials
+// are filled when the remote asks for them and reused by the later requests
+type client struct {
+	// url of the repository without the credentials
+	url  string
+	cfg  *config.Config
+	cred *credential.Credential
+	// username and password are known and sent with the requests
+	hasAuth  bool
+	approved bool
+
+	settings   *settings
+	httpClient *http.Client
+	// the initial request may be redirected with http.followRedirects=initial
+	initial bool
+}
+
+// The credentials embedded in the url are used as they are, the
+// username alone is kept and the password is asked for on 401
+func newClient(gitUrl string, cfg *config.Config) (*client, error) {
+	u, err := url.Parse(strings.TrimRight(gitUrl, "/"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := credential.FromURL(u.String())
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.User = nil
+
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
+	c := &client{
+		url:      u.String(),
+		cfg:      cfg,
+		cred:     cred,
+		hasAuth:  cred.Username != "" && cred.Password != "",
+		settings: loadSettings(cfg, gitUrl),
+	}
+
+	c.httpClient, err = newHTTPClient(cfg, gitUrl, c.allowRedirect)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *client) allowRedirect() bool {
+	switch c.settings.followRedirects {
+	case _RedirectAlways:
+		return true
+	case _RedirectInitial:
+		return c.initial
+	}
+
+	return false
+}
+
+// Sends the request, on 401 the credentials are filled and the request
+// is retried once with basic auth. The helpers are told if the credentials
+// worked, so they can store or erase them
+// @see https://git-scm.com/docs/gitcredentials
+func (c *client) do(method, reqUrl string, header http.Header, body []byte) (*http.Response, error) {
+	for {
+		var reqBody io.Reader
+
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequest(method, reqUrl, reqBody)
+
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header = c.settings.header.Clone()
+
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		if c.hasAuth {
+			req.SetBasicAuth(c.cred.Username, c.cred.Password)
+		}
+
+		resp, err := c.send(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			if c.hasAuth && !c.approved && resp.StatusCode == http.StatusOK {
+				c.approved = true
+				credential.Approve(c.cfg, c.cred)
+			}
+
+			return resp, nil
+		}
+
+		resp.Body.Close()
+
+		if c.hasAuth {
+			credential.Reject(c.cfg, c.cred)
+
+			return nil, fmt.Errorf("%w for '%s'", ErrAuthFailed, c.url)
+		}
+
+		if err = credential.Fill(c.cfg, c.cred); err != nil {
+			return nil, err
+		}
+
+		c.hasAuth = true
+	}
+}
+
+// Sends the request watching for the low speed limit if it's set
+func (c *client) send(req *http.Request) (*http.Response, error) {
+	if c.settings.lowSpeedLimit <= 0 || c.settings.lowSpeedTime <= 0 {
+		return c.httpClient.Do(req)
+	}
+
+	monitor, ctx := newLowSpeedMonitor(req.Context(), c.settings.lowSpeedLimit, c.settings.lowSpeedTime)
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+
+	if err != nil {
+		monitor.stop()
+		return nil, monitor.err(err)
+	}
+
+	monitor.ReadCloser = resp.Body
+	resp.Body = monitor
+
+	return resp, nil
+}
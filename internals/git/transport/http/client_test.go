@@ -0,0 +1,114 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/credential"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+const _Capabilities = "000eversion 2\n0013ls-refs=unborn\n0000"
+
+// Serves the v2 capabilities only with the basic auth credentials
+func newAuthServer(t *testing.T, username, password string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var auths []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+
+		auths = append(auths, user+":"+pass)
+
+		if !ok || user != username || pass != password {
+			w.Header().Set("WWW-Authenticate", "Basic realm=\"git\"")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", _UploadPackAdvertisement)
+		w.Write([]byte(_Capabilities))
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, &auths
+}
+
+func TestConnectAuth(t *testing.T) {
+	t.Setenv("GIT_ASKPASS", "")
+	t.Setenv("SSH_ASKPASS", "")
+
+	srv, auths := newAuthServer(t, "user", "secret")
+
+	helper := path.Join(t.TempDir(), "helper")
+
+	os.WriteFile(helper, []byte("#!/bin/sh\necho \"$1\" >> "+helper+".log\ntest \"$1\" = get && echo username=user && echo password=secret\nexit 0\n"), 0755)
+
+	cfg, _ := config.New(strings.NewReader("[credential]\n\thelper = " + helper + "\n"))
+
+	t.Run("retries with the credentials from the helper", func(t *testing.T) {
+		*auths = nil
+
+		conn, err := Connect(srv.URL+"/repo.git", cfg)
+
+		if err != nil {
+			t.Fatalf("Connect failed with err %v", err)
+		}
+
+		if conn.Version() != transport.ProtocolV2 {
+			t.Errorf("expected v2 but got %d", conn.Version())
+		}
+
+		if strings.Join(*auths, ",") != ":,user:secret" {
+			t.Errorf("expected retry with auth but got %v", *auths)
+		}
+
+		data, _ := os.ReadFile(helper + ".log")
+
+		if string(data) != "get\nstore\n" {
+			t.Errorf("expected get and store but got %q", data)
+		}
+	})
+
+	t.Run("sends the credentials of the url", func(t *testing.T) {
+		*auths = nil
+
+		if _, err := Connect(strings.Replace(srv.URL, "http://", "http://user:secret@", 1)+"/repo.git", nil); err != nil {
+			t.Fatalf("Connect failed with err %v", err)
+		}
+
+		if strings.Join(*auths, ",") != "user:secret" {
+			t.Errorf("expected auth on the first request but got %v", *auths)
+		}
+	})
+
+	t.Run("rejects wrong credentials", func(t *testing.T) {
+		os.Remove(helper + ".log")
+
+		_, err := Connect(strings.Replace(srv.URL, "http://", "http://user:wrong@", 1)+"/repo.git", cfg)
+
+		if !errors.Is(err, ErrAuthFailed) {
+			t.Fatalf("expected ErrAuthFailed but got %v", err)
+		}
+
+		data, _ := os.ReadFile(helper + ".log")
+
+		if string(data) != "erase\n" {
+			t.Errorf("expected erase but got %q", data)
+		}
+	})
+
+	t.Run("fails without credentials", func(t *testing.T) {
+		if _, err := Connect(srv.URL+"/repo.git", nil); !errors.Is(err, credential.ErrNoCredentials) {
+			t.Errorf("expected ErrNoCredentials but got %v", err)
+		}
+	})
+}
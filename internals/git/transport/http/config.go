@@ -0,0 +1,294 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/config"
+)
+
+var ErrTooSlow = errors.New("operation too slow")
+var ErrRedirect = errors.New("redirect not allowed")
+
+// Values of http.followRedirects
+const (
+	_RedirectAlways  = "true"
+	_RedirectNever   = "false"
+	_RedirectInitial = "initial"
+)
+
+// git compresses the upload-pack requests larger than this
+const _GzipThreshold = 1024
+
+const _MaxRedirects = 20
+
+// Settings from the http.* config which applies to the url of the remote,
+// the environment variables override the config like in git
+// @see https://git-scm.com/docs/git-config#Documentation/git-config.txt-http
+type settings struct {
+	header          http.Header
+	followRedirects string
+	// requests are aborted when less than lowSpeedLimit bytes
+	// per second are received for lowSpeedTime seconds
+	lowSpeedLimit int
+	lowSpeedTime  int
+}
+
+// Reads the env variable as int, missing or invalid values are ignored
+func envInt(name string, value int) int {
+	if num, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return num
+	}
+
+	return value
+}
+
+func loadSettings(cfg *config.Config, gitUrl string) *settings {
+	s := &settings{
+		header:          http.Header{},
+		followRedirects: _RedirectInitial,
+		lowSpeedLimit:   envInt("GIT_HTTP_LOW_SPEED_LIMIT", cfg.GetIntURL("http.lowSpeedLimit", gitUrl, 0)),
+		lowSpeedTime:    envInt("GIT_HTTP_LOW_SPEED_TIME", cfg.GetIntURL("http.lowSpeedTime", gitUrl, 0)),
+	}
+
+	userAgent := internals.Agent()
+
+	if agent, ok := cfg.GetURL("http.userAgent", gitUrl); ok && agent != "" {
+		userAgent = agent
+	}
+
+	if agent := os.Getenv("GIT_HTTP_USER_AGENT"); agent != "" {
+		userAgent = agent
+	}
+
+	s.header.Set("User-Agent", userAgent)
+
+	for _, header := range cfg.GetAllURL("http.extraHeader", gitUrl) {
+		if name, value, ok := strings.Cut(header, ":"); ok {
+			s.header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	if follow, ok := cfg.GetURL("http.followRedirects", gitUrl); ok {
+		if strings.EqualFold(follow, _RedirectInitial) {
+			s.followRedirects = _RedirectInitial
+		} else if cfg.GetBoolURL("http.followRedirects", gitUrl, true) {
+			s.followRedirects = _RedirectAlways
+		} else {
+			s.followRedirects = _RedirectNever
+		}
+	}
+
+	return s
+}
+
+// Proxy from http.proxy, else from the environment like HTTPS_PROXY
+func proxyFunc(cfg *config.Config, gitUrl string) (func(*http.Request) (*url.URL, error), error) {
+	proxy, ok := cfg.GetURL("http.proxy", gitUrl)
+
+	if !ok || proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	// git accepts the proxy without the scheme
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+
+	proxyUrl, err := url.Parse(proxy)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid http.proxy '%s': %w", proxy, err)
+	}
+
+	return http.ProxyURL(proxyUrl), nil
+}
+
+// TLS config from http.sslVerify, http.sslCAInfo, http.sslCert and http.sslKey
+func tlsConfig(cfg *config.Config, gitUrl string) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: !cfg.GetBoolURL("http.sslVerify", gitUrl, true) || os.Getenv("GIT_SSL_NO_VERIFY") != "",
+	}
+
+	caInfo, _ := cfg.GetURL("http.sslCAInfo", gitUrl)
+
+	if env := os.Getenv("GIT_SSL_CAINFO"); env != "" {
+		caInfo = env
+	}
+
+	if caInfo != "" {
+		pem, err := os.ReadFile(caInfo)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read http.sslCAInfo: %w", err)
+		}
+
+		// same as curl, the bundle replaces the system certificates
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caInfo)
+		}
+
+		tlsCfg.RootCAs = pool
+	}
+
+	certFile, _ := cfg.GetURL("http.sslCert", gitUrl)
+	keyFile, _ := cfg.GetURL("http.sslKey", gitUrl)
+
+	if env := os.Getenv("GIT_SSL_CERT"); env != "" {
+		certFile = env
+	}
+
+	if env := os.Getenv("GIT_SSL_KEY"); env != "" {
+		keyFile = env
+	}
+
+	if certFile != "" {
+		// the key can be in the same file as the certificate
+		if keyFile == "" {
+			keyFile = certFile
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// Creates the http client for the url, the redirects are checked
+// with allowRedirect as the policy depends on the request
+func newHTTPClient(cfg *config.Config, gitUrl string, allowRedirect func() bool) (*http.Client, error) {
+	proxy, err := proxyFunc(cfg, gitUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg, err := tlsConfig(cfg, gitUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = proxy
+	transport.TLSClientConfig = tlsCfg
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !allowRedirect() {
+				return fmt.Errorf("%w: %s", ErrRedirect, req.URL.Redacted())
+			}
+
+			if len(via) >= _MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", _MaxRedirects)
+			}
+
+			return nil
+		},
+	}, nil
+}
+
+// Compresses the request body like git does for the larger fetch requests
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&buf)
+
+	if _, err := gzipWriter.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Cancels the request when the transfer is slower than the limit for
+// the whole window, same as the low speed limit of curl. It watches
+// the wait for the response and the read of the body
+type lowSpeedMonitor struct {
+	io.ReadCloser
+	limit   int
+	window  time.Duration
+	read    atomic.Int64
+	tooSlow atomic.Bool
+	timer   *time.Timer
+	cancel  context.CancelFunc
+}
+
+func newLowSpeedMonitor(ctx context.Context, limit, seconds int) (*lowSpeedMonitor, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	m := &lowSpeedMonitor{
+		limit:  limit,
+		window: time.Duration(seconds) * time.Second,
+		cancel: cancel,
+	}
+
+	m.timer = time.AfterFunc(m.window, m.check)
+
+	return m, ctx
+}
+
+func (m *lowSpeedMonitor) check() {
+	if m.read.Swap(0) < int64(m.limit)*int64(m.window/time.Second) {
+		m.tooSlow.Store(true)
+		m.cancel()
+		return
+	}
+
+	m.timer.Reset(m.window)
+}
+
+func (m *lowSpeedMonitor) err(err error) error {
+	if err != nil && m.tooSlow.Load() {
+		return fmt.Errorf("%w: less than %d bytes/sec transferred the last %d seconds", ErrTooSlow, m.limit, m.window/time.Second)
+	}
+
+	return err
+}
+
+func (m *lowSpeedMonitor) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+
+	m.read.Add(int64(n))
+
+	return n, m.err(err)
+}
+
+func (m *lowSpeedMonitor) stop() {
+	m.timer.Stop()
+	m.cancel()
+}
+
+func (m *lowSpeedMonitor) Close() error {
+	m.stop()
+
+	return m.ReadCloser.Close()
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/config"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func newTestConfig(t *testing.T, content string) *config.Config {
+	t.Helper()
+
+	cfg, err := config.New(strings.NewReader(content))
+
+	if err != nil {
+		t.Fatalf("failed to parse config %v", err)
+	}
+
+	return cfg
+}
+
+// Serves the v2 capabilities on info/refs and echoes the
+// decompressed body of the service requests
+func serveCapabilities(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, _InfoRefsPath) {
+		w.Header().Set("Content-Type", _UploadPackAdvertisement)
+		w.Write([]byte(_Capabilities))
+		return
+	}
+
+	body := r.Body
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		body, _ = gzip.NewReader(r.Body)
+	}
+
+	io.Copy(w, body)
+}
+
+func TestSettings(t *testing.T) {
+	t.Setenv("GIT_HTTP_USER_AGENT", "")
+
+	var requests []*http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		serveCapabilities(w, r)
+	}))
+	defer srv.Close()
+
+	cfg := newTestConfig(t, `[http]
+	extraHeader = X-All: 1
+	userAgent = custom/1.0
+[http "`+srv.URL+`/other.git"]
+	extraHeader = X-Other: 1
+[http "`+srv.URL+`/repo.git"]
+	extraHeader = X-Repo: 1
+`)
+
+	conn, err := Connect(srv.URL+"/repo.git", cfg)
+
+	if err != nil {
+		t.Fatalf("Connect failed with err %v", err)
+	}
+
+	small := []byte("0014command=ls-refs\n0000")
+	large := []byte(strings.Repeat("0032want 1555f0bf3c0caf8147af9efd42cee5842a3c6e00\n", 40))
+
+	for _, reqBody := range [][]byte{small, large} {
+		resp, err := conn.Command(reqBody)
+
+		if err != nil {
+			t.Fatalf("Command failed with err %v", err)
+		}
+
+		body, _ := io.ReadAll(resp)
+		resp.Close()
+
+		testutils.AssertBytes(t, "request body", reqBody, body)
+	}
+
+	for _, req := range requests {
+		testutils.AssertString(t, "User-Agent", "custom/1.0", req.Header.Get("User-Agent"))
+		testutils.AssertString(t, "X-All", "1", req.Header.Get("X-All"))
+		testutils.AssertString(t, "X-Repo", "1", req.Header.Get("X-Repo"))
+		testutils.AssertString(t, "X-Other", "", req.Header.Get("X-Other"))
+	}
+
+	testutils.AssertString(t, "small request encoding", "", requests[1].Header.Get("Content-Encoding"))
+	testutils.AssertString(t, "large request encoding", "gzip", requests[2].Header.Get("Content-Encoding"))
+}
+
+func TestRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if moved, ok := strings.CutPrefix(r.URL.Path, "/old.git"); ok {
+			http.Redirect(w, r, "/new.git"+moved+"?"+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+
+		serveCapabilities(w, r)
+	}))
+	defer srv.Close()
+
+	t.Run("follows the initial request", func(t *testing.T) {
+		conn, err := Connect(srv.URL+"/old.git", nil)
+
+		if err != nil {
+			t.Fatalf("Connect failed with err %v", err)
+		}
+
+		testutils.AssertString(t, "url", srv.URL+"/new.git", conn.(*Conn).client.url)
+	})
+
+	t.Run("not followed with followRedirects false", func(t *testing.T) {
+		cfg := newTestConfig(t, "[http]\n\tfollowRedirects = false\n")
+
+		if _, err := Connect(srv.URL+"/old.git", cfg); !errors.Is(err, ErrRedirect) {
+			t.Errorf("expected ErrRedirect but got %v", err)
+		}
+	})
+
+	t.Run("later requests are not followed by default", func(t *testing.T) {
+		client, _ := newClient(srv.URL+"/old.git", nil)
+
+		if _, err := client.postService(_UploadPackService, _GitProtocolV2, nil); !errors.Is(err, ErrRedirect) {
+			t.Errorf("expected ErrRedirect but got %v", err)
+		}
+
+		client, _ = newClient(srv.URL+"/old.git", newTestConfig(t, "[http]\n\tfollowRedirects = true\n"))
+
+		if _, err := client.postService(_UploadPackService, _GitProtocolV2, nil); err != nil {
+			t.Errorf("expected redirect to be followed but got %v", err)
+		}
+	})
+}
+
+func TestTLS(t *testing.T) {
+	for _, env := range []string{"GIT_SSL_NO_VERIFY", "GIT_SSL_CAINFO", "GIT_SSL_CERT", "GIT_SSL_KEY"} {
+		t.Setenv(env, "")
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(serveCapabilities))
+	defer srv.Close()
+
+	if _, err := Connect(srv.URL+"/repo.git", nil); err == nil {
+		t.Errorf("expected error for the unknown certificate")
+	}
+
+	if _, err := Connect(srv.URL+"/repo.git", newTestConfig(t, "[http \""+srv.URL+"\"]\n\tsslVerify = false\n")); err != nil {
+		t.Errorf("expected sslVerify false to skip the check but got %v", err)
+	}
+
+	caFile := path.Join(t.TempDir(), "ca.pem")
+
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644)
+
+	if _, err := Connect(srv.URL+"/repo.git", newTestConfig(t, "[http]\n\tsslCAInfo = "+caFile+"\n")); err != nil {
+		t.Errorf("expected the certificate from sslCAInfo to be trusted but got %v", err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		serveCapabilities(w, r)
+	}))
+	defer proxy.Close()
+
+	cfg := newTestConfig(t, "[http \"http://example.com\"]\n\tproxy = "+strings.TrimPrefix(proxy.URL, "http://")+"\n")
+
+	if _, err := Connect("http://example.com/repo.git", cfg); err != nil {
+		t.Fatalf("Connect failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "proxied", "http://example.com/repo.git/info/refs?service=git-upload-pack", strings.Join(proxied, ","))
+}
+
+func TestLowSpeedLimit(t *testing.T) {
+	t.Setenv("GIT_HTTP_LOW_SPEED_LIMIT", "")
+	t.Setenv("GIT_HTTP_LOW_SPEED_TIME", "")
+
+	done := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	cfg := newTestConfig(t, "[http]\n\tlowSpeedLimit = 1000\n\tlowSpeedTime = 1\n")
+
+	if _, err := Connect(srv.URL+"/repo.git", cfg); !errors.Is(err, ErrTooSlow) {
+		t.Errorf("expected ErrTooSlow but got %v", err)
+	}
+}
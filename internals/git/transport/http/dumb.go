@@ -0,0 +1,410 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/revlist"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/tree"
+)
+
+var ErrObjectNotFound = errors.New("object not found on remote")
+
+const _PeeledSuffix = "^{}"
+
+// Dumb HTTP connection, the repository files are read from a static
+// file server and the objects are copied one by one or as whole packs
+// @see https://git-scm.com/docs/http-protocol#_dumb_clients
+type DumbConn struct {
+	client        *client
+	advertisement *transport.Advertisement
+	// idx of the remote packs by pack name, nil till objects/info/packs is read
+	packIdx map[string]*pack.PackIndex
+	// objects of the packs downloaded by this connection
+	fromPack map[string]bool
+}
+
+// Returns the file of the repository, found is false if it doesn't exist
+func (c *DumbConn) get(filePath string) (data []byte, found bool, err error) {
+	resp, err := c.client.do(http.MethodGet, fmt.Sprintf("%s/%s", c.client.url, filePath), http.Header{}, nil)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if err = checkStatus(resp, c.client.url); err != nil {
+		return nil, false, err
+	}
+
+	data, err = io.ReadAll(resp.Body)
+
+	return data, true, err
+}
+
+// <oid>\t<refname>, annotated tags are followed by their peeled line
+func parseDumbRefs(r io.Reader) ([]transport.Ref, error) {
+	var refs []transport.Ref
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		refShaStr, name, ok := strings.Cut(scanner.Text(), "\t")
+
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid ref line %q", ErrMalformedResponse, scanner.Text())
+		}
+
+		refSha, err := sha.FromString(refShaStr)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid ref line %q", ErrMalformedResponse, scanner.Text())
+		}
+
+		if tagName, ok := strings.CutSuffix(name, _PeeledSuffix); ok {
+			if len(refs) == 0 || refs[len(refs)-1].Name != tagName {
+				return nil, fmt.Errorf("%w: peeled ref without tag %q", ErrMalformedResponse, name)
+			}
+
+			refs[len(refs)-1].Peeled = refSha
+			continue
+		}
+
+		refs = append(refs, transport.Ref{Name: name, SHA: refSha})
+	}
+
+	return refs, scanner.Err()
+}
+
+// Reads the HEAD file, HEAD is skipped if it points to a missing branch
+func (c *DumbConn) readHead(refs []transport.Ref) (*transport.Ref, error) {
+	data, found, err := c.get("HEAD")
+
+	if err != nil || !found {
+		return nil, err
+	}
+
+	content := strings.TrimSpace(string(data))
+
+	if target, ok := strings.CutPrefix(content, "ref: "); ok {
+		for _, ref := range refs {
+			if ref.Name == target {
+				return &transport.Ref{Name: "HEAD", SHA: ref.SHA, SymrefTarget: target}, nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	headSha, err := sha.FromString(content)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid HEAD %q", ErrMalformedResponse, content)
+	}
+
+	return &transport.Ref{Name: "HEAD", SHA: headSha}, nil
+}
+
+// Reads the refs from the already fetched info/refs and HEAD
+func connectDumb(client *client, infoRefs io.Reader) (*DumbConn, error) {
+	refs, err := parseDumbRefs(infoRefs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &DumbConn{
+		client:   client,
+		fromPack: make(map[string]bool),
+	}
+
+	head, err := c.readHead(refs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if head != nil {
+		refs = append([]transport.Ref{*head}, refs...)
+	}
+
+	c.advertisement = &transport.Advertisement{Refs: refs}
+
+	return c, nil
+}
+
+// The refs are listed like the v0 advertisement without any capabilities
+func (c *DumbConn) Version() int {
+	return transport.ProtocolV0
+}
+
+func (c *DumbConn) Capabilities() *transport.Capability {
+	return nil
+}
+
+func (c *DumbConn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+// There is no git on the other side to send the commands to
+func (c *DumbConn) Command(reqBody []byte) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("%w: dumb http can't run commands", transport.ErrNotSupported)
+}
+
+func (c *DumbConn) Close() error {
+	return nil
+}
+
+// Reads objects/info/packs and the idx of every pack listed there
+func (c *DumbConn) loadPackIdx() error {
+	if c.packIdx != nil {
+		return nil
+	}
+
+	c.packIdx = make(map[string]*pack.PackIndex)
+
+	data, found, err := c.get("objects/info/packs")
+
+	if err != nil || !found {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		packName, ok := strings.CutPrefix(line, "P ")
+
+		if !ok {
+			continue
+		}
+
+		idxData, found, err := c.get(path.Join("objects/pack", strings.TrimSuffix(packName, ".pack")+".idx"))
+
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			continue
+		}
+
+		idx, err := pack.FromIdxBytes(idxData)
+
+		if err != nil {
+			return err
+		}
+
+		c.packIdx[packName] = idx
+	}
+
+	return nil
+}
+
+// Downloads the pack containing the object, stores it
+// and returns the number of objects in it
+func (c *DumbConn) fetchPacked(gitDir string, objSha *sha.SHA, progress io.Writer) (int, error) {
+	if err := c.loadPackIdx(); err != nil {
+		return 0, err
+	}
+
+	for packName, idx := range c.packIdx {
+		if _, ok := idx.GetObjOffset(objSha); !ok {
+			continue
+		}
+
+		fmt.Fprintf(progress, "Downloading %s\n", packName)
+
+		packData, found, err := c.get(path.Join("objects/pack", packName))
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !found {
+			return 0, fmt.Errorf("%w: %s listed in objects/info/packs is missing", ErrObjectNotFound, packName)
+		}
+
+		if _, err = pack.Store(gitDir, packData); err != nil {
+			return 0, err
+		}
+
+		for _, packedSha := range idx.Objects() {
+			c.fromPack[packedSha.String()] = true
+		}
+
+		delete(c.packIdx, packName)
+
+		return len(idx.Objects()), nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrObjectNotFound, objSha)
+}
+
+// Downloads the loose object, packs are tried if it's not present.
+// Returns the number of objects downloaded
+func (c *DumbConn) fetchObject(gitDir string, objSha *sha.SHA, progress io.Writer) (int, error) {
+	objPath, err := objSha.GetObjPath()
+
+	if err != nil {
+		return 0, err
+	}
+
+	data, found, err := c.get(objPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !found {
+		return c.fetchPacked(gitDir, objSha, progress)
+	}
+
+	contents, err := object.Decompress(bytes.NewReader(data))
+
+	if err != nil {
+		return 0, err
+	}
+
+	dataSha, err := sha.FromData(contents)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if !dataSha.Eq(objSha) {
+		return 0, fmt.Errorf("%w: %s has the contents of %s", object.ErrInvalidObj, objSha, dataSha)
+	}
+
+	obj, err := object.FromRaw(contents)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = object.WriteLoose(gitDir, obj); err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// Returns the objects the object points to
+func linkedObjects(gitDir string, objSha *sha.SHA) ([]*sha.SHA, error) {
+	gitFs := os.DirFS(gitDir)
+
+	obj, err := object.FromSHA(objSha, gitFs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch obj.ObjType {
+	case object.CommitObj:
+		c, err := revlist.ReadCommit(gitFs, objSha)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]*sha.SHA{c.Tree}, c.Parents...), nil
+	case object.TreeObj:
+		t, err := tree.FromSHA(objSha, gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var linked []*sha.SHA
+
+		for _, entry := range t.Entries() {
+			// submodule commits are not in this repository
+			if entry.Mode != tree.ModeGitLink {
+				linked = append(linked, entry.SHA)
+			}
+		}
+
+		return linked, nil
+	case object.TagObj:
+		for _, line := range strings.Split(string(*obj.Contents), "\n") {
+			if target, ok := strings.CutPrefix(line, "object "); ok {
+				targetSha, err := sha.FromString(target)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return []*sha.SHA{targetSha}, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%w: tag %s has no object", object.ErrInvalidObj, objSha)
+	}
+
+	return nil, nil
+}
+
+// Walks from the wants and copies the missing objects like git's http
+// walker. Objects already present are assumed to have their history,
+// except the ones which came with a downloaded pack
+func (c *DumbConn) FetchObjects(gitDir string, wants []*sha.SHA, progress io.Writer) error {
+	if progress == nil {
+		progress = io.Discard
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	queue := append([]*sha.SHA{}, wants...)
+	seen := make(map[string]bool)
+	fetched := 0
+
+	for len(queue) > 0 {
+		objSha := queue[0]
+		queue = queue[1:]
+
+		if seen[objSha.String()] {
+			continue
+		}
+
+		seen[objSha.String()] = true
+
+		if object.Exists(objSha, gitFs) {
+			if !c.fromPack[objSha.String()] {
+				continue
+			}
+		} else {
+			count, err := c.fetchObject(gitDir, objSha, progress)
+
+			if err != nil {
+				return err
+			}
+
+			fetched += count
+		}
+
+		linked, err := linkedObjects(gitDir, objSha)
+
+		if err != nil {
+			return err
+		}
+
+		queue = append(queue, linked...)
+	}
+
+	fmt.Fprintf(progress, "Fetched %d objects, done.\n", fetched)
+
+	return nil
+}
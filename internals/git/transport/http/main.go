@@ -1,169 +1,321 @@
 package http
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"strconv"
 	"strings"
 
-	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/transport"
 )
 
-var _Service = []byte("# service=git-upload-pack\n")
+const _Service = "# service=git-upload-pack"
 
-var _Version = []byte("version 2\n")
+const _Version = "version 2"
 
 var ErrMalformedResponse = errors.New("malformed response")
+var ErrRepoNotFound = errors.New("repository not found")
 
-var _FlushPacketBytes = []byte("0000")
-var _DelimPacketBytes = []byte("0001")
+const _UploadPackService = "git-upload-pack"
+const _ReceivePackService = "git-receive-pack"
 
-var _FlushPacket = []byte("flush")
-var _DelimPacket = []byte("delim")
+const _GitProtocolV2 = "version=2"
 
-var _CapabilityAdvResponsePrefix = [][]byte{
-	_Service,
-	_FlushPacket,
-	_Version,
-}
-
-type Capability struct {
-	LsRefs       string
-	Fetch        []string
-	ServerOption string
-	ObjectFormat string
-}
+const _InfoRefsPath = "/info/refs"
 
-var _CapabilityParserMap = map[string]func(args string, c *Capability) error{
-	"agent": func(args string, c *Capability) error {
-		return nil
-	},
-	"ls-refs": func(args string, c *Capability) error {
-		c.LsRefs = args
+const _UploadPackAdvertisement = "application/x-git-upload-pack-advertisement"
 
-		return nil
-	},
-	"fetch": func(args string, c *Capability) error {
-		c.Fetch = strings.Split(args, " ")
+func checkStatus(resp *http.Response, gitUrl string) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrRepoNotFound, gitUrl)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unable to access '%s': the requested URL returned error: %d", gitUrl, resp.StatusCode)
+	}
 
-		return nil
-	},
-	"server-option": func(args string, c *Capability) error {
-		c.ServerOption = args
+	return nil
+}
 
-		return nil
-	},
-	"object-format": func(args string, c *Capability) error {
-		c.ObjectFormat = args
+// Requests the ref discovery of the service, gitProtocol is
+// sent as Git-Protocol header if it's not empty
+func (c *client) infoRefs(service, gitProtocol string) (*http.Response, error) {
+	header := http.Header{}
 
-		return nil
-	},
-}
+	if gitProtocol != "" {
+		header.Set("Git-Protocol", gitProtocol)
+	}
 
-func CapabilityAdvertisement(gitUrl string) (*Capability, error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/info/refs?service=git-upload-pack", gitUrl), nil)
+	c.initial = true
+	resp, err := c.do(http.MethodGet, fmt.Sprintf("%s/info/refs?service=%s", c.url, service), header, nil)
+	c.initial = false
 
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Add("Git-Protocol", "version=2")
-	req.Header.Add("User-Agent", internals.Agent())
-
-	resp, err := http.DefaultClient.Do(req)
+	// later requests go to where the ref discovery was redirected
+	if redirected, ok := strings.CutSuffix(resp.Request.URL.Path, _InfoRefsPath); ok && resp.Request.URL.Host != "" {
+		u := *resp.Request.URL
+		u.Path, u.RawPath, u.RawQuery = redirected, "", ""
+		c.url = u.String()
+	}
 
-	if err != nil {
+	if err = checkStatus(resp, c.url); err != nil {
+		resp.Body.Close()
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-
-	return parseCapabiltyResponse(resp.Body)
+	return resp, nil
 }
 
-func parseCapabiltyResponse(r io.Reader) (*Capability, error) {
-	readOneLine := func() ([]byte, error) {
-		lineLen := make([]byte, 4)
+// Posts the request body to the service and returns the response body
+func (c *client) postService(service, gitProtocol string, reqBody []byte) (io.ReadCloser, error) {
+	header := http.Header{}
+
+	if gitProtocol != "" {
+		header.Set("Git-Protocol", gitProtocol)
+	}
+
+	header.Set("Content-Type", fmt.Sprintf("application/x-%s-request", service))
+	header.Set("Accept", fmt.Sprintf("application/x-%s-result", service))
 
-		_, err := r.Read(lineLen)
+	if service == _UploadPackService && len(reqBody) > _GzipThreshold {
+		compressed, err := gzipBody(reqBody)
 
 		if err != nil {
-			return []byte{}, err
+			return nil, err
 		}
 
-		/**
-		* i want to know better way to handle this behaviour in generic way
-		* other option is throw errors for this, but then reader code would be
-		* cluttered with error checking everytime, idk
-		 */
-		if bytes.Equal(_FlushPacketBytes, lineLen) {
-			return _FlushPacket, nil
-		}
+		reqBody = compressed
+		header.Set("Content-Encoding", "gzip")
+	}
 
-		if bytes.Equal(_DelimPacketBytes, lineLen) {
-			return _DelimPacket, nil
-		}
+	resp, err := c.do(http.MethodPost, fmt.Sprintf("%s/%s", c.url, service), header, reqBody)
 
-		len, err := strconv.ParseInt(string(lineLen), 16, 64)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return []byte{}, err
-		}
+	if err = checkStatus(resp, c.url); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 
-		data := make([]byte, len-4)
+	return resp.Body, nil
+}
 
-		_, err = r.Read(data)
+// Reads the ref discovery of upload-pack, the remote answers with the
+// v2 capabilities if it understands the Git-Protocol header else with
+// the v0 ref advertisement
+// @see https://git-scm.com/docs/http-protocol#_smart_clients
+func parseUploadPackResponse(body io.Reader) (*Conn, error) {
+	r := pktline.NewReader(body)
 
-		if err != nil {
-			return []byte{}, err
+	pktType, line, err := r.ReadLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// git http-backend skips the service header for v2,
+	// other servers send it like they do for v0
+	if pktType == pktline.TypeData && line == _Service {
+		if pktType, _, err = r.ReadLine(); err != nil {
+			return nil, err
 		}
 
-		return data, nil
+		if pktType != pktline.TypeFlush {
+			return nil, ErrMalformedResponse
+		}
+
+		if pktType, line, err = r.ReadLine(); err != nil {
+			return nil, err
+		}
 	}
 
-	for _, prefix := range _CapabilityAdvResponsePrefix {
-		line, err := readOneLine()
+	switch {
+	case pktType == pktline.TypeFlush:
+		// v0 advertisement of an empty repository
+		return &Conn{version: transport.ProtocolV0, advertisement: &transport.Advertisement{}}, nil
+	case pktType != pktline.TypeData:
+		return nil, ErrMalformedResponse
+	case line != _Version:
+		advertisement, err := transport.ParseAdvertisementFrom(line, r)
 
 		if err != nil {
 			return nil, err
 		}
 
-		if !bytes.Equal(prefix, line) {
-			return nil, ErrMalformedResponse
-		}
+		return &Conn{version: transport.ProtocolV0, advertisement: advertisement}, nil
 	}
 
-	var capability Capability
+	var capability transport.Capability
 
 	for {
-		line, err := readOneLine()
+		pktType, line, err := r.ReadLine()
 
 		if err != nil {
 			return nil, err
 		}
 
-		if bytes.Equal(_FlushPacket, line) {
-			return &capability, nil
+		if pktType == pktline.TypeFlush {
+			return &Conn{version: transport.ProtocolV2, capability: &capability}, nil
 		}
 
-		capabiltyLine := strings.Split(strings.TrimRight(string(line), "\n"), "=")
+		capability.ParseLine(line)
+	}
+}
 
-		key := capabiltyLine[0]
-		var value string
+// Checks the media type of the ref discovery, servers and proxies
+// can add parameters like "; charset=utf-8"
+func isUploadPackAdvertisement(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
 
-		if len(capabiltyLine) > 1 {
-			value = capabiltyLine[1]
-		}
+	return err == nil && mediaType == _UploadPackAdvertisement
+}
 
-		parser, ok := _CapabilityParserMap[key]
+// Smart HTTP connection, every command is a POST request
+// @see https://git-scm.com/docs/http-protocol#_smart_service_git_upload_pack
+type Conn struct {
+	client        *client
+	version       int
+	capability    *transport.Capability
+	advertisement *transport.Advertisement
+}
 
-		if !ok {
-			continue
-		}
+// Fetches the ref discovery and returns the connection speaking the
+// protocol version chosen by the remote. Servers which don't run git
+// serve info/refs as a static file, those are read as dumb HTTP.
+// The credential helpers of cfg are used when the remote asks for auth
+func Connect(gitUrl string, cfg *config.Config) (transport.Conn, error) {
+	client, err := newClient(gitUrl, cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.infoRefs(_UploadPackService, _GitProtocolV2)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if !isUploadPackAdvertisement(resp.Header.Get("Content-Type")) {
+		return connectDumb(client, resp.Body)
+	}
 
-		parser(value, &capability)
+	conn, err := parseUploadPackResponse(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.client = client
+
+	return conn, nil
+}
+
+func (c *Conn) Version() int {
+	return c.version
+}
+
+func (c *Conn) Capabilities() *transport.Capability {
+	return c.capability
+}
+
+func (c *Conn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+func (c *Conn) Command(reqBody []byte) (io.ReadCloser, error) {
+	gitProtocol := ""
+
+	if c.version == transport.ProtocolV2 {
+		gitProtocol = _GitProtocolV2
+	}
+
+	return c.client.postService(_UploadPackService, gitProtocol, reqBody)
+}
+
+// Every request is independent, nothing to close
+func (c *Conn) Close() error {
+	return nil
+}
+
+// Reads the service header and the ref advertisement of receive-pack
+func parseReceivePackAdvertisement(body io.Reader) (*transport.Advertisement, error) {
+	r := pktline.NewReader(body)
+
+	pktType, line, err := r.ReadLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pktType != pktline.TypeData || line != "# service="+_ReceivePackService {
+		return nil, ErrMalformedResponse
+	}
+
+	if pktType, _, err = r.ReadLine(); err != nil {
+		return nil, err
 	}
+
+	if pktType != pktline.TypeFlush {
+		return nil, ErrMalformedResponse
+	}
+
+	return transport.ParseAdvertisement(r)
+}
+
+// Smart HTTP connection to git-receive-pack
+// @see https://git-scm.com/docs/http-protocol#_smart_service_git_receive_pack
+type PushConn struct {
+	client        *client
+	advertisement *transport.Advertisement
+}
+
+// Fetches the ref advertisement of receive-pack and returns the connection
+func ConnectPush(gitUrl string, cfg *config.Config) (*PushConn, error) {
+	client, err := newClient(gitUrl, cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.infoRefs(_ReceivePackService, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	advertisement, err := parseReceivePackAdvertisement(resp.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushConn{
+		client:        client,
+		advertisement: advertisement,
+	}, nil
+}
+
+func (c *PushConn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+func (c *PushConn) ReceivePack(reqBody []byte) (io.ReadCloser, error) {
+	return c.client.postService(_ReceivePackService, "", reqBody)
+}
+
+func (c *PushConn) Close() error {
+	return nil
 }
@@ -0,0 +1,129 @@
+package http
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/transport"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestIsUploadPackAdvertisement(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		_UploadPackAdvertisement:                      true,
+		_UploadPackAdvertisement + "; charset=utf-8":  true,
+		"Application/X-Git-Upload-Pack-Advertisement": true,
+		"text/plain":                false,
+		"text/plain; charset=utf-8": false,
+		"":                          false,
+	} {
+		if got := isUploadPackAdvertisement(contentType); got != expected {
+			t.Errorf("expected %v for %q but got %v", expected, contentType, got)
+		}
+	}
+}
+
+func TestParseUploadPackResponse(t *testing.T) {
+	capabilities := "000eversion 2\n0013ls-refs=unborn\n0020fetch=shallow wait-for-done\n0017object-format=sha1\n0000"
+
+	for name, response := range map[string]string{
+		"with service header":    "001e# service=git-upload-pack\n0000" + capabilities,
+		"without service header": capabilities,
+	} {
+		t.Run(name, func(t *testing.T) {
+			conn, err := parseUploadPackResponse(strings.NewReader(response))
+
+			if err != nil {
+				t.Fatalf("failed with err %v", err)
+			}
+
+			if conn.Version() != transport.ProtocolV2 {
+				t.Fatalf("expected v2 but got %d", conn.Version())
+			}
+
+			c := conn.Capabilities()
+
+			testutils.AssertString(t, "ls-refs", "unborn", c.LsRefs)
+			testutils.AssertString(t, "object-format", "sha1", c.ObjectFormat)
+
+			if !c.FetchSupports("wait-for-done") {
+				t.Errorf("expected fetch to support wait-for-done, got %v", c.Fetch)
+			}
+		})
+	}
+
+	refs := []string{
+		"1555f0bf1d2fc4d1f2c8ee0f6b9f6df3ef3e4b32 HEAD\x00multi_ack_detailed no-done side-band-64k ofs-delta symref=HEAD:refs/heads/main agent=git/2.45.0\n",
+		"1555f0bf1d2fc4d1f2c8ee0f6b9f6df3ef3e4b32 refs/heads/main\n",
+	}
+
+	for name, lines := range map[string][]string{
+		"v0": refs,
+		"v1": append([]string{"version 1\n"}, refs...),
+	} {
+		t.Run("falls back to "+name, func(t *testing.T) {
+			var sb strings.Builder
+
+			w := pktline.NewWriter(&sb)
+
+			w.WriteLine("# service=git-upload-pack")
+			w.WriteFlush()
+
+			for _, line := range lines {
+				w.WriteLine(line)
+			}
+
+			w.WriteFlush()
+
+			conn, err := parseUploadPackResponse(strings.NewReader(sb.String()))
+
+			if err != nil {
+				t.Fatalf("failed with err %v", err)
+			}
+
+			if conn.Version() != transport.ProtocolV0 {
+				t.Fatalf("expected v0 but got %d", conn.Version())
+			}
+
+			advertisement := conn.Advertisement()
+
+			if len(advertisement.Refs) != 2 {
+				t.Fatalf("expected 2 refs but got %v", advertisement.Refs)
+			}
+
+			testutils.AssertString(t, "HEAD symref", "refs/heads/main", advertisement.Refs[0].SymrefTarget)
+
+			if !advertisement.Supports("no-done") {
+				t.Errorf("expected no-done capability, got %v", advertisement.Capabilities)
+			}
+		})
+	}
+
+	t.Run("falls back for empty repositories", func(t *testing.T) {
+		conn, err := parseUploadPackResponse(strings.NewReader("001e# service=git-upload-pack\n00000000"))
+
+		if err != nil {
+			t.Fatalf("failed with err %v", err)
+		}
+
+		if conn.Version() != transport.ProtocolV0 || len(conn.Advertisement().Refs) != 0 {
+			t.Errorf("expected empty v0 advertisement but got %+v", conn)
+		}
+	})
+
+	t.Run("fails for invalid responses", func(t *testing.T) {
+		_, err := parseUploadPackResponse(strings.NewReader("000eversion 3\n0000"))
+
+		if !errors.Is(err, transport.ErrUnexpectedResponse) {
+			t.Errorf("expected ErrUnexpectedResponse but got %v", err)
+		}
+
+		_, err = parseUploadPackResponse(strings.NewReader("001e# service=git-upload-pack\n0001"))
+
+		if !errors.Is(err, ErrMalformedResponse) {
+			t.Errorf("expected ErrMalformedResponse but got %v", err)
+		}
+	})
+}
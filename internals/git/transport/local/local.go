@@ -0,0 +1,223 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/uragirii/got/internals/git/server"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/shallow"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+// Runs the service in-process, the response is streamed through a pipe
+// like it would be from a git process on the other end
+func pipe(serve func(req io.Reader, w io.Writer) error, req []byte) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(serve(bytes.NewReader(req), pw))
+	}()
+
+	return pr
+}
+
+// Connection to the upload-pack of a repository on this machine,
+// it speaks protocol v2 like the http transport
+type Conn struct {
+	gitDir     string
+	uploadPack *server.UploadPack
+}
+
+// Connects to the repository at dir, which can be a working tree or a bare repository
+func Connect(dir string) (*Conn, error) {
+	gitDir, err := server.FindGitDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		gitDir:     gitDir,
+		uploadPack: server.NewUploadPack(gitDir),
+	}, nil
+}
+
+func (c *Conn) Version() int {
+	return transport.ProtocolV2
+}
+
+func (c *Conn) Capabilities() *transport.Capability {
+	return c.uploadPack.Capabilities()
+}
+
+func (c *Conn) Advertisement() *transport.Advertisement {
+	return nil
+}
+
+func (c *Conn) Command(req []byte) (io.ReadCloser, error) {
+	return pipe(c.uploadPack.Command, req), nil
+}
+
+func (c *Conn) Close() error {
+	return nil
+}
+
+// Local connection which hard links the objects instead of
+// sending a pack, used by clone from a path like git clone --local
+type LinkConn struct {
+	*Conn
+}
+
+func ConnectLink(dir string) (*LinkConn, error) {
+	conn, err := Connect(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkConn{Conn: conn}, nil
+}
+
+// Hard links the file, it's copied if linking fails like across devices
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil || errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+
+	srcFile, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer srcFile.Close()
+
+	// copied to a temp file and renamed so that readers never see a
+	// partial file, packs are streamed instead of read in memory
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), "tmp_copy_")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = io.Copy(tmpFile, srcFile)
+
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmpFile.Name(), 0444); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), dst)
+}
+
+// Links all the loose objects and packs, wants are not needed
+// as the whole object store is shared
+func (c *LinkConn) FetchObjects(gitDir string, _ []*sha.SHA, progress io.Writer) error {
+	srcObjects := path.Join(c.gitDir, "objects")
+	dstObjects := path.Join(gitDir, "objects")
+
+	linked := 0
+
+	err := filepath.WalkDir(srcObjects, func(srcPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcObjects, srcPath)
+
+		if err != nil {
+			return err
+		}
+
+		// alternates and server info belong to the source repository
+		if relPath == "info" && d.IsDir() {
+			return filepath.SkipDir
+		}
+
+		dstPath := filepath.Join(dstObjects, relPath)
+
+		if d.IsDir() {
+			return os.MkdirAll(dstPath, 0755)
+		}
+
+		linked++
+
+		return linkOrCopy(srcPath, dstPath)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// history of a shallow source is cut at the same commits
+	shallowData, err := os.ReadFile(path.Join(c.gitDir, shallow.File))
+
+	if err == nil {
+		err = os.WriteFile(path.Join(gitDir, shallow.File), shallowData, 0644)
+	}
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if progress != nil {
+		fmt.Fprintf(progress, "Linked %d object files, done.\n", linked)
+	}
+
+	return nil
+}
+
+// Connection to the receive-pack of a repository on this machine
+type PushConn struct {
+	receivePack   *server.ReceivePack
+	advertisement *transport.Advertisement
+}
+
+func ConnectPush(dir string) (*PushConn, error) {
+	gitDir, err := server.FindGitDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	receivePack := server.NewReceivePack(gitDir)
+
+	advertisement, err := receivePack.Advertisement()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushConn{
+		receivePack:   receivePack,
+		advertisement: advertisement,
+	}, nil
+}
+
+func (c *PushConn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+func (c *PushConn) ReceivePack(req []byte) (io.ReadCloser, error) {
+	return pipe(c.receivePack.Serve, req), nil
+}
+
+func (c *PushConn) Close() error {
+	return nil
+}
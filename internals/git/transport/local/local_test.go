@@ -0,0 +1,258 @@
+package local_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uragirii/got/internals/git/config"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/server"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/transport/local"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// Creates a working tree repository with the testdata pack, main is
+// at the tip and feature at its parent
+func setupRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	gitDir := path.Join(dir, ".git")
+
+	testutils.InitTestRepo(t, gitDir)
+
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	refs.Write(gitDir, "refs/heads/feature", parent)
+
+	return dir
+}
+
+type fakeNegotiator struct {
+	haves []*sha.SHA
+}
+
+func (n *fakeNegotiator) Next() (*sha.SHA, error) {
+	if len(n.haves) == 0 {
+		return nil, nil
+	}
+
+	have := n.haves[0]
+	n.haves = n.haves[1:]
+
+	return have, nil
+}
+
+func (n *fakeNegotiator) Ack(*sha.SHA) {}
+
+func packObjectCount(packData []byte) uint32 {
+	return binary.BigEndian.Uint32(packData[8:12])
+}
+
+func TestConn(t *testing.T) {
+	dir := setupRepo(t)
+
+	conn, err := local.Connect(dir)
+
+	if err != nil {
+		t.Fatalf("Connect failed with err %v", err)
+	}
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	t.Run("lists refs", func(t *testing.T) {
+		remoteRefs, err := transport.LsRefs(conn, []string{"HEAD", "refs/heads/"})
+
+		if err != nil {
+			t.Fatalf("LsRefs failed with err %v", err)
+		}
+
+		if len(remoteRefs) != 3 {
+			t.Fatalf("expected 3 refs but got %v", remoteRefs)
+		}
+
+		testutils.AssertString(t, "HEAD", "refs/heads/main", remoteRefs[0].SymrefTarget)
+		testutils.AssertString(t, "feature", testutils.PackParentSHA, remoteRefs[1].SHA.String())
+		testutils.AssertString(t, "main", testutils.PackTipSHA, remoteRefs[2].SHA.String())
+	})
+
+	t.Run("fetches the whole history", func(t *testing.T) {
+		var packData, progress bytes.Buffer
+
+		if _, err := transport.Fetch(conn, transport.FetchRequest{Wants: []*sha.SHA{tip}}, &packData, &progress); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		gitDir := path.Join(t.TempDir(), ".git")
+
+		repository.Init(gitDir, "main")
+
+		if _, err := pack.Store(gitDir, packData.Bytes()); err != nil {
+			t.Fatalf("failed to store fetched pack %v", err)
+		}
+
+		if !object.Exists(tip, os.DirFS(gitDir)) {
+			t.Errorf("expected fetched pack to have the tip")
+		}
+
+		testutils.AssertString(t, "progress", "remote: Enumerating objects: 509, done.\nremote: Total 509 (delta 0), reused 0 (delta 0), pack-reused 0\n", progress.String())
+	})
+
+	t.Run("negotiates the common commits", func(t *testing.T) {
+		var packData bytes.Buffer
+
+		req := transport.FetchRequest{
+			Wants:      []*sha.SHA{tip},
+			Negotiator: &fakeNegotiator{haves: []*sha.SHA{parent}},
+		}
+
+		if _, err := transport.Fetch(conn, req, &packData, nil); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		// same as git rev-list --objects f4f3eb87..1555f0bf
+		if count := packObjectCount(packData.Bytes()); count != 8 {
+			t.Errorf("expected 8 objects in pack but got %d", count)
+		}
+	})
+
+	t.Run("cuts the history at the depth", func(t *testing.T) {
+		var packData bytes.Buffer
+
+		info, err := transport.Fetch(conn, transport.FetchRequest{Wants: []*sha.SHA{tip}, Depth: 1}, &packData, nil)
+
+		if err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		if len(info.Shallow) != 1 || !info.Shallow[0].Eq(tip) || len(info.Unshallow) != 0 {
+			t.Errorf("expected the tip to be shallow but got %v", info)
+		}
+
+		// deepening from the tip sends the parent and unshallows the tip
+		req := transport.FetchRequest{
+			Wants:          []*sha.SHA{tip},
+			Negotiator:     &fakeNegotiator{haves: []*sha.SHA{tip}},
+			Shallow:        []*sha.SHA{tip},
+			Depth:          1,
+			DeepenRelative: true,
+		}
+
+		if info, err = transport.Fetch(conn, req, &packData, nil); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		if len(info.Shallow) != 1 || !info.Shallow[0].Eq(parent) || len(info.Unshallow) != 1 || !info.Unshallow[0].Eq(tip) {
+			t.Errorf("expected the parent to replace the tip but got %v", info)
+		}
+	})
+
+	t.Run("rejects deepen with deepen-since", func(t *testing.T) {
+		req := transport.FetchRequest{Wants: []*sha.SHA{tip}, Depth: 1, DeepenSince: time.Unix(1, 0)}
+
+		if _, err := transport.Fetch(conn, req, io.Discard, nil); err == nil {
+			t.Errorf("expected the request to fail")
+		}
+	})
+
+	t.Run("filters the objects when allowed", func(t *testing.T) {
+		var packData, progress bytes.Buffer
+
+		req := transport.FetchRequest{Wants: []*sha.SHA{tip}, Filter: "tree:0"}
+
+		if _, err := transport.Fetch(conn, req, &packData, &progress); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		if count := packObjectCount(packData.Bytes()); count != 509 {
+			t.Errorf("expected the filter to be ignored but got %d objects", count)
+		}
+
+		if !strings.HasPrefix(progress.String(), "warning: filtering not recognized by server, ignoring\n") {
+			t.Errorf("expected warning but got %q", progress.String())
+		}
+
+		config.Set(path.Join(dir, ".git", config.RepoConfigFile), "uploadpack.allowFilter", "true")
+
+		filteredConn, _ := local.Connect(dir)
+		packData.Reset()
+
+		if _, err := transport.Fetch(filteredConn, req, &packData, nil); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		// same as git rev-list --objects --filter=tree:0 1555f0bf
+		if count := packObjectCount(packData.Bytes()); count != 76 {
+			t.Errorf("expected only the commits but got %d objects", count)
+		}
+	})
+
+	t.Run("fails for missing repository", func(t *testing.T) {
+		if _, err := local.Connect(t.TempDir()); !errors.Is(err, server.ErrNotRepository) {
+			t.Errorf("expected ErrNotRepository but got %v", err)
+		}
+	})
+}
+
+func TestPushConn(t *testing.T) {
+	dir := setupRepo(t)
+	gitDir := path.Join(dir, ".git")
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+	parent, _ := sha.FromString(testutils.PackParentSHA)
+
+	conn, err := local.ConnectPush(dir)
+
+	if err != nil {
+		t.Fatalf("ConnectPush failed with err %v", err)
+	}
+
+	if len(conn.Advertisement().Refs) != 2 || !conn.Advertisement().Supports("delete-refs") {
+		t.Fatalf("unexpected advertisement %+v", conn.Advertisement())
+	}
+
+	writePack := func(w io.Writer) error {
+		_, err := pack.WriteObjects(w, os.DirFS(gitDir), nil)
+		return err
+	}
+
+	report, err := transport.Push(conn, []transport.PushCommand{
+		{Name: "refs/heads/new", New: parent},
+		{Name: "refs/heads/feature", Old: parent},
+		{Name: "refs/heads/main", Old: parent, New: parent},
+		{Name: "refs/heads/stale", Old: parent, New: tip},
+	}, writePack, nil)
+
+	if err != nil {
+		t.Fatalf("Push failed with err %v", err)
+	}
+
+	expected := []string{"", "", "branch is currently checked out", "failed to update ref"}
+
+	for idx, status := range report.Refs {
+		testutils.AssertString(t, status.Name, expected[idx], status.Error)
+	}
+
+	gitFs := os.DirFS(gitDir)
+
+	if newSha, err := refs.Read(gitFs, "refs/heads/new"); err != nil || !newSha.Eq(parent) {
+		t.Errorf("expected new to be created at parent but got %v %v", newSha, err)
+	}
+
+	if _, err := refs.Read(gitFs, "refs/heads/feature"); !errors.Is(err, refs.ErrRefNotFound) {
+		t.Errorf("expected feature to be deleted but got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+var ErrUnpackFailed = errors.New("remote unpack failed")
+
+// Connection to a remote receive-pack, it only speaks protocol v0
+type PushConn interface {
+	// Refs and capabilities advertised by the remote
+	Advertisement() *Advertisement
+	// Sends the update request and returns the response stream,
+	// caller should close the response
+	ReceivePack(req []byte) (io.ReadCloser, error)
+	Close() error
+}
+
+// Updates the ref from Old to New, Old is nil for creating
+// the ref and New is nil for deleting it
+type PushCommand struct {
+	Name string
+	Old  *sha.SHA
+	New  *sha.SHA
+}
+
+func (c PushCommand) IsDelete() bool {
+	return c.New == nil
+}
+
+func shaOrZero(objSha *sha.SHA) string {
+	if objSha == nil {
+		return sha.ZERO_STR
+	}
+
+	return objSha.String()
+}
+
+type RefStatus struct {
+	Name string
+	// Reason the remote didn't update the ref, empty if it was updated
+	Error string
+}
+
+// Status of the commands reported by the remote, the report is
+// empty if the remote doesn't support report-status
+type PushReport struct {
+	Refs []RefStatus
+}
+
+// Capabilities requested from the remote, only the ones it supports are sent
+func pushCapabilities(a *Advertisement, progress io.Writer) []string {
+	var capabilities []string
+
+	for _, capability := range []string{"report-status", "side-band-64k"} {
+		if a.Supports(capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	if noProgress(progress) && a.Supports("quiet") {
+		capabilities = append(capabilities, "quiet")
+	}
+
+	if a.Supports("agent") {
+		capabilities = append(capabilities, "agent="+internals.Agent())
+	}
+
+	return capabilities
+}
+
+// Parses the report-status response
+// @see https://git-scm.com/docs/pack-protocol#_report_status
+func readReport(r *pktline.Reader) (*PushReport, error) {
+	pktType, line, err := r.ReadLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	unpackStatus, ok := strings.CutPrefix(line, "unpack ")
+
+	if pktType != pktline.TypeData || !ok {
+		return nil, fmt.Errorf("%w: expected unpack status but got %q", ErrUnexpectedResponse, line)
+	}
+
+	if unpackStatus != "ok" {
+		return nil, fmt.Errorf("%w: %s", ErrUnpackFailed, unpackStatus)
+	}
+
+	report := &PushReport{}
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if pktType == pktline.TypeFlush {
+			return report, nil
+		}
+
+		status, rest, _ := strings.Cut(line, " ")
+
+		switch status {
+		case "ok":
+			report.Refs = append(report.Refs, RefStatus{Name: rest})
+		case "ng":
+			name, reason, _ := strings.Cut(rest, " ")
+			report.Refs = append(report.Refs, RefStatus{Name: name, Error: reason})
+		default:
+			return nil, fmt.Errorf("%w: invalid ref status %q", ErrUnexpectedResponse, line)
+		}
+	}
+}
+
+// Sends the ref updates followed by the pack written by writePack, the
+// pack is not sent if all the commands are deletes. Remote progress is
+// written to progress if it's not nil
+// @see https://git-scm.com/docs/pack-protocol#_pushing_data_to_a_server
+func Push(conn PushConn, commands []PushCommand, writePack func(io.Writer) error, progress io.Writer) (*PushReport, error) {
+	advertisement := conn.Advertisement()
+
+	onlyDeletes := true
+
+	for _, command := range commands {
+		if command.IsDelete() && !advertisement.Supports("delete-refs") {
+			return nil, fmt.Errorf("%w: deleting %s", ErrNotSupported, command.Name)
+		}
+
+		onlyDeletes = onlyDeletes && command.IsDelete()
+	}
+
+	capabilities := pushCapabilities(advertisement, progress)
+
+	var req bytes.Buffer
+
+	w := pktline.NewWriter(&req)
+
+	for idx, command := range commands {
+		line := fmt.Sprintf("%s %s %s", shaOrZero(command.Old), shaOrZero(command.New), command.Name)
+
+		// capabilities are sent after NUL of the first command
+		if idx == 0 {
+			line += "\x00" + strings.Join(capabilities, " ")
+		}
+
+		if err := w.WriteLine(line); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.WriteFlush(); err != nil {
+		return nil, err
+	}
+
+	if !onlyDeletes {
+		if err := writePack(&req); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := conn.ReceivePack(req.Bytes())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Close()
+
+	if !advertisement.Supports("report-status") {
+		_, err = io.Copy(io.Discard, resp)
+		return &PushReport{}, err
+	}
+
+	r := pktline.NewReader(resp)
+
+	if advertisement.Supports("side-band-64k") {
+		var report bytes.Buffer
+
+		if err = demuxSideband(r, &report, progress); err != nil {
+			return nil, err
+		}
+
+		r = pktline.NewReader(&report)
+	}
+
+	return readReport(r)
+}
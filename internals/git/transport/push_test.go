@@ -0,0 +1,210 @@
+package transport_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/progress"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+const (
+	_OldSHA = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+	_NewSHA = "f4f3eb879f52ee3b46f67318aa657235d89aebfc"
+)
+
+func pktLines(lines ...string) string {
+	var buffer bytes.Buffer
+
+	w := pktline.NewWriter(&buffer)
+
+	for _, line := range lines {
+		if line == "" {
+			w.WriteFlush()
+		} else {
+			w.WriteLine(line)
+		}
+	}
+
+	return buffer.String()
+}
+
+func TestParseAdvertisement(t *testing.T) {
+	t.Run("parses refs, peeled tags and capabilities", func(t *testing.T) {
+		resp := pktLines(
+			_OldSHA+" HEAD\x00report-status delete-refs symref=HEAD:refs/heads/main agent=git/2.45.0",
+			_OldSHA+" refs/heads/main",
+			_NewSHA+" refs/tags/v1",
+			_OldSHA+" refs/tags/v1^{}",
+			"",
+		)
+
+		a, err := transport.ParseAdvertisement(pktline.NewReader(strings.NewReader(resp)))
+
+		if err != nil {
+			t.Fatalf("ParseAdvertisement failed with err %v", err)
+		}
+
+		if len(a.Refs) != 3 {
+			t.Fatalf("expected 3 refs but got %d", len(a.Refs))
+		}
+
+		testutils.AssertString(t, "symref", "refs/heads/main", a.Refs[0].SymrefTarget)
+		testutils.AssertString(t, "tag", _NewSHA, a.Refs[2].SHA.String())
+		testutils.AssertString(t, "peeled", _OldSHA, a.Refs[2].Peeled.String())
+
+		agent, _ := a.Capability("agent")
+
+		testutils.AssertString(t, "agent", "git/2.45.0", agent)
+
+		if !a.Supports("delete-refs") || a.Supports("atomic") {
+			t.Errorf("unexpected capabilities %v", a.Capabilities)
+		}
+	})
+
+	t.Run("parses empty repository", func(t *testing.T) {
+		resp := pktLines("version 1", sha.ZERO_STR+" capabilities^{}\x00report-status", "")
+
+		a, err := transport.ParseAdvertisement(pktline.NewReader(strings.NewReader(resp)))
+
+		if err != nil {
+			t.Fatalf("ParseAdvertisement failed with err %v", err)
+		}
+
+		if len(a.Refs) != 0 || !a.Supports("report-status") {
+			t.Errorf("expected no refs with report-status but got %v %v", a.Refs, a.Capabilities)
+		}
+	})
+}
+
+type fakePushConn struct {
+	advertisement *transport.Advertisement
+	request       []byte
+	response      string
+}
+
+func (c *fakePushConn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+func (c *fakePushConn) ReceivePack(req []byte) (io.ReadCloser, error) {
+	c.request = req
+
+	return io.NopCloser(strings.NewReader(c.response)), nil
+}
+
+func (c *fakePushConn) Close() error {
+	return nil
+}
+
+func sideband(channel byte, data string) string {
+	var buffer bytes.Buffer
+
+	pktline.NewWriter(&buffer).WritePacket(append([]byte{channel}, data...))
+
+	return buffer.String()
+}
+
+func TestPush(t *testing.T) {
+	oldSha, _ := sha.FromString(_OldSHA)
+	newSha, _ := sha.FromString(_NewSHA)
+
+	writePack := func(w io.Writer) error {
+		_, err := io.WriteString(w, "PACK")
+		return err
+	}
+
+	t.Run("sends commands and pack with side-band", func(t *testing.T) {
+		conn := &fakePushConn{
+			advertisement: &transport.Advertisement{Capabilities: []string{"report-status", "side-band-64k", "delete-refs"}},
+			response: sideband(2, "Resolving deltas: done.\n") +
+				sideband(1, pktLines("unpack ok", "ok refs/heads/main", "ng refs/heads/dev pre-receive hook declined", "")) +
+				"0000",
+		}
+
+		var progress bytes.Buffer
+
+		report, err := transport.Push(conn, []transport.PushCommand{
+			{Name: "refs/heads/main", Old: oldSha, New: newSha},
+			{Name: "refs/heads/dev", New: newSha},
+			{Name: "refs/heads/old", Old: oldSha},
+		}, writePack, &progress)
+
+		if err != nil {
+			t.Fatalf("Push failed with err %v", err)
+		}
+
+		expectedReq := pktLines(
+			_OldSHA+" "+_NewSHA+" refs/heads/main\x00report-status side-band-64k",
+			sha.ZERO_STR+" "+_NewSHA+" refs/heads/dev",
+			_OldSHA+" "+sha.ZERO_STR+" refs/heads/old",
+			"",
+		) + "PACK"
+
+		testutils.AssertString(t, "request", expectedReq, string(conn.request))
+		testutils.AssertString(t, "progress", "remote: Resolving deltas: done.\n", progress.String())
+
+		if len(report.Refs) != 2 {
+			t.Fatalf("expected 2 ref statuses but got %v", report.Refs)
+		}
+
+		testutils.AssertString(t, "ok", "", report.Refs[0].Error)
+		testutils.AssertString(t, "ng", "pre-receive hook declined", report.Refs[1].Error)
+	})
+
+	t.Run("asks for quiet but keeps the remote messages", func(t *testing.T) {
+		conn := &fakePushConn{
+			advertisement: &transport.Advertisement{Capabilities: []string{"report-status", "side-band-64k", "quiet"}},
+			response: sideband(2, "warning: large file\n") +
+				sideband(1, pktLines("unpack ok", "ok refs/heads/main", "")) +
+				"0000",
+		}
+
+		var out bytes.Buffer
+
+		if _, err := transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/main", Old: oldSha, New: newSha}}, writePack, progress.Quiet(&out)); err != nil {
+			t.Fatalf("Push failed with err %v", err)
+		}
+
+		if !bytes.Contains(conn.request, []byte("side-band-64k quiet")) {
+			t.Errorf("expected quiet capability but got %q", conn.request)
+		}
+
+		testutils.AssertString(t, "progress", "remote: warning: large file\n", out.String())
+	})
+
+	t.Run("skips the pack for deletes", func(t *testing.T) {
+		conn := &fakePushConn{
+			advertisement: &transport.Advertisement{Capabilities: []string{"report-status", "delete-refs"}},
+			response:      pktLines("unpack ok", "ok refs/heads/old", ""),
+		}
+
+		if _, err := transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/old", Old: oldSha}}, writePack, nil); err != nil {
+			t.Fatalf("Push failed with err %v", err)
+		}
+
+		if bytes.Contains(conn.request, []byte("PACK")) {
+			t.Errorf("expected no pack for deletes but got %q", conn.request)
+		}
+	})
+
+	t.Run("fails for unsupported deletes and unpack errors", func(t *testing.T) {
+		conn := &fakePushConn{advertisement: &transport.Advertisement{Capabilities: []string{"report-status"}}}
+
+		if _, err := transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/old", Old: oldSha}}, writePack, nil); !errors.Is(err, transport.ErrNotSupported) {
+			t.Errorf("expected ErrNotSupported but got %v", err)
+		}
+
+		conn.response = pktLines("unpack index-pack abnormal exit", "ng refs/heads/main unpacker error", "")
+
+		if _, err := transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/main", New: newSha}}, writePack, nil); !errors.Is(err, transport.ErrUnpackFailed) {
+			t.Errorf("expected ErrUnpackFailed but got %v", err)
+		}
+	})
+}
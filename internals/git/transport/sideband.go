@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/progress"
+)
+
+// @see https://git-scm.com/docs/protocol-capabilities#_side_band_side_band_64k
+const (
+	SidebandData     byte = 1
+	SidebandProgress byte = 2
+	SidebandError    byte = 3
+)
+
+// Checks if the remote should be asked not to send the progress,
+// the writer still gets the remote warnings and errors if it's not nil
+func noProgress(w io.Writer) bool {
+	return !progress.Enabled(w)
+}
+
+// Prefixes every line of the progress with "remote: " like git.
+// Progress uses \r to redraw the same line so that is handled too
+type progressWriter struct {
+	w           io.Writer
+	atLineStart bool
+	// the rest of the redrawn line is cleared on a terminal
+	clearLine bool
+}
+
+func newProgressWriter(w io.Writer) *progressWriter {
+	return &progressWriter{
+		w:           w,
+		atLineStart: true,
+		clearLine:   progress.IsTerminal(w),
+	}
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	var sb strings.Builder
+
+	for _, b := range data {
+		if p.atLineStart {
+			sb.WriteString("remote: ")
+			p.atLineStart = false
+		}
+
+		if b == '\n' || b == '\r' {
+			if p.clearLine {
+				sb.WriteString(progress.ClearLine)
+			}
+
+			p.atLineStart = true
+		}
+
+		sb.WriteByte(b)
+	}
+
+	if _, err := io.WriteString(p.w, sb.String()); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Reads the multiplexed packets till flush packet, data is written to
+// the data writer and progress to the progress writer if it's not nil
+func demuxSideband(r *pktline.Reader, data io.Writer, progress io.Writer) error {
+	var progressOut io.Writer = io.Discard
+
+	if progress != nil {
+		progressOut = newProgressWriter(progress)
+	}
+
+	for {
+		pktType, pkt, err := r.ReadPacket()
+
+		if err != nil {
+			return err
+		}
+
+		if pktType == pktline.TypeFlush {
+			return nil
+		}
+
+		if len(pkt) == 0 {
+			return fmt.Errorf("%w: empty sideband packet", ErrUnexpectedResponse)
+		}
+
+		switch pkt[0] {
+		case SidebandData:
+			if _, err = data.Write(pkt[1:]); err != nil {
+				return err
+			}
+		case SidebandProgress:
+			progressOut.Write(pkt[1:])
+		case SidebandError:
+			return fmt.Errorf("%w: %s", ErrRemote, strings.TrimSpace(string(pkt[1:])))
+		default:
+			return fmt.Errorf("%w: invalid sideband channel %d", ErrUnexpectedResponse, pkt[0])
+		}
+	}
+}
+
+// Writes the data as side-band-64k packets of the channel,
+// data larger than a packet is split into multiple packets
+type SidebandWriter struct {
+	w       *pktline.Writer
+	channel byte
+}
+
+func NewSidebandWriter(w *pktline.Writer, channel byte) *SidebandWriter {
+	return &SidebandWriter{
+		w:       w,
+		channel: channel,
+	}
+}
+
+func (s *SidebandWriter) Write(data []byte) (int, error) {
+	// 1 byte of the packet is used by the channel
+	maxLen := pktline.MaxDataLen - 1
+
+	for written := 0; written < len(data); written += maxLen {
+		chunk := data[written:min(written+maxLen, len(data))]
+
+		if err := s.w.WritePacket(append([]byte{s.channel}, chunk...)); err != nil {
+			return written, err
+		}
+	}
+
+	return len(data), nil
+}
@@ -0,0 +1,369 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/transport"
+)
+
+var ErrHungUp = errors.New("the remote end hung up unexpectedly")
+
+const (
+	_UploadPack  = "git-upload-pack"
+	_ReceivePack = "git-receive-pack"
+)
+
+const _DefaultCommand = "ssh"
+
+// Quotes the arg for the remote shell like git does
+func quote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Same as git, the variant is taken from GIT_SSH_VARIANT or guessed from
+// the name of the program as the other variants don't understand -o.
+// The first word of GIT_SSH_COMMAND is the program
+// @see https://git-scm.com/docs/git-config#Documentation/git-config.txt-sshvariant
+func isOpenSSH(program string, useShell bool) bool {
+	if variant := os.Getenv("GIT_SSH_VARIANT"); variant != "" && variant != "auto" {
+		return variant == "ssh"
+	}
+
+	if useShell {
+		fields := strings.Fields(program)
+
+		if len(fields) == 0 {
+			return false
+		}
+
+		program = fields[0]
+	}
+
+	return path.Base(program) == _DefaultCommand
+}
+
+// Returns the command and the args to start the service on the remote,
+// GIT_SSH_COMMAND is run through the shell as it can contain args, GIT_SSH
+// is run as it is. OpenSSH needs SendEnv to pass GIT_PROTOCOL to the remote
+// @see https://git-scm.com/docs/git#Documentation/git.txt-codeGITSSHcode
+func command(endpoint *Endpoint, service string, gitProtocol string) *exec.Cmd {
+	program, useShell := os.Getenv("GIT_SSH_COMMAND"), true
+
+	if program == "" {
+		program, useShell = os.Getenv("GIT_SSH"), false
+	}
+
+	if program == "" {
+		program, useShell = _DefaultCommand, false
+	}
+
+	var args []string
+
+	if gitProtocol != "" && isOpenSSH(program, useShell) {
+		args = append(args, "-o", "SendEnv=GIT_PROTOCOL")
+	}
+
+	if endpoint.Port != "" {
+		args = append(args, "-p", endpoint.Port)
+	}
+
+	args = append(args, endpoint.Host, fmt.Sprintf("%s %s", service, quote(endpoint.Path)))
+
+	var cmd *exec.Cmd
+
+	if useShell {
+		cmd = exec.Command("sh", append([]string{"-c", program + ` "$@"`, program}, args...)...)
+	} else {
+		cmd = exec.Command(program, args...)
+	}
+
+	cmd.Env = os.Environ()
+
+	if gitProtocol != "" {
+		cmd.Env = append(cmd.Env, "GIT_PROTOCOL="+gitProtocol)
+	}
+
+	// ssh asks for the passwords and prints its errors on the terminal
+	cmd.Stderr = os.Stderr
+
+	return cmd
+}
+
+// Running ssh process, the service talks over its stdin and stdout
+type session struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	exited bool
+	err    error
+}
+
+func start(url, service, gitProtocol string) (*session, error) {
+	endpoint, err := ParseURL(url)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := command(endpoint, service, gitProtocol)
+
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot run %s: %w", path.Base(cmd.Path), err)
+	}
+
+	return &session{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// Closes stdin which ends the service and waits for ssh to exit
+func (s *session) close() error {
+	s.stdin.Close()
+
+	if !s.exited {
+		s.exited, s.err = true, s.cmd.Wait()
+	}
+
+	return s.err
+}
+
+// Called when the service stops responding, ssh exiting
+// with an error is more useful than the read error
+func (s *session) hungUp(err error) error {
+	if waitErr := s.close(); waitErr != nil {
+		return fmt.Errorf("%w: %v", ErrHungUp, waitErr)
+	}
+
+	if errors.Is(err, io.EOF) {
+		return ErrHungUp
+	}
+
+	return err
+}
+
+// Connection to git-upload-pack over ssh, the connection is stateful
+// so every command is sent on the same stream. v2 is asked for with
+// GIT_PROTOCOL, sshd drops it unless it has AcceptEnv GIT_PROTOCOL and
+// the remote answers with the v0 advertisement then
+// @see https://git-scm.com/docs/protocol-v2
+type Conn struct {
+	*session
+	version       int
+	capability    *transport.Capability
+	advertisement *transport.Advertisement
+}
+
+// Starts upload-pack on the remote and reads the capability advertisement
+// of v2 or the ref advertisement of v0
+func Connect(url string) (*Conn, error) {
+	s, err := start(url, _UploadPack, "version=2")
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := pktline.NewReader(s.stdout)
+
+	pktType, line, err := r.ReadLine()
+
+	if err != nil {
+		return nil, s.hungUp(err)
+	}
+
+	switch {
+	case pktType == pktline.TypeFlush:
+		// v0 advertisement of an empty repository
+		return &Conn{session: s, version: transport.ProtocolV0, advertisement: &transport.Advertisement{}}, nil
+	case pktType != pktline.TypeData:
+		s.close()
+
+		return nil, fmt.Errorf("%w: unexpected %s in advertisement", transport.ErrUnexpectedResponse, pktType)
+	case line != "version 2":
+		advertisement, err := transport.ParseAdvertisementFrom(line, r)
+
+		if err != nil {
+			return nil, s.hungUp(err)
+		}
+
+		return &Conn{session: s, version: transport.ProtocolV0, advertisement: advertisement}, nil
+	}
+
+	var capability transport.Capability
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return nil, s.hungUp(err)
+		}
+
+		if pktType == pktline.TypeFlush {
+			return &Conn{session: s, version: transport.ProtocolV2, capability: &capability}, nil
+		}
+
+		capability.ParseLine(line)
+	}
+}
+
+func (c *Conn) Version() int {
+	return c.version
+}
+
+func (c *Conn) Capabilities() *transport.Capability {
+	return c.capability
+}
+
+func (c *Conn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+// upload-pack keeps the negotiation state for the whole stream
+func (c *Conn) Stateful() bool {
+	return true
+}
+
+// Writes the request and returns the response, which has to be
+// read completely before sending the next command
+func (c *Conn) Command(req []byte) (io.ReadCloser, error) {
+	if _, err := c.stdin.Write(req); err != nil {
+		return nil, c.hungUp(err)
+	}
+
+	// v0 responses aren't terminated by a flush, the negotiation reads
+	// them till the NAK and the pack till the remote exits
+	if c.version == transport.ProtocolV0 {
+		return io.NopCloser(c.stdout), nil
+	}
+
+	return &response{r: pktline.NewReader(c.stdout)}, nil
+}
+
+// Sends flush to tell the service there are no more commands
+func (c *Conn) Close() error {
+	pktline.NewWriter(c.stdin).WriteFlush()
+
+	return c.close()
+}
+
+// Reads the packets of a single response from the stream, every v2
+// response is terminated by a flush so the packets after it are left
+// for the next command
+type response struct {
+	r    *pktline.Reader
+	buf  bytes.Buffer
+	done bool
+}
+
+func (r *response) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.done {
+		pktType, data, err := r.r.ReadPacket()
+
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		w := pktline.NewWriter(&r.buf)
+
+		switch pktType {
+		case pktline.TypeData:
+			w.WritePacket(data)
+		case pktline.TypeDelim:
+			w.WriteDelim()
+		case pktline.TypeResponseEnd:
+			w.WriteResponseEnd()
+		case pktline.TypeFlush:
+			w.WriteFlush()
+			r.done = true
+		}
+	}
+
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+
+	return r.buf.Read(p)
+}
+
+// Reads the rest of the response so the stream is at the next one
+func (r *response) Close() error {
+	_, err := io.Copy(io.Discard, r)
+
+	return err
+}
+
+// Connection to git-receive-pack over ssh, receive-pack only speaks v0
+// @see https://git-scm.com/docs/pack-protocol#_pushing_data_to_a_server
+type PushConn struct {
+	*session
+	advertisement *transport.Advertisement
+	sent          bool
+}
+
+// Starts receive-pack on the remote and reads the ref advertisement
+func ConnectPush(url string) (*PushConn, error) {
+	s, err := start(url, _ReceivePack, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	advertisement, err := transport.ParseAdvertisement(pktline.NewReader(s.stdout))
+
+	if err != nil {
+		return nil, s.hungUp(err)
+	}
+
+	return &PushConn{session: s, advertisement: advertisement}, nil
+}
+
+func (c *PushConn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+// Writes the commands with the pack, stdin is closed so receive-pack
+// knows the pack ended. The report is read till ssh exits
+func (c *PushConn) ReceivePack(req []byte) (io.ReadCloser, error) {
+	c.sent = true
+
+	if _, err := c.stdin.Write(req); err != nil {
+		return nil, c.hungUp(err)
+	}
+
+	if err := c.stdin.Close(); err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(c.stdout), nil
+}
+
+// Sends flush if nothing was pushed, receive-pack expects the commands
+func (c *PushConn) Close() error {
+	if !c.sent {
+		pktline.NewWriter(c.stdin).WriteFlush()
+	}
+
+	return c.close()
+}
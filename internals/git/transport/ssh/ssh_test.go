@@ -0,0 +1,423 @@
+package ssh_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/server"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	"github.com/uragirii/got/internals/git/transport/ssh"
+	testutils "github.com/uragirii/got/internals/test_utils"
+	"github.com/uragirii/got/testdata"
+)
+
+// Stands in for ssh, the args are logged and the remote command
+// is run by the test binary itself, see TestMain
+const _FakeSSH = `#!/bin/sh
+echo "$@" > "$GOT_FAKE_SSH_LOG"
+# like sshd without AcceptEnv GIT_PROTOCOL
+[ -n "$GOT_FAKE_SSH_DROP_ENV" ] && unset GIT_PROTOCOL
+for last; do :; done
+GOT_FAKE_SSH_COMMAND="$last" exec "$GOT_FAKE_SSH_BINARY"
+`
+
+// Runs the service like it would be on the remote, ex: git-upload-pack '/repo'
+func runFakeRemote(remoteCmd string) error {
+	service, quoted, _ := strings.Cut(remoteCmd, " ")
+
+	dir := strings.ReplaceAll(strings.Trim(quoted, "'"), `'\''`, "'")
+
+	gitDir, err := server.FindGitDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	switch service {
+	case "git-upload-pack":
+		switch os.Getenv("GIT_PROTOCOL") {
+		case "version=2":
+			return server.NewUploadPack(gitDir).ServeStream(os.Stdin, os.Stdout)
+		case "":
+			return serveV0(gitDir, os.Stdin, os.Stdout)
+		}
+
+		return fmt.Errorf("unexpected GIT_PROTOCOL %q", os.Getenv("GIT_PROTOCOL"))
+	case "git-receive-pack":
+		return server.NewReceivePack(gitDir).ServeStream(os.Stdin, os.Stdout)
+	}
+
+	return fmt.Errorf("unknown service %s", service)
+}
+
+// Plays the v0 upload-pack of a remote which dropped GIT_PROTOCOL, the
+// negotiation is stateful so the wants and the haves must not be resent
+func serveV0(gitDir string, r io.Reader, w io.Writer) error {
+	tip, err := refs.Read(os.DirFS(gitDir), "refs/heads/main")
+
+	if err != nil {
+		return err
+	}
+
+	pw := pktline.NewWriter(w)
+
+	pw.WriteLinef("%s HEAD\x00multi_ack_detailed side-band-64k ofs-delta symref=HEAD:refs/heads/main", tip)
+	pw.WriteLinef("%s refs/heads/main", tip)
+	pw.WriteFlush()
+
+	pr := pktline.NewReader(r)
+
+	for wants := 0; ; wants++ {
+		pktType, _, err := pr.ReadLine()
+
+		if err != nil {
+			return err
+		}
+
+		// flush without wants, the client only wanted the refs
+		if pktType == pktline.TypeFlush && wants == 0 {
+			return nil
+		}
+
+		if pktType == pktline.TypeFlush {
+			break
+		}
+	}
+
+	haves := make(map[string]bool)
+	common := ""
+
+	for {
+		pktType, line, err := pr.ReadLine()
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case pktType == pktline.TypeFlush:
+			pw.WriteLine("NAK")
+		case line == "done":
+			if common != "" {
+				pw.WriteLinef("ACK %s", common)
+			} else {
+				pw.WriteLine("NAK")
+			}
+
+			packData, _ := testdata.TestData.ReadFile(testutils.PackFilePath)
+
+			transport.NewSidebandWriter(pw, 1).Write(packData)
+
+			return pw.WriteFlush()
+		case strings.HasPrefix(line, "have "):
+			have := strings.TrimPrefix(line, "have ")
+
+			if haves[have] {
+				return fmt.Errorf("have %s was resent", have)
+			}
+
+			haves[have] = true
+
+			if haveSha, _ := sha.FromString(have); haveSha != nil && object.Exists(haveSha, os.DirFS(gitDir)) {
+				common = have
+				pw.WriteLinef("ACK %s common", have)
+			}
+		default:
+			return fmt.Errorf("unexpected line %q after the wants", line)
+		}
+	}
+}
+
+type fakeNegotiator struct {
+	haves []*sha.SHA
+}
+
+func (n *fakeNegotiator) Next() (*sha.SHA, error) {
+	if len(n.haves) == 0 {
+		return nil, nil
+	}
+
+	have := n.haves[0]
+	n.haves = n.haves[1:]
+
+	return have, nil
+}
+
+func (n *fakeNegotiator) Ack(*sha.SHA) {}
+
+func TestMain(m *testing.M) {
+	if remoteCmd := os.Getenv("GOT_FAKE_SSH_COMMAND"); remoteCmd != "" {
+		if err := runFakeRemote(remoteCmd); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Points GIT_SSH_COMMAND to the fake ssh and returns the file with its args
+func setupFakeSSH(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	// named ssh so that it's taken as OpenSSH
+	script := path.Join(dir, "ssh")
+
+	if err := os.WriteFile(script, []byte(_FakeSSH), 0755); err != nil {
+		t.Fatalf("failed to write fake ssh %v", err)
+	}
+
+	binary, err := os.Executable()
+
+	if err != nil {
+		t.Fatalf("failed to find test binary %v", err)
+	}
+
+	logFile := path.Join(dir, "args")
+
+	t.Setenv("GIT_SSH_COMMAND", script)
+	t.Setenv("GOT_FAKE_SSH_LOG", logFile)
+	t.Setenv("GOT_FAKE_SSH_BINARY", binary)
+
+	return logFile
+}
+
+// Creates a bare repository with the testdata pack and main at the tip
+func setupRepo(t *testing.T) string {
+	t.Helper()
+
+	gitDir := path.Join(t.TempDir(), "repo.git")
+
+	testutils.InitTestRepo(t, gitDir)
+
+	return gitDir
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		port string
+		path string
+	}{
+		{"git@github.com:org/repo.git", "git@github.com", "", "org/repo.git"},
+		{"host:/srv/repo.git", "host", "", "/srv/repo.git"},
+		{"ssh://git@github.com/org/repo.git", "git@github.com", "", "/org/repo.git"},
+		{"ssh://user@host:2222/srv/repo.git", "user@host", "2222", "/srv/repo.git"},
+		{"git+ssh://host/~user/repo.git", "host", "", "~user/repo.git"},
+		{"ssh://[::1]:22/repo.git", "::1", "22", "/repo.git"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			endpoint, err := ssh.ParseURL(test.url)
+
+			if err != nil {
+				t.Fatalf("ParseURL failed with err %v", err)
+			}
+
+			testutils.AssertString(t, "host", test.host, endpoint.Host)
+			testutils.AssertString(t, "port", test.port, endpoint.Port)
+			testutils.AssertString(t, "path", test.path, endpoint.Path)
+		})
+	}
+
+	for _, url := range []string{"ssh://host", "ssh:///repo.git", "host:"} {
+		if _, err := ssh.ParseURL(url); !errors.Is(err, ssh.ErrInvalidURL) {
+			t.Errorf("expected ErrInvalidURL for %s but got %v", url, err)
+		}
+	}
+
+	// would be passed to ssh as options
+	for _, url := range []string{
+		"ssh://-oProxyCommand=sh${IFS}-c${IFS}touch${IFS}pwned/repo",
+		"-oProxyCommand=touch pwned:repo",
+		"ssh://host:-oProxyCommand=cmd/repo",
+		"host:-repo",
+	} {
+		if _, err := ssh.ParseURL(url); !errors.Is(err, ssh.ErrBlocked) {
+			t.Errorf("expected ErrBlocked for %s but got %v", url, err)
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	logFile := setupFakeSSH(t)
+	gitDir := setupRepo(t)
+
+	conn, err := ssh.Connect("ssh://git@example.com:2222" + gitDir)
+
+	if err != nil {
+		t.Fatalf("Connect failed with err %v", err)
+	}
+
+	args, _ := os.ReadFile(logFile)
+
+	testutils.AssertString(t, "ssh args", fmt.Sprintf("-o SendEnv=GIT_PROTOCOL -p 2222 git@example.com git-upload-pack '%s'\n", gitDir), string(args))
+
+	// both commands go over the same connection
+	remoteRefs, err := transport.LsRefs(conn, []string{"refs/heads/"})
+
+	if err != nil {
+		t.Fatalf("LsRefs failed with err %v", err)
+	}
+
+	if len(remoteRefs) != 1 {
+		t.Fatalf("expected 1 ref but got %v", remoteRefs)
+	}
+
+	testutils.AssertString(t, "main", testutils.PackTipSHA, remoteRefs[0].SHA.String())
+
+	var packData bytes.Buffer
+
+	if _, err = transport.Fetch(conn, transport.FetchRequest{Wants: []*sha.SHA{remoteRefs[0].SHA}}, &packData, nil); err != nil {
+		t.Fatalf("Fetch failed with err %v", err)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Errorf("Close failed with err %v", err)
+	}
+
+	cloneDir := path.Join(t.TempDir(), ".git")
+
+	repository.Init(cloneDir, "main")
+
+	if _, err = pack.Store(cloneDir, packData.Bytes()); err != nil {
+		t.Fatalf("failed to store fetched pack %v", err)
+	}
+
+	if !object.Exists(remoteRefs[0].SHA, os.DirFS(cloneDir)) {
+		t.Errorf("expected fetched pack to have the tip")
+	}
+}
+
+func TestConnV0(t *testing.T) {
+	logFile := setupFakeSSH(t)
+	gitDir := setupRepo(t)
+
+	t.Setenv("GOT_FAKE_SSH_DROP_ENV", "1")
+
+	conn, err := ssh.Connect("git@example.com:" + gitDir)
+
+	if err != nil {
+		t.Fatalf("Connect failed with err %v", err)
+	}
+
+	if conn.Version() != transport.ProtocolV0 {
+		t.Fatalf("expected v0 but got %d", conn.Version())
+	}
+
+	remoteRefs, err := transport.LsRefs(conn, []string{"HEAD"})
+
+	if err != nil {
+		t.Fatalf("LsRefs failed with err %v", err)
+	}
+
+	if len(remoteRefs) != 1 || remoteRefs[0].SymrefTarget != "refs/heads/main" {
+		t.Fatalf("expected HEAD pointing to main but got %+v", remoteRefs)
+	}
+
+	tip := remoteRefs[0].SHA
+
+	// more than a batch of haves so that it takes multiple rounds, the
+	// remote fails if the wants or the common tip are resent
+	haves := []*sha.SHA{tip}
+
+	for len(haves) < 20 {
+		missing, _ := sha.FromString(fmt.Sprintf("%040x", len(haves)))
+		haves = append(haves, missing)
+	}
+
+	negotiator := &fakeNegotiator{haves: haves}
+
+	var packData bytes.Buffer
+
+	if _, err = transport.Fetch(conn, transport.FetchRequest{Wants: []*sha.SHA{tip}, Negotiator: negotiator}, &packData, nil); err != nil {
+		t.Fatalf("Fetch failed with err %v", err)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Errorf("Close failed with err %v", err)
+	}
+
+	if !bytes.HasPrefix(packData.Bytes(), []byte("PACK")) {
+		t.Errorf("expected the pack but got %d bytes", packData.Len())
+	}
+
+	t.Run("sends GIT_PROTOCOL only with OpenSSH", func(t *testing.T) {
+		t.Setenv("GIT_SSH_VARIANT", "simple")
+
+		conn, err := ssh.Connect("git@example.com:" + gitDir)
+
+		if err != nil {
+			t.Fatalf("Connect failed with err %v", err)
+		}
+
+		conn.Close()
+
+		args, _ := os.ReadFile(logFile)
+
+		testutils.AssertString(t, "ssh args", fmt.Sprintf("git@example.com git-upload-pack '%s'\n", gitDir), string(args))
+	})
+}
+
+func TestPushConn(t *testing.T) {
+	logFile := setupFakeSSH(t)
+	gitDir := setupRepo(t)
+
+	conn, err := ssh.ConnectPush("git@example.com:" + gitDir)
+
+	if err != nil {
+		t.Fatalf("ConnectPush failed with err %v", err)
+	}
+
+	args, _ := os.ReadFile(logFile)
+
+	testutils.AssertString(t, "ssh args", fmt.Sprintf("git@example.com git-receive-pack '%s'\n", gitDir), string(args))
+
+	tip, _ := sha.FromString(testutils.PackTipSHA)
+
+	writePack := func(w io.Writer) error {
+		_, err := pack.WriteObjects(w, os.DirFS(gitDir), nil)
+		return err
+	}
+
+	report, err := transport.Push(conn, []transport.PushCommand{{Name: "refs/heads/feature", New: tip}}, writePack, nil)
+
+	if err != nil {
+		t.Fatalf("Push failed with err %v", err)
+	}
+
+	if err = conn.Close(); err != nil {
+		t.Errorf("Close failed with err %v", err)
+	}
+
+	testutils.AssertString(t, "status", "", report.Refs[0].Error)
+
+	if featureSha, err := refs.Read(os.DirFS(gitDir), "refs/heads/feature"); err != nil || !featureSha.Eq(tip) {
+		t.Errorf("expected feature to be created at tip but got %v %v", featureSha, err)
+	}
+}
+
+func TestConnectHungUp(t *testing.T) {
+	t.Setenv("GIT_SSH_COMMAND", "exit 255;")
+
+	if _, err := ssh.Connect("git@example.com:repo.git"); !errors.Is(err, ssh.ErrHungUp) {
+		t.Errorf("expected ErrHungUp but got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidURL = errors.New("invalid ssh url")
+var ErrBlocked = errors.New("blocked")
+
+var _Schemes = []string{"ssh://", "git+ssh://", "ssh+git://"}
+
+// Host and the repository path of an ssh remote
+type Endpoint struct {
+	// Host with the user if any, ex: git@github.com
+	Host string
+	// Empty for the default port
+	Port string
+	Path string
+}
+
+// Returns true for the ssh:// urls and the scp-like [user@]host:path,
+// the caller should check for local paths first
+func IsURL(url string) bool {
+	for _, scheme := range _Schemes {
+		if strings.HasPrefix(url, scheme) {
+			return true
+		}
+	}
+
+	return !strings.Contains(url, "://") && strings.Contains(url, ":")
+}
+
+// Parses ssh://[user@]host[:port]/path and the scp-like [user@]host:path,
+// same as git "/~user/path" in urls is relative to the home of the user
+// @see https://git-scm.com/docs/git-clone#_git_urls
+func ParseURL(url string) (*Endpoint, error) {
+	for _, scheme := range _Schemes {
+		rest, ok := strings.CutPrefix(url, scheme)
+
+		if !ok {
+			continue
+		}
+
+		host, path, ok := strings.Cut(rest, "/")
+
+		if !ok || host == "" || path == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidURL, url)
+		}
+
+		endpoint := &Endpoint{Host: host, Path: "/" + path}
+
+		if strings.HasPrefix(path, "~") {
+			endpoint.Path = path
+		}
+
+		// [::1] style hosts have colons inside the brackets
+		if colon := strings.LastIndex(host, ":"); colon > strings.LastIndex(host, "]") {
+			endpoint.Host, endpoint.Port = host[:colon], host[colon+1:]
+		}
+
+		endpoint.Host = strings.NewReplacer("[", "", "]", "").Replace(endpoint.Host)
+
+		if endpoint.Host == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidURL, url)
+		}
+
+		if err := checkEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+
+		return endpoint, nil
+	}
+
+	host, path, ok := strings.Cut(url, ":")
+
+	if !ok || host == "" || path == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, url)
+	}
+
+	endpoint := &Endpoint{Host: host, Path: path}
+
+	if err := checkEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+// Same as git, the host, port and path are passed as args to ssh so
+// the ones which look like an option are blocked, otherwise a url
+// like ssh://-oProxyCommand=cmd/repo would run the command
+func checkEndpoint(endpoint *Endpoint) error {
+	for _, part := range []struct{ name, value string }{
+		{"hostname", endpoint.Host},
+		{"port", endpoint.Port},
+		{"pathname", endpoint.Path},
+	} {
+		if strings.HasPrefix(part.value, "-") {
+			return fmt.Errorf("strange %s '%s' %w", part.name, part.value, ErrBlocked)
+		}
+	}
+
+	return nil
+}
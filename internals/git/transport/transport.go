@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+var ErrUnexpectedResponse = errors.New("unexpected response from remote")
+var ErrRemote = pktline.ErrRemote
+var ErrNotSupported = errors.New("not supported by remote")
+
+type Ref struct {
+	Name string
+	SHA  *sha.SHA
+	// Set for symbolic refs, ex: refs/heads/main for HEAD
+	SymrefTarget string
+	// Object the annotated tag points to
+	Peeled *sha.SHA
+}
+
+// Capabilities advertised by the server for protocol v2
+// @see https://git-scm.com/docs/protocol-v2#_capabilities
+type Capability struct {
+	Agent        string
+	LsRefs       string
+	Fetch        []string
+	ServerOption string
+	ObjectFormat string
+}
+
+var _CapabilityParserMap = map[string]func(args string, c *Capability){
+	"agent": func(args string, c *Capability) {
+		c.Agent = args
+	},
+	"ls-refs": func(args string, c *Capability) {
+		c.LsRefs = args
+	},
+	"fetch": func(args string, c *Capability) {
+		c.Fetch = strings.Split(args, " ")
+	},
+	"server-option": func(args string, c *Capability) {
+		c.ServerOption = args
+	},
+	"object-format": func(args string, c *Capability) {
+		c.ObjectFormat = args
+	},
+}
+
+// Parses a single capability line like fetch=shallow wait-for-done,
+// unknown capabilities are ignored
+func (c *Capability) ParseLine(line string) {
+	key, value, _ := strings.Cut(line, "=")
+
+	parser, ok := _CapabilityParserMap[key]
+
+	if !ok {
+		return
+	}
+
+	parser(value, c)
+}
+
+// Returns true if the fetch command supports the feature, ex: sideband-all
+func (c *Capability) FetchSupports(feature string) bool {
+	for _, f := range c.Fetch {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Protocol versions of upload-pack, v1 is handled as v0
+// as it only adds the version line to the advertisement
+const (
+	ProtocolV0 = 0
+	ProtocolV2 = 2
+)
+
+// Connection to the upload-pack of a remote, the protocol
+// version is chosen by what the remote answers with
+type Conn interface {
+	// ProtocolV2 or ProtocolV0
+	Version() int
+	// Capabilities advertised by v2, nil for v0
+	Capabilities() *Capability
+	// Refs and capabilities advertised by v0, nil for v2
+	Advertisement() *Advertisement
+	// Sends the command request for v2 or the upload-pack request for
+	// v0 and returns the response stream, caller should close the response
+	Command(req []byte) (io.ReadCloser, error)
+	Close() error
+}
+
+// Implemented by the connections over a single stream which keep the
+// state of the v0 negotiation between the requests, ex: ssh. The wants
+// and the haves are sent only once instead of with every request
+// @see https://git-scm.com/docs/pack-protocol#_packfile_negotiation
+type StatefulConn interface {
+	Stateful() bool
+}
+
+// Implemented by connections which can't send a pack and copy
+// the objects into the repository themselves, ex: dumb HTTP
+type ObjectFetcher interface {
+	// Copies the objects reachable from the wants which are missing in the repository
+	FetchObjects(gitDir string, wants []*sha.SHA, progress io.Writer) error
+}
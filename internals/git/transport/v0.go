@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Returns the advertised refs matching any of the prefixes like
+// ls-refs would, v0 always advertises all the refs
+func filterRefs(refs []Ref, prefixes []string) []Ref {
+	if len(prefixes) == 0 {
+		return append([]Ref{}, refs...)
+	}
+
+	var filtered []Ref
+
+	for _, ref := range refs {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref.Name, prefix) {
+				filtered = append(filtered, ref)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// Capabilities sent with the first want, only the
+// ones advertised by the remote are requested
+func v0FetchCapabilities(advertisement *Advertisement, req FetchRequest, progress io.Writer) []string {
+	var capabilities []string
+
+	for _, capability := range []string{"multi_ack_detailed", "no-done", "ofs-delta"} {
+		if advertisement.Supports(capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	switch {
+	case advertisement.Supports("side-band-64k"):
+		capabilities = append(capabilities, "side-band-64k")
+	case advertisement.Supports("side-band"):
+		capabilities = append(capabilities, "side-band")
+	}
+
+	if req.IncludeTag && advertisement.Supports("include-tag") {
+		capabilities = append(capabilities, "include-tag")
+	}
+
+	if noProgress(progress) && advertisement.Supports("no-progress") {
+		capabilities = append(capabilities, "no-progress")
+	}
+
+	return append(capabilities, fmt.Sprintf("agent=%s", internals.Agent()))
+}
+
+// Reads the ACK and NAK lines of a round. The round ends at the NAK
+// sent for the flush unless it's done, where the pack follows the
+// final ACK or NAK, or it's ready and no-done was requested, where
+// the final ACK follows the NAK
+// @see https://git-scm.com/docs/pack-protocol#_packfile_negotiation
+func readV0Acks(r *pktline.Reader, done bool, noDone bool) (acks []*sha.SHA, ready bool, hasPack bool, err error) {
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if !done && errors.Is(err, io.EOF) {
+			return acks, ready, false, nil
+		}
+
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		if pktType != pktline.TypeData {
+			return nil, false, false, fmt.Errorf("%w: unexpected %s packet in negotiation", ErrUnexpectedResponse, pktType)
+		}
+
+		if line == "NAK" {
+			if done {
+				return acks, ready, true, nil
+			}
+
+			if !ready || !noDone {
+				return acks, ready, false, nil
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 || len(fields) > 3 || fields[0] != "ACK" {
+			return nil, false, false, fmt.Errorf("%w: invalid acknowledgment %q", ErrUnexpectedResponse, line)
+		}
+
+		ackSha, err := sha.FromString(fields[1])
+
+		if err != nil {
+			return nil, false, false, err
+		}
+
+		// final ACK, the pack follows
+		if len(fields) == 2 {
+			return acks, ready, true, nil
+		}
+
+		switch fields[2] {
+		case "common":
+			acks = append(acks, ackSha)
+		case "ready":
+			ready = true
+		case "continue":
+		default:
+			return nil, false, false, fmt.Errorf("%w: invalid acknowledgment %q", ErrUnexpectedResponse, line)
+		}
+	}
+}
+
+// Rounds of the v0 upload-pack negotiation. Over a stateless connection
+// every request resends the wants followed by the haves, a stateful one
+// only sends the haves which weren't sent yet
+// @see https://git-scm.com/docs/http-protocol#_smart_service_git_upload_pack
+func v0FetchRound(conn Conn, req FetchRequest, packWriter io.Writer, progress io.Writer) fetchRound {
+	advertisement := conn.Advertisement()
+
+	capabilities := v0FetchCapabilities(advertisement, req, progress)
+	useSideband := advertisement.Supports("side-band-64k") || advertisement.Supports("side-band")
+	noDone := advertisement.Supports("no-done")
+
+	stateful := false
+
+	if statefulConn, ok := conn.(StatefulConn); ok {
+		stateful = statefulConn.Stateful()
+	}
+
+	sentWants := false
+	sentHaves := make(map[string]bool)
+
+	var round fetchRound
+
+	round = func(haves []*sha.SHA, done bool) ([]*sha.SHA, bool, error) {
+		var buffer bytes.Buffer
+
+		w := pktline.NewWriter(&buffer)
+
+		if !stateful || !sentWants {
+			for idx, want := range req.Wants {
+				if idx == 0 {
+					w.WriteLinef("want %s %s", want, strings.Join(capabilities, " "))
+				} else {
+					w.WriteLinef("want %s", want)
+				}
+			}
+
+			w.WriteFlush()
+
+			sentWants = true
+		}
+
+		for _, have := range haves {
+			if stateful && sentHaves[have.String()] {
+				continue
+			}
+
+			sentHaves[have.String()] = true
+
+			w.WriteLinef("have %s", have)
+		}
+
+		if done {
+			w.WriteLine("done")
+		} else {
+			w.WriteFlush()
+		}
+
+		resp, err := conn.Command(buffer.Bytes())
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		defer resp.Close()
+
+		r := pktline.NewReader(resp)
+
+		acks, ready, hasPack, err := readV0Acks(r, done, noDone)
+
+		if err != nil {
+			return nil, false, err
+		}
+
+		// without no-done the remote waits for done even when it's ready
+		if ready && !hasPack && !noDone {
+			return round(haves, true)
+		}
+
+		if !hasPack {
+			return acks, false, nil
+		}
+
+		if useSideband {
+			return acks, true, demuxSideband(r, packWriter, progress)
+		}
+
+		_, err = io.Copy(packWriter, resp)
+
+		return acks, true, err
+	}
+
+	return round
+}
@@ -0,0 +1,167 @@
+package transport_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/transport"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+// v0 upload-pack connection replying with the responses in order
+type fakeV0Conn struct {
+	advertisement *transport.Advertisement
+	requests      []string
+	responses     []string
+}
+
+func (c *fakeV0Conn) Version() int {
+	return transport.ProtocolV0
+}
+
+func (c *fakeV0Conn) Capabilities() *transport.Capability {
+	return nil
+}
+
+func (c *fakeV0Conn) Advertisement() *transport.Advertisement {
+	return c.advertisement
+}
+
+func (c *fakeV0Conn) Command(req []byte) (io.ReadCloser, error) {
+	c.requests = append(c.requests, string(req))
+
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+
+	return io.NopCloser(strings.NewReader(resp)), nil
+}
+
+func (c *fakeV0Conn) Close() error {
+	return nil
+}
+
+type fakeNegotiator struct {
+	haves []*sha.SHA
+	acked []string
+}
+
+func (n *fakeNegotiator) Next() (*sha.SHA, error) {
+	if len(n.haves) == 0 {
+		return nil, nil
+	}
+
+	have := n.haves[0]
+	n.haves = n.haves[1:]
+
+	return have, nil
+}
+
+func (n *fakeNegotiator) Ack(ackSha *sha.SHA) {
+	n.acked = append(n.acked, ackSha.String())
+}
+
+func TestLsRefsV0(t *testing.T) {
+	oldSha, _ := sha.FromString(_OldSHA)
+
+	conn := &fakeV0Conn{advertisement: &transport.Advertisement{Refs: []transport.Ref{
+		{Name: "HEAD", SHA: oldSha},
+		{Name: "refs/heads/main", SHA: oldSha},
+		{Name: "refs/pull/1/head", SHA: oldSha},
+		{Name: "refs/tags/v1", SHA: oldSha},
+	}}}
+
+	refs, err := transport.LsRefs(conn, []string{"HEAD", "refs/heads/", "refs/tags/"})
+
+	if err != nil {
+		t.Fatalf("LsRefs failed with err %v", err)
+	}
+
+	var names []string
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+
+	testutils.AssertString(t, "refs", "HEAD refs/heads/main refs/tags/v1", strings.Join(names, " "))
+
+	if len(conn.requests) != 0 {
+		t.Errorf("expected refs from the advertisement but got requests %v", conn.requests)
+	}
+}
+
+func TestFetchV0(t *testing.T) {
+	oldSha, _ := sha.FromString(_OldSHA)
+	newSha, _ := sha.FromString(_NewSHA)
+
+	// a full batch of haves so that the first round isn't done
+	haves := []*sha.SHA{oldSha}
+	haveLines := []string{"have " + _OldSHA}
+
+	for len(haves) < 16 {
+		haves = append(haves, newSha)
+		haveLines = append(haveLines, "have "+_NewSHA)
+	}
+
+	wants := pktLines(
+		fmt.Sprintf("want %s multi_ack_detailed no-done ofs-delta side-band-64k agent=%s", _NewSHA, internals.Agent()),
+		"",
+	)
+
+	t.Run("negotiates with multi_ack_detailed and no-done", func(t *testing.T) {
+		conn := &fakeV0Conn{
+			advertisement: &transport.Advertisement{Capabilities: []string{"multi_ack_detailed", "no-done", "side-band-64k", "ofs-delta", "thin-pack"}},
+			responses: []string{
+				pktLines("ACK "+_OldSHA+" common", "ACK "+_OldSHA+" ready", "NAK", "ACK "+_OldSHA) +
+					sideband(2, "Total 1\n") + sideband(1, "PACK") + "0000",
+			},
+		}
+
+		negotiator := &fakeNegotiator{haves: haves}
+
+		var packData, progress bytes.Buffer
+
+		if _, err := transport.Fetch(conn, transport.FetchRequest{Wants: []*sha.SHA{newSha}, Negotiator: negotiator}, &packData, &progress); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		if len(conn.requests) != 1 {
+			t.Fatalf("expected a single request but got %q", conn.requests)
+		}
+
+		testutils.AssertString(t, "request", wants+pktLines(append(haveLines, "")...), conn.requests[0])
+		testutils.AssertString(t, "pack", "PACK", packData.String())
+		testutils.AssertString(t, "progress", "remote: Total 1\n", progress.String())
+	})
+
+	t.Run("sends done when remote is ready without no-done", func(t *testing.T) {
+		conn := &fakeV0Conn{
+			advertisement: &transport.Advertisement{Capabilities: []string{"multi_ack_detailed"}},
+			responses: []string{
+				pktLines("ACK "+_OldSHA+" common", "ACK "+_OldSHA+" ready", "NAK"),
+				pktLines("ACK "+_OldSHA+" common", "ACK "+_OldSHA) + "PACK",
+			},
+		}
+
+		var packData bytes.Buffer
+
+		req := transport.FetchRequest{Wants: []*sha.SHA{newSha}, Negotiator: &fakeNegotiator{haves: haves}}
+
+		if _, err := transport.Fetch(conn, req, &packData, nil); err != nil {
+			t.Fatalf("Fetch failed with err %v", err)
+		}
+
+		wants := pktLines(fmt.Sprintf("want %s multi_ack_detailed agent=%s", _NewSHA, internals.Agent()), "")
+
+		if len(conn.requests) != 2 {
+			t.Fatalf("expected 2 requests but got %q", conn.requests)
+		}
+
+		testutils.AssertString(t, "done request", wants+pktLines(append(haveLines, "done")...), conn.requests[1])
+		testutils.AssertString(t, "pack", "PACK", packData.String())
+	})
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/pktline"
+	"github.com/uragirii/got/internals/git/sha"
+)
+
+// Builds the command request
+// @see https://git-scm.com/docs/protocol-v2#_command_request
+func commandRequest(c *Capability, command string, args []string) []byte {
+	var buffer bytes.Buffer
+
+	w := pktline.NewWriter(&buffer)
+
+	w.WriteLinef("command=%s", command)
+	w.WriteLinef("agent=%s", internals.Agent())
+
+	if c.ObjectFormat != "" {
+		w.WriteLinef("object-format=%s", c.ObjectFormat)
+	}
+
+	w.WriteDelim()
+
+	for _, arg := range args {
+		w.WriteLine(arg)
+	}
+
+	w.WriteFlush()
+
+	return buffer.Bytes()
+}
+
+// <oid> <refname> [symref-target:<target>] [peeled:<oid>]
+func parseRefLine(line string) (Ref, error) {
+	fields := strings.Split(line, " ")
+
+	if len(fields) < 2 {
+		return Ref{}, fmt.Errorf("%w: invalid ref line %q", ErrUnexpectedResponse, line)
+	}
+
+	refSha, err := sha.FromString(fields[0])
+
+	if err != nil {
+		return Ref{}, err
+	}
+
+	ref := Ref{
+		Name: fields[1],
+		SHA:  refSha,
+	}
+
+	for _, attr := range fields[2:] {
+		key, value, _ := strings.Cut(attr, ":")
+
+		switch key {
+		case "symref-target":
+			ref.SymrefTarget = value
+		case "peeled":
+			if ref.Peeled, err = sha.FromString(value); err != nil {
+				return Ref{}, err
+			}
+		}
+	}
+
+	return ref, nil
+}
+
+// Lists the refs on the remote matching any of the prefixes,
+// v0 refs are taken from the advertisement instead
+// @see https://git-scm.com/docs/protocol-v2#_ls_refs
+func LsRefs(conn Conn, prefixes []string) ([]Ref, error) {
+	if conn.Version() == ProtocolV0 {
+		return filterRefs(conn.Advertisement().Refs, prefixes), nil
+	}
+
+	args := []string{"symrefs", "peel"}
+
+	for _, prefix := range prefixes {
+		args = append(args, fmt.Sprintf("ref-prefix %s", prefix))
+	}
+
+	resp, err := conn.Command(commandRequest(conn.Capabilities(), "ls-refs", args))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Close()
+
+	r := pktline.NewReader(resp)
+
+	var refs []Ref
+
+	for {
+		pktType, line, err := r.ReadLine()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if pktType == pktline.TypeFlush {
+			return refs, nil
+		}
+
+		if pktType != pktline.TypeData {
+			return nil, fmt.Errorf("%w: unexpected %s packet in ls-refs", ErrUnexpectedResponse, pktType)
+		}
+
+		ref, err := parseRefLine(line)
+
+		if err != nil {
+			return nil, err
+		}
+
+		refs = append(refs, ref)
+	}
+}
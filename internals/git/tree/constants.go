@@ -7,11 +7,16 @@ type Mode string
 const (
 	ModeNormal     Mode = "100644"
 	ModeExecutable Mode = "100755"
-	// Deprecated: Sym link is not supported at the moment
+	// Blob contains the target of the link
 	ModeSymLink Mode = "120000"
 	ModeDir     Mode = "40000"
+	// Submodule commit
+	ModeGitLink Mode = "160000"
 )
 
+// SHA of the tree without any entries
+const EmptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
 var ErrInvalidTree = fmt.Errorf("invalid tree")
 
 func (mode Mode) Pretty() string {
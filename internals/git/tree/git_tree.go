@@ -1,14 +1,10 @@
 package tree
 
 import (
-	"bytes"
 	"compress/zlib"
-	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
-	"path"
 	"sort"
 	"strings"
 
@@ -89,6 +85,13 @@ func (tree Tree) GetSHA() *sha.SHA {
 	return tree.SHA
 }
 
+// Returns the entries sorted by name
+func (tree Tree) Entries() []TreeEntry {
+	tree.sortEnteries()
+
+	return tree.entries
+}
+
 func (tree Tree) Write(writer io.Writer) error {
 	w := zlib.NewWriter(writer)
 
@@ -105,40 +108,17 @@ func (tree Tree) Write(writer io.Writer) error {
 }
 
 func (tree Tree) WriteToFile() error {
-	objPath, err := tree.SHA.GetObjPath()
-
-	if err != nil {
-		return err
-	}
-
 	gitDir, err := internals.GetGitDir()
 
 	if err != nil {
 		return err
 	}
 
-	objPath = path.Join(gitDir, objPath)
-
-	if _, err := os.Stat(objPath); errors.Is(err, os.ErrNotExist) {
-		var buffer bytes.Buffer
+	contents := []byte(tree.Raw())
 
-		err = tree.Write(&buffer)
-
-		if err != nil {
-			return err
-		}
-
-		err = os.MkdirAll(path.Join(objPath, ".."), 0755)
-
-		if err != nil {
-			return err
-		}
-
-		return os.WriteFile(objPath, buffer.Bytes(), 0444) // Read only file
-
-	}
+	_, err = object.WriteLoose(gitDir, object.ObjectContents{ObjType: object.TreeObj, Contents: &contents})
 
-	return nil
+	return err
 }
 
 func (tree *Tree) sortEnteries() {
@@ -0,0 +1,184 @@
+package worktree
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/uragirii/got/internals/git/index"
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/internals/git/tree"
+	"github.com/uragirii/got/internals/progress"
+)
+
+var ErrUnexpectedObj = fmt.Errorf("unexpected object type")
+
+func writeBlob(filePath string, entry tree.TreeEntry, gitFs fs.FS) error {
+	obj, err := object.FromSHA(entry.SHA, gitFs)
+
+	if err != nil {
+		return err
+	}
+
+	if obj.ObjType != object.BlobObj {
+		return fmt.Errorf("%w: expected blob for %s got %s", ErrUnexpectedObj, filePath, obj.ObjType)
+	}
+
+	// file could be present from an earlier checkout
+	if err = os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if entry.Mode == tree.ModeSymLink {
+		return os.Symlink(string(*obj.Contents), filePath)
+	}
+
+	perm := os.FileMode(0644)
+
+	if entry.Mode == tree.ModeExecutable {
+		perm = 0755
+	}
+
+	return os.WriteFile(filePath, *obj.Contents, perm)
+}
+
+func checkoutTree(dirPath string, t *tree.Tree, gitFs fs.FS, meter *progress.Meter) error {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return err
+	}
+
+	for _, entry := range t.Entries() {
+		entryPath := path.Join(dirPath, entry.Name)
+
+		switch entry.Mode {
+		case tree.ModeDir:
+			subTree, err := entry.GetTree(gitFs)
+
+			if err != nil {
+				return err
+			}
+
+			if err = checkoutTree(entryPath, subTree, gitFs, meter); err != nil {
+				return err
+			}
+		case tree.ModeGitLink:
+			// submodules are not cloned, git leaves an empty dir
+			if err := os.MkdirAll(entryPath, 0755); err != nil {
+				return err
+			}
+		default:
+			if err := writeBlob(entryPath, entry, gitFs); err != nil {
+				return err
+			}
+		}
+
+		if entry.Mode != tree.ModeDir {
+			meter.Add(1)
+		}
+	}
+
+	return nil
+}
+
+// Counts the files in the tree and its sub trees
+func countFiles(t *tree.Tree, gitFs fs.FS) (uint64, error) {
+	var count uint64
+
+	for _, entry := range t.Entries() {
+		if entry.Mode != tree.ModeDir {
+			count++
+			continue
+		}
+
+		subTree, err := entry.GetTree(gitFs)
+
+		if err != nil {
+			return 0, err
+		}
+
+		subCount, err := countFiles(subTree, gitFs)
+
+		if err != nil {
+			return 0, err
+		}
+
+		count += subCount
+	}
+
+	return count, nil
+}
+
+// Fetches the trees and blobs missing from a partial clone a level
+// of the tree at a time, instead of one by one while checking out
+func prefetch(t *tree.Tree, gitFs fs.FS) error {
+	level := []*tree.Tree{t}
+
+	for len(level) != 0 {
+		var missing []*sha.SHA
+		var dirs []tree.TreeEntry
+
+		for _, levelTree := range level {
+			for _, entry := range levelTree.Entries() {
+				switch entry.Mode {
+				case tree.ModeGitLink:
+				case tree.ModeDir:
+					dirs = append(dirs, entry)
+					missing = append(missing, entry.SHA)
+				default:
+					missing = append(missing, entry.SHA)
+				}
+			}
+		}
+
+		if err := object.Prefetch(missing, gitFs); err != nil {
+			return err
+		}
+
+		level = make([]*tree.Tree, 0, len(dirs))
+
+		for _, dir := range dirs {
+			subTree, err := dir.GetTree(gitFs)
+
+			if err != nil {
+				return err
+			}
+
+			level = append(level, subTree)
+		}
+	}
+
+	return nil
+}
+
+// Writes the files of the tree in the root dir and returns the index for
+// the checked out files. "Checking out files" progress is written to progressOut
+func Checkout(gitFs fs.FS, root string, t *tree.Tree, progressOut io.Writer) (*index.Index, error) {
+	if object.HasPromisor(gitFs) {
+		if err := prefetch(t, gitFs); err != nil {
+			return nil, err
+		}
+	}
+
+	meter := progress.New(progressOut, "Checking out files", 0)
+
+	if meter != nil {
+		total, err := countFiles(t, gitFs)
+
+		if err != nil {
+			return nil, err
+		}
+
+		meter.SetTotal(total)
+	}
+
+	if err := checkoutTree(root, t, gitFs, meter); err != nil {
+		return nil, err
+	}
+
+	meter.Done()
+
+	return index.FromTree(root, t, gitFs)
+}
@@ -0,0 +1,203 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Meters are redrawn at most this often, same as git which
+// updates the throughput once a second and percent on change
+const _Interval = 100 * time.Millisecond
+
+// Clears till the end of the line, so a shorter line
+// fully overwrites the one drawn before it
+const ClearLine = "\033[K"
+
+// Checks if the writer is a terminal, the progress is only
+// shown on a terminal by default as it redraws the line with \r
+func IsTerminal(w io.Writer) bool {
+	if quiet, ok := w.(quietWriter); ok {
+		w = quiet.Writer
+	}
+
+	f, ok := w.(*os.File)
+
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// Writer which gets the warnings and other messages but no progress,
+// ex: for --quiet or when stderr is not a terminal
+type quietWriter struct {
+	io.Writer
+}
+
+func Quiet(w io.Writer) io.Writer {
+	return quietWriter{Writer: w}
+}
+
+// Checks if the progress should be written to the writer,
+// nil, io.Discard and Quiet writers don't show the progress
+func Enabled(w io.Writer) bool {
+	_, quiet := w.(quietWriter)
+
+	return w != nil && w != io.Discard && !quiet
+}
+
+// Formats the size like git, ex: 1.50 MiB
+func HumanSize(size uint64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(size)/(1<<10))
+	case size == 1:
+		return "1 byte"
+	}
+
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// Progress meter of a long operation drawn on a single line like git,
+// ex: "Receiving objects:  45% (45/100), 1.20 MiB | 600.00 KiB/s".
+// A nil meter draws nothing so the callers don't have to check. The
+// meter can be updated from multiple goroutines
+type Meter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	title string
+	total uint64
+	count uint64
+	// bytes are shown with the throughput if set
+	throughput bool
+	bytes      uint64
+	start      time.Time
+	lastDraw   time.Time
+}
+
+// Returns nil if the progress is not enabled for the writer,
+// the total is 0 when it's not known upfront
+func New(w io.Writer, title string, total uint64) *Meter {
+	if !Enabled(w) {
+		return nil
+	}
+
+	return &Meter{
+		w:     w,
+		title: title,
+		total: total,
+		start: time.Now(),
+	}
+}
+
+// Same as New but the transferred bytes and the rate are shown too
+func NewThroughput(w io.Writer, title string, total uint64) *Meter {
+	m := New(w, title, total)
+
+	if m != nil {
+		m.throughput = true
+	}
+
+	return m
+}
+
+func (m *Meter) SetTotal(total uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total = total
+}
+
+// Updates the count, the line is redrawn when it's due
+func (m *Meter) Update(count uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update(count)
+}
+
+func (m *Meter) Add(delta uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update(m.count + delta)
+}
+
+// Adds the transferred bytes shown with the throughput
+func (m *Meter) AddBytes(n uint64) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bytes += n
+}
+
+// Draws the final line ending with ", done."
+func (m *Meter) Done() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.draw(", done.\n")
+}
+
+func (m *Meter) update(count uint64) {
+	m.count = count
+
+	if now := time.Now(); now.Sub(m.lastDraw) >= _Interval {
+		m.lastDraw = now
+		m.draw("\r")
+	}
+}
+
+func (m *Meter) draw(end string) {
+	line := m.title + ": "
+
+	if m.total > 0 {
+		line += fmt.Sprintf("%3d%% (%d/%d)", m.count*100/m.total, m.count, m.total)
+	} else {
+		line += fmt.Sprint(m.count)
+	}
+
+	if m.throughput {
+		line += ", " + HumanSize(m.bytes)
+
+		if elapsed := time.Since(m.start).Seconds(); elapsed > 0 {
+			line += " | " + HumanSize(uint64(float64(m.bytes)/elapsed)) + "/s"
+		}
+	}
+
+	if IsTerminal(m.w) {
+		line += ClearLine
+	}
+
+	fmt.Fprint(m.w, line+end)
+}
@@ -0,0 +1,110 @@
+package progress_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/uragirii/got/internals/progress"
+	testutils "github.com/uragirii/got/internals/test_utils"
+)
+
+func TestHumanSize(t *testing.T) {
+	for size, expected := range map[uint64]string{
+		0:             "0 bytes",
+		1:             "1 byte",
+		1023:          "1023 bytes",
+		1536:          "1.50 KiB",
+		5 << 20:       "5.00 MiB",
+		3<<30 + 1<<29: "3.50 GiB",
+	} {
+		testutils.AssertString(t, "size", expected, progress.HumanSize(size))
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	var buffer bytes.Buffer
+
+	if !progress.Enabled(&buffer) {
+		t.Error("expected progress to be enabled for a writer")
+	}
+
+	for _, w := range []io.Writer{nil, io.Discard, progress.Quiet(&buffer)} {
+		if progress.Enabled(w) {
+			t.Errorf("expected progress to be disabled for %T", w)
+		}
+	}
+
+	if progress.IsTerminal(&buffer) {
+		t.Error("expected buffer to not be a terminal")
+	}
+}
+
+func TestMeter(t *testing.T) {
+	t.Run("draws the count with the total", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		m := progress.New(&buffer, "Resolving deltas", 4)
+
+		m.Update(1)
+
+		testutils.AssertString(t, "first draw", "Resolving deltas:  25% (1/4)\r", buffer.String())
+
+		// redraws are throttled
+		m.Update(2)
+		m.Update(3)
+
+		testutils.AssertString(t, "throttled", "Resolving deltas:  25% (1/4)\r", buffer.String())
+
+		m.Add(1)
+		m.Done()
+
+		testutils.AssertString(t, "done", "Resolving deltas:  25% (1/4)\rResolving deltas: 100% (4/4), done.\n", buffer.String())
+	})
+
+	t.Run("draws only the count without a total", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		m := progress.New(&buffer, "Counting objects", 0)
+
+		m.Add(7)
+		buffer.Reset()
+		m.Done()
+
+		testutils.AssertString(t, "done", "Counting objects: 7, done.\n", buffer.String())
+	})
+
+	t.Run("draws the transferred bytes", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		m := progress.NewThroughput(&buffer, "Receiving objects", 2)
+
+		m.AddBytes(2048)
+		m.Update(2)
+		m.Done()
+
+		lines := strings.Split(buffer.String(), "\r")
+
+		if !strings.HasPrefix(lines[1], "Receiving objects: 100% (2/2), 2.00 KiB | ") || !strings.HasSuffix(lines[1], "/s, done.\n") {
+			t.Errorf("expected throughput but got %q", lines[1])
+		}
+	})
+
+	t.Run("is nil when not enabled", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		m := progress.New(progress.Quiet(&buffer), "Receiving objects", 2)
+
+		if m != nil {
+			t.Fatal("expected no meter for a quiet writer")
+		}
+
+		// nil meter is a no-op
+		m.Update(1)
+		m.AddBytes(1)
+		m.Done()
+
+		testutils.AssertString(t, "output", "", buffer.String())
+	})
+}
@@ -0,0 +1,87 @@
+package testutils
+
+import (
+	"testing"
+
+	"github.com/uragirii/got/internals/git/object"
+	"github.com/uragirii/got/internals/git/pack"
+	"github.com/uragirii/got/internals/git/refs"
+	"github.com/uragirii/got/internals/git/repository"
+	"github.com/uragirii/got/internals/git/sha"
+	"github.com/uragirii/got/testdata"
+)
+
+// Testdata pack with the history of this repository till PackTipSHA
+const (
+	PackFilePath  = "pack/pack-9fd2cca459eacd57246d2ba2349866deea5ed542.pack"
+	PackTipSHA    = "1555f0bf3c0caf8147af9efd42cee5842a3c6e00"
+	PackParentSHA = "f4f3eb879f52ee3b46f67318aa657235d89aebfc"
+	PackRootSHA   = "ca5ef24873e56f118ac52c02506f2ef8e9050128"
+)
+
+// Writes the loose object and returns its SHA
+func WriteObj(t *testing.T, gitDir string, objType object.ObjectType, data string) *sha.SHA {
+	t.Helper()
+
+	contents := []byte(data)
+
+	objSha, err := object.WriteLoose(gitDir, object.ObjectContents{ObjType: objType, Contents: &contents})
+
+	if err != nil {
+		t.Fatalf("WriteLoose failed with err %v", err)
+	}
+
+	return objSha
+}
+
+// Writes a root commit with a.txt containing the message, returns the
+// commit and its tree and blob
+func WriteCommit(t *testing.T, gitDir, message string) (*sha.SHA, *sha.SHA, *sha.SHA) {
+	t.Helper()
+
+	blobSha := WriteObj(t, gitDir, object.BlobObj, message)
+	treeSha := WriteObj(t, gitDir, object.TreeObj, "100644 a.txt\x00"+string(*blobSha.GetBytes()))
+	commitSha := WriteObj(t, gitDir, object.CommitObj,
+		"tree "+treeSha.String()+"\nauthor A <a@b.c> 1700000000 +0000\ncommitter A <a@b.c> 1700000000 +0000\n\n"+message+"\n")
+
+	return commitSha, treeSha, blobSha
+}
+
+// Returns the contents of the testdata pack
+func ReadTestPack(t *testing.T) []byte {
+	t.Helper()
+
+	packData, err := testdata.TestData.ReadFile(PackFilePath)
+
+	if err != nil {
+		t.Fatalf("failed to read pack %v", err)
+	}
+
+	return packData
+}
+
+// Stores the testdata pack in the repository
+func StoreTestPack(t *testing.T, gitDir string) {
+	t.Helper()
+
+	if _, err := pack.Store(gitDir, ReadTestPack(t)); err != nil {
+		t.Fatalf("failed to store pack %v", err)
+	}
+}
+
+// Creates a repository with the testdata pack and main at PackTipSHA
+func InitTestRepo(t *testing.T, gitDir string) {
+	t.Helper()
+
+	if err := repository.Init(gitDir, "main"); err != nil {
+		t.Fatalf("Init failed with err %v", err)
+	}
+
+	StoreTestPack(t, gitDir)
+
+	tip, _ := sha.FromString(PackTipSHA)
+
+	if err := refs.Write(gitDir, "refs/heads/main", tip); err != nil {
+		t.Fatalf("failed to write main %v", err)
+	}
+}
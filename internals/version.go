@@ -3,6 +3,7 @@ package internals
 import (
 	"fmt"
 	"runtime/debug"
+	"strings"
 )
 
 var Version = ""
@@ -26,5 +27,5 @@ func SetupVersion(v string) {
 }
 
 func Agent() string {
-	return fmt.Sprintf("got/%s", Version[1:])
+	return fmt.Sprintf("got/%s", strings.TrimLeft(Version, "v-"))
 }
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"path/filepath"
 
 	"github.com/uragirii/got/cmd"
 	"github.com/uragirii/got/internals"
+	"github.com/uragirii/got/internals/git/remote"
 )
 
 // TODO: use from git tags
@@ -21,6 +23,19 @@ var SUPPORTED_COMMANDS []*internals.Command = []*internals.Command{
 	cmd.ADD,
 	cmd.COMMIT,
 	cmd.CLONE,
+	cmd.FETCH,
+	cmd.PUSH,
+	cmd.UPLOAD_PACK,
+	cmd.RECEIVE_PACK,
+	cmd.INDEX_PACK,
+	cmd.UNPACK_OBJECTS,
+	cmd.REPACK,
+	cmd.GC,
+	cmd.PRUNE,
+	cmd.COUNT_OBJECTS,
+	cmd.FSCK,
+	cmd.COMMIT_GRAPH,
+	cmd.MULTI_PACK_INDEX,
 }
 
 func main() {
@@ -49,13 +64,23 @@ func main() {
 		return
 	}
 
+	root := ""
+
 	gitDir, err := internals.GetGitDir()
 
-	if err != nil {
+	switch {
+	// commands like init and clone are run outside a repository
+	case errors.Is(err, internals.ErrNoRepo):
+	case err != nil:
 		panic(err)
-	}
+	default:
+		root = filepath.Join(gitDir, "..")
 
-	root := filepath.Join(gitDir, "..")
+		// objects omitted from a partial clone are fetched when read
+		if err = remote.EnableLazyFetch(gitDir); err != nil {
+			panic(err)
+		}
+	}
 
 	command := args[0]
 